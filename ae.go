@@ -22,6 +22,7 @@ const (
 
 type AeFileProc func(eventLoop *AeEventLoop, fd int, clientData interface{})
 type AeTimeProc func(eventLoop *AeEventLoop, id int, clientData interface{})
+type AeBeforeSleepProc func(eventLoop *AeEventLoop)
 
 type AeFileEvent struct {
 	fd         int
@@ -46,6 +47,7 @@ type AeEventLoop struct {
 	epfd            int
 	timeEventNextId int
 	stop            bool
+	beforeSleep     AeBeforeSleepProc
 }
 
 func GetMsTime() int64 {
@@ -263,9 +265,17 @@ func (eventLoop *AeEventLoop) AeWait() (tes []*AeTimeEvent, fes []*AeFileEvent)
 	return
 }
 
+// AeSetBeforeSleepProc set the proc called before waiting for events.
+func (eventLoop *AeEventLoop) AeSetBeforeSleepProc(proc AeBeforeSleepProc) {
+	eventLoop.beforeSleep = proc
+}
+
 func (eventLoop *AeEventLoop) AeMain() {
 	eventLoop.stop = false
 	for eventLoop.stop != true {
+		if eventLoop.beforeSleep != nil {
+			eventLoop.beforeSleep(eventLoop)
+		}
 		tes, fes := eventLoop.AeWait()
 		eventLoop.AeProcessEvents(tes, fes)
 	}
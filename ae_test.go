@@ -73,4 +73,5 @@ func TestAe(t *testing.T) {
 	<-end
 	<-end
 	aeLoop.stop = true
+	Close(sfd)
 }
@@ -0,0 +1,658 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// Bitmaps are not a type of their own, the bit commands operate on the
+// bytes of REDISSTR values. Bit 0 is the most significant bit of the first
+// byte, and strings are padded with zero bytes when a bit past the end is
+// set. A string written by SETBIT or BITFIELD is kept as a bitmap encoded
+// object whose bytes are modified in place, it's never compressed so a
+// write doesn't copy the whole string.
+
+// operations of BITOP.
+const (
+	BITOP_AND int = 0
+	BITOP_OR  int = 1
+	BITOP_XOR int = 2
+	BITOP_NOT int = 3
+)
+
+// units of the ranges of BITCOUNT and BITPOS.
+const (
+	BIT_RANGE_BYTE int = 0
+	BIT_RANGE_BIT  int = 1
+)
+
+// overflow behaviors of BITFIELD.
+const (
+	BFOVERFLOW_WRAP int = 0
+	BFOVERFLOW_SAT  int = 1
+	BFOVERFLOW_FAIL int = 2
+)
+
+// operations of BITFIELD.
+const (
+	BITFIELDOP_GET    int = 0
+	BITFIELDOP_SET    int = 1
+	BITFIELDOP_INCRBY int = 2
+)
+
+// getBitOffsetFromArgument parse a bit offset, if hash is true an offset
+// like #N is N times bits, as used by BITFIELD to address the N-th integer.
+func getBitOffsetFromArgument(c *RedisClient, o *RedisObj, hash bool, bits int) (int64, bool) {
+	s := o.StrVal()
+	usehash := hash && len(s) > 0 && s[0] == '#'
+	if usehash {
+		s = s[1:]
+	}
+	offset, ok := string2ll(s)
+	if ok && usehash {
+		if offset > math.MaxInt64/int64(bits) {
+			ok = false
+		} else {
+			offset *= int64(bits)
+		}
+	}
+	// the string holding the offset must fit in a bulk.
+	if !ok || offset < 0 || offset>>3 >= PROTO_MAX_BULK_LEN {
+		c.AddReplyError("bit offset is not an integer or out of range")
+		return 0, false
+	}
+	return offset, true
+}
+
+// getBitfieldTypeFromArgument parse a BITFIELD type like i16 or u8, and
+// return whether it is signed and the number of bits.
+func getBitfieldTypeFromArgument(c *RedisClient, o *RedisObj) (bool, int, bool) {
+	s := o.StrVal()
+	signed := len(s) > 0 && (s[0] == 'i' || s[0] == 'I')
+	unsigned := len(s) > 0 && (s[0] == 'u' || s[0] == 'U')
+	var n int64
+	ok := signed || unsigned
+	if ok {
+		n, ok = string2ll(s[1:])
+	}
+	if !ok || n < 1 || (signed && n > 64) || (unsigned && n > 63) {
+		c.AddReplyError("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		return false, 0, false
+	}
+	return signed, int(n), true
+}
+
+// lookupStringForBitCommand return the bitmap at key, grown with zeros so
+// the bit at maxbit exists, the key is created if it doesn't exist. The
+// bytes of the returned object are written in place, a value with another
+// encoding or shared with other objects is converted to a new bitmap first.
+func lookupStringForBitCommand(c *RedisClient, maxbit int64) (*RedisObj, bool) {
+	byteLen := int(maxbit>>3) + 1
+	o := lookupKeyWrite(c.db, c.args[1])
+	if o == nil {
+		o = createBitmapObject(make([]byte, byteLen))
+		dbAdd(c.db, c.args[1], o)
+		o.DecrRefCount()
+		return o, true
+	}
+	if checkType(c, o, REDISSTR) {
+		return nil, false
+	}
+	if o.encoding != REDIS_ENCODING_BITMAP || o.refCount != 1 {
+		newVal := createBitmapObject([]byte(o.StrVal()))
+		dbOverwrite(c.db, c.args[1], newVal)
+		newVal.DecrRefCount()
+		o = newVal
+	} else if o.mcmeta != nil {
+		// the value is modified without being replaced.
+		o.mcmeta.cas = memcachedNextCAS()
+	}
+	if buf := o.Val_.([]byte); byteLen > len(buf) {
+		o.Val_ = append(buf, make([]byte, byteLen-len(buf))...)
+	}
+	return o, true
+}
+
+// getBit return the bit at offset of s, bits past the end are 0.
+func getBit(s string, offset int64) int {
+	byteIdx := offset >> 3
+	if byteIdx >= int64(len(s)) {
+		return 0
+	}
+	return int(s[byteIdx]>>(7-uint(offset&7))) & 1
+}
+
+func setbitCommand(c *RedisClient) {
+	offset, ok := getBitOffsetFromArgument(c, c.args[2], false, 0)
+	if !ok {
+		return
+	}
+	on, ok := getLongLongFromObject(c.args[3])
+	if !ok || on & ^1 != 0 {
+		c.AddReplyError("bit is not an integer or out of range")
+		return
+	}
+	o, ok := lookupStringForBitCommand(c, offset)
+	if !ok {
+		return
+	}
+	buf := o.Val_.([]byte)
+	byteIdx, bit := offset>>3, 7-uint(offset&7)
+	old := int64(buf[byteIdx]>>bit) & 1
+	buf[byteIdx] &^= 1 << bit
+	buf[byteIdx] |= byte(on) << bit
+	c.AddReplyInt(old)
+}
+
+func getbitCommand(c *RedisClient) {
+	offset, ok := getBitOffsetFromArgument(c, c.args[2], false, 0)
+	if !ok {
+		return
+	}
+	o := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if o == nil || checkType(c, o, REDISSTR) {
+		return
+	}
+	if offset>>3 >= int64(stringObjectLen(o)) {
+		c.AddReply(shared.czero)
+		return
+	}
+	if o.encoding == REDIS_ENCODING_BITMAP {
+		c.AddReplyInt(int64(o.Val_.([]byte)[offset>>3]>>(7-uint(offset&7))) & 1)
+		return
+	}
+	// only the bytes up to offset are decompressed.
+	c.AddReplyInt(int64(getBit(stringObjectPrefix(o, int(offset>>3)+1), offset)))
+}
+
+// parseBitRangeOrReply parse the optional start, end and unit arguments of
+// BITCOUNT and BITPOS starting at c.args[i]. The range is converted to bits
+// of a string of strLen bytes, and is empty if start > end.
+func parseBitRangeOrReply(c *RedisClient, i int, strLen int64) (start, end int64, endGiven, ok bool) {
+	start, end = 0, -1
+	unit := BIT_RANGE_BYTE
+	if len(c.args) > i {
+		if start, ok = getLongLongFromObjectOrReply(c, c.args[i], ""); !ok {
+			return
+		}
+	}
+	if len(c.args) > i+1 {
+		if end, ok = getLongLongFromObjectOrReply(c, c.args[i+1], ""); !ok {
+			return
+		}
+		endGiven = true
+	}
+	if len(c.args) > i+2 {
+		switch strings.ToLower(c.args[i+2].StrVal()) {
+		case "byte":
+		case "bit":
+			unit = BIT_RANGE_BIT
+		default:
+			c.AddReply(shared.syntaxErr)
+			return 0, 0, false, false
+		}
+	}
+	if len(c.args) > i+3 {
+		c.AddReply(shared.syntaxErr)
+		return 0, 0, false, false
+	}
+
+	total := strLen
+	if unit == BIT_RANGE_BIT {
+		total *= 8
+	}
+	if start < 0 && end < 0 && start > end {
+		return 0, -1, endGiven, true
+	}
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	// start may be too large to be converted to bits.
+	if start > end {
+		return 0, -1, endGiven, true
+	}
+	if unit == BIT_RANGE_BYTE {
+		start, end = start*8, end*8+7
+	}
+	return start, end, endGiven, true
+}
+
+// popcount count the bits set of s in the bit range [start, end].
+func popcount(s string, start, end int64) int64 {
+	startByte, endByte := start>>3, end>>3
+	var count int64
+	for i := startByte; i <= endByte; i++ {
+		count += int64(bits.OnesCount8(s[i]))
+	}
+	// the bits of the first and last bytes out of the range.
+	count -= int64(bits.OnesCount8(s[startByte] & ^(0xff >> uint(start&7))))
+	count -= int64(bits.OnesCount8(s[endByte] & (0xff >> uint(end&7+1))))
+	return count
+}
+
+func bitcountCommand(c *RedisClient) {
+	if len(c.args) == 3 {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	o := lookupKeyRead(c.db, c.args[1])
+	if o != nil && checkType(c, o, REDISSTR) {
+		return
+	}
+	var strLen int64
+	if o != nil {
+		strLen = int64(stringObjectLen(o))
+	}
+	start, end, _, ok := parseBitRangeOrReply(c, 2, strLen)
+	if !ok {
+		return
+	}
+	if o == nil || start > end {
+		c.AddReply(shared.czero)
+		return
+	}
+	c.AddReplyInt(popcount(stringObjectPrefix(o, int(end>>3)+1), start, end))
+}
+
+// bitpos return the position of the first bit set to bit of s in the bit
+// range [start, end], -1 if not found.
+func bitpos(s string, start, end int64, bit int) int64 {
+	// bytes with all the bits different from the one searched are skipped.
+	skip := byte(0)
+	if bit == 0 {
+		skip = 0xff
+	}
+	for i := start; i <= end; {
+		if i&7 == 0 && i+7 <= end && s[i>>3] == skip {
+			i += 8
+			continue
+		}
+		if getBit(s, i) == bit {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+func bitposCommand(c *RedisClient) {
+	bit, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	if bit != 0 && bit != 1 {
+		c.AddReplyError("The bit argument must be 1 or 0.")
+		return
+	}
+	o := lookupKeyRead(c.db, c.args[1])
+	if o != nil && checkType(c, o, REDISSTR) {
+		return
+	}
+	var strLen int64
+	if o != nil {
+		strLen = int64(stringObjectLen(o))
+	}
+	start, end, endGiven, ok := parseBitRangeOrReply(c, 3, strLen)
+	if !ok {
+		return
+	}
+	// a missing key is an empty string, that has all the bits clear.
+	if o == nil {
+		if bit == 1 {
+			c.AddReply(shared.cnegone)
+		} else {
+			c.AddReply(shared.czero)
+		}
+		return
+	}
+	if start > end {
+		c.AddReply(shared.cnegone)
+		return
+	}
+	pos := bitpos(stringObjectPrefix(o, int(end>>3)+1), start, end, int(bit))
+	// without an explicit end, the string is considered padded with zeros
+	// on the right, so the first clear bit is the one after the range.
+	if pos == -1 && bit == 0 && !endGiven {
+		pos = end + 1
+	}
+	c.AddReplyInt(pos)
+}
+
+func bitopCommand(c *RedisClient) {
+	var op int
+	switch strings.ToLower(c.args[1].StrVal()) {
+	case "and":
+		op = BITOP_AND
+	case "or":
+		op = BITOP_OR
+	case "xor":
+		op = BITOP_XOR
+	case "not":
+		op = BITOP_NOT
+	default:
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	if op == BITOP_NOT && len(c.args) != 4 {
+		c.AddReplyError("BITOP NOT must be called with a single source key.")
+		return
+	}
+
+	// missing keys are empty strings, shorter strings are padded with zeros.
+	srcs := make([]string, 0, len(c.args)-3)
+	maxLen := 0
+	for _, key := range c.args[3:] {
+		o := lookupKeyRead(c.db, key)
+		if o == nil {
+			srcs = append(srcs, "")
+			continue
+		}
+		if checkType(c, o, REDISSTR) {
+			return
+		}
+		s := o.StrVal()
+		srcs = append(srcs, s)
+		if len(s) > maxLen {
+			maxLen = len(s)
+		}
+	}
+
+	res := make([]byte, maxLen)
+	for i := range res {
+		var b byte
+		if i < len(srcs[0]) {
+			b = srcs[0][i]
+		}
+		if op == BITOP_NOT {
+			b = ^b
+		}
+		for _, s := range srcs[1:] {
+			var sb byte
+			if i < len(s) {
+				sb = s[i]
+			}
+			switch op {
+			case BITOP_AND:
+				b &= sb
+			case BITOP_OR:
+				b |= sb
+			case BITOP_XOR:
+				b ^= sb
+			}
+		}
+		res[i] = b
+	}
+
+	dest := c.args[2]
+	if maxLen == 0 {
+		dbDelete(c.db, dest)
+	} else {
+		o := tryObjectEncoding(CreateObject(REDISSTR, string(res)))
+		setKey(c.db, dest, o, false)
+		o.DecrRefCount()
+	}
+	c.AddReplyInt(int64(maxLen))
+}
+
+// getUnsignedBitfield read the unsigned integer of n bits at offset of s,
+// bits past the end are 0.
+func getUnsignedBitfield(s []byte, offset int64, n int) uint64 {
+	var val uint64
+	for j := int64(0); j < int64(n); j++ {
+		byteIdx := (offset + j) >> 3
+		var bit uint64
+		if byteIdx < int64(len(s)) {
+			bit = uint64(s[byteIdx]>>(7-uint((offset+j)&7))) & 1
+		}
+		val = val<<1 | bit
+	}
+	return val
+}
+
+// getSignedBitfield read the two's complement integer of n bits at offset
+// of s.
+func getSignedBitfield(s []byte, offset int64, n int) int64 {
+	val := getUnsignedBitfield(s, offset, n)
+	if n < 64 && val&(1<<uint(n-1)) != 0 {
+		val |= math.MaxUint64 << uint(n)
+	}
+	return int64(val)
+}
+
+// setUnsignedBitfield write the n low bits of val at offset of s, that must
+// be long enough.
+func setUnsignedBitfield(s []byte, offset int64, n int, val uint64) {
+	for j := int64(0); j < int64(n); j++ {
+		bit := byte(val>>uint(int64(n)-1-j)) & 1
+		byteIdx, shift := (offset+j)>>3, 7-uint((offset+j)&7)
+		s[byteIdx] = s[byteIdx]&^(1<<shift) | bit<<shift
+	}
+}
+
+// checkUnsignedBitfieldOverflow check whether value+incr overflows an
+// unsigned integer of n bits, and return the value to store according to
+// owtype with 1 on overflow, -1 on underflow and 0 if it fits.
+func checkUnsignedBitfieldOverflow(value uint64, incr int64, n int, owtype int) (uint64, int) {
+	max := uint64(math.MaxUint64)
+	if n < 64 {
+		max = 1<<uint(n) - 1
+	}
+	maxincr := int64(max - value)
+	minincr := -int64(value)
+	if value > max || (incr > 0 && incr > maxincr) {
+		if owtype == BFOVERFLOW_SAT {
+			return max, 1
+		}
+		return (value + uint64(incr)) & max, 1
+	}
+	if incr < 0 && incr < minincr {
+		if owtype == BFOVERFLOW_SAT {
+			return 0, -1
+		}
+		return (value + uint64(incr)) & max, -1
+	}
+	return value + uint64(incr), 0
+}
+
+// checkSignedBitfieldOverflow is the signed version of
+// checkUnsignedBitfieldOverflow.
+func checkSignedBitfieldOverflow(value, incr int64, n int, owtype int) (int64, int) {
+	max := int64(math.MaxInt64)
+	if n < 64 {
+		max = 1<<uint(n-1) - 1
+	}
+	min := -max - 1
+	maxincr := max - value
+	minincr := min - value
+	wrap := func() int64 {
+		// the n bits of the sum, sign extended.
+		sum := uint64(value) + uint64(incr)
+		if n < 64 {
+			mask := uint64(math.MaxUint64) << uint(n)
+			if sum&(1<<uint(n-1)) != 0 {
+				sum |= mask
+			} else {
+				sum &^= mask
+			}
+		}
+		return int64(sum)
+	}
+	if value > max || (n != 64 && incr > maxincr) || (value >= 0 && incr > 0 && incr > maxincr) {
+		if owtype == BFOVERFLOW_SAT {
+			return max, 1
+		}
+		return wrap(), 1
+	}
+	if value < min || (n != 64 && incr < minincr) || (value < 0 && incr < 0 && incr < minincr) {
+		if owtype == BFOVERFLOW_SAT {
+			return min, -1
+		}
+		return wrap(), -1
+	}
+	return value + incr, 0
+}
+
+// bitfieldOp is an operation of BITFIELD.
+type bitfieldOp struct {
+	offset int64
+	i64    int64 // the value of SET or the increment of INCRBY.
+	opcode int
+	owtype int
+	bits   int
+	signed bool
+}
+
+func bitfieldGeneric(c *RedisClient, readonly bool) {
+	var ops []bitfieldOp
+	owtype := BFOVERFLOW_WRAP
+	writes := false
+	var maxbit int64
+	for i := 2; i < len(c.args); i++ {
+		remargs := len(c.args) - i - 1
+		sub := strings.ToLower(c.args[i].StrVal())
+		var opcode int
+		switch {
+		case sub == "get" && remargs >= 2:
+			opcode = BITFIELDOP_GET
+		case sub == "set" && remargs >= 3:
+			opcode = BITFIELDOP_SET
+		case sub == "incrby" && remargs >= 3:
+			opcode = BITFIELDOP_INCRBY
+		case sub == "overflow" && remargs >= 1:
+			i++
+			switch strings.ToLower(c.args[i].StrVal()) {
+			case "wrap":
+				owtype = BFOVERFLOW_WRAP
+			case "sat":
+				owtype = BFOVERFLOW_SAT
+			case "fail":
+				owtype = BFOVERFLOW_FAIL
+			default:
+				c.AddReplyError("Invalid OVERFLOW type specified")
+				return
+			}
+			continue
+		default:
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+
+		signed, n, ok := getBitfieldTypeFromArgument(c, c.args[i+1])
+		if !ok {
+			return
+		}
+		offset, ok := getBitOffsetFromArgument(c, c.args[i+2], true, n)
+		if !ok {
+			return
+		}
+		op := bitfieldOp{offset: offset, opcode: opcode, owtype: owtype, bits: n, signed: signed}
+		if opcode != BITFIELDOP_GET {
+			if op.i64, ok = getLongLongFromObjectOrReply(c, c.args[i+3], ""); !ok {
+				return
+			}
+			writes = true
+			if offset+int64(n)-1 > maxbit {
+				maxbit = offset + int64(n) - 1
+			}
+			i++
+		}
+		ops = append(ops, op)
+		i += 2
+	}
+	if readonly && writes {
+		c.AddReplyError("BITFIELD_RO only supports the GET subcommand")
+		return
+	}
+
+	var buf []byte
+	if writes {
+		o, ok := lookupStringForBitCommand(c, maxbit)
+		if !ok {
+			return
+		}
+		buf = o.Val_.([]byte)
+	} else {
+		// GET only commands read missing keys as empty strings.
+		o := lookupKeyRead(c.db, c.args[1])
+		if o != nil {
+			if checkType(c, o, REDISSTR) {
+				return
+			}
+			if o.encoding == REDIS_ENCODING_BITMAP {
+				buf = o.Val_.([]byte)
+			} else {
+				buf = []byte(o.StrVal())
+			}
+		}
+	}
+
+	c.AddReplyArrayLen(len(ops))
+	for _, op := range ops {
+		switch {
+		case op.opcode == BITFIELDOP_GET && op.signed:
+			c.AddReplyInt(getSignedBitfield(buf, op.offset, op.bits))
+		case op.opcode == BITFIELDOP_GET:
+			c.AddReplyInt(int64(getUnsignedBitfield(buf, op.offset, op.bits)))
+		case op.signed:
+			oldVal := getSignedBitfield(buf, op.offset, op.bits)
+			var newVal int64
+			var overflow int
+			if op.opcode == BITFIELDOP_INCRBY {
+				newVal, overflow = checkSignedBitfieldOverflow(oldVal, op.i64, op.bits, op.owtype)
+			} else {
+				newVal, overflow = checkSignedBitfieldOverflow(op.i64, 0, op.bits, op.owtype)
+			}
+			if overflow != 0 && op.owtype == BFOVERFLOW_FAIL {
+				c.AddReplyNullBulk()
+				continue
+			}
+			setUnsignedBitfield(buf, op.offset, op.bits, uint64(newVal))
+			// SET replies the old value, INCRBY the new one.
+			if op.opcode == BITFIELDOP_SET {
+				c.AddReplyInt(oldVal)
+			} else {
+				c.AddReplyInt(newVal)
+			}
+		default:
+			oldVal := getUnsignedBitfield(buf, op.offset, op.bits)
+			var newVal uint64
+			var overflow int
+			if op.opcode == BITFIELDOP_INCRBY {
+				newVal, overflow = checkUnsignedBitfieldOverflow(oldVal, op.i64, op.bits, op.owtype)
+			} else {
+				newVal, overflow = checkUnsignedBitfieldOverflow(uint64(op.i64), 0, op.bits, op.owtype)
+			}
+			if overflow != 0 && op.owtype == BFOVERFLOW_FAIL {
+				c.AddReplyNullBulk()
+				continue
+			}
+			setUnsignedBitfield(buf, op.offset, op.bits, newVal)
+			if op.opcode == BITFIELDOP_SET {
+				c.AddReplyInt(int64(oldVal))
+			} else {
+				c.AddReplyInt(int64(newVal))
+			}
+		}
+	}
+}
+
+func bitfieldCommand(c *RedisClient) {
+	bitfieldGeneric(c, false)
+}
+
+func bitfieldroCommand(c *RedisClient) {
+	bitfieldGeneric(c, true)
+}
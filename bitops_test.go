@@ -0,0 +1,166 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSetbitGetbitCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":0\r\n", execCommand(c, "setbit", "key", "7", "1"))
+	assert.Equal(t, "$1\r\n\x01\r\n", execCommand(c, "get", "key"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "setbit", "key", "7", "0"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "setbit", "key", "100", "1"))
+	assert.Equal(t, ":13\r\n", execCommand(c, "strlen", "key"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "getbit", "key", "100"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "getbit", "key", "99"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "getbit", "key", "10000"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "getbit", "nokey", "0"))
+
+	// "1" is 0x31.
+	execCommand(c, "set", "int", "1")
+	assert.Equal(t, ":1\r\n", execCommand(c, "getbit", "int", "7"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "setbit", "int", "6", "1"))
+	assert.Equal(t, "$1\r\n3\r\n", execCommand(c, "get", "int"))
+
+	// a large bitmap is written in place and never compressed.
+	execCommand(c, "setbit", "big", "80000", "1")
+	key := CreateObject(REDISSTR, "big")
+	o := c.db.data.DictGet(key)
+	assert.Equal(t, REDIS_ENCODING_BITMAP, o.encoding)
+	assert.Equal(t, ":0\r\n", execCommand(c, "setbit", "big", "8", "1"))
+	assert.Equal(t, o, c.db.data.DictGet(key))
+	assert.Equal(t, "*1\r\n:0\r\n", execCommand(c, "bitfield", "big", "set", "u8", "16", "255"))
+	assert.Equal(t, ":10\r\n", execCommand(c, "bitcount", "big"))
+	assert.Equal(t, "$3\r\nraw\r\n", execCommand(c, "object", "encoding", "big"))
+	// the copy doesn't share the bytes.
+	execCommand(c, "copy", "big", "big2")
+	execCommand(c, "setbit", "big2", "0", "1")
+	assert.Equal(t, ":0\r\n", execCommand(c, "getbit", "big", "0"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "getbit", "big2", "0"))
+
+	assert.Equal(t, "-ERR bit is not an integer or out of range\r\n", execCommand(c, "setbit", "key", "0", "2"))
+	assert.Equal(t, "-ERR bit offset is not an integer or out of range\r\n", execCommand(c, "setbit", "key", "-1", "1"))
+	assert.Equal(t, "-ERR bit offset is not an integer or out of range\r\n", execCommand(c, "getbit", "key", "4294967296"))
+	execCommand(c, "rpush", "list", "a")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "setbit", "list", "0", "1"))
+}
+
+func TestBitcountCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "key", "foobar")
+	assert.Equal(t, ":26\r\n", execCommand(c, "bitcount", "key"))
+	assert.Equal(t, ":4\r\n", execCommand(c, "bitcount", "key", "0", "0"))
+	assert.Equal(t, ":6\r\n", execCommand(c, "bitcount", "key", "1", "1"))
+	assert.Equal(t, ":15\r\n", execCommand(c, "bitcount", "key", "1", "-3"))
+	assert.Equal(t, ":6\r\n", execCommand(c, "bitcount", "key", "1", "1", "byte"))
+	assert.Equal(t, ":17\r\n", execCommand(c, "bitcount", "key", "5", "30", "bit"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "bitcount", "key", "-2", "-1", "BIT"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "bitcount", "key", "-1", "-2"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "bitcount", "key", "3", "1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "bitcount", "key", "2305843009213693952", "-1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "bitcount", "key", "9223372036854775807", "9223372036854775807"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "bitcount", "nokey"))
+
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "bitcount", "key", "0"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "bitcount", "key", "0", "1", "word"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "bitcount", "key", "0", "1", "bit", "bit"))
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", execCommand(c, "bitcount", "key", "a", "1"))
+}
+
+func TestBitposCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "key", "\xff\xf0\x00")
+	assert.Equal(t, ":12\r\n", execCommand(c, "bitpos", "key", "0"))
+	execCommand(c, "set", "key", "\x00\xff\xf0")
+	assert.Equal(t, ":8\r\n", execCommand(c, "bitpos", "key", "1", "0"))
+	assert.Equal(t, ":16\r\n", execCommand(c, "bitpos", "key", "1", "2"))
+	assert.Equal(t, ":16\r\n", execCommand(c, "bitpos", "key", "1", "2", "-1", "byte"))
+	assert.Equal(t, ":8\r\n", execCommand(c, "bitpos", "key", "1", "7", "15", "bit"))
+	assert.Equal(t, ":8\r\n", execCommand(c, "bitpos", "key", "1", "7", "-3", "bit"))
+	assert.Equal(t, ":20\r\n", execCommand(c, "bitpos", "key", "0", "12", "-1", "bit"))
+
+	// looking for a clear bit past the end of the string.
+	execCommand(c, "set", "key", "\xff\xff\xff")
+	assert.Equal(t, ":24\r\n", execCommand(c, "bitpos", "key", "0"))
+	assert.Equal(t, ":24\r\n", execCommand(c, "bitpos", "key", "0", "1"))
+	assert.Equal(t, ":-1\r\n", execCommand(c, "bitpos", "key", "0", "0", "-1"))
+	assert.Equal(t, ":-1\r\n", execCommand(c, "bitpos", "key", "1", "2305843009213693952", "-1"))
+	execCommand(c, "set", "key", "\x00\x00\x00")
+	assert.Equal(t, ":-1\r\n", execCommand(c, "bitpos", "key", "1"))
+	assert.Equal(t, ":-1\r\n", execCommand(c, "bitpos", "key", "1", "2", "1"))
+
+	assert.Equal(t, ":-1\r\n", execCommand(c, "bitpos", "nokey", "1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "bitpos", "nokey", "0"))
+	assert.Equal(t, "-ERR The bit argument must be 1 or 0.\r\n", execCommand(c, "bitpos", "key", "2"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "bitpos", "key", "1", "0", "1", "bits"))
+}
+
+func TestBitopCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "key1", "foobar")
+	execCommand(c, "set", "key2", "abcdef")
+	assert.Equal(t, ":6\r\n", execCommand(c, "bitop", "and", "dest", "key1", "key2"))
+	assert.Equal(t, "$6\r\n`bc`ab\r\n", execCommand(c, "get", "dest"))
+	assert.Equal(t, ":6\r\n", execCommand(c, "bitop", "OR", "dest", "key1", "key2"))
+	assert.Equal(t, "$6\r\ngoofev\r\n", execCommand(c, "get", "dest"))
+	assert.Equal(t, ":6\r\n", execCommand(c, "bitop", "xor", "dest", "key1", "key2"))
+	assert.Equal(t, "$6\r\n\x07\x0d\x0c\x06\x04\x14\r\n", execCommand(c, "get", "dest"))
+
+	// the shorter strings are padded with zeros.
+	execCommand(c, "set", "short", "\xff")
+	assert.Equal(t, ":6\r\n", execCommand(c, "bitop", "or", "dest", "short", "nokey", "key1"))
+	assert.Equal(t, "$6\r\n\xffoobar\r\n", execCommand(c, "get", "dest"))
+	assert.Equal(t, ":6\r\n", execCommand(c, "bitop", "and", "dest", "short", "key1"))
+	assert.Equal(t, "$6\r\nf\x00\x00\x00\x00\x00\r\n", execCommand(c, "get", "dest"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "bitop", "not", "dest", "short"))
+	assert.Equal(t, "$1\r\n\x00\r\n", execCommand(c, "get", "dest"))
+
+	// the destination is deleted when the result is empty.
+	execCommand(c, "expire", "dest", "100")
+	assert.Equal(t, ":0\r\n", execCommand(c, "bitop", "and", "dest", "nokey"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "dest"))
+
+	assert.Equal(t, "-ERR BITOP NOT must be called with a single source key.\r\n", execCommand(c, "bitop", "not", "dest", "key1", "key2"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "bitop", "nand", "dest", "key1"))
+	execCommand(c, "rpush", "list", "a")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "bitop", "or", "dest", "key1", "list"))
+}
+
+func TestBitfieldCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "*2\r\n:1\r\n:0\r\n", execCommand(c, "bitfield", "key", "incrby", "i5", "100", "1", "get", "u4", "0"))
+	assert.Equal(t, "*2\r\n:0\r\n:255\r\n", execCommand(c, "bitfield", "key", "set", "u8", "#1", "255", "get", "u8", "8"))
+	assert.Equal(t, "*1\r\n:-1\r\n", execCommand(c, "bitfield", "key", "get", "i8", "8"))
+	assert.Equal(t, "*1\r\n:0\r\n", execCommand(c, "bitfield", "key", "get", "u8", "1000"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "bitfield", "key"))
+	assert.Equal(t, "*1\r\n:0\r\n", execCommand(c, "bitfield", "nokey", "get", "i64", "0"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "nokey"))
+
+	// the overflow behavior applies to the following operations.
+	want := []string{"*2\r\n:1\r\n:1\r\n", "*2\r\n:2\r\n:2\r\n", "*2\r\n:3\r\n:3\r\n", "*2\r\n:0\r\n:3\r\n"}
+	for _, w := range want {
+		assert.Equal(t, w, execCommand(c, "bitfield", "ow", "incrby", "u2", "100", "1", "overflow", "sat", "incrby", "u2", "102", "1"))
+	}
+	assert.Equal(t, "*1\r\n$-1\r\n", execCommand(c, "bitfield", "ow", "overflow", "fail", "incrby", "u2", "102", "1"))
+	assert.Equal(t, "*2\r\n:0\r\n:-128\r\n", execCommand(c, "bitfield", "signed", "set", "i8", "0", "127", "incrby", "i8", "0", "1"))
+	assert.Equal(t, "*2\r\n:-128\r\n:-128\r\n", execCommand(c, "bitfield", "signed", "overflow", "sat", "set", "i8", "0", "-200", "incrby", "i8", "0", "-1"))
+	assert.Equal(t, "*2\r\n:9223372036854775807\r\n:-9223372036854775808\r\n", execCommand(c, "bitfield", "big", "incrby", "i64", "0", "9223372036854775807", "incrby", "i64", "0", "1"))
+	assert.Equal(t, "*1\r\n:-9223372036854775808\r\n", execCommand(c, "bitfield", "big", "overflow", "sat", "incrby", "i64", "0", "-1"))
+	assert.Equal(t, "*2\r\n:0\r\n:15\r\n", execCommand(c, "bitfield", "u", "set", "u8", "0", "-1", "overflow", "sat", "incrby", "u4", "0", "100"))
+
+	// a failed write still pads the string.
+	assert.Equal(t, "*1\r\n$-1\r\n", execCommand(c, "bitfield", "fail", "overflow", "fail", "set", "u2", "14", "4"))
+	assert.Equal(t, "$2\r\n\x00\x00\r\n", execCommand(c, "get", "fail"))
+
+	assert.Equal(t, "*1\r\n:255\r\n", execCommand(c, "bitfield_ro", "key", "get", "u8", "8"))
+	assert.Equal(t, "-ERR BITFIELD_RO only supports the GET subcommand\r\n", execCommand(c, "bitfield_ro", "key", "set", "u8", "0", "1"))
+	assert.Equal(t, "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.\r\n", execCommand(c, "bitfield", "key", "get", "u64", "0"))
+	assert.Equal(t, "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.\r\n", execCommand(c, "bitfield", "key", "get", "x8", "0"))
+	assert.Equal(t, "-ERR bit offset is not an integer or out of range\r\n", execCommand(c, "bitfield", "key", "get", "u8", "#a"))
+	assert.Equal(t, "-ERR Invalid OVERFLOW type specified\r\n", execCommand(c, "bitfield", "key", "overflow", "none"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "bitfield", "key", "get", "u8"))
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", execCommand(c, "bitfield", "key", "set", "u8", "0", "a"))
+	execCommand(c, "rpush", "list", "a")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "bitfield", "list", "get", "u8", "0"))
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"math"
+)
+
+// A client executing a blocking command on keys with no data is parked on
+// the blockingKeys of its db, in FIFO order for every key. Writes to a key
+// with blocked clients signal it as ready, and after the command the ready
+// keys are served to the clients blocked on them. A blocked client doesn't
+// process any other command until it is served, times out or is unblocked
+// by CLIENT UNBLOCK.
+
+// types of blocking operations.
+const (
+	BLOCKED_NONE   int = 0
+	BLOCKED_LIST   int = 1 // BLPOP, BRPOP and BLMOVE
+	BLOCKED_STREAM int = 2 // XREAD and XREADGROUP
+)
+
+// blockingState is what a blocked client is waiting for.
+type blockingState struct {
+	btype     int
+	db        *RedisDB
+	keys      []*RedisObj // the keys the client is blocked on.
+	timeout   int64       // unix time in ms of the timeout, 0 blocks forever.
+	timeEvent int         // id of the time event of the timeout, 0 if none.
+	// BLOCKED_LIST
+	wherefrom int       // the end the element is popped from.
+	target    *RedisObj // destination of BLMOVE, nil for BLPOP and BRPOP.
+	whereto   int       // the end of target the element is pushed to.
+	// BLOCKED_STREAM
+	ids           map[string]streamID // the entries after these IDs are served.
+	xreadCount    int64               // max entries served for every key, 0 for all.
+	xreadGroup    *RedisObj           // the group of XREADGROUP, nil for XREAD.
+	xreadConsumer *RedisObj           // the consumer of XREADGROUP.
+	xreadNoAck    bool                // NOACK of XREADGROUP.
+}
+
+// readyKey is a key with blocked clients that got new data.
+type readyKey struct {
+	db  *RedisDB
+	key *RedisObj
+}
+
+// getTimeoutFromObjectOrReply parse a timeout in seconds with decimals, or
+// in integer milliseconds, and return the unix time in ms of the timeout, 0
+// for no timeout.
+func getTimeoutFromObjectOrReply(c *RedisClient, o *RedisObj, unit int) (int64, bool) {
+	var ms int64
+	if unit == UNIT_SECONDS {
+		secs, ok := getLongDoubleFromObject(o)
+		if !ok || math.IsNaN(secs) || math.IsInf(secs, 0) {
+			c.AddReplyError("timeout is not a float or out of range")
+			return 0, false
+		}
+		if secs*1000 >= math.MaxInt64 {
+			c.AddReplyError("timeout is out of range")
+			return 0, false
+		}
+		ms = int64(secs * 1000)
+		if secs < 0 {
+			ms = -1
+		}
+	} else {
+		var ok bool
+		if ms, ok = getLongLongFromObjectOrReply(c, o, "timeout is not an integer or out of range"); !ok {
+			return 0, false
+		}
+	}
+	if ms < 0 {
+		c.AddReplyError("timeout is negative")
+		return 0, false
+	}
+	if ms == 0 {
+		return 0, true
+	}
+	now := GetMsTime()
+	if ms > math.MaxInt64-now {
+		c.AddReplyError("timeout is out of range")
+		return 0, false
+	}
+	return now + ms, true
+}
+
+// blockForKeys block the client on keys until one of them is served to it
+// or the timeout is reached. The fields of c.bpop specific of btype must be
+// already set.
+func blockForKeys(c *RedisClient, btype int, keys []*RedisObj, timeout int64) {
+	c.flags |= CLIENT_BLOCKED
+	c.bpop.btype = btype
+	c.bpop.db = c.db
+	c.bpop.timeout = timeout
+	blocked := make(map[string]bool)
+	for _, key := range keys {
+		// a key may be given more than once.
+		if blocked[key.StrVal()] {
+			continue
+		}
+		blocked[key.StrVal()] = true
+		key.IncrRefCount()
+		c.bpop.keys = append(c.bpop.keys, key)
+		c.db.blockingKeys[key.StrVal()] = append(c.db.blockingKeys[key.StrVal()], c)
+	}
+	if timeout > 0 {
+		duration := timeout - GetMsTime()
+		if duration < 0 {
+			duration = 0
+		}
+		c.bpop.timeEvent = server.aeLoop.AeCreateTimeEvent(AE_ONCE, duration, blockedClientTimeoutProc, c)
+	}
+}
+
+// unblockClient remove the client from the keys it is blocked on, the
+// pending commands of the client are processed before the next event loop
+// iteration.
+func unblockClient(c *RedisClient) {
+	db := c.bpop.db
+	for _, key := range c.bpop.keys {
+		clients := db.blockingKeys[key.StrVal()]
+		for i, bc := range clients {
+			if bc == c {
+				clients = append(clients[:i], clients[i+1:]...)
+				break
+			}
+		}
+		if len(clients) == 0 {
+			delete(db.blockingKeys, key.StrVal())
+		} else {
+			db.blockingKeys[key.StrVal()] = clients
+		}
+		key.DecrRefCount()
+	}
+	if c.bpop.timeEvent != 0 {
+		server.aeLoop.AeDeleteTimeEvent(c.bpop.timeEvent)
+	}
+	if c.bpop.target != nil {
+		c.bpop.target.DecrRefCount()
+	}
+	if c.bpop.xreadGroup != nil {
+		c.bpop.xreadGroup.DecrRefCount()
+		c.bpop.xreadConsumer.DecrRefCount()
+	}
+	c.bpop = blockingState{}
+	c.flags &^= CLIENT_BLOCKED
+	if c.flags&CLIENT_UNBLOCKED == 0 {
+		c.flags |= CLIENT_UNBLOCKED
+		server.unblockedClients = append(server.unblockedClients, c)
+	}
+}
+
+// replyToBlockedClientTimedOut send the reply of a timed out blocking
+// command.
+func replyToBlockedClientTimedOut(c *RedisClient) {
+	if c.bpop.btype == BLOCKED_LIST && c.bpop.target != nil {
+		c.AddReply(shared.nullBulk)
+	} else {
+		c.AddReply(shared.nullArray)
+	}
+}
+
+// blockedClientTimeoutProc is the time event of the timeout of a blocked
+// client.
+func blockedClientTimeoutProc(loop *AeEventLoop, id int, clientData interface{}) {
+	c := clientData.(*RedisClient)
+	// the AE_ONCE event is deleted by the event loop.
+	c.bpop.timeEvent = 0
+	replyToBlockedClientTimedOut(c)
+	unblockClient(c)
+}
+
+// signalKeyAsReady queue key to be served to the clients blocked on it, it
+// must be called whenever a key may have got data for them.
+func signalKeyAsReady(db *RedisDB, key *RedisObj) {
+	if _, ok := db.blockingKeys[key.StrVal()]; !ok {
+		return
+	}
+	if db.readyKeys[key.StrVal()] {
+		return
+	}
+	db.readyKeys[key.StrVal()] = true
+	key.IncrRefCount()
+	server.readyKeys = append(server.readyKeys, &readyKey{db: db, key: key})
+}
+
+// scanDatabaseForReadyKeys signal the keys of db with blocked clients that
+// exist, it is called when the content of db is replaced as a whole.
+func scanDatabaseForReadyKeys(db *RedisDB) {
+	for key := range db.blockingKeys {
+		o := CreateObject(REDISSTR, key)
+		if db.data.DictGet(o) != nil {
+			signalKeyAsReady(db, o)
+		}
+		o.DecrRefCount()
+	}
+}
+
+// handleClientsBlockedOnKeys serve the ready keys to the clients blocked on
+// them. Serving a client may signal more keys as ready, e.g. the target of
+// BLMOVE, so the loop runs until no key is ready.
+func handleClientsBlockedOnKeys() {
+	for len(server.readyKeys) > 0 {
+		readyKeys := server.readyKeys
+		server.readyKeys = nil
+		for _, rk := range readyKeys {
+			delete(rk.db.readyKeys, rk.key.StrVal())
+			o := lookupKeyWrite(rk.db, rk.key)
+			if o != nil && o.Type_ == REDISLIST {
+				serveClientsBlockedOnListKey(o, rk)
+			} else if o != nil && o.Type_ == REDISSTREAM {
+				serveClientsBlockedOnStreamKey(o, rk)
+			}
+			rk.key.DecrRefCount()
+		}
+	}
+}
+
+// serveClientsBlockedOnListKey pop the elements of the list o for the
+// clients blocked on it in FIFO order, until the list is empty.
+func serveClientsBlockedOnListKey(o *RedisObj, rk *readyKey) {
+	// the served clients are removed from the original slice.
+	clients := append([]*RedisClient(nil), rk.db.blockingKeys[rk.key.StrVal()]...)
+	for _, receiver := range clients {
+		if receiver.bpop.btype != BLOCKED_LIST {
+			continue
+		}
+		if !serveClientBlockedOnList(receiver, rk.key, o) {
+			continue
+		}
+		unblockClient(receiver)
+		if listTypeLength(o) == 0 {
+			dbDelete(rk.db, rk.key)
+			break
+		}
+	}
+}
+
+// serveClientsBlockedOnStreamKey serve the new entries of the stream o to
+// the clients blocked on it. All the clients get the entries, except the
+// clients of the same consumer group, served in FIFO order.
+func serveClientsBlockedOnStreamKey(o *RedisObj, rk *readyKey) {
+	s := o.Val_.(*stream)
+	clients := append([]*RedisClient(nil), rk.db.blockingKeys[rk.key.StrVal()]...)
+	for _, receiver := range clients {
+		if receiver.bpop.btype != BLOCKED_STREAM {
+			continue
+		}
+		serveClientBlockedOnStream(receiver, rk.key, s)
+	}
+}
+
+// processUnblockedClients process the commands the unblocked clients
+// received while they were blocked.
+func processUnblockedClients() {
+	for len(server.unblockedClients) > 0 {
+		c := server.unblockedClients[0]
+		server.unblockedClients = server.unblockedClients[1:]
+		c.flags &^= CLIENT_UNBLOCKED
+		if c.flags&CLIENT_BLOCKED != 0 || c.queryLen == 0 {
+			continue
+		}
+		if err := processQueryBuf(c); err != nil {
+			freeClient(c)
+		}
+	}
+}
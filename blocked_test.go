@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestBlockingPopCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "rpush", "l2", "a", "b")
+	assert.Equal(t, "*2\r\n$2\r\nl2\r\n$1\r\na\r\n", execCommand(c, "blpop", "l1", "l2", "0"))
+	assert.Equal(t, "*2\r\n$2\r\nl2\r\n$1\r\nb\r\n", execCommand(c, "brpop", "l2", "0"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "l2"))
+	execCommand(c, "set", "str", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "blpop", "str", "0"))
+	assert.Equal(t, "-ERR timeout is negative\r\n", execCommand(c, "blpop", "l1", "-1"))
+	assert.Equal(t, "-ERR timeout is not a float or out of range\r\n", execCommand(c, "blpop", "l1", "abc"))
+	assert.Equal(t, "-ERR timeout is out of range\r\n", execCommand(c, "blpop", "l1", "1e17"))
+	assert.Equal(t, "-ERR timeout is out of range\r\n", execCommand(c, "blpop", "l1", "9223372036000000"))
+	assert.Equal(t, 0, len(c.db.blockingKeys))
+}
+
+func TestBlockedClientsServedInOrder(t *testing.T) {
+	c := testClient()
+	c1, c2 := CreateClient(c.fd), CreateClient(c.fd)
+	assert.Equal(t, "", execCommand(c1, "blpop", "l1", "l2", "0"))
+	assert.Equal(t, "", execCommand(c2, "brpop", "l2", "0"))
+	assert.Equal(t, CLIENT_BLOCKED, c1.flags&CLIENT_BLOCKED)
+	assert.Equal(t, []*RedisClient{c1, c2}, c.db.blockingKeys["l2"])
+
+	// the first blocked client is served first, and removed from all the
+	// keys it blocked on.
+	assert.Equal(t, ":1\r\n", execCommand(c, "rpush", "l2", "x"))
+	assert.Equal(t, "*2\r\n$2\r\nl2\r\n$1\r\nx\r\n", takeReply(c1))
+	assert.Equal(t, "", takeReply(c2))
+	assert.Equal(t, 0, c1.flags&CLIENT_BLOCKED)
+	assert.Equal(t, []*RedisClient{c2}, c.db.blockingKeys["l2"])
+	assert.Nil(t, c.db.blockingKeys["l1"])
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "l2"))
+
+	// one push serves several clients.
+	execCommand(c1, "blpop", "l2", "0")
+	assert.Equal(t, ":3\r\n", execCommand(c, "rpush", "l2", "x", "y", "z"))
+	assert.Equal(t, "*2\r\n$2\r\nl2\r\n$1\r\nz\r\n", takeReply(c2))
+	assert.Equal(t, "*2\r\n$2\r\nl2\r\n$1\r\nx\r\n", takeReply(c1))
+	assert.Equal(t, "*1\r\n$1\r\ny\r\n", execCommand(c, "lrange", "l2", "0", "-1"))
+	assert.Equal(t, 0, len(c.db.blockingKeys))
+	assert.Equal(t, 0, len(c.db.readyKeys))
+
+	// the commands received while blocked are processed once unblocked.
+	execCommand(c1, "blpop", "l3", "0")
+	assert.Equal(t, "", execCommand(c1, "llen", "l2"))
+	execCommand(c, "lpush", "l3", "a")
+	assert.Equal(t, "*2\r\n$2\r\nl3\r\n$1\r\na\r\n", takeReply(c1))
+	processUnblockedClients()
+	assert.Equal(t, ":1\r\n", takeReply(c1))
+
+	// a key added by any command serves the clients.
+	execCommand(c1, "blpop", "l4", "0")
+	execCommand(c, "rpush", "tmp", "a")
+	execCommand(c, "rename", "tmp", "l4")
+	assert.Equal(t, "*2\r\n$2\r\nl4\r\n$1\r\na\r\n", takeReply(c1))
+}
+
+func TestBlmoveCmd(t *testing.T) {
+	c := testClient()
+	c1, c2 := CreateClient(c.fd), CreateClient(c.fd)
+	execCommand(c, "rpush", "src", "a", "b")
+	assert.Equal(t, "$1\r\nb\r\n", execCommand(c, "blmove", "src", "dst", "right", "left", "0"))
+	assert.Equal(t, "$1\r\na\r\n", execCommand(c, "brpoplpush", "src", "dst", "0"))
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", execCommand(c, "lrange", "dst", "0", "-1"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "blmove", "src", "dst", "up", "left", "0"))
+
+	// the element moved by a blocked client serves the clients blocked on
+	// the destination.
+	assert.Equal(t, "", execCommand(c1, "blmove", "src", "dst2", "left", "right", "0"))
+	assert.Equal(t, "", execCommand(c2, "blpop", "dst2", "0"))
+	execCommand(c, "rpush", "src", "x")
+	assert.Equal(t, "$1\r\nx\r\n", takeReply(c1))
+	assert.Equal(t, "*2\r\n$4\r\ndst2\r\n$1\r\nx\r\n", takeReply(c2))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "src"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "dst2"))
+
+	// a client whose destination is not a list is not served.
+	execCommand(c, "set", "str", "v")
+	execCommand(c1, "blmove", "src", "str", "left", "right", "0")
+	execCommand(c2, "blpop", "src", "0")
+	execCommand(c, "rpush", "src", "y")
+	assert.Equal(t, "", takeReply(c1))
+	assert.Equal(t, "*2\r\n$3\r\nsrc\r\n$1\r\ny\r\n", takeReply(c2))
+	assert.Equal(t, []*RedisClient{c1}, c.db.blockingKeys["src"])
+}
+
+func TestBlockingTimeout(t *testing.T) {
+	c := testClient()
+	c1 := CreateClient(c.fd)
+	execCommand(c1, "blpop", "l", "0.01")
+	te := server.aeLoop.TimeEventHead
+	assert.Equal(t, c1.bpop.timeEvent, te.id)
+	server.aeLoop.AeProcessEvents([]*AeTimeEvent{te}, nil)
+	assert.Equal(t, "*-1\r\n", takeReply(c1))
+	assert.Equal(t, 0, c1.flags&CLIENT_BLOCKED)
+	assert.Equal(t, 0, len(c.db.blockingKeys))
+	assert.Nil(t, server.aeLoop.TimeEventHead)
+
+	execCommand(c1, "blmove", "l", "dst", "left", "left", "1")
+	te = server.aeLoop.TimeEventHead
+	server.aeLoop.AeProcessEvents([]*AeTimeEvent{te}, nil)
+	assert.Equal(t, "$-1\r\n", takeReply(c1))
+
+	// the time event is deleted when the client is served.
+	execCommand(c1, "blpop", "l", "100")
+	assert.NotNil(t, server.aeLoop.TimeEventHead)
+	execCommand(c, "rpush", "l", "a")
+	assert.Equal(t, "*2\r\n$1\r\nl\r\n$1\r\na\r\n", takeReply(c1))
+	assert.Nil(t, server.aeLoop.TimeEventHead)
+}
+
+func TestClientUnblockCmd(t *testing.T) {
+	c := testClient()
+	// c1 is freed below, it must not share the fd of the server.
+	c1 := CreateClient(-1)
+	server.clients[-1] = c1
+	id := strconv.FormatInt(c1.id, 10)
+	assert.Equal(t, ":"+id+"\r\n", execCommand(c1, "client", "id"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "client", "unblock", id))
+
+	execCommand(c1, "blpop", "l", "0")
+	assert.Equal(t, ":1\r\n", execCommand(c, "client", "unblock", id))
+	assert.Equal(t, "*-1\r\n", takeReply(c1))
+	assert.Equal(t, 0, len(c.db.blockingKeys))
+
+	execCommand(c1, "blmove", "l", "dst", "left", "left", "0")
+	assert.Equal(t, "-ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR\r\n", execCommand(c, "client", "unblock", id, "foo"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "client", "unblock", id, "error"))
+	assert.Equal(t, "-UNBLOCKED client unblocked via CLIENT UNBLOCK\r\n", takeReply(c1))
+	assert.Equal(t, ":0\r\n", execCommand(c, "client", "unblock", "12345"))
+	assert.Equal(t, "-ERR unknown subcommand or wrong number of arguments for 'foo'. Try CLIENT HELP.\r\n", execCommand(c, "client", "foo"))
+
+	// a disconnected client is removed from the keys.
+	execCommand(c1, "blpop", "l", "0")
+	freeClient(c1)
+	assert.Equal(t, 0, len(c.db.blockingKeys))
+	assert.NotContains(t, server.unblockedClients, c1)
+}
@@ -6,9 +6,56 @@ import (
 	"os"
 )
 
+const (
+	CONFIG_DEFAULT_HZ int = 10
+	CONFIG_MIN_HZ     int = 1
+	CONFIG_MAX_HZ     int = 500
+
+	CONFIG_DEFAULT_DBNUM int = 16
+
+	CONFIG_DEFAULT_HASH_MAX_LISTPACK_ENTRIES int = 128
+	CONFIG_DEFAULT_HASH_MAX_LISTPACK_VALUE   int = 64
+	CONFIG_DEFAULT_LIST_MAX_LISTPACK_SIZE    int = -2
+	CONFIG_DEFAULT_LIST_COMPRESS_DEPTH       int = 0
+
+	CONFIG_DEFAULT_STRING_COMPRESS_THRESHOLD int = 1024
+
+	CONFIG_DEFAULT_HLL_SPARSE_MAX_BYTES int = 3000
+
+	CONFIG_DEFAULT_STREAM_NODE_MAX_BYTES   int = 4096
+	CONFIG_DEFAULT_STREAM_NODE_MAX_ENTRIES int = 100
+)
+
 type Config struct {
 	Port int    `json:"port"`
 	Addr string `json:"addr"`
+	Hz   int    `json:"hz"`
+	// number of databases
+	Databases int `json:"databases"`
+	// a hash is encoded as a listpack while it has at most
+	// hash-max-listpack-entries fields and no field or value is longer than
+	// hash-max-listpack-value bytes.
+	HashMaxListpackEntries int `json:"hash-max-listpack-entries"`
+	HashMaxListpackValue   int `json:"hash-max-listpack-value"`
+	// a list is encoded as a listpack while it fits list-max-listpack-size,
+	// a positive value is the max number of elements and -1 to -5 is the
+	// max size of 4, 8, 16, 32 or 64 kb.
+	ListMaxListpackSize int `json:"list-max-listpack-size"`
+	// a large list is a quicklist of listpack nodes, the nodes deeper than
+	// list-compress-depth from both ends are compressed, 0 disables it.
+	ListCompressDepth int `json:"list-compress-depth"`
+	// strings longer than string-compress-threshold bytes are stored lzf
+	// compressed, 0 disables the compression.
+	StringCompressThreshold int `json:"string-compress-threshold"`
+	// a HyperLogLog is promoted from the sparse to the dense representation
+	// when it gets longer than hll-sparse-max-bytes.
+	HllSparseMaxBytes int `json:"hll-sparse-max-bytes"`
+	// a stream node holds at most stream-node-max-entries entries and
+	// stream-node-max-bytes bytes, 0 disables a limit.
+	StreamNodeMaxBytes   int `json:"stream-node-max-bytes"`
+	StreamNodeMaxEntries int `json:"stream-node-max-entries"`
+	// the port of the memcached protocol listener, 0 disables it.
+	MemcachedPort int `json:"memcached-port"`
 }
 
 func LoadConfig(path string) (config *Config, err error) {
@@ -23,7 +70,21 @@ func LoadConfig(path string) (config *Config, err error) {
 		return
 	}
 
-	config = &Config{}
+	config = &Config{
+		Hz:        CONFIG_DEFAULT_HZ,
+		Databases: CONFIG_DEFAULT_DBNUM,
+
+		HashMaxListpackEntries: CONFIG_DEFAULT_HASH_MAX_LISTPACK_ENTRIES,
+		HashMaxListpackValue:   CONFIG_DEFAULT_HASH_MAX_LISTPACK_VALUE,
+		ListMaxListpackSize:    CONFIG_DEFAULT_LIST_MAX_LISTPACK_SIZE,
+		ListCompressDepth:      CONFIG_DEFAULT_LIST_COMPRESS_DEPTH,
+
+		StringCompressThreshold: CONFIG_DEFAULT_STRING_COMPRESS_THRESHOLD,
+		HllSparseMaxBytes:       CONFIG_DEFAULT_HLL_SPARSE_MAX_BYTES,
+
+		StreamNodeMaxBytes:   CONFIG_DEFAULT_STREAM_NODE_MAX_BYTES,
+		StreamNodeMaxEntries: CONFIG_DEFAULT_STREAM_NODE_MAX_ENTRIES,
+	}
 	if err = json.Unmarshal(jsonStr, config); err != nil {
 		return nil, err
 	}
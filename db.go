@@ -0,0 +1,580 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+func createKeyspaceDict() *Dict {
+	return DictCreate(DictFunc{
+		HashFunc:  RedisStrHash,
+		EqualFunc: RedisStrEqual,
+	})
+}
+
+// selectDb switch the db of client, return false if id is out of range.
+func selectDb(c *RedisClient, id int64) bool {
+	if id < 0 || id >= int64(server.dbnum) {
+		return false
+	}
+	c.db = server.db[id]
+	return true
+}
+
+// emptyDb remove all the keys of db, or all the dbs if id is -1, and
+// return the number of removed keys.
+func emptyDb(id int) int64 {
+	var removed int64
+	for _, db := range server.db {
+		if id != -1 && id != db.id {
+			continue
+		}
+		removed += db.data.DictSize()
+		db.data = createKeyspaceDict()
+		db.expire = createKeyspaceDict()
+		db.expiresCursor = 0
+	}
+	return removed
+}
+
+func keyIsExpired(db *RedisDB, key *RedisObj) bool {
+	when := getExpire(db, key)
+	if when < 0 {
+		// no expire for this key.
+		return false
+	}
+	return when <= GetMsTime()
+}
+
+// expireIfNeeded delete the key and return true if it's expired.
+func expireIfNeeded(db *RedisDB, key *RedisObj) bool {
+	if !keyIsExpired(db, key) {
+		return false
+	}
+	db.expire.DictDelete(key)
+	db.data.DictDelete(key)
+	server.statExpiredKeys++
+	return true
+}
+
+func lookupKeyRead(db *RedisDB, key *RedisObj) *RedisObj {
+	expireIfNeeded(db, key)
+	return db.data.DictGet(key)
+}
+
+func lookupKeyWrite(db *RedisDB, key *RedisObj) *RedisObj {
+	expireIfNeeded(db, key)
+	return db.data.DictGet(key)
+}
+
+// lookupKeyReadOrReply reply obj to client and return nil if key doesn't exist.
+func lookupKeyReadOrReply(c *RedisClient, key *RedisObj, obj *RedisObj) *RedisObj {
+	val := lookupKeyRead(c.db, key)
+	if val == nil {
+		c.AddReply(obj)
+	}
+	return val
+}
+
+func lookupKeyWriteOrReply(c *RedisClient, key *RedisObj, obj *RedisObj) *RedisObj {
+	val := lookupKeyWrite(c.db, key)
+	if val == nil {
+		c.AddReply(obj)
+	}
+	return val
+}
+
+// checkType reply a WRONGTYPE error and return true if the type of obj is not t.
+func checkType(c *RedisClient, obj *RedisObj, t RedisType) bool {
+	if obj.Type_ != t {
+		c.AddReply(shared.wrongTypeErr)
+		return true
+	}
+	return false
+}
+
+// dbAdd add the key to db, the key must not exist.
+func dbAdd(db *RedisDB, key, val *RedisObj) {
+	db.data.DictAdd(key, val)
+	signalKeyAsReady(db, key)
+}
+
+// dbOverwrite replace the value of an existing key, the expire is untouched.
+func dbOverwrite(db *RedisDB, key, val *RedisObj) {
+	db.data.DictSet(key, val)
+	signalKeyAsReady(db, key)
+}
+
+// setKey add or overwrite the key, the expire of the key is removed unless
+// keepTTL is true.
+func setKey(db *RedisDB, key, val *RedisObj, keepTTL bool) {
+	db.data.DictSet(key, val)
+	signalKeyAsReady(db, key)
+	if !keepTTL {
+		removeExpire(db, key)
+	}
+}
+
+// dbDelete return true if the key exists and is deleted.
+func dbDelete(db *RedisDB, key *RedisObj) bool {
+	db.expire.DictDelete(key)
+	return db.data.DictDelete(key) == nil
+}
+
+// getExpire return the unix time in ms when key expires, or -1 if no expire.
+func getExpire(db *RedisDB, key *RedisObj) int64 {
+	entry := db.expire.DictFind(key)
+	if entry == nil {
+		return -1
+	}
+	return entry.Val.IntVal()
+}
+
+func setExpire(db *RedisDB, key *RedisObj, when int64) {
+	expObj := CreateFromInt(when)
+	db.expire.DictSet(key, expObj)
+	expObj.DecrRefCount()
+}
+
+func removeExpire(db *RedisDB, key *RedisObj) bool {
+	return db.expire.DictDelete(key) == nil
+}
+
+// dupValue return a deep copy of the value o, so the copy can be modified
+// independently.
+func dupValue(o *RedisObj) *RedisObj {
+	switch o.Type_ {
+	case REDISSTR:
+		return dupStringObject(o)
+	case REDISLIST:
+		return listTypeDup(o)
+	case REDISDICT:
+		return hashTypeDup(o)
+	case REDISSET:
+		return setTypeDup(o)
+	case REDISZSET:
+		return zsetDup(o)
+	case REDISSTREAM:
+		d := CreateObject(REDISSTREAM, streamDup(o.Val_.(*stream)))
+		d.encoding = REDIS_ENCODING_STREAM
+		return d
+	default:
+		panic("unknown object type")
+	}
+}
+
+func delGenericCommand(c *RedisClient) {
+	var deleted int64
+	for _, key := range c.args[1:] {
+		expireIfNeeded(c.db, key)
+		if dbDelete(c.db, key) {
+			deleted++
+		}
+	}
+	c.AddReplyInt(deleted)
+}
+
+func delCommand(c *RedisClient) {
+	delGenericCommand(c)
+}
+
+// unlinkCommand is the same as DEL, since values are freed by the GC anyway.
+func unlinkCommand(c *RedisClient) {
+	delGenericCommand(c)
+}
+
+// existsCommand reply the number of keys existing, a key mentioned
+// multiple times is counted multiple times.
+func existsCommand(c *RedisClient) {
+	var count int64
+	for _, key := range c.args[1:] {
+		if lookupKeyRead(c.db, key) != nil {
+			count++
+		}
+	}
+	c.AddReplyInt(count)
+}
+
+func touchCommand(c *RedisClient) {
+	existsCommand(c)
+}
+
+func typeCommand(c *RedisClient) {
+	val := lookupKeyRead(c.db, c.args[1])
+	if val == nil {
+		c.AddReplyStatus("none")
+		return
+	}
+	c.AddReplyStatus(typeName(val.Type_))
+}
+
+func dbsizeCommand(c *RedisClient) {
+	c.AddReplyInt(c.db.data.DictSize())
+}
+
+func randomkeyCommand(c *RedisClient) {
+	for {
+		entry := c.db.data.DictGetRandomKey()
+		if entry == nil {
+			c.AddReplyNullBulk()
+			return
+		}
+		if expireIfNeeded(c.db, entry.Key) {
+			// the key is expired and deleted, try again.
+			continue
+		}
+		c.AddReplyBulk(entry.Key)
+		return
+	}
+}
+
+func renameGenericCommand(c *RedisClient, nx bool) {
+	src, dst := c.args[1], c.args[2]
+	// when source and dest key is the same, no operation is performed
+	// if the key exists, however we still return an error on unexisting key.
+	sameKey := src.StrVal() == dst.StrVal()
+
+	val := lookupKeyWriteOrReply(c, src, shared.noKeyErr)
+	if val == nil {
+		return
+	}
+	if sameKey {
+		if nx {
+			c.AddReply(shared.czero)
+		} else {
+			c.AddReply(shared.ok)
+		}
+		return
+	}
+
+	when := getExpire(c.db, src)
+	if lookupKeyWrite(c.db, dst) != nil {
+		if nx {
+			c.AddReply(shared.czero)
+			return
+		}
+		dbDelete(c.db, dst)
+	}
+	dbAdd(c.db, dst, val)
+	if when != -1 {
+		setExpire(c.db, dst, when)
+	}
+	dbDelete(c.db, src)
+	if nx {
+		c.AddReply(shared.cone)
+	} else {
+		c.AddReply(shared.ok)
+	}
+}
+
+func renameCommand(c *RedisClient) {
+	renameGenericCommand(c, false)
+}
+
+func renamenxCommand(c *RedisClient) {
+	renameGenericCommand(c, true)
+}
+
+// copyCommand implement COPY source destination [DB destination-db] [REPLACE]
+func copyCommand(c *RedisClient) {
+	src, dst := c.args[1], c.args[2]
+	srcDb, dstDb := c.db, c.db
+	replace := false
+	for i := 3; i < len(c.args); i++ {
+		opt := strings.ToLower(c.args[i].StrVal())
+		if opt == "replace" {
+			replace = true
+		} else if opt == "db" && i+1 < len(c.args) {
+			id, ok := getDbIndexOrReply(c, c.args[i+1], "")
+			if !ok {
+				return
+			}
+			dstDb = server.db[id]
+			i++
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+	if srcDb == dstDb && src.StrVal() == dst.StrVal() {
+		c.AddReplyError("source and destination objects are the same")
+		return
+	}
+
+	val := lookupKeyRead(srcDb, src)
+	if val == nil {
+		c.AddReply(shared.czero)
+		return
+	}
+	if lookupKeyWrite(dstDb, dst) != nil {
+		if !replace {
+			c.AddReply(shared.czero)
+			return
+		}
+		dbDelete(dstDb, dst)
+	}
+
+	newVal := dupValue(val)
+	dbAdd(dstDb, dst, newVal)
+	newVal.DecrRefCount()
+	if when := getExpire(srcDb, src); when != -1 {
+		setExpire(dstDb, dst, when)
+	}
+	c.AddReply(shared.cone)
+}
+
+// getDbIndexOrReply parse a db index, reply msg if it is not an integer, or
+// an out of range error if the db doesn't exist.
+func getDbIndexOrReply(c *RedisClient, o *RedisObj, msg string) (int, bool) {
+	id, ok := getLongLongFromObjectOrReply(c, o, msg)
+	if !ok {
+		return 0, false
+	}
+	if id < 0 || id >= int64(server.dbnum) {
+		c.AddReplyError("DB index is out of range")
+		return 0, false
+	}
+	return int(id), true
+}
+
+func selectCommand(c *RedisClient) {
+	id, ok := getDbIndexOrReply(c, c.args[1], "invalid DB index")
+	if !ok {
+		return
+	}
+	selectDb(c, int64(id))
+	c.AddReply(shared.ok)
+}
+
+// moveCommand implement MOVE key db
+func moveCommand(c *RedisClient) {
+	key := c.args[1]
+	id, ok := getDbIndexOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	srcDb, dstDb := c.db, server.db[id]
+	if srcDb == dstDb {
+		c.AddReplyError("source and destination objects are the same")
+		return
+	}
+
+	val := lookupKeyWrite(srcDb, key)
+	if val == nil {
+		c.AddReply(shared.czero)
+		return
+	}
+	if lookupKeyWrite(dstDb, key) != nil {
+		c.AddReply(shared.czero)
+		return
+	}
+	when := getExpire(srcDb, key)
+	dbAdd(dstDb, key, val)
+	if when != -1 {
+		setExpire(dstDb, key, when)
+	}
+	dbDelete(srcDb, key)
+	c.AddReply(shared.cone)
+}
+
+// swapdbCommand implement SWAPDB index1 index2, the clients selecting one db
+// will see the data of the other one.
+func swapdbCommand(c *RedisClient) {
+	id1, ok := getDbIndexOrReply(c, c.args[1], "invalid first DB index")
+	if !ok {
+		return
+	}
+	id2, ok := getDbIndexOrReply(c, c.args[2], "invalid second DB index")
+	if !ok {
+		return
+	}
+	db1, db2 := server.db[id1], server.db[id2]
+	db1.data, db2.data = db2.data, db1.data
+	db1.expire, db2.expire = db2.expire, db1.expire
+	db1.expiresCursor, db2.expiresCursor = db2.expiresCursor, db1.expiresCursor
+	// the clients blocked on a db may be served by the keys swapped in.
+	scanDatabaseForReadyKeys(db1)
+	scanDatabaseForReadyKeys(db2)
+	c.AddReply(shared.ok)
+}
+
+// parseFlushallFlagsOrReply accept the ASYNC and SYNC options, which make no
+// difference here as the values are freed by the GC.
+func parseFlushallFlagsOrReply(c *RedisClient) bool {
+	if len(c.args) > 2 {
+		c.AddReply(shared.syntaxErr)
+		return false
+	}
+	if len(c.args) == 2 {
+		opt := strings.ToLower(c.args[1].StrVal())
+		if opt != "async" && opt != "sync" {
+			c.AddReply(shared.syntaxErr)
+			return false
+		}
+	}
+	return true
+}
+
+// flushdbCommand implement FLUSHDB [ASYNC|SYNC]
+func flushdbCommand(c *RedisClient) {
+	if !parseFlushallFlagsOrReply(c) {
+		return
+	}
+	emptyDb(c.db.id)
+	c.AddReply(shared.ok)
+}
+
+// flushallCommand implement FLUSHALL [ASYNC|SYNC]
+func flushallCommand(c *RedisClient) {
+	if !parseFlushallFlagsOrReply(c) {
+		return
+	}
+	emptyDb(-1)
+	c.AddReply(shared.ok)
+}
+
+// keysCommand implement KEYS pattern
+func keysCommand(c *RedisClient) {
+	pattern := c.args[1].StrVal()
+	allKeys := pattern == "*"
+	node := c.AddDeferredArrayLen()
+	num := 0
+	iter := c.db.data.DictGetSafeIterator()
+	for entry := iter.DictNext(); entry != nil; entry = iter.DictNext() {
+		key := entry.Key.StrVal()
+		if (allKeys || stringmatch(pattern, key, false)) && !keyIsExpired(c.db, entry.Key) {
+			c.AddReplyBulkStr(key)
+			num++
+		}
+	}
+	iter.DictReleaseIterator()
+	c.SetDeferredArrayLen(node, num)
+}
+
+// parseScanCursorOrReply parse the cursor of SCAN family commands, reply an
+// error and return false if the cursor is invalid.
+func parseScanCursorOrReply(c *RedisClient, o *RedisObj) (uint64, bool) {
+	cursor, err := strconv.ParseUint(o.StrVal(), 10, 64)
+	if err != nil {
+		c.AddReplyError("invalid cursor")
+		return 0, false
+	}
+	return cursor, true
+}
+
+// scanGenericCommand implement SCAN, o is nil when scanning the keyspace.
+// The options start from c.args[2] for SCAN and c.args[3] for the others.
+func scanGenericCommand(c *RedisClient, o *RedisObj, cursor uint64) {
+	i := 2
+	if o != nil {
+		i = 3
+	}
+	var count int64 = 10
+	var pattern, typ string
+	usePattern, useType := false, false
+	for ; i < len(c.args); i += 2 {
+		if i+1 >= len(c.args) {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+		opt := strings.ToLower(c.args[i].StrVal())
+		if opt == "count" {
+			var ok bool
+			if count, ok = getLongLongFromObjectOrReply(c, c.args[i+1], ""); !ok {
+				return
+			}
+			if count < 1 {
+				c.AddReply(shared.syntaxErr)
+				return
+			}
+		} else if opt == "match" {
+			pattern = c.args[i+1].StrVal()
+			// the pattern always matches if it is exactly "*".
+			usePattern = pattern != "*"
+		} else if opt == "type" && o == nil {
+			typ = strings.ToLower(c.args[i+1].StrVal())
+			useType = true
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+
+	// a hash replies the fields along with their values.
+	var d *Dict
+	withValues := false
+	if o == nil {
+		d = c.db.data
+	} else if o.Type_ == REDISDICT {
+		withValues = true
+		if o.encoding == REDIS_ENCODING_HT {
+			d = o.Val_.(*Dict)
+		}
+	} else if o.Type_ == REDISSET {
+		d = o.Val_.(*Dict)
+	}
+
+	// collect the keys first, so the keyspace is not modified while scanning.
+	// A listpack is small, all its elements are returned in a single call.
+	var keys []string
+	maxIterations := count * 10
+	if o != nil && o.encoding == REDIS_ENCODING_LISTPACK {
+		lp := o.Val_.(*Listpack)
+		for p := lp.LpFirst(); p != -1; p = lp.LpNext(p) {
+			keys = append(keys, lp.LpGetString(p))
+		}
+		cursor = 0
+	}
+	for d != nil {
+		cursor = d.DictScan(cursor, func(entry *DictEntry) {
+			keys = append(keys, entry.Key.StrVal())
+			if withValues {
+				keys = append(keys, entry.Val.StrVal())
+			}
+		})
+		maxIterations--
+		if cursor == 0 || maxIterations == 0 || int64(len(keys)) >= count {
+			break
+		}
+	}
+
+	// filter the elements.
+	filtered := keys[:0]
+	for i := 0; i < len(keys); i++ {
+		key := keys[i]
+		if usePattern && !stringmatch(pattern, key, false) {
+			if withValues {
+				i++
+			}
+			continue
+		}
+		if o == nil {
+			keyObj := CreateObject(REDISSTR, key)
+			val := lookupKeyRead(c.db, keyObj)
+			if val == nil || (useType && typeName(val.Type_) != typ) {
+				continue
+			}
+		}
+		filtered = append(filtered, key)
+		if withValues {
+			i++
+			filtered = append(filtered, keys[i])
+		}
+	}
+
+	c.AddReplyArrayLen(2)
+	c.AddReplyBulkStr(strconv.FormatUint(cursor, 10))
+	c.AddReplyArrayLen(len(filtered))
+	for _, key := range filtered {
+		c.AddReplyBulkStr(key)
+	}
+}
+
+// scanCommand implement SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func scanCommand(c *RedisClient) {
+	cursor, ok := parseScanCursorOrReply(c, c.args[1])
+	if !ok {
+		return
+	}
+	scanGenericCommand(c, nil, cursor)
+}
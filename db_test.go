@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDelCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "mset", "k1", "v1", "k2", "v2", "k3", "v3")
+	assert.Equal(t, ":3\r\n", execCommand(c, "dbsize"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "del", "k1", "k2", "k4"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "unlink", "k3"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "del", "k3"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "dbsize"))
+}
+
+func TestExistsCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "mset", "k1", "v1", "k2", "v2")
+	assert.Equal(t, ":1\r\n", execCommand(c, "exists", "k1"))
+	assert.Equal(t, ":3\r\n", execCommand(c, "exists", "k1", "k2", "k1", "k3"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "touch", "k1", "k2", "k3"))
+	execCommand(c, "set", "k1", "v", "pxat", "1")
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "k1"))
+}
+
+func TestTypeCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "str", "v")
+	assert.Equal(t, "+string\r\n", execCommand(c, "type", "str"))
+	assert.Equal(t, "+none\r\n", execCommand(c, "type", "nokey"))
+	c.db.data.DictSet(CreateObject(REDISSTR, "list"), CreateObject(REDISLIST, ListCreate(ListFunc{})))
+	assert.Equal(t, "+list\r\n", execCommand(c, "type", "list"))
+	c.db.data.DictSet(CreateObject(REDISSTR, "hash"), CreateObject(REDISDICT, DictCreate(DictFunc{})))
+	assert.Equal(t, "+hash\r\n", execCommand(c, "type", "hash"))
+}
+
+func TestRenameCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "-ERR no such key\r\n", execCommand(c, "rename", "k1", "k2"))
+	execCommand(c, "setex", "k1", "100", "v1")
+	when := getExpire(c.db, CreateObject(REDISSTR, "k1"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "rename", "k1", "k1"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "rename", "k1", "k2"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "k1"))
+	assert.Equal(t, "$2\r\nv1\r\n", execCommand(c, "get", "k2"))
+	// the ttl is moved with the key.
+	assert.Equal(t, when, getExpire(c.db, CreateObject(REDISSTR, "k2")))
+	assert.Equal(t, int64(-1), getExpire(c.db, CreateObject(REDISSTR, "k1")))
+
+	execCommand(c, "set", "k3", "v3")
+	assert.Equal(t, ":0\r\n", execCommand(c, "renamenx", "k2", "k3"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "renamenx", "k2", "k2"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "renamenx", "k2", "k4"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "rename", "k4", "k3"))
+	assert.Equal(t, "$2\r\nv1\r\n", execCommand(c, "get", "k3"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "dbsize"))
+}
+
+func TestCopyCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "setex", "k1", "100", "v1")
+	assert.Equal(t, ":0\r\n", execCommand(c, "copy", "nokey", "k2"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "copy", "k1", "k2"))
+	assert.Equal(t, "$2\r\nv1\r\n", execCommand(c, "get", "k2"))
+	assert.Equal(t, getExpire(c.db, CreateObject(REDISSTR, "k1")), getExpire(c.db, CreateObject(REDISSTR, "k2")))
+
+	execCommand(c, "set", "k3", "v3")
+	assert.Equal(t, ":0\r\n", execCommand(c, "copy", "k3", "k2"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "copy", "k3", "k2", "replace"))
+	assert.Equal(t, "$2\r\nv3\r\n", execCommand(c, "get", "k2"))
+	assert.Equal(t, int64(-1), getExpire(c.db, CreateObject(REDISSTR, "k2")))
+
+	assert.Equal(t, "-ERR source and destination objects are the same\r\n", execCommand(c, "copy", "k1", "k1"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "copy", "k1", "k2", "foo"))
+}
+
+func TestRandomkeyCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "$-1\r\n", execCommand(c, "randomkey"))
+	execCommand(c, "set", "k1", "v1")
+	assert.Equal(t, "$2\r\nk1\r\n", execCommand(c, "randomkey"))
+
+	// expired keys are skipped.
+	c.db.data.DictSet(CreateObject(REDISSTR, "k2"), CreateObject(REDISSTR, "v2"))
+	setExpire(c.db, CreateObject(REDISSTR, "k2"), 1)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "$2\r\nk1\r\n", execCommand(c, "randomkey"))
+	}
+	assert.Equal(t, ":1\r\n", execCommand(c, "dbsize"))
+}
+
+func TestKeysCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "*0\r\n", execCommand(c, "keys", "*"))
+	execCommand(c, "mset", "user:1", "a", "user:2", "b", "item:1", "c")
+	execCommand(c, "set", "user:3", "d", "pxat", "1")
+	reply := execCommand(c, "keys", "user:*")
+	assert.Contains(t, reply, "*2\r\n")
+	assert.Contains(t, reply, "$6\r\nuser:1\r\n")
+	assert.Contains(t, reply, "$6\r\nuser:2\r\n")
+	assert.Equal(t, "*1\r\n$6\r\nitem:1\r\n", execCommand(c, "keys", "i[a-z]em:?"))
+	assert.Contains(t, execCommand(c, "keys", "*"), "*3\r\n")
+}
+
+func TestScanCmd(t *testing.T) {
+	c := testClient()
+	size := 200
+	for i := 0; i < size; i++ {
+		execCommand(c, "set", fmt.Sprintf("key:%v", i), "v")
+	}
+	c.db.data.DictSet(CreateObject(REDISSTR, "list"), CreateObject(REDISLIST, ListCreate(ListFunc{})))
+
+	scanAll := func(args ...string) map[string]bool {
+		keys := make(map[string]bool)
+		cursor := "0"
+		for {
+			execArgs := append([]string{"scan", cursor}, args...)
+			ReadQuery(c, argsToQuery(execArgs))
+			assert.Nil(t, processQueryBuf(c))
+			reply := takeReply(c)
+			// *2\r\n$len\r\ncursor\r\n*n\r\n($len\r\nkey\r\n)*
+			lines := strings.Split(reply, "\r\n")
+			cursor = lines[2]
+			for i := 5; i < len(lines)-1; i += 2 {
+				keys[lines[i]] = true
+			}
+			if cursor == "0" {
+				break
+			}
+		}
+		return keys
+	}
+
+	assert.Equal(t, size+1, len(scanAll()))
+	assert.Equal(t, size+1, len(scanAll("count", "3")))
+	keys := scanAll("match", "key:1?")
+	assert.Equal(t, 10, len(keys))
+	assert.True(t, keys["key:15"])
+	keys = scanAll("type", "list")
+	assert.Equal(t, 1, len(keys))
+	assert.True(t, keys["list"])
+
+	assert.Equal(t, "-ERR invalid cursor\r\n", execCommand(c, "scan", "abc"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "scan", "0", "count", "0"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "scan", "0", "match"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "scan", "0", "foo", "bar"))
+}
+
+func TestSelectCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, 16, server.dbnum)
+	execCommand(c, "set", "k", "v0")
+	assert.Equal(t, "+OK\r\n", execCommand(c, "select", "1"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "k"))
+	execCommand(c, "set", "k", "v1")
+	assert.Equal(t, "-ERR DB index is out of range\r\n", execCommand(c, "select", "16"))
+	assert.Equal(t, "-ERR invalid DB index\r\n", execCommand(c, "select", "a"))
+	execCommand(c, "select", "0")
+	assert.Equal(t, "$2\r\nv0\r\n", execCommand(c, "get", "k"))
+	info := execCommand(c, "info", "keyspace")
+	assert.True(t, strings.Contains(info, "db0:keys=1,expires=0"))
+	assert.True(t, strings.Contains(info, "db1:keys=1,expires=0"))
+}
+
+func TestMoveCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "k", "v", "ex", "100")
+	assert.Equal(t, "-ERR source and destination objects are the same\r\n", execCommand(c, "move", "k", "0"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "move", "k", "2"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "k"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "move", "k", "2"))
+	execCommand(c, "select", "2")
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(c, "get", "k"))
+	assert.Equal(t, ":100\r\n", execCommand(c, "ttl", "k"))
+	// the key exists in the destination.
+	execCommand(c, "select", "0")
+	execCommand(c, "set", "k", "v0")
+	assert.Equal(t, ":0\r\n", execCommand(c, "move", "k", "2"))
+}
+
+func TestSwapdbCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "k", "v0")
+	assert.Equal(t, "+OK\r\n", execCommand(c, "swapdb", "0", "1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "k"))
+	execCommand(c, "select", "1")
+	assert.Equal(t, "$2\r\nv0\r\n", execCommand(c, "get", "k"))
+	assert.Equal(t, "-ERR invalid first DB index\r\n", execCommand(c, "swapdb", "a", "1"))
+	assert.Equal(t, "-ERR invalid second DB index\r\n", execCommand(c, "swapdb", "0", "b"))
+	assert.Equal(t, "-ERR DB index is out of range\r\n", execCommand(c, "swapdb", "0", "16"))
+}
+
+func TestFlushCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "mset", "k1", "v1", "k2", "v2")
+	execCommand(c, "select", "1")
+	execCommand(c, "set", "k1", "v1", "ex", "100")
+	assert.Equal(t, "+OK\r\n", execCommand(c, "flushdb"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "dbsize"))
+	assert.Equal(t, int64(0), c.db.expire.DictSize())
+	execCommand(c, "select", "0")
+	assert.Equal(t, ":2\r\n", execCommand(c, "dbsize"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "flushall", "now"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "flushall", "async"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "dbsize"))
+}
+
+func TestCopyToDb(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "k", "v")
+	assert.Equal(t, ":1\r\n", execCommand(c, "copy", "k", "k", "db", "3"))
+	assert.Equal(t, "-ERR DB index is out of range\r\n", execCommand(c, "copy", "k", "k", "db", "16"))
+	execCommand(c, "select", "3")
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(c, "get", "k"))
+}
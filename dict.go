@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"math"
+	"math/bits"
 	"math/rand"
 )
 
@@ -21,7 +22,7 @@ var (
 
 type DictEntry struct {
 	Key  *RedisObj
-	Val  *RedisObj
+	Val  *RedisObj // nil if the dict is used as a set.
 	next *DictEntry
 }
 
@@ -41,7 +42,20 @@ type Dict struct {
 	DictFunc
 	HashTable [2]*DictHashTable
 	rehashIdx int64
-	// TODO: impl iterator
+	iterators int64 // number of safe iterators currently running
+}
+
+// DictIterator iterate all the entries of dict. If safe is true, it is
+// allowed to add, find and delete entries while iterating, rehashing is
+// paused until the iterator is released. Otherwise only DictNext can be
+// called until the iteration is done.
+type DictIterator struct {
+	dict      *Dict
+	table     int
+	index     int64
+	safe      bool
+	entry     *DictEntry
+	nextEntry *DictEntry
 }
 
 func DictCreate(dictFunc DictFunc) *Dict {
@@ -51,6 +65,17 @@ func DictCreate(dictFunc DictFunc) *Dict {
 	return &dict
 }
 
+// DictSize return the number of entries in dict.
+func (dict *Dict) DictSize() int64 {
+	var size int64
+	for _, ht := range dict.HashTable {
+		if ht != nil {
+			size += ht.used
+		}
+	}
+	return size
+}
+
 func (dict *Dict) DictIsRehashing() bool {
 	return dict.rehashIdx != -1
 }
@@ -94,8 +119,9 @@ func (dict *Dict) DictRehash(step int64) {
 }
 
 func (dict *Dict) DictRehashStep() {
-	// TODO: if dict->iterators == 0
-	dict.DictRehash(DICT_DEFAULT_REHASH_STEP)
+	if dict.iterators == 0 {
+		dict.DictRehash(DICT_DEFAULT_REHASH_STEP)
+	}
 }
 
 func dictNextPower(size int64) int64 {
@@ -109,7 +135,7 @@ func dictNextPower(size int64) int64 {
 
 func (dict *Dict) DictExpand(size int64) error {
 	realSize := dictNextPower(size)
-	if dict.DictIsRehashing() || (dict.HashTable[0] != nil && dict.HashTable[0].used > size) {
+	if dict.DictIsRehashing() || (dict.HashTable[0] != nil && dict.HashTable[0].size >= realSize) {
 		return EP_ERR
 	}
 
@@ -235,7 +261,9 @@ func (dict *Dict) DictAdd(key, val *RedisObj) error {
 		return EX_ERR
 	}
 	entry.Val = val
-	entry.Val.IncrRefCount()
+	if val != nil {
+		val.IncrRefCount()
+	}
 	return nil
 }
 
@@ -245,14 +273,20 @@ func (dict *Dict) DictSet(key, val *RedisObj) {
 		return
 	}
 	entry := dict.DictFind(key)
-	entry.Val.DecrRefCount()
+	if val != nil {
+		val.IncrRefCount()
+	}
+	if entry.Val != nil {
+		entry.Val.DecrRefCount()
+	}
 	entry.Val = val
-	val.IncrRefCount()
 }
 
 func freeEntry(e *DictEntry) {
 	e.Key.DecrRefCount()
-	e.Val.DecrRefCount()
+	if e.Val != nil {
+		e.Val.DecrRefCount()
+	}
 }
 
 func (dict *Dict) DictDelete(key *RedisObj) error {
@@ -338,3 +372,117 @@ func (dict *Dict) DictGetRandomKey() *DictEntry {
 
 	return he
 }
+
+func (dict *Dict) DictGetIterator() *DictIterator {
+	return &DictIterator{
+		dict:  dict,
+		table: 0,
+		index: -1,
+	}
+}
+
+func (dict *Dict) DictGetSafeIterator() *DictIterator {
+	iter := dict.DictGetIterator()
+	iter.safe = true
+	return iter
+}
+
+// DictNext return the next entry, or nil if the iteration is done.
+func (iter *DictIterator) DictNext() *DictEntry {
+	for {
+		if iter.entry == nil {
+			ht := iter.dict.HashTable[iter.table]
+			if ht == nil {
+				return nil
+			}
+			if iter.index == -1 && iter.table == 0 && iter.safe {
+				iter.dict.iterators++
+			}
+			iter.index++
+			if iter.index >= ht.size {
+				if iter.dict.DictIsRehashing() && iter.table == 0 {
+					iter.table++
+					iter.index = 0
+					ht = iter.dict.HashTable[1]
+				} else {
+					return nil
+				}
+			}
+			iter.entry = ht.table[iter.index]
+		} else {
+			iter.entry = iter.nextEntry
+		}
+		if iter.entry != nil {
+			// save the next entry, because the returned entry may be deleted.
+			iter.nextEntry = iter.entry.next
+			return iter.entry
+		}
+	}
+}
+
+func (iter *DictIterator) DictReleaseIterator() {
+	if iter.safe && !(iter.index == -1 && iter.table == 0) {
+		iter.dict.iterators--
+	}
+}
+
+// DictScan iterate the entries of dict in a stateless way, fn is called for
+// each entry in the bucket the cursor points to, and the next cursor is
+// returned. A scan starts with cursor 0 and ends when 0 is returned. Every
+// entry present in the dict from the start to the end of a full scan is
+// guaranteed to be returned, even if the dict is rehashed between calls,
+// some entries may be returned multiple times though.
+//
+// The cursor is incremented on its reversed bits, so the higher bits are
+// incremented first. When the table grows or shrinks, the buckets already
+// visited in the old table map to buckets already visited in the new one,
+// as the bucket index of an entry in a table of size 2^n is the lower n
+// bits of its hash.
+func (dict *Dict) DictScan(cursor uint64, fn func(entry *DictEntry)) uint64 {
+	if dict.DictSize() == 0 {
+		return 0
+	}
+	// rehashing is paused, so fn can safely look up the dict.
+	dict.iterators++
+	defer func() { dict.iterators-- }()
+
+	emit := func(ht *DictHashTable, idx uint64) {
+		de := ht.table[idx&uint64(ht.mask)]
+		for de != nil {
+			next := de.next
+			fn(de)
+			de = next
+		}
+	}
+
+	if !dict.DictIsRehashing() {
+		t0 := dict.HashTable[0]
+		m0 := uint64(t0.mask)
+		emit(t0, cursor)
+		// set unmasked bits so incrementing the reversed cursor operates
+		// on the masked bits.
+		cursor |= ^m0
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		return cursor
+	}
+
+	t0, t1 := dict.HashTable[0], dict.HashTable[1]
+	// make sure t0 is the smaller and t1 is the bigger table.
+	if t0.size > t1.size {
+		t0, t1 = t1, t0
+	}
+	m0, m1 := uint64(t0.mask), uint64(t1.mask)
+	emit(t0, cursor)
+	// iterate over indices in larger table that are the expansion of the
+	// index pointed to by the cursor in the smaller table.
+	for {
+		emit(t1, cursor)
+		cursor |= ^m1
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		// continue while bits covered by mask difference is non-zero.
+		if cursor&(m0^m1) == 0 {
+			break
+		}
+	}
+	return cursor
+}
@@ -85,6 +85,7 @@ func TestRehash(t *testing.T) {
 	err := d.DictAdd(key, val)
 	assert.Nil(t, err)
 	assert.Equal(t, true, d.DictIsRehashing())
+	assert.Equal(t, int64(size+1), d.DictSize())
 	assert.Equal(t, int64(0), d.rehashIdx)
 	assert.Equal(t, DICT_HT_INITIAL_SIZE, d.HashTable[0].size)
 	assert.Equal(t, DICT_HT_INITIAL_SIZE*DICT_HT_GROW_RATIO, d.HashTable[1].size)
@@ -104,3 +105,75 @@ func TestRehash(t *testing.T) {
 	}
 
 }
+
+func TestDictIterator(t *testing.T) {
+	d := DictCreate(DictFunc{
+		HashFunc:  RedisStrHash,
+		EqualFunc: RedisStrEqual,
+	})
+	iter := d.DictGetSafeIterator()
+	assert.Nil(t, iter.DictNext())
+	iter.DictReleaseIterator()
+
+	size := 100
+	for i := 0; i < size; i++ {
+		d.DictAdd(CreateObject(REDISSTR, fmt.Sprintf("k%v", i)), CreateObject(REDISSTR, fmt.Sprintf("v%v", i)))
+	}
+
+	seen := make(map[string]bool)
+	iter = d.DictGetIterator()
+	for entry := iter.DictNext(); entry != nil; entry = iter.DictNext() {
+		seen[entry.Key.StrVal()] = true
+	}
+	iter.DictReleaseIterator()
+	assert.Equal(t, size, len(seen))
+
+	// delete entries while iterating with a safe iterator.
+	iter = d.DictGetSafeIterator()
+	for entry := iter.DictNext(); entry != nil; entry = iter.DictNext() {
+		assert.Equal(t, int64(1), d.iterators)
+		assert.Nil(t, d.DictDelete(entry.Key))
+	}
+	iter.DictReleaseIterator()
+	assert.Equal(t, int64(0), d.iterators)
+	assert.Equal(t, int64(0), d.DictSize())
+}
+
+func TestDictScan(t *testing.T) {
+	d := DictCreate(DictFunc{
+		HashFunc:  RedisStrHash,
+		EqualFunc: RedisStrEqual,
+	})
+	assert.Equal(t, uint64(0), d.DictScan(0, func(entry *DictEntry) {}))
+
+	size := 1000
+	for i := 0; i < size; i++ {
+		d.DictAdd(CreateObject(REDISSTR, fmt.Sprintf("k%v", i)), CreateObject(REDISSTR, fmt.Sprintf("v%v", i)))
+	}
+
+	// keep adding keys to the dict while scanning, so that the scan goes
+	// through rehashing and table growing.
+	seen := make(map[string]bool)
+	var cursor uint64
+	rehashed := false
+	i := size
+	for {
+		cursor = d.DictScan(cursor, func(entry *DictEntry) {
+			seen[entry.Key.StrVal()] = true
+		})
+		if d.DictIsRehashing() {
+			rehashed = true
+		}
+		for j := 0; j < 5; j++ {
+			d.DictAdd(CreateObject(REDISSTR, fmt.Sprintf("k%v", i)), CreateObject(REDISSTR, fmt.Sprintf("v%v", i)))
+			i++
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	assert.True(t, rehashed)
+	for i := 0; i < size; i++ {
+		assert.True(t, seen[fmt.Sprintf("k%v", i)])
+	}
+}
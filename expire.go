@@ -0,0 +1,269 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	CRON_DBS_PER_CALL                   int   = 16 // dbs checked in each cycle.
+	ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP   int64 = 20 // keys sampled in each round.
+	ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC  int   = 25 // max % of cpu time used by a cycle.
+	ACTIVE_EXPIRE_CYCLE_ACCEPTABLE_PERC int64 = 25 // max % of expired keys in a round to stop.
+)
+
+// activeExpireCycle delete the expired keys which are never accessed again.
+// The keys with an expire are sampled in rounds of
+// ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP, and another round is done as long as
+// more than ACTIVE_EXPIRE_CYCLE_ACCEPTABLE_PERC percent of the sampled keys
+// were expired, until the time budget of the cycle is used up. The expire
+// dict is sampled with DictScan, each db remembers its cursor and the server
+// remembers the db, so the next cycle resumes where the previous one stopped.
+func activeExpireCycle() {
+	start := time.Now()
+	timelimit := time.Duration(1000000*ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC/server.hz/100) * time.Microsecond
+	var totalSampled, totalExpired int64
+
+	dbsPerCall := CRON_DBS_PER_CALL
+	if dbsPerCall > server.dbnum {
+		dbsPerCall = server.dbnum
+	}
+	timelimitExit := false
+	for j := 0; j < dbsPerCall && !timelimitExit; j++ {
+		db := server.db[server.currentDb%server.dbnum]
+		server.currentDb++
+		sampled, expired := activeExpireCycleDb(db, start, timelimit)
+		totalSampled += sampled
+		totalExpired += expired
+		if time.Since(start) > timelimit {
+			timelimitExit = true
+			server.statExpiredTimeCapReachedCount++
+		}
+	}
+
+	var currentPerc float64
+	if totalSampled > 0 {
+		currentPerc = float64(totalExpired) / float64(totalSampled)
+	}
+	server.statExpiredStalePerc = currentPerc*0.05 + server.statExpiredStalePerc*0.95
+}
+
+// activeExpireCycleDb run the expire rounds on db until the time budget is
+// used up, and return the number of sampled and expired keys.
+func activeExpireCycleDb(db *RedisDB, start time.Time, timelimit time.Duration) (totalSampled, totalExpired int64) {
+	for {
+		num := db.expire.DictSize()
+		if num == 0 {
+			break
+		}
+		if num > ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP {
+			num = ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP
+		}
+
+		// collect the samples first, as the dict must not be modified
+		// while scanning. Scanning stops after visiting too many empty
+		// buckets, to bound the time of a round on sparse tables.
+		type sample struct {
+			key  *RedisObj
+			when int64
+		}
+		var samples []sample
+		maxBuckets := num * 20
+		for checked := int64(0); int64(len(samples)) < num && checked < maxBuckets; checked++ {
+			db.expiresCursor = db.expire.DictScan(db.expiresCursor, func(entry *DictEntry) {
+				entry.Key.IncrRefCount()
+				samples = append(samples, sample{entry.Key, entry.Val.IntVal()})
+			})
+			if db.expiresCursor == 0 {
+				break
+			}
+		}
+
+		var expired int64
+		now := GetMsTime()
+		for _, s := range samples {
+			// the same key may be sampled twice during rehashing.
+			if s.when <= now && db.expire.DictFind(s.key) != nil {
+				db.expire.DictDelete(s.key)
+				db.data.DictDelete(s.key)
+				server.statExpiredKeys++
+				expired++
+			}
+			s.key.DecrRefCount()
+		}
+		totalSampled += int64(len(samples))
+		totalExpired += expired
+
+		if time.Since(start) > timelimit {
+			break
+		}
+		if len(samples) == 0 || expired*100/int64(len(samples)) <= ACTIVE_EXPIRE_CYCLE_ACCEPTABLE_PERC {
+			break
+		}
+	}
+	return
+}
+
+// flags of the expire family commands.
+const (
+	EXPIRE_NX int = 1 << 0 // set expiry only when the key has no expiry.
+	EXPIRE_XX int = 1 << 1 // set expiry only when the key has an expiry.
+	EXPIRE_GT int = 1 << 2 // set expiry only when the new expiry is greater than current one.
+	EXPIRE_LT int = 1 << 3 // set expiry only when the new expiry is less than current one.
+)
+
+// parseExtendedExpireArgumentsOrReply parse the NX, XX, GT and LT options
+// starting from c.args[3].
+func parseExtendedExpireArgumentsOrReply(c *RedisClient) (int, bool) {
+	flags := 0
+	for _, arg := range c.args[3:] {
+		switch strings.ToLower(arg.StrVal()) {
+		case "nx":
+			flags |= EXPIRE_NX
+		case "xx":
+			flags |= EXPIRE_XX
+		case "gt":
+			flags |= EXPIRE_GT
+		case "lt":
+			flags |= EXPIRE_LT
+		default:
+			c.AddReplyErrorFormat("Unsupported option %s", arg.StrVal())
+			return 0, false
+		}
+	}
+	if flags&EXPIRE_NX != 0 && flags&(EXPIRE_XX|EXPIRE_GT|EXPIRE_LT) != 0 {
+		c.AddReplyError("NX and XX, GT or LT options at the same time are not compatible")
+		return 0, false
+	}
+	if flags&EXPIRE_GT != 0 && flags&EXPIRE_LT != 0 {
+		c.AddReplyError("GT and LT options at the same time are not compatible")
+		return 0, false
+	}
+	return flags, true
+}
+
+// expireGenericCommand implement EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT.
+// basetime is 0 for the *AT variants, and unit is the unit of the argument.
+func expireGenericCommand(c *RedisClient, basetime int64, unit int) {
+	key := c.args[1]
+	flags, ok := parseExtendedExpireArgumentsOrReply(c)
+	if !ok {
+		return
+	}
+	when, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	// the expire time must not overflow once converted to an absolute ms time.
+	if unit == UNIT_SECONDS {
+		if when > math.MaxInt64/1000 || when < math.MinInt64/1000 {
+			c.AddReplyErrorFormat("invalid expire time in '%s' command", c.args[0].StrVal())
+			return
+		}
+		when *= 1000
+	}
+	if when > math.MaxInt64-basetime {
+		c.AddReplyErrorFormat("invalid expire time in '%s' command", c.args[0].StrVal())
+		return
+	}
+	when += basetime
+
+	if lookupKeyWrite(c.db, key) == nil {
+		c.AddReply(shared.czero)
+		return
+	}
+
+	if flags != 0 {
+		current := getExpire(c.db, key)
+		// a key without ttl is treated as an infinite ttl in GT and LT.
+		if (flags&EXPIRE_NX != 0 && current != -1) ||
+			(flags&EXPIRE_XX != 0 && current == -1) ||
+			(flags&EXPIRE_GT != 0 && (current == -1 || when <= current)) ||
+			(flags&EXPIRE_LT != 0 && current != -1 && when >= current) {
+			c.AddReply(shared.czero)
+			return
+		}
+	}
+
+	if when <= GetMsTime() {
+		// negative or past time deletes the key at once.
+		dbDelete(c.db, key)
+	} else {
+		setExpire(c.db, key, when)
+	}
+	c.AddReply(shared.cone)
+}
+
+// expireCommand implement EXPIRE key seconds [NX|XX|GT|LT]
+func expireCommand(c *RedisClient) {
+	expireGenericCommand(c, GetMsTime(), UNIT_SECONDS)
+}
+
+func pexpireCommand(c *RedisClient) {
+	expireGenericCommand(c, GetMsTime(), UNIT_MILLISECONDS)
+}
+
+func expireatCommand(c *RedisClient) {
+	expireGenericCommand(c, 0, UNIT_SECONDS)
+}
+
+func pexpireatCommand(c *RedisClient) {
+	expireGenericCommand(c, 0, UNIT_MILLISECONDS)
+}
+
+// ttlGenericCommand reply -2 if the key doesn't exist, -1 if the key has no
+// ttl, otherwise the remaining ttl or the absolute expire time in the unit.
+func ttlGenericCommand(c *RedisClient, outputMs bool, outputAbs bool) {
+	key := c.args[1]
+	if lookupKeyRead(c.db, key) == nil {
+		c.AddReplyInt(-2)
+		return
+	}
+	expire := getExpire(c.db, key)
+	if expire == -1 {
+		c.AddReplyInt(-1)
+		return
+	}
+	ttl := expire
+	if !outputAbs {
+		ttl = expire - GetMsTime()
+		if ttl < 0 {
+			ttl = 0
+		}
+	}
+	if outputMs {
+		c.AddReplyInt(ttl)
+	} else {
+		c.AddReplyInt((ttl + 500) / 1000)
+	}
+}
+
+func ttlCommand(c *RedisClient) {
+	ttlGenericCommand(c, false, false)
+}
+
+func pttlCommand(c *RedisClient) {
+	ttlGenericCommand(c, true, false)
+}
+
+func expiretimeCommand(c *RedisClient) {
+	ttlGenericCommand(c, false, true)
+}
+
+func pexpiretimeCommand(c *RedisClient) {
+	ttlGenericCommand(c, true, true)
+}
+
+func persistCommand(c *RedisClient) {
+	key := c.args[1]
+	if lookupKeyWrite(c.db, key) == nil {
+		c.AddReply(shared.czero)
+		return
+	}
+	if removeExpire(c.db, key) {
+		c.AddReply(shared.cone)
+	} else {
+		c.AddReply(shared.czero)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// replyInt parse an integer reply.
+func replyInt(reply string) int64 {
+	val, _ := strconv.ParseInt(strings.TrimSuffix(reply[1:], "\r\n"), 10, 64)
+	return val
+}
+
+func TestTtlCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":-2\r\n", execCommand(c, "ttl", "key"))
+	assert.Equal(t, ":-2\r\n", execCommand(c, "pttl", "key"))
+	execCommand(c, "set", "key", "val")
+	assert.Equal(t, ":-1\r\n", execCommand(c, "ttl", "key"))
+	assert.Equal(t, ":-1\r\n", execCommand(c, "pexpiretime", "key"))
+
+	assert.Equal(t, ":1\r\n", execCommand(c, "expire", "key", "100"))
+	assert.Equal(t, ":100\r\n", execCommand(c, "ttl", "key"))
+	pttl := replyInt(execCommand(c, "pttl", "key"))
+	assert.True(t, pttl > 99000 && pttl <= 100000)
+
+	at := GetMsTime()/1000 + 1000
+	assert.Equal(t, ":1\r\n", execCommand(c, "expireat", "key", strconv.FormatInt(at, 10)))
+	assert.Equal(t, ":"+strconv.FormatInt(at, 10)+"\r\n", execCommand(c, "expiretime", "key"))
+	assert.Equal(t, ":"+strconv.FormatInt(at*1000, 10)+"\r\n", execCommand(c, "pexpiretime", "key"))
+
+	assert.Equal(t, ":1\r\n", execCommand(c, "pexpireat", "key", strconv.FormatInt(at*1000+1, 10)))
+	assert.Equal(t, ":"+strconv.FormatInt(at*1000+1, 10)+"\r\n", execCommand(c, "pexpiretime", "key"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "pexpire", "key", "100000"))
+	pttl = replyInt(execCommand(c, "pttl", "key"))
+	assert.True(t, pttl > 99000 && pttl <= 100000)
+
+	assert.Equal(t, ":1\r\n", execCommand(c, "persist", "key"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "persist", "key"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "persist", "nokey"))
+	assert.Equal(t, ":-1\r\n", execCommand(c, "ttl", "key"))
+}
+
+func TestExpirePastTime(t *testing.T) {
+	c := testClient()
+	execCommand(c, "mset", "k1", "v", "k2", "v", "k3", "v")
+	assert.Equal(t, ":1\r\n", execCommand(c, "expire", "k1", "-1"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "pexpire", "k2", "0"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "expireat", "k3", "100"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "dbsize"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "expire", "k1", "100"))
+
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", execCommand(c, "expire", "k1", "a"))
+	assert.Equal(t, "-ERR invalid expire time in 'expire' command\r\n", execCommand(c, "expire", "k1", "9223372036854775807"))
+	assert.Equal(t, "-ERR invalid expire time in 'pexpire' command\r\n", execCommand(c, "pexpire", "k1", "9223372036854775807"))
+}
+
+func TestExpireFlags(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "key", "val")
+	assert.Equal(t, ":0\r\n", execCommand(c, "expire", "key", "100", "xx"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "expire", "key", "100", "gt"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "expire", "key", "100", "lt"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "expire", "key", "200", "nx"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "expire", "key", "200", "xx"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "expire", "key", "100", "gt"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "expire", "key", "300", "gt"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "expire", "key", "400", "lt"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "pexpire", "key", "100000", "XX", "LT"))
+	assert.Equal(t, ":100\r\n", execCommand(c, "ttl", "key"))
+	execCommand(c, "persist", "key")
+	assert.Equal(t, ":1\r\n", execCommand(c, "pexpireat", "key", "9999999999999", "nx"))
+
+	assert.Equal(t, "-ERR NX and XX, GT or LT options at the same time are not compatible\r\n",
+		execCommand(c, "expire", "key", "100", "nx", "gt"))
+	assert.Equal(t, "-ERR GT and LT options at the same time are not compatible\r\n",
+		execCommand(c, "expire", "key", "100", "gt", "lt"))
+	assert.Equal(t, "-ERR Unsupported option foo\r\n", execCommand(c, "expire", "key", "100", "foo"))
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	c := testClient()
+	size := 1000
+	for i := 0; i < size; i++ {
+		key := CreateObject(REDISSTR, strconv.Itoa(i))
+		c.db.data.DictSet(key, CreateObject(REDISSTR, "v"))
+		if i%10 == 0 {
+			// keep some keys with a long ttl.
+			setExpire(c.db, key, GetMsTime()+100000)
+		} else {
+			setExpire(c.db, key, GetMsTime()-1)
+		}
+	}
+
+	// the cycle keeps going while most of the sampled keys are expired.
+	activeExpireCycle()
+	assert.True(t, c.db.data.DictSize() < int64(size/2))
+	for i := 0; i < 100 && c.db.data.DictSize() > int64(size/10); i++ {
+		activeExpireCycle()
+	}
+	assert.Equal(t, int64(size/10), c.db.data.DictSize())
+	assert.Equal(t, int64(size/10), c.db.expire.DictSize())
+	assert.Equal(t, int64(size-size/10), server.statExpiredKeys)
+	assert.True(t, server.statExpiredStalePerc > 0)
+
+	info := execCommand(c, "info", "stats")
+	assert.Contains(t, info, "expired_keys:900\r\n")
+	assert.Contains(t, info, "expired_time_cap_reached_count:0\r\n")
+}
+
+func TestActiveExpireTimeCap(t *testing.T) {
+	c := testClient()
+	for i := 0; i < 1000; i++ {
+		key := CreateObject(REDISSTR, strconv.Itoa(i))
+		c.db.data.DictSet(key, CreateObject(REDISSTR, "v"))
+		setExpire(c.db, key, GetMsTime()-1)
+	}
+	// a huge hz leaves no time budget, so the cycle stops after one round.
+	server.hz = 1000000000
+	activeExpireCycle()
+	assert.Equal(t, int64(1), server.statExpiredTimeCapReachedCount)
+	assert.True(t, c.db.data.DictSize() <= 1000-ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP)
+	assert.True(t, c.db.data.DictSize() > 900)
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A geo set is a zset whose scores are the 52 bits geohashes of the
+// positions of the members, so the members in a cell are a score range.
+// GEOSEARCH scans the cell of the center of the search and its 8 neighbors,
+// with cells large enough to cover the search area, and filters the
+// members by their distance.
+
+// the orders of the results of GEOSEARCH.
+const (
+	SORT_NONE = 0
+	SORT_ASC  = 1
+	SORT_DESC = 2
+)
+
+const geoAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geoPoint is a member found by GEOSEARCH.
+type geoPoint struct {
+	longitude float64
+	latitude  float64
+	dist      float64
+	score     float64
+	member    *RedisObj
+}
+
+// extractLongLatOrReply parse the longitude and latitude at args[0] and
+// args[1].
+func extractLongLatOrReply(c *RedisClient, args []*RedisObj) ([2]float64, bool) {
+	var xy [2]float64
+	for i := 0; i < 2; i++ {
+		var ok bool
+		if xy[i], ok = getLongDoubleFromObjectOrReply(c, args[i], ""); !ok {
+			return xy, false
+		}
+	}
+	if xy[0] < GEO_LONG_MIN || xy[0] > GEO_LONG_MAX || xy[1] < GEO_LAT_MIN || xy[1] > GEO_LAT_MAX {
+		c.AddReplyErrorFormat("invalid longitude,latitude pair %f,%f", xy[0], xy[1])
+		return xy, false
+	}
+	return xy, true
+}
+
+// decodeGeohash return the longitude and latitude of a score.
+func decodeGeohash(score float64) [2]float64 {
+	return geohashDecodeToLongLatWGS84(GeoHashBits{bits: uint64(score), step: GEO_STEP_MAX})
+}
+
+// longLatFromMember return the position of member of the geo set zobj, ok
+// is false if it is not a member.
+func longLatFromMember(zobj *RedisObj, member *RedisObj) ([2]float64, bool) {
+	score, ok := zsetScore(zobj, member)
+	if !ok {
+		return [2]float64{}, false
+	}
+	return decodeGeohash(score), true
+}
+
+// extractUnitOrReply return the meters of the unit of distance.
+func extractUnitOrReply(c *RedisClient, unit *RedisObj) (float64, bool) {
+	switch strings.ToLower(unit.StrVal()) {
+	case "m":
+		return 1, true
+	case "km":
+		return 1000, true
+	case "ft":
+		return 0.3048, true
+	case "mi":
+		return 1609.34, true
+	}
+	c.AddReplyError("unsupported unit provided. please use M, KM, FT, MI")
+	return 0, false
+}
+
+// extractDistanceOrReply parse the radius and unit at args[0] and args[1].
+func extractDistanceOrReply(c *RedisClient, args []*RedisObj) (radius, conversion float64, ok bool) {
+	if radius, ok = getLongDoubleFromObjectOrReply(c, args[0], "need numeric radius"); !ok {
+		return
+	}
+	if radius < 0 {
+		c.AddReplyError("radius cannot be negative")
+		return 0, 0, false
+	}
+	conversion, ok = extractUnitOrReply(c, args[1])
+	return
+}
+
+// extractBoxOrReply parse the width, height and unit at args[0] to
+// args[2].
+func extractBoxOrReply(c *RedisClient, args []*RedisObj) (width, height, conversion float64, ok bool) {
+	if width, ok = getLongDoubleFromObjectOrReply(c, args[0], "need numeric width"); !ok {
+		return
+	}
+	if height, ok = getLongDoubleFromObjectOrReply(c, args[1], "need numeric height"); !ok {
+		return
+	}
+	if width < 0 || height < 0 {
+		c.AddReplyError("height or width cannot be negative")
+		return 0, 0, 0, false
+	}
+	conversion, ok = extractUnitOrReply(c, args[2])
+	return
+}
+
+// geoWithinShape return the distance of the point from the center of
+// shape, ok is false if the point is out of shape.
+func geoWithinShape(shape *GeoShape, xy [2]float64) (float64, bool) {
+	if shape.shapeType == CIRCULAR_TYPE {
+		return geohashGetDistanceIfInRadius(shape.xy[0], shape.xy[1], xy[0], xy[1], shape.radius*shape.conversion)
+	}
+	return geohashGetDistanceIfInRectangle(shape.width*shape.conversion, shape.height*shape.conversion,
+		shape.xy[0], shape.xy[1], xy[0], xy[1])
+}
+
+// geoGetPointsInRange append to points the members of zobj with a score in
+// [min, max) that are in shape, until there are limit points if limit is
+// not 0.
+func geoGetPointsInRange(zobj *RedisObj, min, max float64, shape *GeoShape, points []geoPoint, limit int) []geoPoint {
+	spec := ZRangeSpec{min: min, max: max, maxex: true}
+	zsl := zobj.Val_.(*zset).zsl
+	for ln := zsl.ZslFirstInRange(&spec); ln != nil && zslValueLteMax(ln.score, &spec); ln = ln.level[0].forward {
+		if limit > 0 && len(points) >= limit {
+			break
+		}
+		xy := decodeGeohash(ln.score)
+		dist, ok := geoWithinShape(shape, xy)
+		if !ok {
+			continue
+		}
+		points = append(points, geoPoint{longitude: xy[0], latitude: xy[1], dist: dist, score: ln.score, member: ln.ele})
+	}
+	return points
+}
+
+// membersOfAllNeighbors return the members of zobj in shape, up to limit
+// members if limit is not 0.
+func membersOfAllNeighbors(zobj *RedisObj, shape *GeoShape, limit int) []geoPoint {
+	n := geohashCalculateAreasByShapeWGS84(shape)
+	cells := []GeoHashBits{n.hash, n.neighbors.north, n.neighbors.south, n.neighbors.east,
+		n.neighbors.west, n.neighbors.northEast, n.neighbors.northWest, n.neighbors.southEast,
+		n.neighbors.southWest}
+	var points []geoPoint
+	lastProcessed := -1
+	for i, cell := range cells {
+		if cell.isZero() {
+			continue
+		}
+		// with a huge radius the neighbors may be the same cell, the
+		// members would be found twice.
+		if lastProcessed >= 0 && cell == cells[lastProcessed] {
+			continue
+		}
+		if limit > 0 && len(points) >= limit {
+			break
+		}
+		// the scores of the cell are the ones starting with its bits.
+		min := float64(geohashAlign52Bits(cell))
+		cell.bits++
+		max := float64(geohashAlign52Bits(cell))
+		points = geoGetPointsInRange(zobj, min, max, shape, points, limit)
+		lastProcessed = i
+	}
+	return points
+}
+
+// geoaddCommand implement GEOADD key [NX|XX] [CH] longitude latitude member
+// [longitude latitude member ...]
+func geoaddCommand(c *RedisClient) {
+	flags := ZADD_IN_NONE
+	ch := false
+	longidx := 2
+	for ; longidx < len(c.args); longidx++ {
+		opt := strings.ToLower(c.args[longidx].StrVal())
+		if opt == "nx" {
+			flags |= ZADD_IN_NX
+		} else if opt == "xx" {
+			flags |= ZADD_IN_XX
+		} else if opt == "ch" {
+			ch = true
+		} else {
+			break
+		}
+	}
+	elements := len(c.args) - longidx
+	if elements%3 != 0 || elements == 0 || (flags&ZADD_IN_NX != 0 && flags&ZADD_IN_XX != 0) {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	elements /= 3
+
+	// parse all the positions first, so the command is either fully
+	// executed or not at all.
+	scores := make([]float64, elements)
+	for i := 0; i < elements; i++ {
+		xy, ok := extractLongLatOrReply(c, c.args[longidx+i*3:])
+		if !ok {
+			return
+		}
+		hash, _ := geohashEncodeWGS84(xy[0], xy[1], GEO_STEP_MAX)
+		scores[i] = float64(geohashAlign52Bits(hash))
+	}
+
+	key := c.args[1]
+	zobj := lookupKeyWrite(c.db, key)
+	if zobj != nil && checkType(c, zobj, REDISZSET) {
+		return
+	}
+	if zobj == nil {
+		if flags&ZADD_IN_XX != 0 {
+			c.AddReply(shared.czero)
+			return
+		}
+		zobj = createZsetObject()
+		dbAdd(c.db, key, zobj)
+		zobj.DecrRefCount()
+	}
+	var added, updated int64
+	for i := 0; i < elements; i++ {
+		outFlags, _ := zsetAdd(zobj, scores[i], c.args[longidx+i*3+2], flags)
+		if outFlags&ZADD_OUT_ADDED != 0 {
+			added++
+		}
+		if outFlags&ZADD_OUT_UPDATED != 0 {
+			updated++
+		}
+	}
+	if ch {
+		c.AddReplyInt(added + updated)
+	} else {
+		c.AddReplyInt(added)
+	}
+}
+
+// addReplyLongLat reply a position as an array of longitude and latitude.
+func addReplyLongLat(c *RedisClient, xy [2]float64) {
+	c.AddReplyArrayLen(2)
+	c.AddReplyBulkStr(humanDoubleString(xy[0]))
+	c.AddReplyBulkStr(humanDoubleString(xy[1]))
+}
+
+// addReplyDistance reply a distance in the unit of conversion meters.
+func addReplyDistance(c *RedisClient, dist, conversion float64) {
+	c.AddReplyBulkStr(fmt.Sprintf("%.4f", dist/conversion))
+}
+
+// geoposCommand implement GEOPOS key [member ...]
+func geoposCommand(c *RedisClient) {
+	zobj := lookupKeyRead(c.db, c.args[1])
+	if zobj != nil && checkType(c, zobj, REDISZSET) {
+		return
+	}
+	c.AddReplyArrayLen(len(c.args) - 2)
+	for _, member := range c.args[2:] {
+		var xy [2]float64
+		ok := false
+		if zobj != nil {
+			xy, ok = longLatFromMember(zobj, member)
+		}
+		if !ok {
+			c.AddReply(shared.nullArray)
+			continue
+		}
+		addReplyLongLat(c, xy)
+	}
+}
+
+// geodistCommand implement GEODIST key member1 member2 [M|KM|FT|MI]
+func geodistCommand(c *RedisClient) {
+	conversion := 1.0
+	if len(c.args) == 5 {
+		var ok bool
+		if conversion, ok = extractUnitOrReply(c, c.args[4]); !ok {
+			return
+		}
+	} else if len(c.args) > 5 {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	zobj := lookupKeyReadOrReply(c, c.args[1], shared.nullBulk)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	xy1, ok1 := longLatFromMember(zobj, c.args[2])
+	xy2, ok2 := longLatFromMember(zobj, c.args[3])
+	if !ok1 || !ok2 {
+		c.AddReply(shared.nullBulk)
+		return
+	}
+	addReplyDistance(c, geohashGetDistance(xy1[0], xy1[1], xy2[0], xy2[1]), conversion)
+}
+
+// geohashCommand implement GEOHASH key [member ...], the hashes are the
+// standard 11 characters geohashes, with latitudes from -90 to 90 rather
+// than the limits of the index.
+func geohashCommand(c *RedisClient) {
+	zobj := lookupKeyRead(c.db, c.args[1])
+	if zobj != nil && checkType(c, zobj, REDISZSET) {
+		return
+	}
+	c.AddReplyArrayLen(len(c.args) - 2)
+	for _, member := range c.args[2:] {
+		var xy [2]float64
+		ok := false
+		if zobj != nil {
+			xy, ok = longLatFromMember(zobj, member)
+		}
+		if !ok {
+			c.AddReplyNullBulk()
+			continue
+		}
+		hash, _ := geohashEncode(GeoHashRange{-180, 180}, GeoHashRange{-90, 90}, xy[0], xy[1], GEO_STEP_MAX)
+		buf := make([]byte, 11)
+		for i := range buf {
+			// the last character has only 2 bits, it is always 0.
+			idx := 0
+			if i < 10 {
+				idx = int(hash.bits>>(52-uint(i+1)*5)) & 0x1f
+			}
+			buf[i] = geoAlphabet[idx]
+		}
+		c.AddReplyBulkStr(string(buf))
+	}
+}
+
+// geosearchGenericCommand implement GEOSEARCH, and GEOSEARCHSTORE if store
+// is true.
+//
+// GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count [ANY]]
+// [WITHCOORD] [WITHDIST] [WITHHASH]
+//
+// GEOSEARCHSTORE destination source ... [STOREDIST]
+func geosearchGenericCommand(c *RedisClient, store bool) {
+	keyidx := 1
+	if store {
+		keyidx = 2
+	}
+	zobj := lookupKeyRead(c.db, c.args[keyidx])
+	if zobj != nil && checkType(c, zobj, REDISZSET) {
+		return
+	}
+
+	var shape GeoShape
+	var withdist, withhash, withcoords, storedist, any bool
+	var frommember, fromloc, byradius, bybox bool
+	sortOrder := SORT_NONE
+	var count int64
+	args := c.args[keyidx+1:]
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch arg := strings.ToLower(args[i].StrVal()); {
+		case arg == "withdist":
+			withdist = true
+		case arg == "withhash":
+			withhash = true
+		case arg == "withcoord":
+			withcoords = true
+		case arg == "any":
+			any = true
+		case arg == "asc":
+			sortOrder = SORT_ASC
+		case arg == "desc":
+			sortOrder = SORT_DESC
+		case arg == "count" && remaining >= 1:
+			var ok bool
+			if count, ok = getLongLongFromObjectOrReply(c, args[i+1], ""); !ok {
+				return
+			}
+			if count <= 0 {
+				c.AddReplyError("COUNT must be > 0")
+				return
+			}
+			i++
+		case arg == "frommember" && remaining >= 1 && !fromloc:
+			var ok bool
+			if zobj != nil {
+				shape.xy, ok = longLatFromMember(zobj, args[i+1])
+			}
+			if !ok {
+				c.AddReplyError("could not decode requested zset member")
+				return
+			}
+			frommember = true
+			i++
+		case arg == "fromlonlat" && remaining >= 2:
+			var ok bool
+			if shape.xy, ok = extractLongLatOrReply(c, args[i+1:]); !ok {
+				return
+			}
+			fromloc = true
+			i += 2
+		case arg == "byradius" && remaining >= 2:
+			var ok bool
+			if shape.radius, shape.conversion, ok = extractDistanceOrReply(c, args[i+1:]); !ok {
+				return
+			}
+			shape.shapeType = CIRCULAR_TYPE
+			byradius = true
+			i += 2
+		case arg == "bybox" && remaining >= 3:
+			var ok bool
+			if shape.width, shape.height, shape.conversion, ok = extractBoxOrReply(c, args[i+1:]); !ok {
+				return
+			}
+			shape.shapeType = RECTANGLE_TYPE
+			bybox = true
+			i += 3
+		case arg == "storedist" && store:
+			storedist = true
+		default:
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+	if frommember == fromloc {
+		c.AddReplyErrorFormat("exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", c.args[0].StrVal())
+		return
+	}
+	if byradius == bybox {
+		c.AddReplyErrorFormat("exactly one of BYRADIUS and BYBOX can be specified for %s", c.args[0].StrVal())
+		return
+	}
+	if any && count == 0 {
+		c.AddReplyError("the ANY argument requires COUNT argument")
+		return
+	}
+	if store && (withdist || withhash || withcoords) {
+		c.AddReplyError("GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+		return
+	}
+
+	// a missing source is an empty geo set.
+	if zobj == nil {
+		if store {
+			dbDelete(c.db, c.args[1])
+			c.AddReply(shared.czero)
+		} else {
+			c.AddReply(shared.emptyArray)
+		}
+		return
+	}
+
+	// the closest members can't be known without sorting them, unless any
+	// of them is enough.
+	if count != 0 && sortOrder == SORT_NONE && !any {
+		sortOrder = SORT_ASC
+	}
+	limit := 0
+	if any {
+		limit = int(count)
+	}
+	points := membersOfAllNeighbors(zobj, &shape, limit)
+	if sortOrder == SORT_ASC {
+		sortGeoPoints(points, false)
+	} else if sortOrder == SORT_DESC {
+		sortGeoPoints(points, true)
+	}
+	if count > 0 && int64(len(points)) > count {
+		points = points[:count]
+	}
+
+	if store {
+		geosearchStore(c, points, storedist, shape.conversion)
+		return
+	}
+	options := 0
+	for _, with := range []bool{withdist, withhash, withcoords} {
+		if with {
+			options++
+		}
+	}
+	c.AddReplyArrayLen(len(points))
+	for _, p := range points {
+		if options == 0 {
+			c.AddReplyBulk(p.member)
+			continue
+		}
+		c.AddReplyArrayLen(options + 1)
+		c.AddReplyBulk(p.member)
+		if withdist {
+			addReplyDistance(c, p.dist, shape.conversion)
+		}
+		if withhash {
+			c.AddReplyInt(int64(p.score))
+		}
+		if withcoords {
+			addReplyLongLat(c, [2]float64{p.longitude, p.latitude})
+		}
+	}
+}
+
+// sortGeoPoints sort the points by distance.
+func sortGeoPoints(points []geoPoint, desc bool) {
+	sort.Slice(points, func(i, j int) bool {
+		if desc {
+			return points[i].dist > points[j].dist
+		}
+		return points[i].dist < points[j].dist
+	})
+}
+
+// geosearchStore store the points found by GEOSEARCHSTORE as a geo set, or
+// as a zset of the distances if storedist is true.
+func geosearchStore(c *RedisClient, points []geoPoint, storedist bool, conversion float64) {
+	dest := c.args[1]
+	if len(points) == 0 {
+		dbDelete(c.db, dest)
+		c.AddReply(shared.czero)
+		return
+	}
+	zobj := createZsetObject()
+	for _, p := range points {
+		score := p.score
+		if storedist {
+			score = p.dist / conversion
+		}
+		zsetAdd(zobj, score, p.member, ZADD_IN_NONE)
+	}
+	setKey(c.db, dest, zobj, false)
+	zobj.DecrRefCount()
+	c.AddReplyInt(int64(len(points)))
+}
+
+func geosearchCommand(c *RedisClient) {
+	geosearchGenericCommand(c, false)
+}
+
+func geosearchstoreCommand(c *RedisClient) {
+	geosearchGenericCommand(c, true)
+}
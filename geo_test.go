@@ -0,0 +1,150 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// sicily is the geo set of the examples of the Redis documentation.
+func sicily(c *RedisClient) {
+	execCommand(c, "geoadd", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")
+}
+
+func TestGeoaddCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":2\r\n", execCommand(c, "geoadd", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"))
+	assert.Equal(t, "+zset\r\n", execCommand(c, "type", "Sicily"))
+	assert.Equal(t, "$16\r\n3479099956230698\r\n", execCommand(c, "zscore", "Sicily", "Palermo"))
+	assert.Equal(t, "$16\r\n3479447370796909\r\n", execCommand(c, "zscore", "Sicily", "Catania"))
+
+	assert.Equal(t, ":0\r\n", execCommand(c, "geoadd", "Sicily", "13.361389", "38.115556", "Palermo"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "geoadd", "Sicily", "ch", "13.5", "38.1", "Palermo"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "geoadd", "Sicily", "nx", "13.361389", "38.115556", "Palermo"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "geoadd", "Sicily", "xx", "13.361389", "38.115556", "Enna"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "geoadd", "nokey", "xx", "13.361389", "38.115556", "Enna"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "nokey"))
+
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "geoadd", "Sicily", "nx", "13.361389", "38.115556"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "geoadd", "Sicily", "nx", "xx", "13.361389", "38.115556", "Palermo"))
+	assert.Equal(t, "-ERR invalid longitude,latitude pair 13.361389,86.000000\r\n", execCommand(c, "geoadd", "Sicily", "13.361389", "86", "North"))
+	assert.Equal(t, "-ERR value is not a valid float\r\n", execCommand(c, "geoadd", "Sicily", "a", "38", "A"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "zcard", "Sicily"))
+	execCommand(c, "set", "str", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "geoadd", "str", "13.361389", "38.115556", "Palermo"))
+}
+
+func TestGeoposGeodistGeohashCmd(t *testing.T) {
+	c := testClient()
+	sicily(c)
+	assert.Equal(t, "*3\r\n*2\r\n$20\r\n13.36138933897018433\r\n$20\r\n38.11555639549629859\r\n"+
+		"*2\r\n$20\r\n15.08726745843887329\r\n$20\r\n37.50266842333162032\r\n*-1\r\n",
+		execCommand(c, "geopos", "Sicily", "Palermo", "Catania", "NonExisting"))
+	assert.Equal(t, "*1\r\n*-1\r\n", execCommand(c, "geopos", "nokey", "Palermo"))
+
+	assert.Equal(t, "$11\r\n166274.1516\r\n", execCommand(c, "geodist", "Sicily", "Palermo", "Catania"))
+	assert.Equal(t, "$8\r\n166.2742\r\n", execCommand(c, "geodist", "Sicily", "Palermo", "Catania", "km"))
+	assert.Equal(t, "$8\r\n103.3182\r\n", execCommand(c, "geodist", "Sicily", "Palermo", "Catania", "MI"))
+	assert.Equal(t, "$6\r\n0.0000\r\n", execCommand(c, "geodist", "Sicily", "Palermo", "Palermo"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "geodist", "Sicily", "Foo", "Bar"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "geodist", "nokey", "Foo", "Bar"))
+	assert.Equal(t, "-ERR unsupported unit provided. please use M, KM, FT, MI\r\n", execCommand(c, "geodist", "Sicily", "Palermo", "Catania", "yd"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "geodist", "Sicily", "Palermo", "Catania", "km", "km"))
+
+	assert.Equal(t, "*3\r\n$11\r\nsqc8b49rny0\r\n$11\r\nsqdtr74hyu0\r\n$-1\r\n", execCommand(c, "geohash", "Sicily", "Palermo", "Catania", "Enna"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "geohash", "Sicily"))
+}
+
+func TestGeosearchCmd(t *testing.T) {
+	c := testClient()
+	sicily(c)
+	assert.Equal(t, "*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n", execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "asc"))
+	assert.Equal(t, "*2\r\n$7\r\nPalermo\r\n$7\r\nCatania\r\n", execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "desc"))
+	assert.Equal(t, "*1\r\n$7\r\nCatania\r\n", execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "100", "km"))
+	assert.Equal(t, "*2\r\n*2\r\n$7\r\nCatania\r\n$7\r\n56.4413\r\n*2\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "withdist", "asc"))
+	assert.Equal(t, "*1\r\n*2\r\n$7\r\nCatania\r\n:3479447370796909\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "withhash", "count", "1"))
+
+	execCommand(c, "geoadd", "Sicily", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2")
+	assert.Equal(t, "*4\r\n"+
+		"*3\r\n$7\r\nCatania\r\n$7\r\n56.4413\r\n*2\r\n$20\r\n15.08726745843887329\r\n$20\r\n37.50266842333162032\r\n"+
+		"*3\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n*2\r\n$20\r\n13.36138933897018433\r\n$20\r\n38.11555639549629859\r\n"+
+		"*3\r\n$5\r\nedge2\r\n$8\r\n279.7403\r\n*2\r\n$20\r\n17.24151045083999634\r\n$20\r\n38.78813451624225195\r\n"+
+		"*3\r\n$5\r\nedge1\r\n$8\r\n279.7405\r\n*2\r\n$19\r\n12.7584877610206604\r\n$20\r\n38.78813451624225195\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "bybox", "400", "400", "km", "asc", "withcoord", "withdist"))
+	assert.Equal(t, "*3\r\n$7\r\nPalermo\r\n$5\r\nedge1\r\n$7\r\nCatania\r\n", execCommand(c, "geosearch", "Sicily", "frommember", "Palermo", "byradius", "170", "km", "asc"))
+	assert.Equal(t, "*1\r\n$7\r\nPalermo\r\n", execCommand(c, "geosearch", "Sicily", "frommember", "Palermo", "bybox", "100", "100", "km"))
+
+	// ANY stops at the first members found, in any order.
+	reply := execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "bybox", "400", "400", "km", "count", "2", "any")
+	assert.Equal(t, "*2\r\n", reply[:4])
+
+	assert.Equal(t, "*0\r\n", execCommand(c, "geosearch", "nokey", "fromlonlat", "15", "37", "byradius", "200", "km"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "geosearch", "Sicily", "fromlonlat", "-15", "-37", "byradius", "200", "km"))
+}
+
+func TestGeosearchErrors(t *testing.T) {
+	c := testClient()
+	sicily(c)
+	assert.Equal(t, "-ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for geosearch\r\n",
+		execCommand(c, "geosearch", "Sicily", "byradius", "200", "km", "asc", "withdist"))
+	assert.Equal(t, "-ERR syntax error\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "frommember", "Palermo", "byradius", "200", "km"))
+	assert.Equal(t, "-ERR exactly one of BYRADIUS and BYBOX can be specified for geosearch\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "bybox", "1", "1", "km"))
+	assert.Equal(t, "-ERR the ANY argument requires COUNT argument\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "any"))
+	assert.Equal(t, "-ERR COUNT must be > 0\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "count", "0"))
+	assert.Equal(t, "-ERR could not decode requested zset member\r\n",
+		execCommand(c, "geosearch", "Sicily", "frommember", "Enna", "byradius", "200", "km"))
+	assert.Equal(t, "-ERR radius cannot be negative\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "-1", "km"))
+	assert.Equal(t, "-ERR need numeric radius\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "a", "km"))
+	assert.Equal(t, "-ERR height or width cannot be negative\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "bybox", "1", "-1", "km"))
+	assert.Equal(t, "-ERR syntax error\r\n",
+		execCommand(c, "geosearch", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "storedist"))
+	assert.Equal(t, "-ERR GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options\r\n",
+		execCommand(c, "geosearchstore", "dst", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "withdist"))
+}
+
+func TestGeosearchstoreCmd(t *testing.T) {
+	c := testClient()
+	sicily(c)
+	assert.Equal(t, ":2\r\n", execCommand(c, "geosearchstore", "dst", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km"))
+	assert.Equal(t, execCommand(c, "geopos", "Sicily", "Palermo", "Catania"), execCommand(c, "geopos", "dst", "Palermo", "Catania"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "geosearchstore", "dst", "Sicily", "fromlonlat", "15", "37", "byradius", "200", "km", "count", "1", "storedist"))
+	assert.Equal(t, "*2\r\n$7\r\nCatania\r\n$16\r\n56.4412578701582\r\n", execCommand(c, "zrange", "dst", "0", "-1", "withscores"))
+
+	// the destination is deleted when nothing is found.
+	assert.Equal(t, ":0\r\n", execCommand(c, "geosearchstore", "dst", "Sicily", "fromlonlat", "-15", "-37", "byradius", "200", "km"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "dst"))
+	execCommand(c, "set", "dst", "v")
+	assert.Equal(t, ":0\r\n", execCommand(c, "geosearchstore", "dst", "nokey", "fromlonlat", "15", "37", "byradius", "200", "km"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "dst"))
+}
+
+func TestGeohashNeighbors(t *testing.T) {
+	hash, ok := geohashEncodeWGS84(13.361389, 38.115556, 10)
+	assert.True(t, ok)
+	area := geohashDecode(GeoHashRange{GEO_LONG_MIN, GEO_LONG_MAX}, GeoHashRange{GEO_LAT_MIN, GEO_LAT_MAX}, hash)
+	n := geohashNeighbors(hash)
+	// every neighbor shares an edge or a corner with the cell.
+	longRange, latRange := geohashGetCoordRange()
+	east := geohashDecode(longRange, latRange, n.east)
+	north := geohashDecode(longRange, latRange, n.north)
+	southWest := geohashDecode(longRange, latRange, n.southWest)
+	assert.InDelta(t, area.longitude.max, east.longitude.min, 1e-9)
+	assert.InDelta(t, area.latitude.min, east.latitude.min, 1e-9)
+	assert.InDelta(t, area.latitude.max, north.latitude.min, 1e-9)
+	assert.InDelta(t, area.longitude.min, southWest.longitude.max, 1e-9)
+	assert.InDelta(t, area.latitude.min, southWest.latitude.max, 1e-9)
+
+	_, ok = geohashEncodeWGS84(13, 86, 26)
+	assert.False(t, ok)
+	sep := deinterleave64(interleave64(0x9, 0x12345678))
+	assert.Equal(t, uint32(0x9), uint32(sep))
+	assert.Equal(t, uint32(0x12345678), uint32(sep>>32))
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"math"
+)
+
+// A geohash interleaves the bits of the latitude and the longitude, so that
+// close points share a prefix. The positions of a geo set are stored as
+// the 52 bits geohash of 26 steps, which is the score of the member and
+// makes the zset a score ordered index of the cells.
+
+const (
+	GEO_STEP_MAX = 26 // 26*2 = 52 bits.
+
+	// the limits of EPSG:900913 / EPSG:3785 / OSGEO:41001.
+	GEO_LAT_MIN  = -85.05112878
+	GEO_LAT_MAX  = 85.05112878
+	GEO_LONG_MIN = -180.0
+	GEO_LONG_MAX = 180.0
+
+	// the earth radius used by the distances, as in the haversine formula.
+	EARTH_RADIUS_IN_METERS = 6372797.560856
+	MERCATOR_MAX           = 20037726.37
+)
+
+type GeoHashBits struct {
+	bits uint64
+	step uint
+}
+
+type GeoHashRange struct {
+	min, max float64
+}
+
+type GeoHashArea struct {
+	hash      GeoHashBits
+	longitude GeoHashRange
+	latitude  GeoHashRange
+}
+
+type GeoHashNeighbors struct {
+	north, east, west, south                   GeoHashBits
+	northEast, southEast, northWest, southWest GeoHashBits
+}
+
+// GeoHashRadius is the cell of the center of a search, and its neighbors
+// covering the rest of the search area. The neighbors not needed to cover
+// it are zero.
+type GeoHashRadius struct {
+	hash      GeoHashBits
+	area      GeoHashArea
+	neighbors GeoHashNeighbors
+}
+
+// the shapes of GEOSEARCH.
+const (
+	CIRCULAR_TYPE  = 1
+	RECTANGLE_TYPE = 2
+)
+
+// GeoShape is the search area, the sizes are in the unit of conversion
+// meters.
+type GeoShape struct {
+	shapeType     int
+	xy            [2]float64 // the longitude and latitude of the center.
+	conversion    float64
+	radius        float64
+	width, height float64
+}
+
+func degRad(ang float64) float64 {
+	return ang * (math.Pi / 180.0)
+}
+
+func radDeg(ang float64) float64 {
+	return ang / (math.Pi / 180.0)
+}
+
+func (h GeoHashBits) isZero() bool {
+	return h.bits == 0 && h.step == 0
+}
+
+// interleave64 interleave the bits of xlo and ylo, xlo takes the even
+// positions and ylo the odd ones.
+func interleave64(xlo, ylo uint32) uint64 {
+	B := [...]uint64{0x5555555555555555, 0x3333333333333333, 0x0F0F0F0F0F0F0F0F,
+		0x00FF00FF00FF00FF, 0x0000FFFF0000FFFF}
+	S := [...]uint{1, 2, 4, 8, 16}
+	x, y := uint64(xlo), uint64(ylo)
+	for i := 4; i >= 0; i-- {
+		x = (x | (x << S[i])) & B[i]
+		y = (y | (y << S[i])) & B[i]
+	}
+	return x | (y << 1)
+}
+
+// deinterleave64 is the reverse of interleave64, the even bits are
+// returned in the low 32 bits and the odd ones in the high 32 bits.
+func deinterleave64(interleaved uint64) uint64 {
+	B := [...]uint64{0x5555555555555555, 0x3333333333333333, 0x0F0F0F0F0F0F0F0F,
+		0x00FF00FF00FF00FF, 0x0000FFFF0000FFFF, 0x00000000FFFFFFFF}
+	S := [...]uint{0, 1, 2, 4, 8, 16}
+	x := interleaved
+	y := interleaved >> 1
+	for i := 0; i < 6; i++ {
+		x = (x | (x >> S[i])) & B[i]
+		y = (y | (y >> S[i])) & B[i]
+	}
+	return x | (y << 32)
+}
+
+// geohashGetCoordRange return the ranges of the longitude and latitude
+// that can be indexed.
+func geohashGetCoordRange() (GeoHashRange, GeoHashRange) {
+	return GeoHashRange{GEO_LONG_MIN, GEO_LONG_MAX}, GeoHashRange{GEO_LAT_MIN, GEO_LAT_MAX}
+}
+
+// geohashEncode return the geohash of step*2 bits of the point in the
+// ranges, ok is false if the point is out of the ranges.
+func geohashEncode(longRange, latRange GeoHashRange, longitude, latitude float64, step uint) (GeoHashBits, bool) {
+	// the points out of the indexable limits are refused with any range.
+	if step > 32 || step == 0 ||
+		longitude > GEO_LONG_MAX || longitude < GEO_LONG_MIN ||
+		latitude > GEO_LAT_MAX || latitude < GEO_LAT_MIN {
+		return GeoHashBits{}, false
+	}
+	if latitude < latRange.min || latitude > latRange.max ||
+		longitude < longRange.min || longitude > longRange.max {
+		return GeoHashBits{}, false
+	}
+	latOffset := (latitude - latRange.min) / (latRange.max - latRange.min)
+	longOffset := (longitude - longRange.min) / (longRange.max - longRange.min)
+	// convert to fixed point based on the step size.
+	latOffset *= float64(uint64(1) << step)
+	longOffset *= float64(uint64(1) << step)
+	return GeoHashBits{bits: interleave64(uint32(latOffset), uint32(longOffset)), step: step}, true
+}
+
+func geohashEncodeWGS84(longitude, latitude float64, step uint) (GeoHashBits, bool) {
+	longRange, latRange := geohashGetCoordRange()
+	return geohashEncode(longRange, latRange, longitude, latitude, step)
+}
+
+// geohashDecode return the cell of hash.
+func geohashDecode(longRange, latRange GeoHashRange, hash GeoHashBits) GeoHashArea {
+	area := GeoHashArea{hash: hash}
+	step := hash.step
+	hashSep := deinterleave64(hash.bits)
+	latScale := latRange.max - latRange.min
+	longScale := longRange.max - longRange.min
+	ilato := uint32(hashSep)
+	ilono := uint32(hashSep >> 32)
+	cells := float64(uint64(1) << step)
+	area.latitude.min = latRange.min + (float64(ilato)/cells)*latScale
+	area.latitude.max = latRange.min + (float64(uint64(ilato)+1)/cells)*latScale
+	area.longitude.min = longRange.min + (float64(ilono)/cells)*longScale
+	area.longitude.max = longRange.min + (float64(uint64(ilono)+1)/cells)*longScale
+	return area
+}
+
+// geohashDecodeAreaToLongLat return the center of the cell.
+func geohashDecodeAreaToLongLat(area GeoHashArea) [2]float64 {
+	var xy [2]float64
+	xy[0] = (area.longitude.min + area.longitude.max) / 2
+	if xy[0] > GEO_LONG_MAX {
+		xy[0] = GEO_LONG_MAX
+	}
+	if xy[0] < GEO_LONG_MIN {
+		xy[0] = GEO_LONG_MIN
+	}
+	xy[1] = (area.latitude.min + area.latitude.max) / 2
+	if xy[1] > GEO_LAT_MAX {
+		xy[1] = GEO_LAT_MAX
+	}
+	if xy[1] < GEO_LAT_MIN {
+		xy[1] = GEO_LAT_MIN
+	}
+	return xy
+}
+
+func geohashDecodeToLongLatWGS84(hash GeoHashBits) [2]float64 {
+	longRange, latRange := geohashGetCoordRange()
+	return geohashDecodeAreaToLongLat(geohashDecode(longRange, latRange, hash))
+}
+
+// geohashMoveX move hash by d cells east, or west if d is negative. The
+// longitude bits are incremented in place, the carry passing through the
+// latitude bits set to 1.
+func geohashMoveX(hash *GeoHashBits, d int) {
+	if d == 0 {
+		return
+	}
+	x := hash.bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.bits & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - hash.step*2)
+	if d > 0 {
+		x = x + (zz + 1)
+	} else {
+		x = x | zz
+		x = x - (zz + 1)
+	}
+	x &= uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.step*2)
+	hash.bits = x | y
+}
+
+// geohashMoveY move hash by d cells north, or south if d is negative.
+func geohashMoveY(hash *GeoHashBits, d int) {
+	if d == 0 {
+		return
+	}
+	x := hash.bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.bits & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.step*2)
+	if d > 0 {
+		y = y + (zz + 1)
+	} else {
+		y = y | zz
+		y = y - (zz + 1)
+	}
+	y &= uint64(0x5555555555555555) >> (64 - hash.step*2)
+	hash.bits = x | y
+}
+
+func geohashNeighbors(hash GeoHashBits) GeoHashNeighbors {
+	var n GeoHashNeighbors
+	move := func(dx, dy int) GeoHashBits {
+		h := hash
+		geohashMoveX(&h, dx)
+		geohashMoveY(&h, dy)
+		return h
+	}
+	n.east = move(1, 0)
+	n.west = move(-1, 0)
+	n.south = move(0, -1)
+	n.north = move(0, 1)
+	n.northWest = move(-1, 1)
+	n.southWest = move(-1, -1)
+	n.northEast = move(1, 1)
+	n.southEast = move(1, -1)
+	return n
+}
+
+// geohashEstimateStepsByRadius return the steps of the cells for a search
+// of rangeMeters around a point at latitude lat. The cells are the
+// largest ones that, with their neighbors, cover the search area.
+func geohashEstimateStepsByRadius(rangeMeters, lat float64) uint {
+	if rangeMeters == 0 {
+		return GEO_STEP_MAX
+	}
+	step := 1
+	for rangeMeters < MERCATOR_MAX {
+		rangeMeters *= 2
+		step++
+	}
+	// make sure the range is included in most of the base cases.
+	step -= 2
+
+	// the cells are smaller near the poles.
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > GEO_STEP_MAX {
+		step = GEO_STEP_MAX
+	}
+	return uint(step)
+}
+
+// geohashBoundingBox return the min longitude, min latitude, max
+// longitude and max latitude of the box containing the shape.
+func geohashBoundingBox(shape *GeoShape) [4]float64 {
+	longitude, latitude := shape.xy[0], shape.xy[1]
+	height, width := shape.radius, shape.radius
+	if shape.shapeType == RECTANGLE_TYPE {
+		height, width = shape.height/2, shape.width/2
+	}
+	height *= shape.conversion
+	width *= shape.conversion
+
+	latDelta := radDeg(height / EARTH_RADIUS_IN_METERS)
+	longDeltaTop := radDeg(width / EARTH_RADIUS_IN_METERS / math.Cos(degRad(latitude+latDelta)))
+	longDeltaBottom := radDeg(width / EARTH_RADIUS_IN_METERS / math.Cos(degRad(latitude-latDelta)))
+	// the box is wider on the side closer to the equator.
+	var bounds [4]float64
+	if latitude < 0 {
+		bounds[0] = longitude - longDeltaBottom
+		bounds[2] = longitude + longDeltaBottom
+	} else {
+		bounds[0] = longitude - longDeltaTop
+		bounds[2] = longitude + longDeltaTop
+	}
+	bounds[1] = latitude - latDelta
+	bounds[3] = latitude + latDelta
+	return bounds
+}
+
+// geohashCalculateAreasByShapeWGS84 return the 9 cells to search for the
+// members in shape.
+func geohashCalculateAreasByShapeWGS84(shape *GeoShape) GeoHashRadius {
+	bounds := geohashBoundingBox(shape)
+	minLon, minLat, maxLon, maxLat := bounds[0], bounds[1], bounds[2], bounds[3]
+	longitude, latitude := shape.xy[0], shape.xy[1]
+	radiusMeters := shape.radius
+	if shape.shapeType == RECTANGLE_TYPE {
+		radiusMeters = math.Sqrt((shape.width/2)*(shape.width/2) + (shape.height/2)*(shape.height/2))
+	}
+	radiusMeters *= shape.conversion
+
+	steps := geohashEstimateStepsByRadius(radiusMeters, latitude)
+	longRange, latRange := geohashGetCoordRange()
+	hash, _ := geohashEncode(longRange, latRange, longitude, latitude, steps)
+	neighbors := geohashNeighbors(hash)
+	area := geohashDecode(longRange, latRange, hash)
+
+	// the estimated step may be too large when the search area is near the
+	// edges of the cell, so that the neighbors don't cover it. Check if
+	// the neighbors cover it, and use a smaller step if not.
+	decreaseStep := false
+	north := geohashDecode(longRange, latRange, neighbors.north)
+	south := geohashDecode(longRange, latRange, neighbors.south)
+	east := geohashDecode(longRange, latRange, neighbors.east)
+	west := geohashDecode(longRange, latRange, neighbors.west)
+	if north.latitude.max < maxLat || south.latitude.min > minLat ||
+		east.longitude.max < maxLon || west.longitude.min > minLon {
+		decreaseStep = true
+	}
+	if steps > 1 && decreaseStep {
+		steps--
+		hash, _ = geohashEncode(longRange, latRange, longitude, latitude, steps)
+		neighbors = geohashNeighbors(hash)
+		area = geohashDecode(longRange, latRange, hash)
+	}
+
+	// exclude the neighbors out of the search area.
+	if steps >= 2 {
+		if area.latitude.min < minLat {
+			neighbors.south = GeoHashBits{}
+			neighbors.southWest = GeoHashBits{}
+			neighbors.southEast = GeoHashBits{}
+		}
+		if area.latitude.max > maxLat {
+			neighbors.north = GeoHashBits{}
+			neighbors.northEast = GeoHashBits{}
+			neighbors.northWest = GeoHashBits{}
+		}
+		if area.longitude.min < minLon {
+			neighbors.west = GeoHashBits{}
+			neighbors.southWest = GeoHashBits{}
+			neighbors.northWest = GeoHashBits{}
+		}
+		if area.longitude.max > maxLon {
+			neighbors.east = GeoHashBits{}
+			neighbors.southEast = GeoHashBits{}
+			neighbors.northEast = GeoHashBits{}
+		}
+	}
+	return GeoHashRadius{hash: hash, area: area, neighbors: neighbors}
+}
+
+// geohashAlign52Bits return the bits of hash shifted to be compared with
+// the 52 bits scores.
+func geohashAlign52Bits(hash GeoHashBits) uint64 {
+	return hash.bits << (52 - hash.step*2)
+}
+
+func geohashGetLatDistance(lat1d, lat2d float64) float64 {
+	return EARTH_RADIUS_IN_METERS * math.Abs(degRad(lat2d)-degRad(lat1d))
+}
+
+// geohashGetDistance return the distance in meters with the haversine
+// formula.
+func geohashGetDistance(lon1d, lat1d, lon2d, lat2d float64) float64 {
+	lon1r := degRad(lon1d)
+	lon2r := degRad(lon2d)
+	v := math.Sin((lon2r - lon1r) / 2)
+	// the longitudes are practically the same.
+	if v == 0 {
+		return geohashGetLatDistance(lat1d, lat2d)
+	}
+	lat1r := degRad(lat1d)
+	lat2r := degRad(lat2d)
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2.0 * EARTH_RADIUS_IN_METERS * math.Asin(math.Sqrt(a))
+}
+
+// geohashGetDistanceIfInRadius return the distance between the points,
+// ok is false if it is greater than radius.
+func geohashGetDistanceIfInRadius(x1, y1, x2, y2, radius float64) (float64, bool) {
+	distance := geohashGetDistance(x1, y1, x2, y2)
+	return distance, distance <= radius
+}
+
+// geohashGetDistanceIfInRectangle return the distance between the points,
+// ok is false if (x2, y2) is not in the rectangle centered at (x1, y1).
+func geohashGetDistanceIfInRectangle(widthM, heightM, x1, y1, x2, y2 float64) (float64, bool) {
+	// the latitude distance is cheaper, so it is checked first.
+	if geohashGetLatDistance(y2, y1) > heightM/2 {
+		return 0, false
+	}
+	if geohashGetDistance(x2, y1, x1, y1) > widthM/2 {
+		return 0, false
+	}
+	return geohashGetDistance(x1, y1, x2, y2), true
+}
@@ -11,21 +11,69 @@ import (
 )
 
 type RedisDB struct {
-	data   *Dict
-	expire *Dict
+	id            int
+	data          *Dict
+	expire        *Dict
+	expiresCursor uint64 // where the active expire cycle resumes scanning
+	// clients blocked on every key, in the order they blocked.
+	blockingKeys map[string][]*RedisClient
+	// keys with blocked clients already queued in server.readyKeys.
+	readyKeys map[string]bool
 }
 
 type RedisServer struct {
 	fd      int
 	port    int
 	addr    string
-	db      *RedisDB
+	hz      int // frequency of ServerCron
+	db      []*RedisDB
+	dbnum   int
 	clients map[int]*RedisClient
 	aeLoop  *AeEventLoop
+	// the db where the next active expire cycle starts
+	currentDb int
+	// id of the last created client
+	nextClientId int64
+	// keys with blocked clients that got new data
+	readyKeys []*readyKey
+	// clients unblocked whose pending commands must be processed
+	unblockedClients []*RedisClient
+	// limits of the listpack encoding
+	hashMaxListpackEntries int
+	hashMaxListpackValue   int
+	listMaxListpackSize    int
+	listCompressDepth      int
+	// strings longer than this are lzf compressed, 0 disables it
+	stringCompressThreshold int
+	// max length of a sparse HyperLogLog
+	hllSparseMaxBytes int
+	// limits of the nodes of a stream
+	streamNodeMaxBytes   int
+	streamNodeMaxEntries int
+	// channel -> clients subscribed to it
+	pubsubChannels *Dict
+	// patterns subscribed by every client, in subscription order
+	pubsubPatterns []*pubsubPattern
+	// pattern -> number of clients subscribed to it
+	pubsubPatternsCount map[string]int
+	// the memcached protocol listener, fd is -1 if it's disabled
+	memcachedPort int
+	memcachedFd   int
+	// the last CAS given to a memcached item
+	memcachedCas uint64
+	// stats
+	statExpiredKeys                int64   // number of expired keys
+	statExpiredStalePerc           float64 // percentage of keys probably expired
+	statExpiredTimeCapReachedCount int64   // early stopped expire cycles
+	statMemcachedGetHits           int64   // memcached get of existing items
+	statMemcachedGetMisses         int64   // memcached get of missing items
+	statMemcachedCmdSet            int64   // memcached storage commands
 }
 
 type RedisClient struct {
+	id       int64
 	fd       int
+	flags    int
 	db       *RedisDB
 	args     []*RedisObj
 	reply    *List
@@ -33,10 +81,24 @@ type RedisClient struct {
 	queryBuf []byte // unhandled query content
 	queryLen int    // unhandled query content len
 	cmdType  CmdType
-	bulkNum  int // number of string in multi bulk command
-	bulkLen  int // len of each bulk string
+	bulkNum  int           // number of string in multi bulk command
+	bulkLen  int           // len of each bulk string, -1 if it's not read yet
+	bpop     blockingState // what the client is blocked on
+	// bytes of a refused memcached data block still to be dropped
+	swallowLen int
+	// channels and patterns the client is subscribed to
+	pubsubChannels *Dict
+	pubsubPatterns *List
 }
 
+// client flags
+const (
+	CLIENT_BLOCKED   int = 1 << 0 // the client is running a blocking command
+	CLIENT_UNBLOCKED int = 1 << 1 // queued in server.unblockedClients
+	CLIENT_PUBSUB    int = 1 << 2 // subscribed to channels or patterns
+	CLIENT_MEMCACHED int = 1 << 3 // speaking the memcached protocol
+)
+
 type CmdType = byte
 
 const (
@@ -56,77 +118,184 @@ type CommandProc func(c *RedisClient)
 type RedisCommand struct {
 	name  string
 	proc  CommandProc
-	arity int // number of parameter
+	arity int // number of parameter, -N means at least N parameters
 }
 
 var server RedisServer
 var cmdTable []RedisCommand = []RedisCommand{
+	// string
 	{"get", getCommand, 2},
-	{"set", setCommand, 3},
-	{"expire", expireCommand, 3},
+	{"set", setCommand, -3},
+	{"setnx", setnxCommand, 3},
+	{"setex", setexCommand, 4},
+	{"psetex", psetexCommand, 4},
+	{"getset", getsetCommand, 3},
+	{"getdel", getdelCommand, 2},
+	{"getex", getexCommand, -2},
+	{"append", appendCommand, 3},
+	{"strlen", strlenCommand, 2},
+	{"getrange", getrangeCommand, 4},
+	{"setrange", setrangeCommand, 4},
+	{"mget", mgetCommand, -2},
+	{"mset", msetCommand, -3},
+	{"msetnx", msetnxCommand, -3},
+	{"incr", incrCommand, 2},
+	{"decr", decrCommand, 2},
+	{"incrby", incrbyCommand, 3},
+	{"decrby", decrbyCommand, 3},
+	{"incrbyfloat", incrbyfloatCommand, 3},
+	// bitmap
+	{"setbit", setbitCommand, 4},
+	{"getbit", getbitCommand, 3},
+	{"bitcount", bitcountCommand, -2},
+	{"bitpos", bitposCommand, -3},
+	{"bitop", bitopCommand, -4},
+	{"bitfield", bitfieldCommand, -2},
+	{"bitfield_ro", bitfieldroCommand, -2},
+	// hyperloglog
+	{"pfadd", pfaddCommand, -2},
+	{"pfcount", pfcountCommand, -2},
+	{"pfmerge", pfmergeCommand, -2},
+	// list
+	{"lpush", lpushCommand, -3},
+	{"rpush", rpushCommand, -3},
+	{"lpushx", lpushxCommand, -3},
+	{"rpushx", rpushxCommand, -3},
+	{"lpop", lpopCommand, -2},
+	{"rpop", rpopCommand, -2},
+	{"llen", llenCommand, 2},
+	{"lrange", lrangeCommand, 4},
+	{"lindex", lindexCommand, 3},
+	{"lset", lsetCommand, 4},
+	{"lrem", lremCommand, 4},
+	{"ltrim", ltrimCommand, 4},
+	{"linsert", linsertCommand, 5},
+	{"lpos", lposCommand, -3},
+	{"lmove", lmoveCommand, 5},
+	{"rpoplpush", rpoplpushCommand, 3},
+	{"blpop", blpopCommand, -3},
+	{"brpop", brpopCommand, -3},
+	{"blmove", blmoveCommand, 6},
+	{"brpoplpush", brpoplpushCommand, 4},
+	// hash
+	{"hset", hsetCommand, -4},
+	{"hsetnx", hsetnxCommand, 4},
+	{"hget", hgetCommand, 3},
+	{"hmget", hmgetCommand, -3},
+	{"hdel", hdelCommand, -3},
+	{"hlen", hlenCommand, 2},
+	{"hexists", hexistsCommand, 3},
+	{"hkeys", hkeysCommand, 2},
+	{"hvals", hvalsCommand, 2},
+	{"hgetall", hgetallCommand, 2},
+	{"hincrby", hincrbyCommand, 4},
+	{"hincrbyfloat", hincrbyfloatCommand, 4},
+	{"hstrlen", hstrlenCommand, 3},
+	{"hrandfield", hrandfieldCommand, -2},
+	{"hscan", hscanCommand, -3},
+	// set
+	{"sadd", saddCommand, -3},
+	{"srem", sremCommand, -3},
+	{"sismember", sismemberCommand, 3},
+	{"smismember", smismemberCommand, -3},
+	{"scard", scardCommand, 2},
+	{"smembers", smembersCommand, 2},
+	{"spop", spopCommand, -2},
+	{"srandmember", srandmemberCommand, -2},
+	{"smove", smoveCommand, 4},
+	{"sinter", sinterCommand, -2},
+	{"sinterstore", sinterstoreCommand, -3},
+	{"sunion", sunionCommand, -2},
+	{"sunionstore", sunionstoreCommand, -3},
+	{"sdiff", sdiffCommand, -2},
+	{"sdiffstore", sdiffstoreCommand, -3},
+	{"sintercard", sintercardCommand, -3},
+	{"sscan", sscanCommand, -3},
+	// zset
+	{"zadd", zaddCommand, -4},
+	{"zincrby", zincrbyCommand, 4},
+	{"zcard", zcardCommand, 2},
+	{"zscore", zscoreCommand, 3},
+	{"zmscore", zmscoreCommand, -3},
+	{"zrank", zrankCommand, 3},
+	{"zrevrank", zrevrankCommand, 3},
+	{"zrange", zrangeCommand, -4},
+	{"zcount", zcountCommand, 4},
+	{"zlexcount", zlexcountCommand, 4},
+	{"zrem", zremCommand, -3},
+	{"zremrangebyrank", zremrangebyrankCommand, 4},
+	{"zremrangebyscore", zremrangebyscoreCommand, 4},
+	{"zremrangebylex", zremrangebylexCommand, 4},
+	{"zpopmin", zpopminCommand, -2},
+	{"zpopmax", zpopmaxCommand, -2},
+	{"zunionstore", zunionstoreCommand, -4},
+	{"zinterstore", zinterstoreCommand, -4},
+	// geo
+	{"geoadd", geoaddCommand, -5},
+	{"geopos", geoposCommand, -2},
+	{"geodist", geodistCommand, -4},
+	{"geohash", geohashCommand, -2},
+	{"geosearch", geosearchCommand, -7},
+	{"geosearchstore", geosearchstoreCommand, -8},
+	// stream
+	{"xadd", xaddCommand, -5},
+	{"xrange", xrangeCommand, -4},
+	{"xrevrange", xrevrangeCommand, -4},
+	{"xlen", xlenCommand, 2},
+	{"xdel", xdelCommand, -3},
+	{"xtrim", xtrimCommand, -4},
+	{"xread", xreadCommand, -4},
+	{"xreadgroup", xreadgroupCommand, -7},
+	{"xgroup", xgroupCommand, -2},
+	{"xack", xackCommand, -4},
+	{"xpending", xpendingCommand, -3},
+	{"xclaim", xclaimCommand, -6},
+	{"xautoclaim", xautoclaimCommand, -6},
+	{"xinfo", xinfoCommand, -2},
+	// keyspace
+	{"del", delCommand, -2},
+	{"unlink", unlinkCommand, -2},
+	{"exists", existsCommand, -2},
+	{"touch", touchCommand, -2},
+	{"type", typeCommand, 2},
+	{"object", objectCommand, -2},
+	{"rename", renameCommand, 3},
+	{"renamenx", renamenxCommand, 3},
+	{"copy", copyCommand, -3},
+	{"randomkey", randomkeyCommand, 1},
+	{"dbsize", dbsizeCommand, 1},
+	{"keys", keysCommand, 2},
+	{"scan", scanCommand, -2},
+	// expire
+	{"expire", expireCommand, -3},
+	{"pexpire", pexpireCommand, -3},
+	{"expireat", expireatCommand, -3},
+	{"pexpireat", pexpireatCommand, -3},
+	{"ttl", ttlCommand, 2},
+	{"pttl", pttlCommand, 2},
+	{"expiretime", expiretimeCommand, 2},
+	{"pexpiretime", pexpiretimeCommand, 2},
+	{"persist", persistCommand, 2},
+	// db
+	{"select", selectCommand, 2},
+	{"move", moveCommand, 3},
+	{"swapdb", swapdbCommand, 3},
+	{"flushdb", flushdbCommand, -1},
+	{"flushall", flushallCommand, -1},
+	// pubsub
+	{"subscribe", subscribeCommand, -2},
+	{"unsubscribe", unsubscribeCommand, -1},
+	{"psubscribe", psubscribeCommand, -2},
+	{"punsubscribe", punsubscribeCommand, -1},
+	{"publish", publishCommand, 3},
+	{"pubsub", pubsubCommand, -2},
+	// server
+	{"ping", pingCommand, -1},
+	{"info", infoCommand, -1},
+	{"client", clientCommand, -2},
 	// TODO: more command
 }
 
-func expireIfNeeded(key *RedisObj) {
-	entry := server.db.expire.DictFind(key)
-	if entry == nil {
-		// no expire for this key.
-		return
-	}
-	when := entry.Val.IntVal()
-	if when > GetMsTime() {
-		// return if the key has not expired.
-		return
-	}
-	server.db.expire.DictDelete(key)
-	server.db.data.DictDelete(key)
-}
-
-func lookupKeyRead(key *RedisObj) *RedisObj {
-	expireIfNeeded(key)
-	return server.db.data.DictGet(key)
-}
-
-func getCommand(c *RedisClient) {
-	key := c.args[1]
-	val := lookupKeyRead(key)
-	if val == nil {
-		// TODO: extract shared.strings
-		c.AddReplyStr("$-1\r\n")
-	} else if val.Type_ != REDISSTR {
-		// TODO: extract shared.strings
-		c.AddReplyStr("-ERR: wrong type\r\n")
-	} else {
-		str := val.StrVal()
-		c.AddReplyStr(fmt.Sprintf("$%d%v\t\n", len(str), str))
-	}
-}
-
-func setCommand(c *RedisClient) {
-	key := c.args[1]
-	val := c.args[2]
-	if val.Type_ != REDISSTR {
-		c.AddReplyStr("-ERR: wrong type\r\n")
-	}
-	server.db.data.DictSet(key, val)
-	server.db.expire.DictDelete(key)
-	c.AddReplyStr("+OK\r\n")
-}
-
-func expireCommand(c *RedisClient) {
-	key := c.args[1]
-	val := c.args[2]
-	if val.Type_ != REDISSTR {
-		// TODO: extract shared.strings
-		c.AddReplyStr("-ERR: wrong type\r\n")
-	}
-	expire := GetMsTime() + (val.IntVal() * 1000)
-	expObj := CreateFromInt(expire)
-	server.db.expire.DictSet(key, expObj)
-	expObj.DecrRefCount()
-	c.AddReplyStr("+OK\r\n")
-}
-
 func lookupCommand(cmdName string) *RedisCommand {
 	for _, c := range cmdTable {
 		if c.name == cmdName {
@@ -136,18 +305,6 @@ func lookupCommand(cmdName string) *RedisCommand {
 	return nil
 }
 
-func (c *RedisClient) AddReply(obj *RedisObj) {
-	c.reply.ListAddNodeTail(obj)
-	obj.IncrRefCount()
-	server.aeLoop.AeCreateFileEvent(c.fd, AE_WRITABLE, SendReplyToClient, c)
-}
-
-func (c *RedisClient) AddReplyStr(str string) {
-	obj := CreateObject(REDISSTR, str)
-	c.AddReply(obj)
-	obj.DecrRefCount()
-}
-
 func processCommand(c *RedisClient) {
 	cmdName := c.args[0].StrVal()
 	log.Printf("process command: %v\n", cmdName)
@@ -157,16 +314,26 @@ func processCommand(c *RedisClient) {
 	}
 	cmd := lookupCommand(cmdName)
 	if cmd == nil {
-		c.AddReplyStr("-ERR: unknown command\r\n")
+		c.AddReplyErrorFormat("unknown command '%s'", cmdName)
+		resetClient(c)
+		return
+	} else if (cmd.arity > 0 && cmd.arity != len(c.args)) || len(c.args) < -cmd.arity {
+		c.AddReplyErrorFormat("wrong number of arguments for '%s' command", cmdName)
 		resetClient(c)
 		return
-	} else if cmd.arity != len(c.args) {
-		c.AddReplyStr("-ERR: wrong number of args\r\n")
+	}
+	// a subscribed client can only manage its subscriptions.
+	if c.flags&CLIENT_PUBSUB != 0 && cmd.name != "subscribe" && cmd.name != "unsubscribe" &&
+		cmd.name != "psubscribe" && cmd.name != "punsubscribe" && cmd.name != "ping" {
+		c.AddReplyErrorFormat("Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", cmdName)
 		resetClient(c)
 		return
 	}
 	cmd.proc(c)
 	resetClient(c)
+	if len(server.readyKeys) > 0 {
+		handleClientsBlockedOnKeys()
+	}
 }
 
 func freeClientArgs(c *RedisClient) {
@@ -184,6 +351,19 @@ func freeReplyList(c *RedisClient) {
 }
 
 func freeClient(c *RedisClient) {
+	if c.flags&CLIENT_BLOCKED != 0 {
+		unblockClient(c)
+	}
+	if c.flags&CLIENT_UNBLOCKED != 0 {
+		for i, uc := range server.unblockedClients {
+			if uc == c {
+				server.unblockedClients = append(server.unblockedClients[:i], server.unblockedClients[i+1:]...)
+				break
+			}
+		}
+	}
+	pubsubUnsubscribeAllChannels(c, false)
+	pubsubUnsubscribeAllPatterns(c, false)
 	freeClientArgs(c)
 	freeReplyList(c)
 	delete(server.clients, c.fd)
@@ -196,7 +376,7 @@ func resetClient(c *RedisClient) {
 	freeClientArgs(c)
 	c.cmdType = REDIS_CMD_UNKNOWN
 	c.bulkNum = 0
-	c.bulkLen = 0
+	c.bulkLen = -1
 }
 
 func (c *RedisClient) findLineInQuery() (int, error) {
@@ -243,7 +423,8 @@ func handleBulkCmdBuf(c *RedisClient) (bool, error) {
 		if err != nil {
 			return false, err
 		}
-		if bnum == 0 {
+		if bnum <= 0 {
+			c.args = nil
 			return true, nil
 		}
 		c.bulkNum = bnum
@@ -253,7 +434,7 @@ func handleBulkCmdBuf(c *RedisClient) (bool, error) {
 	// read every bulk string
 	for c.bulkNum > 0 {
 		// read bulk length
-		if c.bulkLen == 0 {
+		if c.bulkLen == -1 {
 			index, err := c.findLineInQuery()
 			if index < 0 {
 				return false, err
@@ -262,9 +443,12 @@ func handleBulkCmdBuf(c *RedisClient) (bool, error) {
 				return false, errors.New("expect $ for bulk length")
 			}
 			blen, err := c.getBulkNumInQuery(1, index)
-			if err != nil || blen == 0 {
+			if err != nil {
 				return false, err
 			}
+			if blen < 0 {
+				return false, errors.New("invalid bulk length")
+			}
 			if blen > REDIS_BULK_MAX {
 				return false, errors.New("too big bulk")
 			}
@@ -281,7 +465,7 @@ func handleBulkCmdBuf(c *RedisClient) (bool, error) {
 		c.args[len(c.args)-c.bulkNum] = CreateObject(REDISSTR, string(c.queryBuf[:index]))
 		c.queryBuf = c.queryBuf[index+2:]
 		c.queryLen -= index + 2
-		c.bulkLen = 0
+		c.bulkLen = -1
 		c.bulkNum -= 1
 	}
 	// read every bulk
@@ -290,6 +474,10 @@ func handleBulkCmdBuf(c *RedisClient) (bool, error) {
 
 func processQueryBuf(c *RedisClient) error {
 	for c.queryLen > 0 {
+		// the commands of a blocked client wait until it is unblocked.
+		if c.flags&CLIENT_BLOCKED != 0 {
+			break
+		}
 		if c.cmdType == REDIS_CMD_UNKNOWN {
 			if c.queryBuf[0] == '*' {
 				c.cmdType = REDIS_CMD_BULK
@@ -398,26 +586,56 @@ func RedisStrHash(key *RedisObj) int64 {
 
 func CreateClient(fd int) *RedisClient {
 	var c RedisClient
+	server.nextClientId++
+	c.id = server.nextClientId
 	c.fd = fd
-	c.db = server.db
+	c.db = server.db[0]
+	c.bulkLen = -1
 	c.queryBuf = make([]byte, REDIS_IOBUF_LEN, REDIS_IOBUF_LEN)
 	c.reply = ListCreate(ListFunc{EqualFunc: RedisStrEqual})
+	c.pubsubChannels = createPubsubChannelsDict()
+	c.pubsubPatterns = ListCreate(ListFunc{EqualFunc: RedisStrEqual})
 	return &c
 }
 
 func initServer(config *Config) error {
 	server.port = config.Port
 	server.addr = config.Addr
+	server.hz = config.Hz
+	if server.hz < CONFIG_MIN_HZ {
+		server.hz = CONFIG_MIN_HZ
+	} else if server.hz > CONFIG_MAX_HZ {
+		server.hz = CONFIG_MAX_HZ
+	}
 	server.clients = make(map[int]*RedisClient)
-	server.db = &RedisDB{
-		data: DictCreate(DictFunc{
-			HashFunc:  RedisStrHash,
-			EqualFunc: RedisStrEqual,
-		}),
-		expire: DictCreate(DictFunc{
-			HashFunc:  RedisStrHash,
-			EqualFunc: RedisStrEqual,
-		}),
+	server.currentDb = 0
+	server.readyKeys = nil
+	server.unblockedClients = nil
+	resetServerStats()
+	server.hashMaxListpackEntries = config.HashMaxListpackEntries
+	server.hashMaxListpackValue = config.HashMaxListpackValue
+	server.listMaxListpackSize = config.ListMaxListpackSize
+	server.listCompressDepth = config.ListCompressDepth
+	server.stringCompressThreshold = config.StringCompressThreshold
+	server.hllSparseMaxBytes = config.HllSparseMaxBytes
+	server.streamNodeMaxBytes = config.StreamNodeMaxBytes
+	server.streamNodeMaxEntries = config.StreamNodeMaxEntries
+	server.pubsubChannels = createPubsubChannelsDict()
+	server.pubsubPatterns = nil
+	server.pubsubPatternsCount = make(map[string]int)
+	server.dbnum = config.Databases
+	if server.dbnum < 1 {
+		server.dbnum = 1
+	}
+	server.db = make([]*RedisDB, server.dbnum)
+	for i := range server.db {
+		server.db[i] = &RedisDB{
+			id:           i,
+			data:         createKeyspaceDict(),
+			expire:       createKeyspaceDict(),
+			blockingKeys: make(map[string][]*RedisClient),
+			readyKeys:    make(map[string]bool),
+		}
 	}
 
 	var err error
@@ -427,6 +645,15 @@ func initServer(config *Config) error {
 	}
 
 	server.fd, err = TcpServer(server.port, server.addr)
+	if err != nil {
+		return err
+	}
+
+	server.memcachedPort = config.MemcachedPort
+	server.memcachedFd = -1
+	if server.memcachedPort != 0 {
+		server.memcachedFd, err = TcpServer(server.memcachedPort, server.addr)
+	}
 
 	return err
 }
@@ -444,20 +671,135 @@ func AcceptHandler(le *AeEventLoop, fd int, extra interface{}) {
 	log.Printf("accept client, fd: %v\n", cfd)
 }
 
-const EXPIRE_CHECK_COUNT int = 100
+func resetServerStats() {
+	server.statExpiredKeys = 0
+	server.statExpiredStalePerc = 0
+	server.statExpiredTimeCapReachedCount = 0
+	server.statMemcachedGetHits = 0
+	server.statMemcachedGetMisses = 0
+	server.statMemcachedCmdSet = 0
+}
+
+// genRedisInfoString return the info of section, all sections if it's "all"
+// or "default".
+func genRedisInfoString(section string) string {
+	all := section == "all" || section == "default"
+	var info string
+	if all || section == "stats" {
+		info += "# Stats\r\n" +
+			fmt.Sprintf("expired_keys:%d\r\n", server.statExpiredKeys) +
+			fmt.Sprintf("expired_stale_perc:%.2f\r\n", server.statExpiredStalePerc*100) +
+			fmt.Sprintf("expired_time_cap_reached_count:%d\r\n", server.statExpiredTimeCapReachedCount)
+	}
+	if all || section == "keyspace" {
+		if info != "" {
+			info += "\r\n"
+		}
+		info += "# Keyspace\r\n"
+		for _, db := range server.db {
+			keys, vkeys := db.data.DictSize(), db.expire.DictSize()
+			if keys > 0 {
+				info += fmt.Sprintf("db%d:keys=%d,expires=%d\r\n", db.id, keys, vkeys)
+			}
+		}
+	}
+	return info
+}
 
-// ServerCron delete key randomly
-func ServerCron(loop *AeEventLoop, id int, extra interface{}) {
-	for i := 0; i < EXPIRE_CHECK_COUNT; i++ {
-		entry := server.db.expire.DictGetRandomKey()
-		if entry == nil {
-			break
+// pingCommand implement PING [message], a subscribed client gets the pong
+// as a pubsub message.
+func pingCommand(c *RedisClient) {
+	if len(c.args) > 2 {
+		c.AddReplyErrorFormat("wrong number of arguments for '%s' command", c.args[0].StrVal())
+		return
+	}
+	if c.flags&CLIENT_PUBSUB != 0 {
+		c.AddReplyArrayLen(2)
+		c.AddReplyBulkStr("pong")
+		if len(c.args) == 2 {
+			c.AddReplyBulk(c.args[1])
+		} else {
+			c.AddReplyBulkStr("")
 		}
-		if entry.Val.IntVal() < GetMsTime() {
-			server.db.data.DictDelete(entry.Key)
-			server.db.expire.DictDelete(entry.Key)
+	} else if len(c.args) == 2 {
+		c.AddReplyBulk(c.args[1])
+	} else {
+		c.AddReply(shared.pong)
+	}
+}
+
+// infoCommand implement INFO [section]
+func infoCommand(c *RedisClient) {
+	section := "default"
+	if len(c.args) == 2 {
+		section = strings.ToLower(c.args[1].StrVal())
+	} else if len(c.args) > 2 {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	c.AddReplyBulkStr(genRedisInfoString(section))
+}
+
+// clientCommand implement CLIENT ID and CLIENT UNBLOCK client-id
+// [TIMEOUT|ERROR]
+func clientCommand(c *RedisClient) {
+	sub := strings.ToLower(c.args[1].StrVal())
+	if sub == "id" && len(c.args) == 2 {
+		c.AddReplyInt(c.id)
+	} else if sub == "unblock" && (len(c.args) == 3 || len(c.args) == 4) {
+		id, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+		if !ok {
+			return
+		}
+		unblockError := false
+		if len(c.args) == 4 {
+			switch strings.ToLower(c.args[3].StrVal()) {
+			case "timeout":
+			case "error":
+				unblockError = true
+			default:
+				c.AddReplyError("CLIENT UNBLOCK reason should be TIMEOUT or ERROR")
+				return
+			}
+		}
+		target := lookupClientByID(id)
+		if target == nil || target.flags&CLIENT_BLOCKED == 0 {
+			c.AddReply(shared.czero)
+			return
+		}
+		if unblockError {
+			target.AddReplyError("-UNBLOCKED client unblocked via CLIENT UNBLOCK")
+		} else {
+			replyToBlockedClientTimedOut(target)
+		}
+		unblockClient(target)
+		c.AddReply(shared.cone)
+	} else {
+		c.AddReplyErrorFormat("unknown subcommand or wrong number of arguments for '%s'. Try CLIENT HELP.", c.args[1].StrVal())
+	}
+}
+
+// lookupClientByID return the connected client with id, nil if not found.
+func lookupClientByID(id int64) *RedisClient {
+	for _, c := range server.clients {
+		if c.id == id {
+			return c
 		}
 	}
+	return nil
+}
+
+// beforeSleep is called before the event loop waits for events.
+func beforeSleep(loop *AeEventLoop) {
+	processUnblockedClients()
+	if len(server.readyKeys) > 0 {
+		handleClientsBlockedOnKeys()
+	}
+}
+
+// ServerCron do the periodic tasks, it's called server.hz times per second.
+func ServerCron(loop *AeEventLoop, id int, extra interface{}) {
+	activeExpireCycle()
 }
 
 func main() {
@@ -471,7 +813,11 @@ func main() {
 		log.Printf("Init server error: %v\n", err)
 	}
 	server.aeLoop.AeCreateFileEvent(server.fd, AE_READABLE, AcceptHandler, nil)
-	server.aeLoop.AeCreateTimeEvent(AE_NORMAL, 1, ServerCron, nil)
+	if server.memcachedFd >= 0 {
+		server.aeLoop.AeCreateFileEvent(server.memcachedFd, AE_READABLE, MemcachedAcceptHandler, nil)
+	}
+	server.aeLoop.AeCreateTimeEvent(AE_NORMAL, int64(1000/server.hz), ServerCron, nil)
+	server.aeLoop.AeSetBeforeSleepProc(beforeSleep)
 	log.Println("Redis server is up.")
 	server.aeLoop.AeMain()
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"strconv"
 	"testing"
@@ -8,6 +9,10 @@ import (
 )
 
 func ReadQuery(c *RedisClient, query string) {
+	// the buffer grows like in ReadQueryFromClient.
+	if len(c.queryBuf)-c.queryLen < len(query) {
+		c.queryBuf = append(c.queryBuf, make([]byte, len(query))...)
+	}
 	for _, v := range []byte(query) {
 		c.queryBuf[c.queryLen] = v
 		c.queryLen += 1
@@ -91,24 +96,24 @@ func TestExpireCmd(t *testing.T) {
 	assert.Nil(t, err)
 
 	key := CreateObject(REDISSTR, "key")
-	val := server.db.data.DictGet(key)
+	val := server.db[0].data.DictGet(key)
 	assert.Equal(t, "val", val.StrVal())
-	val = server.db.expire.DictGet(key)
+	val = server.db[0].expire.DictGet(key)
 	assert.Nil(t, val)
 
 	ReadQuery(c, "expire key 1\r\n")
 	err = processQueryBuf(c)
 	assert.Nil(t, err)
 
-	val = server.db.data.DictGet(key)
+	val = server.db[0].data.DictGet(key)
 	assert.Equal(t, "val", val.StrVal())
-	val = server.db.expire.DictGet(key)
+	val = server.db[0].expire.DictGet(key)
 	assert.Equal(t, strconv.Itoa(int(GetMsTime())+1000), val.StrVal())
 
 	time.Sleep(2 * time.Second)
-	val = server.db.data.DictGet(key)
+	val = server.db[0].data.DictGet(key)
 	assert.Nil(t, val)
-	val = server.db.expire.DictGet(key)
+	val = server.db[0].expire.DictGet(key)
 	assert.Nil(t, val)
 
 	server.aeLoop.stop = true
@@ -126,14 +131,14 @@ func TestProcessQueryBuf(t *testing.T) {
 	assert.Equal(t, 3, len(c.args))
 
 	key := CreateObject(REDISSTR, "key")
-	val := server.db.data.DictGet(key)
+	val := server.db[0].data.DictGet(key)
 	assert.Equal(t, "val", val.StrVal())
 
 	ReadQuery(c, "set key val2\r\n")
 	err = processQueryBuf(c)
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(c.args))
-	val2 := server.db.data.DictGet(key)
+	val2 := server.db[0].data.DictGet(key)
 	assert.Equal(t, "val2", val2.StrVal())
 
 	// no command name SET
@@ -142,7 +147,89 @@ func TestProcessQueryBuf(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(c.args))
 	key = CreateObject(REDISSTR, "key")
-	val = server.db.data.DictGet(key)
+	val = server.db[0].data.DictGet(key)
 	assert.NotEqual(t, "val", val.StrVal())
 	assert.Equal(t, "val2", val.StrVal())
 }
+
+// takeReply drain the reply list of client and return its content.
+func takeReply(c *RedisClient) string {
+	var rep string
+	for c.reply.ListLength() > 0 {
+		n := c.reply.ListFirst()
+		rep += n.Val.StrVal()
+		c.reply.ListDelNode(n)
+		n.Val.DecrRefCount()
+	}
+	return rep
+}
+
+// argsToQuery encode args as a command in bulk protocol.
+func argsToQuery(args []string) string {
+	query := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		query += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return query
+}
+
+// execCommand run the command in bulk protocol and return the reply.
+func execCommand(c *RedisClient, args ...string) string {
+	ReadQuery(c, argsToQuery(args))
+	if err := processQueryBuf(c); err != nil {
+		return err.Error()
+	}
+	return takeReply(c)
+}
+
+// testClient init a fresh server and return a client connected to it.
+func testClient() *RedisClient {
+	conf, _ := LoadConfig("config.json")
+	initServer(conf)
+	return CreateClient(server.fd)
+}
+
+func TestCommandReply(t *testing.T) {
+	c := testClient()
+
+	ReadQuery(c, "get key\r\n")
+	assert.Nil(t, processQueryBuf(c))
+	assert.Equal(t, "$-1\r\n", takeReply(c))
+
+	ReadQuery(c, "set key val\r\n")
+	assert.Nil(t, processQueryBuf(c))
+	assert.Equal(t, "+OK\r\n", takeReply(c))
+
+	ReadQuery(c, "get key\r\n")
+	assert.Nil(t, processQueryBuf(c))
+	assert.Equal(t, "$3\r\nval\r\n", takeReply(c))
+
+	ReadQuery(c, "expire nokey 10\r\n")
+	assert.Nil(t, processQueryBuf(c))
+	assert.Equal(t, ":0\r\n", takeReply(c))
+
+	ReadQuery(c, "expire key 10\r\n")
+	assert.Nil(t, processQueryBuf(c))
+	assert.Equal(t, ":1\r\n", takeReply(c))
+
+	ReadQuery(c, "foo\r\n")
+	assert.Nil(t, processQueryBuf(c))
+	assert.Equal(t, "-ERR unknown command 'foo'\r\n", takeReply(c))
+
+	ReadQuery(c, "get\r\n")
+	assert.Nil(t, processQueryBuf(c))
+	assert.Equal(t, "-ERR wrong number of arguments for 'get' command\r\n", takeReply(c))
+}
+
+func TestArity(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "-ERR wrong number of arguments for 'mget' command\r\n", execCommand(c, "mget"))
+	assert.Equal(t, "*1\r\n$-1\r\n", execCommand(c, "mget", "a"))
+	assert.Equal(t, "*2\r\n$-1\r\n$-1\r\n", execCommand(c, "mget", "a", "b"))
+}
+
+func TestEmptyBulk(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "+OK\r\n", execCommand(c, "set", "key", ""))
+	assert.Equal(t, "$0\r\n\r\n", execCommand(c, "get", "key"))
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// A HyperLogLog is stored as a REDISSTR value with the same layout as
+// Redis, so it can be read with GET and restored with SET:
+//
+//	+------+---+-----+----------+
+//	| HYLL | E | N/U | Cardin.  |
+//	+------+---+-----+----------+
+//
+// 4 bytes of magic, 1 byte of encoding, 3 unused bytes and the cached
+// cardinality as 8 bytes little endian. The most significant bit of the
+// last byte of the cache is set when it is no longer valid.
+//
+// The registers follow the header. The dense encoding packs the 16384
+// registers of 6 bits each, starting from the least significant bits of
+// every byte. The sparse encoding is a run length encoding of the
+// registers with three opcodes:
+//
+//	00xxxxxx          ZERO: xxxxxx+1 registers set to 0 (1 to 64).
+//	01xxxxxx yyyyyyyy XZERO: xxxxxxyyyyyyyy+1 registers set to 0 (1 to 16384).
+//	1vvvvvxx          VAL: xx+1 registers set to vvvvv+1 (1 to 4 of 1 to 32).
+//
+// A new HyperLogLog is sparse, and is promoted to dense when a register
+// value doesn't fit VAL or the value gets longer than hll-sparse-max-bytes.
+
+const (
+	HLL_P             = 14 // the greater, the lower the error.
+	HLL_Q             = 64 - HLL_P
+	HLL_REGISTERS     = 1 << HLL_P
+	HLL_P_MASK        = HLL_REGISTERS - 1
+	HLL_BITS          = 6
+	HLL_REGISTER_MAX  = (1 << HLL_BITS) - 1
+	HLL_HDR_SIZE      = 16
+	HLL_DENSE_SIZE    = HLL_HDR_SIZE + (HLL_REGISTERS*HLL_BITS+7)/8
+	HLL_ALPHA_INF     = 0.721347520444481703680
+	HLL_MAGIC         = "HYLL"
+	HLL_ENCODING_BYTE = 4
+	HLL_CARD_BYTE     = 8
+
+	HLL_DENSE        byte = 0
+	HLL_SPARSE       byte = 1
+	HLL_MAX_ENCODING byte = 1
+
+	HLL_SPARSE_XZERO_BIT            = 0x40
+	HLL_SPARSE_VAL_BIT              = 0x80
+	HLL_SPARSE_VAL_MAX_VALUE        = 32
+	HLL_SPARSE_VAL_MAX_LEN          = 4
+	HLL_SPARSE_ZERO_MAX_LEN         = 64
+	HLL_SPARSE_XZERO_MAX_LEN        = 16384
+	HLL_HASH_SEED            uint64 = 0xadc83b19
+)
+
+const (
+	HLL_INVALID_TYPE_ERR = "-WRONGTYPE Key is not a valid HyperLogLog string value."
+	HLL_INVALID_OBJ_ERR  = "-INVALIDOBJ Corrupted HLL object detected"
+)
+
+// hllRun is a run of registers with the same value of the sparse encoding.
+type hllRun struct {
+	val    uint8
+	length int
+}
+
+// murmurHash64A is MurmurHash2 64 bit, reading the words as little endian
+// on every platform so the registers don't depend on the byte order.
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m uint64 = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+	n := len(key) / 8 * 8
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	tail := key[n:]
+	if len(tail) > 0 {
+		for i := len(tail) - 1; i >= 0; i-- {
+			h ^= uint64(tail[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllPatLen return the register of ele, and the length of the 000..1
+// pattern of the hash bits not used for the index, that is the value to
+// set to the register if greater.
+func hllPatLen(ele []byte) (int, uint8) {
+	hash := murmurHash64A(ele, HLL_HASH_SEED)
+	index := int(hash & HLL_P_MASK)
+	// the bit at HLL_Q terminates the pattern.
+	hash >>= HLL_P
+	hash |= 1 << HLL_Q
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// hllCreate return an empty HyperLogLog with the sparse encoding.
+func hllCreate() []byte {
+	hll := make([]byte, HLL_HDR_SIZE, HLL_HDR_SIZE+2)
+	copy(hll, HLL_MAGIC)
+	hll[HLL_ENCODING_BYTE] = HLL_SPARSE
+	return hllSparseEncode(hll, []hllRun{{val: 0, length: HLL_REGISTERS}})
+}
+
+// isHLLObjectOrReply check o is a string with the layout of a
+// HyperLogLog, otherwise reply an error and return false. A key of another
+// type gets the usual WRONGTYPE error.
+func isHLLObjectOrReply(c *RedisClient, o *RedisObj) bool {
+	if checkType(c, o, REDISSTR) {
+		return false
+	}
+	if stringObjectLen(o) < HLL_HDR_SIZE {
+		c.AddReplyError(HLL_INVALID_TYPE_ERR)
+		return false
+	}
+	hll := o.StrVal()
+	if hll[:4] != HLL_MAGIC || hll[HLL_ENCODING_BYTE] > HLL_MAX_ENCODING ||
+		(hll[HLL_ENCODING_BYTE] == HLL_DENSE && len(hll) != HLL_DENSE_SIZE) {
+		c.AddReplyError(HLL_INVALID_TYPE_ERR)
+		return false
+	}
+	return true
+}
+
+func hllValidCache(hll []byte) bool {
+	return hll[HLL_CARD_BYTE+7]&(1<<7) == 0
+}
+
+func hllInvalidateCache(hll []byte) {
+	hll[HLL_CARD_BYTE+7] |= 1 << 7
+}
+
+func hllDenseGet(registers []byte, regnum int) uint8 {
+	b := regnum * HLL_BITS / 8
+	fb := uint(regnum * HLL_BITS & 7)
+	v := registers[b] >> fb
+	if b+1 < len(registers) {
+		v |= registers[b+1] << (8 - fb)
+	}
+	return v & HLL_REGISTER_MAX
+}
+
+func hllDenseSet(registers []byte, regnum int, val uint8) {
+	b := regnum * HLL_BITS / 8
+	fb := uint(regnum * HLL_BITS & 7)
+	registers[b] &^= HLL_REGISTER_MAX << fb
+	registers[b] |= val << fb
+	if b+1 < len(registers) {
+		registers[b+1] &^= HLL_REGISTER_MAX >> (8 - fb)
+		registers[b+1] |= val >> (8 - fb)
+	}
+}
+
+// hllDenseAdd add ele to the dense registers, and return true if a
+// register changed.
+func hllDenseAdd(registers []byte, ele []byte) bool {
+	index, count := hllPatLen(ele)
+	if count > hllDenseGet(registers, index) {
+		hllDenseSet(registers, index, count)
+		return true
+	}
+	return false
+}
+
+// hllSparseRuns decode the opcodes of a sparse HyperLogLog, and return
+// false if they don't cover exactly all the registers.
+func hllSparseRuns(hll []byte) ([]hllRun, bool) {
+	var runs []hllRun
+	total := 0
+	for p := HLL_HDR_SIZE; p < len(hll); p++ {
+		var run hllRun
+		switch op := hll[p]; {
+		case op&HLL_SPARSE_VAL_BIT != 0:
+			run.val = (op>>2)&0x1f + 1
+			run.length = int(op&0x3) + 1
+		case op&HLL_SPARSE_XZERO_BIT != 0:
+			if p+1 == len(hll) {
+				return nil, false
+			}
+			p++
+			run.length = (int(op&0x3f)<<8 | int(hll[p])) + 1
+		default:
+			run.length = int(op&0x3f) + 1
+		}
+		runs = append(runs, run)
+		total += run.length
+	}
+	return runs, total == HLL_REGISTERS
+}
+
+// hllSparseEncode append the opcodes of runs to the header hdr, adjacent
+// runs with the same value are merged.
+func hllSparseEncode(hdr []byte, runs []hllRun) []byte {
+	hll := hdr[:HLL_HDR_SIZE]
+	for i := 0; i < len(runs); {
+		val, length := runs[i].val, 0
+		for ; i < len(runs) && runs[i].val == val; i++ {
+			length += runs[i].length
+		}
+		for length > 0 {
+			switch {
+			case val != 0:
+				n := length
+				if n > HLL_SPARSE_VAL_MAX_LEN {
+					n = HLL_SPARSE_VAL_MAX_LEN
+				}
+				hll = append(hll, HLL_SPARSE_VAL_BIT|(val-1)<<2|byte(n-1))
+				length -= n
+			case length > HLL_SPARSE_ZERO_MAX_LEN:
+				n := length
+				if n > HLL_SPARSE_XZERO_MAX_LEN {
+					n = HLL_SPARSE_XZERO_MAX_LEN
+				}
+				hll = append(hll, HLL_SPARSE_XZERO_BIT|byte((n-1)>>8), byte((n-1)&0xff))
+				length -= n
+			default:
+				hll = append(hll, byte(length-1))
+				length = 0
+			}
+		}
+	}
+	return hll
+}
+
+// hllRunsToDense return the dense HyperLogLog with the header of hdr and
+// the registers of runs.
+func hllRunsToDense(hdr []byte, runs []hllRun) []byte {
+	dense := make([]byte, HLL_DENSE_SIZE)
+	copy(dense, hdr[:HLL_HDR_SIZE])
+	dense[HLL_ENCODING_BYTE] = HLL_DENSE
+	registers := dense[HLL_HDR_SIZE:]
+	idx := 0
+	for _, run := range runs {
+		if run.val != 0 {
+			for j := 0; j < run.length; j++ {
+				hllDenseSet(registers, idx+j, run.val)
+			}
+		}
+		idx += run.length
+	}
+	return dense
+}
+
+// hllSparseSet set the register index of a sparse HyperLogLog to count if
+// greater. It returns the new HyperLogLog, that is promoted to dense when
+// count doesn't fit the sparse encoding or it gets too long, and 1 if the
+// register changed, 0 if not and -1 if the HyperLogLog is corrupted.
+func hllSparseSet(hll []byte, index int, count uint8) ([]byte, int) {
+	runs, ok := hllSparseRuns(hll)
+	if !ok {
+		return hll, -1
+	}
+	if count > HLL_SPARSE_VAL_MAX_VALUE {
+		dense := hllRunsToDense(hll, runs)
+		hllDenseSet(dense[HLL_HDR_SIZE:], index, count)
+		return dense, 1
+	}
+
+	// split the run holding the register in up to 3 runs.
+	start := 0
+	i := 0
+	for ; start+runs[i].length <= index; i++ {
+		start += runs[i].length
+	}
+	run := runs[i]
+	if run.val >= count {
+		return hll, 0
+	}
+	var split []hllRun
+	if before := index - start; before > 0 {
+		split = append(split, hllRun{val: run.val, length: before})
+	}
+	split = append(split, hllRun{val: count, length: 1})
+	if after := start + run.length - index - 1; after > 0 {
+		split = append(split, hllRun{val: run.val, length: after})
+	}
+	newRuns := make([]hllRun, 0, len(runs)+2)
+	newRuns = append(newRuns, runs[:i]...)
+	newRuns = append(newRuns, split...)
+	newRuns = append(newRuns, runs[i+1:]...)
+
+	hll = hllSparseEncode(hll, newRuns)
+	if len(hll) > server.hllSparseMaxBytes {
+		return hllRunsToDense(hll, newRuns), 1
+	}
+	return hll, 1
+}
+
+// hllAdd add ele to the HyperLogLog, and return it with 1 if a register
+// changed, 0 if not and -1 if it is corrupted.
+func hllAdd(hll []byte, ele []byte) ([]byte, int) {
+	if hll[HLL_ENCODING_BYTE] == HLL_DENSE {
+		if hllDenseAdd(hll[HLL_HDR_SIZE:], ele) {
+			return hll, 1
+		}
+		return hll, 0
+	}
+	index, count := hllPatLen(ele)
+	return hllSparseSet(hll, index, count)
+}
+
+// hllMerge set every register of max to the register of hll if greater,
+// and return false if hll is corrupted.
+func hllMerge(max []uint8, hll []byte) bool {
+	if hll[HLL_ENCODING_BYTE] == HLL_DENSE {
+		registers := hll[HLL_HDR_SIZE:]
+		for i := 0; i < HLL_REGISTERS; i++ {
+			if val := hllDenseGet(registers, i); val > max[i] {
+				max[i] = val
+			}
+		}
+		return true
+	}
+	runs, ok := hllSparseRuns(hll)
+	if !ok {
+		return false
+	}
+	idx := 0
+	for _, run := range runs {
+		for j := idx; j < idx+run.length; j++ {
+			if run.val > max[j] {
+				max[j] = run.val
+			}
+		}
+		idx += run.length
+	}
+	return true
+}
+
+// hllTau and hllSigma are the functions of the estimator of "New
+// cardinality estimation algorithms for HyperLogLog sketches" by Otmar
+// Ertl, that needs no bias correction.
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if zPrime == z {
+			break
+		}
+	}
+	return z / 3
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			break
+		}
+	}
+	return z
+}
+
+// hllCountRegisters estimate the cardinality from the registers values.
+func hllCountRegisters(max []uint8) uint64 {
+	var reghisto [64]int
+	for _, val := range max {
+		reghisto[val]++
+	}
+	m := float64(HLL_REGISTERS)
+	z := m * hllTau((m-float64(reghisto[HLL_Q+1]))/m)
+	for j := HLL_Q; j >= 1; j-- {
+		z += float64(reghisto[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(reghisto[0])/m)
+	return uint64(math.Round(HLL_ALPHA_INF * m * m / z))
+}
+
+// hllCount estimate the cardinality of the HyperLogLog, and return false
+// if it is corrupted.
+func hllCount(hll []byte) (uint64, bool) {
+	max := make([]uint8, HLL_REGISTERS)
+	if !hllMerge(max, hll) {
+		return 0, false
+	}
+	return hllCountRegisters(max), true
+}
+
+// hllStore set key to the HyperLogLog hll, o is its current value or nil.
+// The value is never compressed, as it changes on most PFADD.
+func hllStore(c *RedisClient, key, o *RedisObj, hll []byte) {
+	newVal := CreateObject(REDISSTR, string(hll))
+	if o == nil {
+		dbAdd(c.db, key, newVal)
+	} else {
+		dbOverwrite(c.db, key, newVal)
+	}
+	newVal.DecrRefCount()
+}
+
+func pfaddCommand(c *RedisClient) {
+	o := lookupKeyWrite(c.db, c.args[1])
+	var hll []byte
+	updated := 0
+	if o == nil {
+		hll = hllCreate()
+		updated++
+	} else {
+		if !isHLLObjectOrReply(c, o) {
+			return
+		}
+		hll = []byte(o.StrVal())
+	}
+	for _, ele := range c.args[2:] {
+		var ret int
+		hll, ret = hllAdd(hll, []byte(ele.StrVal()))
+		if ret == -1 {
+			c.AddReplyError(HLL_INVALID_OBJ_ERR)
+			return
+		}
+		updated += ret
+	}
+	if updated > 0 {
+		hllInvalidateCache(hll)
+		hllStore(c, c.args[1], o, hll)
+		c.AddReply(shared.cone)
+	} else {
+		c.AddReply(shared.czero)
+	}
+}
+
+func pfcountCommand(c *RedisClient) {
+	// the union of several keys is estimated from the max of every
+	// register, without any change to the keys.
+	if len(c.args) > 2 {
+		max := make([]uint8, HLL_REGISTERS)
+		for _, key := range c.args[1:] {
+			o := lookupKeyRead(c.db, key)
+			if o == nil {
+				continue
+			}
+			if !isHLLObjectOrReply(c, o) {
+				return
+			}
+			if !hllMerge(max, []byte(o.StrVal())) {
+				c.AddReplyError(HLL_INVALID_OBJ_ERR)
+				return
+			}
+		}
+		c.AddReplyInt(int64(hllCountRegisters(max)))
+		return
+	}
+
+	o := lookupKeyWrite(c.db, c.args[1])
+	if o == nil {
+		c.AddReply(shared.czero)
+		return
+	}
+	if !isHLLObjectOrReply(c, o) {
+		return
+	}
+	hll := []byte(o.StrVal())
+	if hllValidCache(hll) {
+		c.AddReplyInt(int64(binary.LittleEndian.Uint64(hll[HLL_CARD_BYTE:])))
+		return
+	}
+	card, ok := hllCount(hll)
+	if !ok {
+		c.AddReplyError(HLL_INVALID_OBJ_ERR)
+		return
+	}
+	binary.LittleEndian.PutUint64(hll[HLL_CARD_BYTE:], card)
+	hllStore(c, c.args[1], o, hll)
+	c.AddReplyInt(int64(card))
+}
+
+func pfmergeCommand(c *RedisClient) {
+	// the destination is merged with the sources, and is dense if any of
+	// them is.
+	max := make([]uint8, HLL_REGISTERS)
+	useDense := false
+	for _, key := range c.args[1:] {
+		o := lookupKeyRead(c.db, key)
+		if o == nil {
+			continue
+		}
+		if !isHLLObjectOrReply(c, o) {
+			return
+		}
+		hll := []byte(o.StrVal())
+		if hll[HLL_ENCODING_BYTE] == HLL_DENSE {
+			useDense = true
+		}
+		if !hllMerge(max, hll) {
+			c.AddReplyError(HLL_INVALID_OBJ_ERR)
+			return
+		}
+	}
+
+	// the registers of the destination are already in max, so its
+	// registers are replaced as a whole.
+	o := lookupKeyWrite(c.db, c.args[1])
+	hdr := hllCreate()
+	if o != nil {
+		hdr = []byte(o.StrVal())
+	}
+	runs := make([]hllRun, 0, HLL_REGISTERS)
+	for _, val := range max {
+		if val > HLL_SPARSE_VAL_MAX_VALUE {
+			useDense = true
+		}
+		runs = append(runs, hllRun{val: val, length: 1})
+	}
+	var hll []byte
+	if !useDense {
+		hll = hllSparseEncode(hdr, runs)
+		useDense = len(hll) > server.hllSparseMaxBytes
+	}
+	if useDense {
+		hll = hllRunsToDense(hdr, runs)
+	}
+	hllInvalidateCache(hll)
+	hllStore(c, c.args[1], o, hll)
+	c.AddReply(shared.ok)
+}
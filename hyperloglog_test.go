@@ -0,0 +1,170 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+// pfaddRange add the elements prefix0 to prefix(n-1) to key, in batches.
+func pfaddRange(c *RedisClient, key, prefix string, n int) {
+	for i := 0; i < n; i += 20 {
+		args := []string{"pfadd", key}
+		for j := i; j < i+20 && j < n; j++ {
+			args = append(args, prefix+strconv.Itoa(j))
+		}
+		execCommand(c, args...)
+	}
+}
+
+// hllEncoding return the encoding byte of the HyperLogLog at key.
+func hllEncoding(c *RedisClient, key string) byte {
+	o := lookupKeyRead(c.db, CreateObject(REDISSTR, key))
+	return o.StrVal()[HLL_ENCODING_BYTE]
+}
+
+func TestPfaddPfcountCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":1\r\n", execCommand(c, "pfadd", "hll"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "pfadd", "hll"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "pfcount", "hll"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "pfadd", "hll", "a", "b", "c"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "pfadd", "hll", "a", "b"))
+	assert.Equal(t, ":3\r\n", execCommand(c, "pfcount", "hll"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "pfcount", "nokey"))
+	assert.Equal(t, HLL_SPARSE, hllEncoding(c, "hll"))
+
+	// the standard error is 0.81%.
+	for _, n := range []int{1000, 10000, 50000} {
+		execCommand(c, "del", "hll")
+		pfaddRange(c, "hll", "ele:", n)
+		reply := execCommand(c, "pfcount", "hll")
+		count, _ := strconv.Atoi(reply[1 : len(reply)-2])
+		assert.InDelta(t, n, count, float64(n)*0.03)
+	}
+	assert.Equal(t, HLL_DENSE, hllEncoding(c, "hll"))
+}
+
+func TestHllSparseDense(t *testing.T) {
+	c := testClient()
+	// with no room for the sparse encoding every HyperLogLog is dense, and
+	// the registers are the same.
+	pfaddRange(c, "sparse", "x", 300)
+	server.hllSparseMaxBytes = 0
+	pfaddRange(c, "dense", "x", 300)
+	assert.Equal(t, HLL_SPARSE, hllEncoding(c, "sparse"))
+	assert.Equal(t, HLL_DENSE, hllEncoding(c, "dense"))
+	assert.Equal(t, execCommand(c, "pfcount", "sparse"), execCommand(c, "pfcount", "dense"))
+
+	max1, max2 := make([]uint8, HLL_REGISTERS), make([]uint8, HLL_REGISTERS)
+	assert.True(t, hllMerge(max1, []byte(lookupKeyRead(c.db, CreateObject(REDISSTR, "sparse")).StrVal())))
+	assert.True(t, hllMerge(max2, []byte(lookupKeyRead(c.db, CreateObject(REDISSTR, "dense")).StrVal())))
+	assert.Equal(t, max1, max2)
+
+	// a sparse HyperLogLog is promoted when it gets too long.
+	server.hllSparseMaxBytes = 200
+	pfaddRange(c, "promoted", "x", 300)
+	assert.Equal(t, HLL_DENSE, hllEncoding(c, "promoted"))
+	assert.Equal(t, execCommand(c, "pfcount", "sparse"), execCommand(c, "pfcount", "promoted"))
+}
+
+func TestHllSparseSet(t *testing.T) {
+	hll := hllCreate()
+	assert.Equal(t, []byte{0x7f, 0xff}, hll[HLL_HDR_SIZE:])
+	hll, ret := hllSparseSet(hll, 100, 3)
+	assert.Equal(t, 1, ret)
+	// XZERO of 100, VAL 3, XZERO of 16283.
+	assert.Equal(t, []byte{0x40, 0x63, 0x88, 0x7f, 0x9a}, hll[HLL_HDR_SIZE:])
+	hll, ret = hllSparseSet(hll, 100, 2)
+	assert.Equal(t, 0, ret)
+	hll, _ = hllSparseSet(hll, 101, 3)
+	assert.Equal(t, []byte{0x40, 0x63, 0x89, 0x7f, 0x99}, hll[HLL_HDR_SIZE:])
+	hll, _ = hllSparseSet(hll, 0, 40)
+	assert.Equal(t, HLL_DENSE, hll[HLL_ENCODING_BYTE])
+	registers := hll[HLL_HDR_SIZE:]
+	assert.Equal(t, uint8(40), hllDenseGet(registers, 0))
+	assert.Equal(t, uint8(3), hllDenseGet(registers, 100))
+	assert.Equal(t, uint8(3), hllDenseGet(registers, 101))
+	assert.Equal(t, uint8(0), hllDenseGet(registers, 102))
+
+	hllDenseSet(registers, HLL_REGISTERS-1, HLL_REGISTER_MAX)
+	assert.Equal(t, uint8(HLL_REGISTER_MAX), hllDenseGet(registers, HLL_REGISTERS-1))
+	assert.Equal(t, uint8(0), hllDenseGet(registers, HLL_REGISTERS-2))
+}
+
+func TestHllCachedCardinality(t *testing.T) {
+	c := testClient()
+	execCommand(c, "pfadd", "hll", "a", "b")
+	assert.Equal(t, "$1\r\n\x80\r\n", execCommand(c, "getrange", "hll", "15", "15"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "pfcount", "hll"))
+	assert.Equal(t, "$8\r\n\x02\x00\x00\x00\x00\x00\x00\x00\r\n", execCommand(c, "getrange", "hll", "8", "15"))
+	execCommand(c, "pfadd", "hll", "a")
+	assert.Equal(t, "$1\r\n\x00\r\n", execCommand(c, "getrange", "hll", "15", "15"))
+	execCommand(c, "pfadd", "hll", "c")
+	assert.Equal(t, "$1\r\n\x80\r\n", execCommand(c, "getrange", "hll", "15", "15"))
+
+	// the cached value is trusted.
+	hll := []byte(lookupKeyRead(c.db, CreateObject(REDISSTR, "hll")).StrVal())
+	hll[HLL_CARD_BYTE], hll[HLL_CARD_BYTE+7] = 100, 0
+	execCommand(c, "set", "hll", string(hll))
+	assert.Equal(t, ":100\r\n", execCommand(c, "pfcount", "hll"))
+}
+
+func TestPfcountPfmergeCmd(t *testing.T) {
+	c := testClient()
+	pfaddRange(c, "h0", "a", 500)
+	pfaddRange(c, "h1", "a", 500)
+	pfaddRange(c, "h2", "a", 1000)
+	pfaddRange(c, "h3", "b", 1000)
+	server.hllSparseMaxBytes = 0
+	pfaddRange(c, "h4", "c", 100)
+	server.hllSparseMaxBytes = CONFIG_DEFAULT_HLL_SPARSE_MAX_BYTES
+
+	assert.Equal(t, execCommand(c, "pfcount", "h2"), execCommand(c, "pfcount", "h1", "h2", "nokey"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "pfmerge", "dst", "h2", "h3"))
+	union := execCommand(c, "pfcount", "h1", "h2", "h3")
+	assert.Equal(t, union, execCommand(c, "pfcount", "dst"))
+	count, _ := strconv.Atoi(union[1 : len(union)-2])
+	assert.InDelta(t, 2000, count, 60)
+
+	// the destination is merged too, and is dense if any source is.
+	assert.Equal(t, "+OK\r\n", execCommand(c, "pfmerge", "h1", "h3"))
+	assert.Equal(t, union, execCommand(c, "pfcount", "h1", "h2"))
+	assert.Equal(t, HLL_SPARSE, hllEncoding(c, "h1"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "pfmerge", "h1", "h4"))
+	assert.Equal(t, HLL_DENSE, hllEncoding(c, "h1"))
+	assert.Equal(t, execCommand(c, "pfcount", "h0", "h3", "h4"), execCommand(c, "pfcount", "h1"))
+
+	assert.Equal(t, "+OK\r\n", execCommand(c, "pfmerge", "empty"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "pfcount", "empty"))
+}
+
+func TestHllInvalidObjects(t *testing.T) {
+	c := testClient()
+	invalidType := "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"
+	wrongType := "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	execCommand(c, "set", "str", "not a hyperloglog")
+	execCommand(c, "rpush", "list", "a")
+	assert.Equal(t, invalidType, execCommand(c, "pfadd", "str", "a"))
+	assert.Equal(t, wrongType, execCommand(c, "pfadd", "list", "a"))
+	assert.Equal(t, wrongType, execCommand(c, "pfcount", "list"))
+	assert.Equal(t, invalidType, execCommand(c, "pfcount", "nokey", "str"))
+	assert.Equal(t, wrongType, execCommand(c, "pfcount", "nokey", "list"))
+	assert.Equal(t, invalidType, execCommand(c, "pfmerge", "dst", "str"))
+	assert.Equal(t, wrongType, execCommand(c, "pfmerge", "dst", "list"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "dst"))
+
+	// a dense HyperLogLog must have all the registers.
+	hll := hllCreate()
+	hll[HLL_ENCODING_BYTE] = HLL_DENSE
+	execCommand(c, "set", "short", string(hll))
+	assert.Equal(t, invalidType, execCommand(c, "pfcount", "short"))
+
+	// sparse opcodes not covering all the registers.
+	hll = hllCreate()
+	hllInvalidateCache(hll)
+	execCommand(c, "set", "corrupted", string(hll[:len(hll)-1]))
+	assert.Equal(t, "-INVALIDOBJ Corrupted HLL object detected\r\n", execCommand(c, "pfcount", "corrupted"))
+	assert.Equal(t, "-INVALIDOBJ Corrupted HLL object detected\r\n", execCommand(c, "pfadd", "corrupted", "a"))
+	assert.Equal(t, "-INVALIDOBJ Corrupted HLL object detected\r\n", execCommand(c, "pfmerge", "dst", "corrupted"))
+}
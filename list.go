@@ -6,8 +6,11 @@ type ListNode struct {
 	prev *ListNode
 }
 
+// ListFunc holds the optional callbacks of the list, EqualFunc is used by
+// ListSearchKey and DupFunc by ListDup, which shares the values if not set.
 type ListFunc struct {
 	EqualFunc func(a, b *RedisObj) bool
+	DupFunc   func(val *RedisObj) *RedisObj
 }
 
 type List struct {
@@ -17,6 +20,19 @@ type List struct {
 	length int
 }
 
+// directions of the list iterator.
+const (
+	AL_START_HEAD int = 0
+	AL_START_TAIL int = 1
+)
+
+// ListIterator walk the list from head to tail or from tail to head. The
+// node returned by ListNext can be deleted without breaking the iteration.
+type ListIterator struct {
+	next      *ListNode
+	direction int
+}
+
 func ListCreate(listFunc ListFunc) *List {
 	var list List
 	list.ListFunc = listFunc
@@ -35,6 +51,14 @@ func (list *List) ListLast() *ListNode {
 	return list.tail
 }
 
+func (node *ListNode) ListNextNode() *ListNode {
+	return node.next
+}
+
+func (node *ListNode) ListPrevNode() *ListNode {
+	return node.prev
+}
+
 func (list *List) ListSearchKey(val *RedisObj) *ListNode {
 	p := list.head
 	for p != nil {
@@ -74,39 +98,152 @@ func (list *List) ListAddNodeTail(val *RedisObj) {
 	list.length += 1
 }
 
+// ListInsertNode insert val after the node old if after is true, otherwise
+// before it.
+func (list *List) ListInsertNode(old *ListNode, val *RedisObj, after bool) {
+	node := &ListNode{Val: val}
+	if after {
+		node.prev = old
+		node.next = old.next
+		if list.tail == old {
+			list.tail = node
+		}
+	} else {
+		node.next = old
+		node.prev = old.prev
+		if list.head == old {
+			list.head = node
+		}
+	}
+	if node.prev != nil {
+		node.prev.next = node
+	}
+	if node.next != nil {
+		node.next.prev = node
+	}
+	list.length += 1
+}
+
+// ListDelKey delete the first node holding a value equal to val.
 func (list *List) ListDelKey(val *RedisObj) {
-	p := list.ListSearchKey(val)
+	list.ListDelNode(list.ListSearchKey(val))
+}
 
-	if list.head == p {
-		if p.next != nil {
-			p.next.prev = nil
-		}
-		list.head = p.next
-		p.next = nil
+// ListDelNode unlink the node n from the list in O(1).
+func (list *List) ListDelNode(n *ListNode) {
+	if n == nil {
+		return
+	}
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		list.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		list.tail = n.prev
 	}
+	n.next = nil
+	n.prev = nil
+	list.length -= 1
+}
 
-	if list.tail == p {
-		if p.prev != nil {
-			p.prev.next = nil
+// ListIndex return the node at index, where 0 is the head and -1 is the
+// tail, or nil if index is out of range.
+func (list *List) ListIndex(index int) *ListNode {
+	var n *ListNode
+	if index < 0 {
+		index = -index - 1
+		n = list.tail
+		for n != nil && index > 0 {
+			n = n.prev
+			index--
+		}
+	} else {
+		n = list.head
+		for n != nil && index > 0 {
+			n = n.next
+			index--
 		}
-		list.tail = p.prev
-		p.prev = nil
 	}
+	return n
+}
 
-	if p.prev != nil {
-		p.prev.next = p.next
+func (list *List) ListGetIterator(direction int) *ListIterator {
+	iter := &ListIterator{direction: direction}
+	if direction == AL_START_HEAD {
+		iter.next = list.head
+	} else {
+		iter.next = list.tail
 	}
-	if p.next != nil {
-		p.next.prev = p.prev
+	return iter
+}
+
+// ListRewind reset the iterator to the head of the list.
+func (list *List) ListRewind(iter *ListIterator) {
+	iter.next = list.head
+	iter.direction = AL_START_HEAD
+}
+
+// ListRewindTail reset the iterator to the tail of the list.
+func (list *List) ListRewindTail(iter *ListIterator) {
+	iter.next = list.tail
+	iter.direction = AL_START_TAIL
+}
+
+// ListNext return the next node, or nil when the iteration is done.
+func (iter *ListIterator) ListNext() *ListNode {
+	current := iter.next
+	if current != nil {
+		if iter.direction == AL_START_HEAD {
+			iter.next = current.next
+		} else {
+			iter.next = current.prev
+		}
 	}
-	p.next = nil
-	p.prev = nil
+	return current
+}
 
-	list.length -= 1
+// ListDup return a copy of the list, the values are copied with DupFunc if
+// set, otherwise the new list shares the same values.
+func (list *List) ListDup() *List {
+	dup := ListCreate(list.ListFunc)
+	iter := list.ListGetIterator(AL_START_HEAD)
+	for n := iter.ListNext(); n != nil; n = iter.ListNext() {
+		val := n.Val
+		if dup.DupFunc != nil {
+			val = dup.DupFunc(val)
+		}
+		dup.ListAddNodeTail(val)
+	}
+	return dup
 }
 
-func (list *List) ListDelNode(n *ListNode) {
-	if n != nil {
-		list.ListDelKey(n.Val)
+// ListRotate move the tail node to the head.
+func (list *List) ListRotate() {
+	if list.length <= 1 {
+		return
+	}
+	tail := list.tail
+	list.tail = tail.prev
+	list.tail.next = nil
+	tail.prev = nil
+	tail.next = list.head
+	list.head.prev = tail
+	list.head = tail
+}
+
+// ListRotateHeadToTail move the head node to the tail.
+func (list *List) ListRotateHeadToTail() {
+	if list.length <= 1 {
+		return
 	}
+	head := list.head
+	list.head = head.next
+	list.head.prev = nil
+	head.next = nil
+	head.prev = list.tail
+	list.tail.next = head
+	list.tail = head
 }
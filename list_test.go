@@ -59,3 +59,98 @@ func TestList(t *testing.T) {
 	l.ListDelNode(l.ListLast())
 	assert.Equal(t, 0, l.ListLength())
 }
+
+func listValues(l *List, direction int) []string {
+	var vals []string
+	iter := l.ListGetIterator(direction)
+	for n := iter.ListNext(); n != nil; n = iter.ListNext() {
+		vals = append(vals, n.Val.StrVal())
+	}
+	return vals
+}
+
+func TestListDelDuplicateNode(t *testing.T) {
+	l := ListCreate(ListFunc{EqualFunc: RedisStrEqual})
+	l.ListAddNodeTail(CreateObject(REDISSTR, "a"))
+	l.ListAddNodeTail(CreateObject(REDISSTR, "b"))
+	l.ListAddNodeTail(CreateObject(REDISSTR, "a"))
+
+	// the tail node must be deleted, not the first node with the same value.
+	l.ListDelNode(l.ListLast())
+	assert.Equal(t, []string{"a", "b"}, listValues(l, AL_START_HEAD))
+	l.ListAddNodeTail(CreateObject(REDISSTR, "a"))
+	l.ListDelNode(l.ListIndex(2))
+	assert.Equal(t, []string{"a", "b"}, listValues(l, AL_START_HEAD))
+
+	l.ListDelKey(CreateObject(REDISSTR, "none"))
+	assert.Equal(t, 2, l.ListLength())
+}
+
+func TestListIterator(t *testing.T) {
+	l := ListCreate(ListFunc{EqualFunc: RedisStrEqual})
+	assert.Nil(t, l.ListGetIterator(AL_START_HEAD).ListNext())
+	for _, v := range []string{"1", "2", "3", "4"} {
+		l.ListAddNodeTail(CreateObject(REDISSTR, v))
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4"}, listValues(l, AL_START_HEAD))
+	assert.Equal(t, []string{"4", "3", "2", "1"}, listValues(l, AL_START_TAIL))
+
+	// delete the current node while iterating.
+	iter := l.ListGetIterator(AL_START_TAIL)
+	for n := iter.ListNext(); n != nil; n = iter.ListNext() {
+		if n.Val.StrVal() == "3" || n.Val.StrVal() == "4" {
+			l.ListDelNode(n)
+		}
+	}
+	assert.Equal(t, []string{"1", "2"}, listValues(l, AL_START_HEAD))
+
+	l.ListRewind(iter)
+	assert.Equal(t, "1", iter.ListNext().Val.StrVal())
+	l.ListRewindTail(iter)
+	assert.Equal(t, "2", iter.ListNext().Val.StrVal())
+}
+
+func TestListIndexInsert(t *testing.T) {
+	l := ListCreate(ListFunc{EqualFunc: RedisStrEqual})
+	assert.Nil(t, l.ListIndex(0))
+	assert.Nil(t, l.ListIndex(-1))
+	l.ListAddNodeTail(CreateObject(REDISSTR, "b"))
+	l.ListInsertNode(l.ListFirst(), CreateObject(REDISSTR, "a"), false)
+	l.ListInsertNode(l.ListLast(), CreateObject(REDISSTR, "d"), true)
+	l.ListInsertNode(l.ListIndex(1), CreateObject(REDISSTR, "c"), true)
+	assert.Equal(t, 4, l.ListLength())
+	assert.Equal(t, []string{"a", "b", "c", "d"}, listValues(l, AL_START_HEAD))
+	assert.Equal(t, []string{"d", "c", "b", "a"}, listValues(l, AL_START_TAIL))
+
+	assert.Equal(t, "a", l.ListIndex(0).Val.StrVal())
+	assert.Equal(t, "c", l.ListIndex(2).Val.StrVal())
+	assert.Equal(t, "d", l.ListIndex(-1).Val.StrVal())
+	assert.Equal(t, "a", l.ListIndex(-4).Val.StrVal())
+	assert.Nil(t, l.ListIndex(4))
+	assert.Nil(t, l.ListIndex(-5))
+}
+
+func TestListRotateDup(t *testing.T) {
+	l := ListCreate(ListFunc{EqualFunc: RedisStrEqual})
+	l.ListRotate()
+	for _, v := range []string{"1", "2", "3"} {
+		l.ListAddNodeTail(CreateObject(REDISSTR, v))
+	}
+	l.ListRotate()
+	assert.Equal(t, []string{"3", "1", "2"}, listValues(l, AL_START_HEAD))
+	assert.Equal(t, []string{"2", "1", "3"}, listValues(l, AL_START_TAIL))
+	l.ListRotateHeadToTail()
+	assert.Equal(t, []string{"1", "2", "3"}, listValues(l, AL_START_HEAD))
+	assert.Equal(t, []string{"3", "2", "1"}, listValues(l, AL_START_TAIL))
+
+	dup := l.ListDup()
+	assert.Equal(t, l.ListFirst().Val, dup.ListFirst().Val)
+	dup.ListDelNode(dup.ListFirst())
+	assert.Equal(t, 3, l.ListLength())
+	assert.Equal(t, []string{"2", "3"}, listValues(dup, AL_START_HEAD))
+
+	l.DupFunc = dupStringObject
+	dup = l.ListDup()
+	assert.NotSame(t, l.ListFirst().Val, dup.ListFirst().Val)
+	assert.Equal(t, []string{"1", "2", "3"}, listValues(dup, AL_START_HEAD))
+}
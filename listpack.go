@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// A listpack is a contiguous buffer of string and integer elements:
+//
+//	<total-bytes> <num-elements> <element-1> ... <element-N> <end>
+//
+// total-bytes is a 32 bit and num-elements a 16 bit little endian integer,
+// end is the LP_EOF byte. Every element is its encoding followed by the
+// data and by the backlen, the length of encoding+data stored from right to
+// left so the listpack can be walked in both directions. An element is
+// addressed by its offset in the buffer.
+const (
+	LP_HDR_SIZE           int  = 6
+	LP_HDR_NUMELE_UNKNOWN int  = 65535
+	LP_EOF                byte = 0xFF
+)
+
+// encodings of the elements.
+const (
+	LP_ENCODING_7BIT_UINT      byte = 0x00
+	LP_ENCODING_7BIT_UINT_MASK byte = 0x80
+	LP_ENCODING_6BIT_STR       byte = 0x80
+	LP_ENCODING_6BIT_STR_MASK  byte = 0xC0
+	LP_ENCODING_13BIT_INT      byte = 0xC0
+	LP_ENCODING_13BIT_INT_MASK byte = 0xE0
+	LP_ENCODING_12BIT_STR      byte = 0xE0
+	LP_ENCODING_12BIT_STR_MASK byte = 0xF0
+	LP_ENCODING_32BIT_STR      byte = 0xF0
+	LP_ENCODING_16BIT_INT      byte = 0xF1
+	LP_ENCODING_24BIT_INT      byte = 0xF2
+	LP_ENCODING_32BIT_INT      byte = 0xF3
+	LP_ENCODING_64BIT_INT      byte = 0xF4
+)
+
+// where of LpInsert.
+const (
+	LP_BEFORE  int = 0
+	LP_AFTER   int = 1
+	LP_REPLACE int = 2
+)
+
+type Listpack struct {
+	buf []byte
+}
+
+func LpNew() *Listpack {
+	lp := &Listpack{buf: make([]byte, LP_HDR_SIZE+1)}
+	lp.buf[LP_HDR_SIZE] = LP_EOF
+	lp.lpSetHeader(0)
+	return lp
+}
+
+// LpDup return a copy of the listpack.
+func (lp *Listpack) LpDup() *Listpack {
+	buf := make([]byte, len(lp.buf))
+	copy(buf, lp.buf)
+	return &Listpack{buf: buf}
+}
+
+func (lp *Listpack) LpBytes() int {
+	return len(lp.buf)
+}
+
+func (lp *Listpack) lpSetHeader(numele int) {
+	binary.LittleEndian.PutUint32(lp.buf[0:4], uint32(len(lp.buf)))
+	if numele >= LP_HDR_NUMELE_UNKNOWN {
+		numele = LP_HDR_NUMELE_UNKNOWN
+	}
+	binary.LittleEndian.PutUint16(lp.buf[4:6], uint16(numele))
+}
+
+// lpIncrNumElements add incr to the number of elements in the header, an
+// unknown number stays unknown.
+func (lp *Listpack) lpIncrNumElements(incr int) {
+	numele := int(binary.LittleEndian.Uint16(lp.buf[4:6]))
+	if numele != LP_HDR_NUMELE_UNKNOWN {
+		numele += incr
+	}
+	lp.lpSetHeader(numele)
+}
+
+// LpLength return the number of elements, the listpack is walked if there
+// are too many elements to be stored in the header.
+func (lp *Listpack) LpLength() int {
+	numele := int(binary.LittleEndian.Uint16(lp.buf[4:6]))
+	if numele != LP_HDR_NUMELE_UNKNOWN {
+		return numele
+	}
+	count := 0
+	for p := lp.LpFirst(); p != -1; p = lp.LpNext(p) {
+		count++
+	}
+	if count < LP_HDR_NUMELE_UNKNOWN {
+		lp.lpSetHeader(count)
+	}
+	return count
+}
+
+// lpStringToInt64 return the integer value of s if it can be stored as an
+// integer without losing its exact representation.
+func lpStringToInt64(s string) (int64, bool) {
+	return string2ll(s)
+}
+
+// lpEncodeElement return the encoding and the data of an element.
+func lpEncodeElement(ele string) []byte {
+	if v, ok := lpStringToInt64(ele); ok {
+		switch {
+		case v >= 0 && v <= 127:
+			return []byte{byte(v)}
+		case v >= -4096 && v <= 4095:
+			uv := uint64(v) & 0x1FFF
+			return []byte{LP_ENCODING_13BIT_INT | byte(uv>>8), byte(uv)}
+		case v >= -32768 && v <= 32767:
+			return []byte{LP_ENCODING_16BIT_INT, byte(v), byte(v >> 8)}
+		case v >= -8388608 && v <= 8388607:
+			return []byte{LP_ENCODING_24BIT_INT, byte(v), byte(v >> 8), byte(v >> 16)}
+		case v >= -2147483648 && v <= 2147483647:
+			buf := []byte{LP_ENCODING_32BIT_INT, 0, 0, 0, 0}
+			binary.LittleEndian.PutUint32(buf[1:], uint32(v))
+			return buf
+		default:
+			buf := make([]byte, 9)
+			buf[0] = LP_ENCODING_64BIT_INT
+			binary.LittleEndian.PutUint64(buf[1:], uint64(v))
+			return buf
+		}
+	}
+
+	var buf []byte
+	l := len(ele)
+	if l < 64 {
+		buf = make([]byte, 1, 1+l)
+		buf[0] = LP_ENCODING_6BIT_STR | byte(l)
+	} else if l < 4096 {
+		buf = make([]byte, 2, 2+l)
+		buf[0] = LP_ENCODING_12BIT_STR | byte(l>>8)
+		buf[1] = byte(l)
+	} else {
+		buf = make([]byte, 5, 5+l)
+		buf[0] = LP_ENCODING_32BIT_STR
+		binary.LittleEndian.PutUint32(buf[1:], uint32(l))
+	}
+	return append(buf, ele...)
+}
+
+// lpEncodeBacklen return the backlen of an element with encoding+data of
+// l bytes. The first byte holds the most significant bits, the others have
+// the high bit set to tell that more bytes follow on the left.
+func lpEncodeBacklen(l int) []byte {
+	switch {
+	case l <= 127:
+		return []byte{byte(l)}
+	case l < 16383:
+		return []byte{byte(l >> 7), byte(l&127) | 128}
+	case l < 2097151:
+		return []byte{byte(l >> 14), byte((l>>7)&127) | 128, byte(l&127) | 128}
+	case l < 268435455:
+		return []byte{byte(l >> 21), byte((l>>14)&127) | 128, byte((l>>7)&127) | 128, byte(l&127) | 128}
+	}
+	return []byte{byte(l >> 28), byte((l>>21)&127) | 128, byte((l>>14)&127) | 128,
+		byte((l>>7)&127) | 128, byte(l&127) | 128}
+}
+
+// lpDecodeBacklen decode the backlen ending at offset p, return the length
+// of the previous encoding+data and the size of the backlen.
+func (lp *Listpack) lpDecodeBacklen(p int) (int, int) {
+	val, shift, size := 0, 0, 0
+	for {
+		b := lp.buf[p-size]
+		val |= int(b&127) << shift
+		size++
+		if b&128 == 0 {
+			break
+		}
+		shift += 7
+	}
+	return val, size
+}
+
+// lpCurrentEncodedSize return the size of the encoding and the data of the
+// element at p.
+func (lp *Listpack) lpCurrentEncodedSize(p int) int {
+	b := lp.buf[p]
+	switch {
+	case b&LP_ENCODING_7BIT_UINT_MASK == LP_ENCODING_7BIT_UINT:
+		return 1
+	case b&LP_ENCODING_6BIT_STR_MASK == LP_ENCODING_6BIT_STR:
+		return 1 + int(b&0x3F)
+	case b&LP_ENCODING_13BIT_INT_MASK == LP_ENCODING_13BIT_INT:
+		return 2
+	case b&LP_ENCODING_12BIT_STR_MASK == LP_ENCODING_12BIT_STR:
+		return 2 + (int(b&0x0F)<<8 | int(lp.buf[p+1]))
+	}
+	switch b {
+	case LP_ENCODING_16BIT_INT:
+		return 3
+	case LP_ENCODING_24BIT_INT:
+		return 4
+	case LP_ENCODING_32BIT_INT:
+		return 5
+	case LP_ENCODING_64BIT_INT:
+		return 9
+	case LP_ENCODING_32BIT_STR:
+		return 5 + int(binary.LittleEndian.Uint32(lp.buf[p+1:]))
+	}
+	panic("invalid listpack encoding")
+}
+
+// lpEntrySize return the total size of the element at p, backlen included.
+func (lp *Listpack) lpEntrySize(p int) int {
+	l := lp.lpCurrentEncodedSize(p)
+	return l + len(lpEncodeBacklen(l))
+}
+
+// LpFirst return the offset of the first element, -1 if lp is empty.
+func (lp *Listpack) LpFirst() int {
+	if lp.buf[LP_HDR_SIZE] == LP_EOF {
+		return -1
+	}
+	return LP_HDR_SIZE
+}
+
+// LpLast return the offset of the last element, -1 if lp is empty.
+func (lp *Listpack) LpLast() int {
+	return lp.LpPrev(len(lp.buf) - 1)
+}
+
+// LpNext return the offset of the element after p, -1 if p is the last one.
+func (lp *Listpack) LpNext(p int) int {
+	p += lp.lpEntrySize(p)
+	if lp.buf[p] == LP_EOF {
+		return -1
+	}
+	return p
+}
+
+// LpPrev return the offset of the element before p, -1 if p is the first one.
+func (lp *Listpack) LpPrev(p int) int {
+	if p == LP_HDR_SIZE {
+		return -1
+	}
+	l, size := lp.lpDecodeBacklen(p - 1)
+	return p - size - l
+}
+
+// LpGet return the element at p, isInt tells whether the element is stored
+// as the integer ival or as the string sval.
+func (lp *Listpack) LpGet(p int) (sval string, ival int64, isInt bool) {
+	b := lp.buf[p]
+	switch {
+	case b&LP_ENCODING_7BIT_UINT_MASK == LP_ENCODING_7BIT_UINT:
+		return "", int64(b), true
+	case b&LP_ENCODING_6BIT_STR_MASK == LP_ENCODING_6BIT_STR:
+		l := int(b & 0x3F)
+		return string(lp.buf[p+1 : p+1+l]), 0, false
+	case b&LP_ENCODING_13BIT_INT_MASK == LP_ENCODING_13BIT_INT:
+		uv := int64(b&0x1F)<<8 | int64(lp.buf[p+1])
+		if uv >= 1<<12 {
+			uv -= 1 << 13
+		}
+		return "", uv, true
+	case b&LP_ENCODING_12BIT_STR_MASK == LP_ENCODING_12BIT_STR:
+		l := int(b&0x0F)<<8 | int(lp.buf[p+1])
+		return string(lp.buf[p+2 : p+2+l]), 0, false
+	}
+	switch b {
+	case LP_ENCODING_16BIT_INT:
+		return "", int64(int16(binary.LittleEndian.Uint16(lp.buf[p+1:]))), true
+	case LP_ENCODING_24BIT_INT:
+		uv := uint32(lp.buf[p+1]) | uint32(lp.buf[p+2])<<8 | uint32(lp.buf[p+3])<<16
+		return "", int64(int32(uv<<8) >> 8), true
+	case LP_ENCODING_32BIT_INT:
+		return "", int64(int32(binary.LittleEndian.Uint32(lp.buf[p+1:]))), true
+	case LP_ENCODING_64BIT_INT:
+		return "", int64(binary.LittleEndian.Uint64(lp.buf[p+1:])), true
+	case LP_ENCODING_32BIT_STR:
+		l := int(binary.LittleEndian.Uint32(lp.buf[p+1:]))
+		return string(lp.buf[p+5 : p+5+l]), 0, false
+	}
+	panic("invalid listpack encoding")
+}
+
+// LpGetString return the element at p as a string.
+func (lp *Listpack) LpGetString(p int) string {
+	sval, ival, isInt := lp.LpGet(p)
+	if isInt {
+		return strconv.FormatInt(ival, 10)
+	}
+	return sval
+}
+
+// LpGetObject return the element at p as a new string object.
+func (lp *Listpack) LpGetObject(p int) *RedisObj {
+	sval, ival, isInt := lp.LpGet(p)
+	if isInt {
+		return CreateFromInt(ival)
+	}
+	return CreateObject(REDISSTR, sval)
+}
+
+// LpInsert insert ele before or after the element at p, or replace it.
+// With LP_BEFORE p can be the offset of LP_EOF to append. Return the offset
+// of the inserted element.
+func (lp *Listpack) LpInsert(ele string, p int, where int) int {
+	if where == LP_AFTER {
+		p += lp.lpEntrySize(p)
+		where = LP_BEFORE
+	}
+	oldlen := 0
+	if where == LP_REPLACE {
+		oldlen = lp.lpEntrySize(p)
+	}
+	enc := lpEncodeElement(ele)
+	entry := append(enc, lpEncodeBacklen(len(enc))...)
+
+	total := len(lp.buf)
+	delta := len(entry) - oldlen
+	if delta > 0 {
+		lp.buf = append(lp.buf, make([]byte, delta)...)
+	}
+	copy(lp.buf[p+len(entry):], lp.buf[p+oldlen:total])
+	copy(lp.buf[p:], entry)
+	if delta < 0 {
+		lp.buf = lp.buf[:total+delta]
+	}
+	if where == LP_REPLACE {
+		lp.lpIncrNumElements(0)
+	} else {
+		lp.lpIncrNumElements(1)
+	}
+	return p
+}
+
+// LpAppend add ele at the end of the listpack.
+func (lp *Listpack) LpAppend(ele string) {
+	lp.LpInsert(ele, len(lp.buf)-1, LP_BEFORE)
+}
+
+// LpPrepend add ele at the start of the listpack.
+func (lp *Listpack) LpPrepend(ele string) {
+	lp.LpInsert(ele, LP_HDR_SIZE, LP_BEFORE)
+}
+
+// LpReplace replace the element at p with ele.
+func (lp *Listpack) LpReplace(p int, ele string) int {
+	return lp.LpInsert(ele, p, LP_REPLACE)
+}
+
+// LpDelete delete the element at p, return the offset of the element that
+// followed it, -1 if it was the last one.
+func (lp *Listpack) LpDelete(p int) int {
+	lp.buf = append(lp.buf[:p], lp.buf[p+lp.lpEntrySize(p):]...)
+	lp.lpIncrNumElements(-1)
+	if lp.buf[p] == LP_EOF {
+		return -1
+	}
+	return p
+}
+
+// lpSplit move the elements from the offset p to the end to a new
+// listpack, which is returned.
+func (lp *Listpack) lpSplit(p int) *Listpack {
+	numele := lp.LpLength()
+	moved := 0
+	for q := p; q != -1; q = lp.LpNext(q) {
+		moved++
+	}
+	newLp := &Listpack{buf: make([]byte, LP_HDR_SIZE, LP_HDR_SIZE+len(lp.buf)-p)}
+	newLp.buf = append(newLp.buf, lp.buf[p:]...)
+	newLp.lpSetHeader(moved)
+	lp.buf = append(lp.buf[:p], LP_EOF)
+	lp.lpSetHeader(numele - moved)
+	return newLp
+}
+
+// LpSeek return the offset of the element at index, negative index counts
+// from the tail, -1 if index is out of range.
+func (lp *Listpack) LpSeek(index int) int {
+	numele := lp.LpLength()
+	if index < 0 {
+		index += numele
+	}
+	if index < 0 || index >= numele {
+		return -1
+	}
+	// walk from the nearest end.
+	if index < numele/2 {
+		p := lp.LpFirst()
+		for ; index > 0; index-- {
+			p = lp.LpNext(p)
+		}
+		return p
+	}
+	p := lp.LpLast()
+	for index = numele - 1 - index; index > 0; index-- {
+		p = lp.LpPrev(p)
+	}
+	return p
+}
+
+// lpCompare report whether the element at p is equal to ele.
+func (lp *Listpack) lpCompare(p int, ele string) bool {
+	sval, ival, isInt := lp.LpGet(p)
+	if isInt {
+		v, ok := lpStringToInt64(ele)
+		return ok && v == ival
+	}
+	return sval == ele
+}
+
+// LpFind return the offset of the first element equal to ele starting at
+// p, skipping skip elements after every compared one, -1 if not found.
+// With skip 1 only the keys of a listpack of key value pairs are compared.
+func (lp *Listpack) LpFind(p int, ele string, skip int) int {
+	for p != -1 {
+		if lp.lpCompare(p, ele) {
+			return p
+		}
+		p = lp.LpNext(p)
+		for i := 0; i < skip && p != -1; i++ {
+			p = lp.LpNext(p)
+		}
+	}
+	return -1
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// lpElements return the elements of lp from the first one.
+func lpElements(lp *Listpack) []string {
+	var elements []string
+	for p := lp.LpFirst(); p != -1; p = lp.LpNext(p) {
+		elements = append(elements, lp.LpGetString(p))
+	}
+	return elements
+}
+
+func TestListpackEncoding(t *testing.T) {
+	lp := LpNew()
+	assert.Equal(t, 0, lp.LpLength())
+	assert.Equal(t, -1, lp.LpFirst())
+	assert.Equal(t, -1, lp.LpLast())
+
+	// one element of every encoding.
+	elements := []string{"0", "127", "128", "-4096", "4095", "-32768", "32767", "-8388608", "8388607",
+		"-2147483648", "2147483647", "-9223372036854775808", "9223372036854775807",
+		"", "a", "01", "+1", strings.Repeat("b", 63), strings.Repeat("c", 64),
+		strings.Repeat("d", 4095), strings.Repeat("e", 4096), strings.Repeat("f", 20000)}
+	for _, ele := range elements {
+		lp.LpAppend(ele)
+	}
+	assert.Equal(t, len(elements), lp.LpLength())
+	assert.Equal(t, elements, lpElements(lp))
+
+	// walk backward.
+	i := len(elements) - 1
+	for p := lp.LpLast(); p != -1; p = lp.LpPrev(p) {
+		assert.Equal(t, elements[i], lp.LpGetString(p))
+		i--
+	}
+	assert.Equal(t, -1, i)
+
+	sval, ival, isInt := lp.LpGet(lp.LpSeek(3))
+	assert.True(t, isInt)
+	assert.Equal(t, int64(-4096), ival)
+	sval, _, isInt = lp.LpGet(lp.LpSeek(15))
+	assert.False(t, isInt)
+	assert.Equal(t, "01", sval)
+}
+
+func TestListpackInsertDelete(t *testing.T) {
+	lp := LpNew()
+	lp.LpAppend("b")
+	lp.LpPrepend("a")
+	lp.LpAppend("d")
+	p := lp.LpInsert("c", lp.LpSeek(1), LP_AFTER)
+	assert.Equal(t, "c", lp.LpGetString(p))
+	lp.LpInsert("x", lp.LpSeek(0), LP_BEFORE)
+	assert.Equal(t, []string{"x", "a", "b", "c", "d"}, lpElements(lp))
+	assert.Equal(t, "d", lp.LpGetString(lp.LpSeek(-1)))
+	assert.Equal(t, -1, lp.LpSeek(5))
+	assert.Equal(t, -1, lp.LpSeek(-6))
+
+	lp.LpReplace(lp.LpSeek(2), strings.Repeat("y", 200))
+	assert.Equal(t, strings.Repeat("y", 200), lp.LpGetString(lp.LpSeek(2)))
+
+	p = lp.LpDelete(lp.LpSeek(0))
+	assert.Equal(t, "a", lp.LpGetString(p))
+	assert.Equal(t, -1, lp.LpDelete(lp.LpLast()))
+	assert.Equal(t, 3, lp.LpLength())
+	assert.Equal(t, lp.LpBytes(), int(lp.buf[0])|int(lp.buf[1])<<8|int(lp.buf[2])<<16|int(lp.buf[3])<<24)
+
+	dup := lp.LpDup()
+	dup.LpAppend("z")
+	assert.Equal(t, 3, lp.LpLength())
+	assert.Equal(t, 4, dup.LpLength())
+}
+
+func TestListpackFind(t *testing.T) {
+	lp := LpNew()
+	for i := 0; i < 10; i++ {
+		lp.LpAppend("f" + strconv.Itoa(i))
+		lp.LpAppend(strconv.Itoa(i))
+	}
+	p := lp.LpFind(lp.LpFirst(), "f3", 1)
+	assert.Equal(t, "3", lp.LpGetString(lp.LpNext(p)))
+	// the values are skipped.
+	assert.Equal(t, -1, lp.LpFind(lp.LpFirst(), "3", 1))
+	assert.Equal(t, "3", lp.LpGetString(lp.LpFind(lp.LpFirst(), "3", 0)))
+	assert.Equal(t, -1, lp.LpFind(lp.LpFirst(), "f10", 1))
+}
+
+func TestListpackManyElements(t *testing.T) {
+	lp := LpNew()
+	for i := 0; i < 70000; i++ {
+		lp.LpAppend("1")
+	}
+	assert.Equal(t, 70000, lp.LpLength())
+	for i := 0; i < 5000; i++ {
+		lp.LpDelete(lp.LpFirst())
+	}
+	assert.Equal(t, 65000, lp.LpLength())
+}
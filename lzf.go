@@ -0,0 +1,121 @@
+package main
+
+// LZF compression in the format of liblzf. The compressed data is a
+// sequence of:
+//
+//	000LLLLL <L+1 literal bytes>
+//	LLLOOOOO oooooooo               back reference of L+2 bytes at offset O+1
+//	111OOOOO LLLLLLLL oooooooo      back reference of L+9 bytes at offset O+1
+const (
+	LZF_HLOG    uint = 16
+	LZF_MAX_LIT int  = 1 << 5
+	LZF_MAX_OFF int  = 1 << 13
+	LZF_MAX_REF int  = (1 << 8) + (1 << 3) // max bytes of a back reference
+)
+
+func lzfHash(p []byte, hlog uint) uint32 {
+	v := uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+	return (v * 2654435761) >> (32 - hlog)
+}
+
+// lzfCompress return the compressed in, or nil if the result would be
+// longer than outMax bytes.
+func lzfCompress(in []byte, outMax int) []byte {
+	n := len(in)
+	if n == 0 || outMax <= 0 {
+		return nil
+	}
+	out := make([]byte, 0, outMax)
+	emitLiterals := func(lit []byte) {
+		for len(lit) > 0 {
+			l := len(lit)
+			if l > LZF_MAX_LIT {
+				l = LZF_MAX_LIT
+			}
+			out = append(out, byte(l-1))
+			out = append(out, lit[:l]...)
+			lit = lit[l:]
+		}
+	}
+
+	// htab holds the last position+1 of every hashed 3 bytes sequence, it
+	// is not larger than the input so small inputs are cheap to compress.
+	hlog := uint(8)
+	for hlog < LZF_HLOG && 1<<hlog < n {
+		hlog++
+	}
+	htab := make([]int32, 1<<hlog)
+	ip, litStart := 0, 0
+	for ip+2 < n {
+		h := lzfHash(in[ip:], hlog)
+		ref := int(htab[h]) - 1
+		htab[h] = int32(ip + 1)
+		if ref < 0 || ip-ref-1 >= LZF_MAX_OFF ||
+			in[ref] != in[ip] || in[ref+1] != in[ip+1] || in[ref+2] != in[ip+2] {
+			ip++
+			continue
+		}
+
+		maxlen := n - ip
+		if maxlen > LZF_MAX_REF {
+			maxlen = LZF_MAX_REF
+		}
+		l := 3
+		for l < maxlen && in[ref+l] == in[ip+l] {
+			l++
+		}
+		emitLiterals(in[litStart:ip])
+		off, enc := ip-ref-1, l-2
+		if enc < 7 {
+			out = append(out, byte(off>>8)|byte(enc<<5))
+		} else {
+			out = append(out, byte(off>>8)|7<<5, byte(enc-7))
+		}
+		out = append(out, byte(off))
+		if len(out) > outMax {
+			return nil
+		}
+		for i := ip + 1; i < ip+l && i+2 < n; i++ {
+			htab[lzfHash(in[i:], hlog)] = int32(i + 1)
+		}
+		ip += l
+		litStart = ip
+	}
+	emitLiterals(in[litStart:])
+	if len(out) > outMax {
+		return nil
+	}
+	return out
+}
+
+// lzfDecompress return the first outLen bytes of the data compressed in in,
+// the decompression stops as soon as outLen bytes are produced.
+func lzfDecompress(in []byte, outLen int) []byte {
+	out := make([]byte, 0, outLen)
+	ip := 0
+	for ip < len(in) && len(out) < outLen {
+		ctrl := int(in[ip])
+		ip++
+		if ctrl < LZF_MAX_LIT {
+			l := ctrl + 1
+			out = append(out, in[ip:ip+l]...)
+			ip += l
+			continue
+		}
+		l := ctrl >> 5
+		if l == 7 {
+			l += int(in[ip])
+			ip++
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[ip]) - 1
+		ip++
+		// the reference may overlap the bytes being produced.
+		for i := 0; i < l+2; i++ {
+			out = append(out, out[ref+i])
+		}
+	}
+	if len(out) > outLen {
+		out = out[:outLen]
+	}
+	return out
+}
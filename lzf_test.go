@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestLzfRoundTrip(t *testing.T) {
+	inputs := []string{
+		strings.Repeat("a", 100000),
+		strings.Repeat("hello world ", 1000),
+		strings.Repeat("abcdefghijklmnopqrstuvwxyz0123456789", 50) + strings.Repeat("x", 300),
+	}
+	for _, in := range inputs {
+		data := lzfCompress([]byte(in), len(in))
+		assert.NotNil(t, data)
+		assert.Less(t, len(data), len(in))
+		assert.Equal(t, in, string(lzfDecompress(data, len(in))))
+	}
+
+	// long runs of literals mixed with back references.
+	r := rand.New(rand.NewSource(1))
+	buf := make([]byte, 0, 50000)
+	for len(buf) < 40000 {
+		if r.Intn(2) == 0 || len(buf) < 10 {
+			for i := r.Intn(100); i >= 0; i-- {
+				buf = append(buf, byte(r.Intn(256)))
+			}
+		} else {
+			start := r.Intn(len(buf))
+			buf = append(buf, buf[start:start+r.Intn(len(buf)-start)%400]...)
+		}
+	}
+	data := lzfCompress(buf, len(buf))
+	assert.NotNil(t, data)
+	assert.Equal(t, buf, lzfDecompress(data, len(buf)))
+}
+
+func TestLzfDoesNotPay(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	buf := make([]byte, 10000)
+	r.Read(buf)
+	assert.Nil(t, lzfCompress(buf, len(buf)))
+	assert.Nil(t, lzfCompress([]byte("abc"), 0))
+
+	in := strings.Repeat("ab", 100)
+	data := lzfCompress([]byte(in), len(in))
+	assert.NotNil(t, data)
+	assert.Nil(t, lzfCompress([]byte(in), len(data)-1))
+}
+
+func TestLzfDecompressPrefix(t *testing.T) {
+	in := strings.Repeat("0123456789", 1000)
+	data := lzfCompress([]byte(in), len(in))
+	for _, n := range []int{0, 1, 7, 10, 333, 5000, len(in)} {
+		assert.Equal(t, in[:n], string(lzfDecompress(data, n)))
+	}
+}
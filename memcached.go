@@ -0,0 +1,512 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The memcached listener speaks the memcached ASCII protocol on the items of
+// db 0, an item is a string key, so both protocols see the same data. A
+// memcached client is a RedisClient with CLIENT_MEMCACHED, it shares the
+// reply list and the event handlers with the redis clients.
+
+const (
+	MEMCACHED_VERSION       string = "1.6.0" // reported by the version command
+	MEMCACHED_KEY_MAX       int    = 250
+	MEMCACHED_LINE_MAX      int    = 2048
+	MEMCACHED_ITEM_SIZE_MAX int    = 1024 * 1024
+	// an exptime up to 30 days is relative to now, otherwise it's a unix time.
+	MEMCACHED_REALTIME_MAXDELTA int64 = 60 * 60 * 24 * 30
+)
+
+// memcachedMeta is what memcached stores alongside a value.
+type memcachedMeta struct {
+	flags uint32
+	cas   uint64
+}
+
+// memcachedNextCAS return a new unique CAS.
+func memcachedNextCAS() uint64 {
+	server.memcachedCas++
+	return server.memcachedCas
+}
+
+func MemcachedAcceptHandler(le *AeEventLoop, fd int, extra interface{}) {
+	cfd, err := Accept(fd)
+	if err != nil {
+		log.Printf("memcached accept err: %v\n", err)
+		return
+	}
+	c := CreateClient(cfd)
+	c.flags |= CLIENT_MEMCACHED
+	server.clients[cfd] = c
+	server.aeLoop.AeCreateFileEvent(cfd, AE_READABLE, ReadMemcachedQueryFromClient, c)
+	log.Printf("accept memcached client, fd: %v\n", cfd)
+}
+
+func ReadMemcachedQueryFromClient(el *AeEventLoop, fd int, client interface{}) {
+	c := client.(*RedisClient)
+	if len(c.queryBuf)-c.queryLen < REDIS_BULK_MAX {
+		c.queryBuf = append(c.queryBuf, make([]byte, REDIS_BULK_MAX, REDIS_BULK_MAX)...)
+	}
+	n, err := Read(fd, c.queryBuf[c.queryLen:])
+	if err != nil {
+		log.Printf("memcached client %v read err: %v\n", fd, err)
+		freeClient(c)
+		return
+	}
+	c.queryLen += n
+	if err = processMemcachedQueryBuf(c); err != nil {
+		log.Printf("handle memcached query buf err: %v\n", err)
+		freeClient(c)
+	}
+}
+
+// consumeQuery remove the first n bytes of the query buffer.
+func (c *RedisClient) consumeQuery(n int) {
+	c.queryBuf = c.queryBuf[n:]
+	c.queryLen -= n
+}
+
+// processMemcachedQueryBuf process the complete commands in the query
+// buffer. The line of a storage command is kept in c.args until its data
+// block of c.bulkLen bytes is read. The data block of a too large item is
+// dropped as it arrives, without being buffered.
+func processMemcachedQueryBuf(c *RedisClient) error {
+	for c.queryLen > 0 {
+		if c.swallowLen > 0 {
+			n := c.swallowLen
+			if n > c.queryLen {
+				n = c.queryLen
+			}
+			c.consumeQuery(n)
+			c.swallowLen -= n
+			continue
+		}
+		if c.bulkLen >= 0 {
+			if c.queryLen < c.bulkLen+2 {
+				break
+			}
+			data := string(c.queryBuf[:c.bulkLen])
+			ok := c.queryBuf[c.bulkLen] == '\r' && c.queryBuf[c.bulkLen+1] == '\n'
+			c.consumeQuery(c.bulkLen + 2)
+			c.bulkLen = -1
+			if ok {
+				memcachedStoreCommand(c, data)
+			} else {
+				c.AddReplyStr("CLIENT_ERROR bad data chunk\r\n")
+			}
+			resetClient(c)
+			continue
+		}
+
+		index := strings.IndexByte(string(c.queryBuf[:c.queryLen]), '\n')
+		if index < 0 {
+			if c.queryLen > MEMCACHED_LINE_MAX {
+				return errors.New("too big memcached command line")
+			}
+			break
+		}
+		line := strings.TrimSuffix(string(c.queryBuf[:index]), "\r")
+		c.consumeQuery(index + 1)
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			c.AddReplyStr("ERROR\r\n")
+			continue
+		}
+		if fields[0] == "quit" {
+			freeClient(c)
+			return nil
+		}
+		c.args = make([]*RedisObj, len(fields))
+		for i, v := range fields {
+			c.args[i] = CreateObject(REDISSTR, v)
+		}
+		processMemcachedCommand(c)
+		// a storage command waits for its data block.
+		if c.bulkLen < 0 {
+			resetClient(c)
+		}
+		if len(server.readyKeys) > 0 {
+			handleClientsBlockedOnKeys()
+		}
+	}
+	return nil
+}
+
+// memcachedReply add the reply unless the command ends with noreply.
+func memcachedReply(c *RedisClient, noreply bool, reply string) {
+	if !noreply {
+		c.AddReplyStr(reply)
+	}
+}
+
+// memcachedNoreply report whether the command ends with noreply.
+func memcachedNoreply(c *RedisClient) bool {
+	return len(c.args) > 1 && c.args[len(c.args)-1].StrVal() == "noreply"
+}
+
+// memcachedLookupItem return the string value of key, nil if it doesn't
+// exist or it's not a string.
+func memcachedLookupItem(db *RedisDB, key *RedisObj) *RedisObj {
+	o := lookupKeyRead(db, key)
+	if o == nil || o.Type_ != REDISSTR {
+		return nil
+	}
+	return o
+}
+
+// memcachedItemMeta return the meta of the item o at key, a CAS is given
+// to the values stored by the redis commands. A value shared with other
+// objects is copied first.
+func memcachedItemMeta(db *RedisDB, key, o *RedisObj) *memcachedMeta {
+	if o.mcmeta != nil {
+		return o.mcmeta
+	}
+	if o.refCount != 1 {
+		// the copy of a small integer would be shared too.
+		if o.encoding == REDIS_ENCODING_INT {
+			o = CreateObject(REDISSTR, o.StrVal())
+		} else {
+			o = dupStringObject(o)
+		}
+		dbOverwrite(db, key, o)
+		o.DecrRefCount()
+	}
+	o.mcmeta = &memcachedMeta{cas: memcachedNextCAS()}
+	return o.mcmeta
+}
+
+// memcachedExpireAt convert an exptime to the unix time in ms of the
+// expire, -1 for no expire.
+func memcachedExpireAt(exptime int64) int64 {
+	if exptime == 0 {
+		return -1
+	}
+	if exptime < 0 {
+		return 0
+	}
+	if exptime <= MEMCACHED_REALTIME_MAXDELTA {
+		return GetMsTime() + exptime*1000
+	}
+	return exptime * 1000
+}
+
+// memcachedSetExpire set the expire of key to exptime.
+func memcachedSetExpire(db *RedisDB, key *RedisObj, exptime int64) {
+	if when := memcachedExpireAt(exptime); when >= 0 {
+		setExpire(db, key, when)
+	} else {
+		removeExpire(db, key)
+	}
+}
+
+// memcachedStoreItem store data at key with flags and a new CAS.
+func memcachedStoreItem(db *RedisDB, key *RedisObj, data string, flags uint32, keepTTL bool) {
+	o := CreateObject(REDISSTR, data)
+	if len(data) > 20 {
+		o = tryCompressStringObject(o)
+	}
+	o.mcmeta = &memcachedMeta{flags: flags, cas: memcachedNextCAS()}
+	setKey(db, key, o, keepTTL)
+	o.DecrRefCount()
+}
+
+// processMemcachedCommand execute the command in c.args.
+func processMemcachedCommand(c *RedisClient) {
+	switch c.args[0].StrVal() {
+	case "get", "gets":
+		memcachedGetCommand(c)
+	case "set", "add", "replace", "append", "prepend", "cas":
+		memcachedParseStoreCommand(c)
+	case "delete":
+		memcachedDeleteCommand(c)
+	case "incr", "decr":
+		memcachedIncrDecrCommand(c)
+	case "touch":
+		memcachedTouchCommand(c)
+	case "flush_all":
+		memcachedFlushAllCommand(c)
+	case "stats":
+		memcachedStatsCommand(c)
+	case "version":
+		c.AddReplyStr("VERSION " + MEMCACHED_VERSION + "\r\n")
+	default:
+		c.AddReplyStr("ERROR\r\n")
+	}
+}
+
+func memcachedBadFormat(c *RedisClient) {
+	c.AddReplyStr("CLIENT_ERROR bad command line format\r\n")
+}
+
+// memcachedValidKey report whether key can be used by memcached.
+func memcachedValidKey(key *RedisObj) bool {
+	return stringObjectLen(key) <= MEMCACHED_KEY_MAX
+}
+
+// memcachedGetCommand implement get <key>* and gets <key>*
+func memcachedGetCommand(c *RedisClient) {
+	if len(c.args) < 2 {
+		c.AddReplyStr("ERROR\r\n")
+		return
+	}
+	withCas := c.args[0].StrVal() == "gets"
+	for _, key := range c.args[1:] {
+		if !memcachedValidKey(key) {
+			memcachedBadFormat(c)
+			return
+		}
+	}
+	for _, key := range c.args[1:] {
+		o := memcachedLookupItem(c.db, key)
+		if o == nil {
+			server.statMemcachedGetMisses++
+			continue
+		}
+		server.statMemcachedGetHits++
+		var flags uint32
+		if o.mcmeta != nil {
+			flags = o.mcmeta.flags
+		}
+		data := o.StrVal()
+		header := fmt.Sprintf("VALUE %s %d %d", key.StrVal(), flags, len(data))
+		if withCas {
+			header += " " + strconv.FormatUint(memcachedItemMeta(c.db, key, o).cas, 10)
+		}
+		c.AddReplyStr(header + "\r\n" + data + "\r\n")
+	}
+	c.AddReplyStr("END\r\n")
+}
+
+// memcachedParseStoreCommand parse <command> <key> <flags> <exptime>
+// <bytes> [noreply] and cas <key> <flags> <exptime> <bytes> <cas unique>
+// [noreply], and wait for the data block.
+func memcachedParseStoreCommand(c *RedisClient) {
+	nargs := 5
+	if c.args[0].StrVal() == "cas" {
+		nargs = 6
+	}
+	noreply := memcachedNoreply(c)
+	if len(c.args) != nargs && !(noreply && len(c.args) == nargs+1) {
+		memcachedBadFormat(c)
+		return
+	}
+	_, errFlags := strconv.ParseUint(c.args[2].StrVal(), 10, 32)
+	_, errExp := strconv.ParseInt(c.args[3].StrVal(), 10, 64)
+	size, errSize := strconv.Atoi(c.args[4].StrVal())
+	var errCas error
+	if nargs == 6 {
+		_, errCas = strconv.ParseUint(c.args[5].StrVal(), 10, 64)
+	}
+	// the size with the trailing \r\n must fit in an int32, like memcached.
+	if !memcachedValidKey(c.args[1]) || errFlags != nil || errExp != nil || errSize != nil || errCas != nil ||
+		size < 0 || size > math.MaxInt32-2 {
+		memcachedBadFormat(c)
+		return
+	}
+	if size > MEMCACHED_ITEM_SIZE_MAX {
+		memcachedReply(c, noreply, "SERVER_ERROR object too large for cache\r\n")
+		c.swallowLen = size + 2
+		return
+	}
+	c.bulkLen = size
+}
+
+// memcachedStoreCommand store data with the command in c.args.
+func memcachedStoreCommand(c *RedisClient, data string) {
+	cmd, key := c.args[0].StrVal(), c.args[1]
+	noreply := memcachedNoreply(c)
+	flags, _ := strconv.ParseUint(c.args[2].StrVal(), 10, 32)
+	exptime, _ := strconv.ParseInt(c.args[3].StrVal(), 10, 64)
+	server.statMemcachedCmdSet++
+
+	item := memcachedLookupItem(c.db, key)
+	switch cmd {
+	case "add":
+		if lookupKeyWrite(c.db, key) != nil {
+			memcachedReply(c, noreply, "NOT_STORED\r\n")
+			return
+		}
+	case "replace":
+		if item == nil {
+			memcachedReply(c, noreply, "NOT_STORED\r\n")
+			return
+		}
+	case "append", "prepend":
+		if item == nil {
+			memcachedReply(c, noreply, "NOT_STORED\r\n")
+			return
+		}
+		// the flags and the exptime of the item are kept.
+		var oldFlags uint32
+		if item.mcmeta != nil {
+			oldFlags = item.mcmeta.flags
+		}
+		if cmd == "append" {
+			data = item.StrVal() + data
+		} else {
+			data = data + item.StrVal()
+		}
+		memcachedStoreItem(c.db, key, data, oldFlags, true)
+		memcachedReply(c, noreply, "STORED\r\n")
+		return
+	case "cas":
+		if item == nil {
+			memcachedReply(c, noreply, "NOT_FOUND\r\n")
+			return
+		}
+		cas, _ := strconv.ParseUint(c.args[5].StrVal(), 10, 64)
+		if item.mcmeta == nil || item.mcmeta.cas != cas {
+			memcachedReply(c, noreply, "EXISTS\r\n")
+			return
+		}
+	}
+	memcachedStoreItem(c.db, key, data, uint32(flags), false)
+	memcachedSetExpire(c.db, key, exptime)
+	memcachedReply(c, noreply, "STORED\r\n")
+}
+
+// memcachedDeleteCommand implement delete <key> [noreply]
+func memcachedDeleteCommand(c *RedisClient) {
+	noreply := memcachedNoreply(c)
+	if len(c.args) != 2 && !(noreply && len(c.args) == 3) {
+		c.AddReplyStr("CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]\r\n")
+		return
+	}
+	if memcachedLookupItem(c.db, c.args[1]) == nil {
+		memcachedReply(c, noreply, "NOT_FOUND\r\n")
+		return
+	}
+	dbDelete(c.db, c.args[1])
+	memcachedReply(c, noreply, "DELETED\r\n")
+}
+
+// memcachedIncrDecrCommand implement incr <key> <value> [noreply] and decr
+// <key> <value> [noreply]. The values are unsigned 64 bit integers, incr
+// wraps around and decr stops at 0.
+func memcachedIncrDecrCommand(c *RedisClient) {
+	noreply := memcachedNoreply(c)
+	if len(c.args) != 3 && !(noreply && len(c.args) == 4) {
+		c.AddReplyStr("ERROR\r\n")
+		return
+	}
+	delta, err := strconv.ParseUint(c.args[2].StrVal(), 10, 64)
+	if err != nil {
+		c.AddReplyStr("CLIENT_ERROR invalid numeric delta argument\r\n")
+		return
+	}
+	key := c.args[1]
+	item := memcachedLookupItem(c.db, key)
+	if item == nil {
+		memcachedReply(c, noreply, "NOT_FOUND\r\n")
+		return
+	}
+	value, err := strconv.ParseUint(item.StrVal(), 10, 64)
+	if err != nil {
+		c.AddReplyStr("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+		return
+	}
+	if c.args[0].StrVal() == "incr" {
+		value += delta
+	} else if delta > value {
+		value = 0
+	} else {
+		value -= delta
+	}
+	var flags uint32
+	if item.mcmeta != nil {
+		flags = item.mcmeta.flags
+	}
+	str := strconv.FormatUint(value, 10)
+	memcachedStoreItem(c.db, key, str, flags, true)
+	memcachedReply(c, noreply, str+"\r\n")
+}
+
+// memcachedTouchCommand implement touch <key> <exptime> [noreply]
+func memcachedTouchCommand(c *RedisClient) {
+	noreply := memcachedNoreply(c)
+	if len(c.args) != 3 && !(noreply && len(c.args) == 4) {
+		c.AddReplyStr("ERROR\r\n")
+		return
+	}
+	exptime, err := strconv.ParseInt(c.args[2].StrVal(), 10, 64)
+	if err != nil {
+		c.AddReplyStr("CLIENT_ERROR invalid exptime argument\r\n")
+		return
+	}
+	if memcachedLookupItem(c.db, c.args[1]) == nil {
+		memcachedReply(c, noreply, "NOT_FOUND\r\n")
+		return
+	}
+	memcachedSetExpire(c.db, c.args[1], exptime)
+	memcachedReply(c, noreply, "TOUCHED\r\n")
+}
+
+func memcachedFlushProc(loop *AeEventLoop, id int, extra interface{}) {
+	emptyDb(0)
+}
+
+// memcachedFlushAllCommand implement flush_all [delay] [noreply], the
+// items of db 0 are removed now or after delay seconds.
+func memcachedFlushAllCommand(c *RedisClient) {
+	noreply := memcachedNoreply(c)
+	nargs := len(c.args)
+	if noreply {
+		nargs--
+	}
+	if nargs > 2 {
+		c.AddReplyStr("ERROR\r\n")
+		return
+	}
+	var delay int64
+	if nargs == 2 {
+		var err error
+		if delay, err = strconv.ParseInt(c.args[1].StrVal(), 10, 64); err != nil || delay < 0 {
+			memcachedBadFormat(c)
+			return
+		}
+	}
+	if delay > 0 {
+		server.aeLoop.AeCreateTimeEvent(AE_ONCE, delay*1000, memcachedFlushProc, nil)
+	} else {
+		emptyDb(0)
+	}
+	memcachedReply(c, noreply, "OK\r\n")
+}
+
+// memcachedStatsCommand implement stats
+func memcachedStatsCommand(c *RedisClient) {
+	if len(c.args) != 1 {
+		c.AddReplyStr("ERROR\r\n")
+		return
+	}
+	var connections int
+	for _, client := range server.clients {
+		if client.flags&CLIENT_MEMCACHED != 0 {
+			connections++
+		}
+	}
+	hits, misses := server.statMemcachedGetHits, server.statMemcachedGetMisses
+	stats := []string{
+		fmt.Sprintf("pid %d", os.Getpid()),
+		fmt.Sprintf("time %d", GetMsTime()/1000),
+		"version " + MEMCACHED_VERSION,
+		fmt.Sprintf("curr_connections %d", connections),
+		fmt.Sprintf("curr_items %d", c.db.data.DictSize()),
+		fmt.Sprintf("cmd_get %d", hits+misses),
+		fmt.Sprintf("cmd_set %d", server.statMemcachedCmdSet),
+		fmt.Sprintf("get_hits %d", hits),
+		fmt.Sprintf("get_misses %d", misses),
+	}
+	var reply string
+	for _, stat := range stats {
+		reply += "STAT " + stat + "\r\n"
+	}
+	c.AddReplyStr(reply + "END\r\n")
+}
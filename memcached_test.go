@@ -0,0 +1,154 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// memcachedClient return a memcached client of the server of c.
+func memcachedClient(c *RedisClient) *RedisClient {
+	mc := CreateClient(c.fd)
+	mc.flags |= CLIENT_MEMCACHED
+	return mc
+}
+
+// execMemcached process the memcached query and return the reply.
+func execMemcached(c *RedisClient, query string) string {
+	ReadQuery(c, query)
+	if err := processMemcachedQueryBuf(c); err != nil {
+		return err.Error()
+	}
+	return takeReply(c)
+}
+
+// memcachedCas return the CAS of key reported by gets.
+func memcachedCas(c *RedisClient, key string) string {
+	header := strings.Split(execMemcached(c, "gets "+key+"\r\n"), "\r\n")[0]
+	fields := strings.Fields(header)
+	return fields[len(fields)-1]
+}
+
+func TestMemcachedStorageCmd(t *testing.T) {
+	c := testClient()
+	mc := memcachedClient(c)
+	assert.Equal(t, "STORED\r\n", execMemcached(mc, "set k 5 0 5\r\nhello\r\n"))
+	assert.Equal(t, "VALUE k 5 5\r\nhello\r\nEND\r\n", execMemcached(mc, "get k nokey\r\n"))
+	assert.Equal(t, "NOT_STORED\r\n", execMemcached(mc, "add k 0 0 1\r\nx\r\n"))
+	assert.Equal(t, "STORED\r\n", execMemcached(mc, "add k2 0 0 1\r\nx\r\n"))
+	assert.Equal(t, "NOT_STORED\r\n", execMemcached(mc, "replace nokey 0 0 1\r\nx\r\n"))
+	assert.Equal(t, "STORED\r\n", execMemcached(mc, "replace k2 3 0 1\r\ny\r\n"))
+	assert.Equal(t, "STORED\r\n", execMemcached(mc, "append k 9 0 6\r\n world\r\n"))
+	assert.Equal(t, "STORED\r\n", execMemcached(mc, "prepend k 9 0 1\r\n>\r\n"))
+	// the flags are kept by append and prepend.
+	assert.Equal(t, "VALUE k 5 12\r\n>hello world\r\nVALUE k2 3 1\r\ny\r\nEND\r\n", execMemcached(mc, "get k k2\r\n"))
+	assert.Equal(t, "NOT_STORED\r\n", execMemcached(mc, "append nokey 0 0 1\r\nx\r\n"))
+
+	// the data block may come in several reads.
+	assert.Equal(t, "", execMemcached(mc, "set k3 0 0 4 noreply\r\nab"))
+	assert.Equal(t, "", execMemcached(mc, "cd\r\n"))
+	assert.Equal(t, "VALUE k3 0 4\r\nabcd\r\nEND\r\n", execMemcached(mc, "get k3\r\n"))
+	assert.Equal(t, "CLIENT_ERROR bad data chunk\r\n", execMemcached(mc, "set k3 0 0 2\r\nabcd"))
+	assert.Equal(t, "CLIENT_ERROR bad command line format\r\n", execMemcached(mc, "set k3 x 0 1\r\n"))
+	assert.Equal(t, "ERROR\r\n", execMemcached(mc, "foo\r\n"))
+
+	// the items are strings of db 0.
+	assert.Equal(t, "$12\r\n>hello world\r\n", execCommand(c, "get", "k"))
+	execCommand(c, "set", "k", "redis")
+	assert.Equal(t, "VALUE k 0 5\r\nredis\r\nEND\r\n", execMemcached(mc, "get k\r\n"))
+	execCommand(c, "rpush", "list", "a")
+	assert.Equal(t, "END\r\n", execMemcached(mc, "get list\r\n"))
+	assert.Equal(t, "NOT_STORED\r\n", execMemcached(mc, "add list 0 0 1\r\nx\r\n"))
+
+	assert.Equal(t, "DELETED\r\n", execMemcached(mc, "delete k\r\n"))
+	assert.Equal(t, "NOT_FOUND\r\n", execMemcached(mc, "delete k\r\n"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "k"))
+
+	// the data block of a too large item is dropped as it arrives.
+	assert.Equal(t, "SERVER_ERROR object too large for cache\r\n", execMemcached(mc, "set big 0 0 2000000\r\n"))
+	assert.Equal(t, "", execMemcached(mc, strings.Repeat("x", 1500000)))
+	assert.Equal(t, 0, mc.queryLen)
+	assert.Equal(t, "END\r\n", execMemcached(mc, strings.Repeat("x", 500000)+"\r\nget big\r\n"))
+	assert.Equal(t, "CLIENT_ERROR bad command line format\r\n", execMemcached(mc, "set big 0 0 9223372036854775807\r\n"))
+	assert.Equal(t, "ERROR\r\n", execMemcached(mc, "x\r\n"))
+	assert.Equal(t, "CLIENT_ERROR bad command line format\r\n", execMemcached(mc, "set big 0 0 2147483646\r\n"))
+	assert.Equal(t, "", execMemcached(mc, "set big 0 0 2147483645 noreply\r\n"))
+	assert.Equal(t, 2147483647, mc.swallowLen)
+}
+
+func TestMemcachedCasCmd(t *testing.T) {
+	c := testClient()
+	mc := memcachedClient(c)
+	execMemcached(mc, "set k 0 0 1\r\na\r\n")
+	cas := memcachedCas(mc, "k")
+	assert.Equal(t, cas, memcachedCas(mc, "k"))
+	assert.Equal(t, "STORED\r\n", execMemcached(mc, "cas k 1 0 1 "+cas+"\r\nb\r\n"))
+	assert.Equal(t, "EXISTS\r\n", execMemcached(mc, "cas k 1 0 1 "+cas+"\r\nc\r\n"))
+	assert.Equal(t, "NOT_FOUND\r\n", execMemcached(mc, "cas nokey 0 0 1 1\r\nc\r\n"))
+
+	// a value written by redis gets a new CAS.
+	cas = memcachedCas(mc, "k")
+	execCommand(c, "set", "k", "v")
+	assert.NotEqual(t, cas, memcachedCas(mc, "k"))
+	execCommand(c, "set", "n", "1000")
+	cas = memcachedCas(mc, "n")
+	execCommand(c, "incr", "n")
+	assert.NotEqual(t, cas, memcachedCas(mc, "n"))
+	// a shared integer is copied before the CAS is set.
+	execCommand(c, "set", "small", "1")
+	memcachedCas(mc, "small")
+	assert.Nil(t, shared.integers[1].mcmeta)
+}
+
+func TestMemcachedIncrTouchCmd(t *testing.T) {
+	c := testClient()
+	mc := memcachedClient(c)
+	execMemcached(mc, "set n 7 0 2\r\n10\r\n")
+	assert.Equal(t, "15\r\n", execMemcached(mc, "incr n 5\r\n"))
+	assert.Equal(t, "0\r\n", execMemcached(mc, "decr n 100\r\n"))
+	assert.Equal(t, "0\r\n", execMemcached(mc, "incr n 0\r\n"))
+	execMemcached(mc, "set n 7 0 20\r\n18446744073709551615\r\n")
+	assert.Equal(t, "1\r\n", execMemcached(mc, "incr n 2\r\n"))
+	assert.Equal(t, "VALUE n 7 1\r\n1\r\nEND\r\n", execMemcached(mc, "get n\r\n"))
+	assert.Equal(t, "NOT_FOUND\r\n", execMemcached(mc, "incr nokey 1\r\n"))
+	assert.Equal(t, "CLIENT_ERROR invalid numeric delta argument\r\n", execMemcached(mc, "incr n x\r\n"))
+	execMemcached(mc, "set s 0 0 1\r\nx\r\n")
+	assert.Equal(t, "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n", execMemcached(mc, "decr s 1\r\n"))
+
+	assert.Equal(t, "STORED\r\n", execMemcached(mc, "set e 0 100 1\r\nx\r\n"))
+	ttl, _ := strconv.Atoi(strings.Trim(execCommand(c, "ttl", "e"), ":\r\n"))
+	assert.True(t, ttl > 90 && ttl <= 100)
+	assert.Equal(t, "TOUCHED\r\n", execMemcached(mc, "touch e 0\r\n"))
+	assert.Equal(t, ":-1\r\n", execCommand(c, "ttl", "e"))
+	assert.Equal(t, "NOT_FOUND\r\n", execMemcached(mc, "touch nokey 10\r\n"))
+	// a negative exptime expires the item immediately.
+	assert.Equal(t, "STORED\r\n", execMemcached(mc, "set e 0 -1 1\r\nx\r\n"))
+	assert.Equal(t, "END\r\n", execMemcached(mc, "get e\r\n"))
+}
+
+func TestMemcachedServerCmd(t *testing.T) {
+	c := testClient()
+	mc := memcachedClient(c)
+	assert.Equal(t, "VERSION "+MEMCACHED_VERSION+"\r\n", execMemcached(mc, "version\r\n"))
+	execMemcached(mc, "set k 0 0 1\r\nx\r\n")
+	execMemcached(mc, "get k nokey\r\n")
+	stats := execMemcached(mc, "stats\r\n")
+	assert.Contains(t, stats, "STAT curr_items 1\r\n")
+	assert.Contains(t, stats, "STAT get_hits 1\r\nSTAT get_misses 1\r\n")
+	assert.True(t, strings.HasSuffix(stats, "END\r\n"))
+
+	execCommand(c, "select", "1")
+	execCommand(c, "set", "other", "v")
+	assert.Equal(t, "OK\r\n", execMemcached(mc, "flush_all\r\n"))
+	assert.Equal(t, "END\r\n", execMemcached(mc, "get k\r\n"))
+	// only db 0 is flushed.
+	assert.Equal(t, ":1\r\n", execCommand(c, "dbsize"))
+
+	execMemcached(mc, "set k 0 0 1\r\nx\r\n")
+	assert.Equal(t, "", execMemcached(mc, "flush_all 10 noreply\r\n"))
+	assert.Equal(t, "VALUE k 0 1\r\nx\r\nEND\r\n", execMemcached(mc, "get k\r\n"))
+	te := server.aeLoop.TimeEventHead
+	server.aeLoop.AeProcessEvents([]*AeTimeEvent{te}, nil)
+	assert.Equal(t, "END\r\n", execMemcached(mc, "get k\r\n"))
+}
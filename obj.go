@@ -1,6 +1,10 @@
 package main
 
-import "strconv"
+import (
+	"math"
+	"strconv"
+	"strings"
+)
 
 type RedisType uint8
 type RedisVal interface{}
@@ -9,19 +13,110 @@ const (
 	REDISSTR  RedisType = 0x01
 	REDISLIST RedisType = 0x02
 	REDISDICT RedisType = 0x03
+	REDISSET  RedisType = 0x04
+	REDISZSET RedisType = 0x05
+	// REDISSTREAM is a stream of entries of field value pairs.
+	REDISSTREAM RedisType = 0x06
+	// REDISCLIENTS is the clients subscribed to a pubsub channel, it's only
+	// used by the server and never stored in a db.
+	REDISCLIENTS RedisType = 0x07
+)
+
+// typeName return the name of type t reported by the TYPE command.
+func typeName(t RedisType) string {
+	switch t {
+	case REDISSTR:
+		return "string"
+	case REDISLIST:
+		return "list"
+	case REDISDICT:
+		return "hash"
+	case REDISSET:
+		return "set"
+	case REDISZSET:
+		return "zset"
+	case REDISSTREAM:
+		return "stream"
+	}
+	return "unknown"
+}
+
+type RedisEncoding uint8
+
+const (
+	REDIS_ENCODING_RAW    RedisEncoding = 0x00 // Val_ is a string.
+	REDIS_ENCODING_INT    RedisEncoding = 0x01 // Val_ is an int64.
+	REDIS_ENCODING_EMBSTR RedisEncoding = 0x02 // Val_ is a short string.
+
+	REDIS_ENCODING_HT        RedisEncoding = 0x03 // Val_ is a *Dict.
+	REDIS_ENCODING_LISTPACK  RedisEncoding = 0x05 // Val_ is a *Listpack.
+	REDIS_ENCODING_SKIPLIST  RedisEncoding = 0x06 // Val_ is a *zset.
+	REDIS_ENCODING_LZF       RedisEncoding = 0x07 // Val_ is a *lzfString.
+	REDIS_ENCODING_QUICKLIST RedisEncoding = 0x08 // Val_ is a *Quicklist.
+	REDIS_ENCODING_STREAM    RedisEncoding = 0x09 // Val_ is a *stream.
+	REDIS_ENCODING_BITMAP    RedisEncoding = 0x0a // Val_ is a []byte written in place.
+	REDIS_ENCODING_CLIENTS   RedisEncoding = 0x0b // Val_ is a []*RedisClient.
+)
+
+// strEncoding return the name of encoding reported by OBJECT ENCODING.
+func strEncoding(encoding RedisEncoding) string {
+	switch encoding {
+	case REDIS_ENCODING_RAW, REDIS_ENCODING_BITMAP:
+		return "raw"
+	case REDIS_ENCODING_INT:
+		return "int"
+	case REDIS_ENCODING_EMBSTR:
+		return "embstr"
+	case REDIS_ENCODING_HT:
+		return "hashtable"
+	case REDIS_ENCODING_LISTPACK:
+		return "listpack"
+	case REDIS_ENCODING_SKIPLIST:
+		return "skiplist"
+	case REDIS_ENCODING_LZF:
+		return "lzf"
+	case REDIS_ENCODING_QUICKLIST:
+		return "quicklist"
+	case REDIS_ENCODING_STREAM:
+		return "stream"
+	}
+	return "unknown"
+}
+
+const (
+	// OBJ_SHARED_REFCOUNT marks an object as shared, its refcount is never changed.
+	OBJ_SHARED_REFCOUNT int = math.MaxInt32
+	// OBJ_SHARED_INTEGERS is the number of preallocated integer objects.
+	OBJ_SHARED_INTEGERS int64 = 10000
+	// OBJ_ENCODING_EMBSTR_SIZE_LIMIT is the max length of an embstr string.
+	OBJ_ENCODING_EMBSTR_SIZE_LIMIT int = 44
 )
 
+// lzfString is the value of a lzf encoded string, it is never modified so
+// it can be shared by several objects.
+type lzfString struct {
+	data []byte // the compressed string
+	len  int    // length of the uncompressed string
+}
+
 type RedisObj struct {
 	Type_    RedisType
 	Val_     RedisVal
+	encoding RedisEncoding
 	refCount int
+	// flags and CAS of a string stored or read with gets by the memcached
+	// protocol, nil otherwise.
+	mcmeta *memcachedMeta
 }
 
 func (o *RedisObj) IntVal() int64 {
 	if o.Type_ != REDISSTR {
 		return 0
 	}
-	val, _ := strconv.ParseInt(o.Val_.(string), 10, 64)
+	if o.encoding == REDIS_ENCODING_INT {
+		return o.Val_.(int64)
+	}
+	val, _ := strconv.ParseInt(o.StrVal(), 10, 64)
 	return val
 }
 
@@ -29,33 +124,297 @@ func (o *RedisObj) StrVal() string {
 	if o.Type_ != REDISSTR {
 		return ""
 	}
+	if o.encoding == REDIS_ENCODING_INT {
+		return strconv.FormatInt(o.Val_.(int64), 10)
+	}
+	if o.encoding == REDIS_ENCODING_LZF {
+		lzf := o.Val_.(*lzfString)
+		return string(lzfDecompress(lzf.data, lzf.len))
+	}
+	if o.encoding == REDIS_ENCODING_BITMAP {
+		return string(o.Val_.([]byte))
+	}
 	return o.Val_.(string)
 }
 
+// stringObjectLen return the length of the string o without decompressing it.
+func stringObjectLen(o *RedisObj) int {
+	switch o.encoding {
+	case REDIS_ENCODING_INT:
+		return len(strconv.FormatInt(o.Val_.(int64), 10))
+	case REDIS_ENCODING_LZF:
+		return o.Val_.(*lzfString).len
+	case REDIS_ENCODING_BITMAP:
+		return len(o.Val_.([]byte))
+	}
+	return len(o.Val_.(string))
+}
+
+// stringObjectPrefix return the first n bytes of the string o, a lzf
+// encoded string is only decompressed up to n bytes.
+func stringObjectPrefix(o *RedisObj, n int) string {
+	if o.encoding == REDIS_ENCODING_LZF {
+		lzf := o.Val_.(*lzfString)
+		return string(lzfDecompress(lzf.data, n))
+	}
+	if o.encoding == REDIS_ENCODING_BITMAP {
+		buf := o.Val_.([]byte)
+		if n < len(buf) {
+			buf = buf[:n]
+		}
+		return string(buf)
+	}
+	str := o.StrVal()
+	if n < len(str) {
+		str = str[:n]
+	}
+	return str
+}
+
+// CreateFromInt return a shared integer if val is small enough, otherwise
+// a new int encoded string object.
 func CreateFromInt(val int64) *RedisObj {
+	if val >= 0 && val < OBJ_SHARED_INTEGERS {
+		return shared.integers[val]
+	}
 	return &RedisObj{
 		Type_:    REDISSTR,
-		Val_:     strconv.FormatInt(val, 10),
+		Val_:     val,
+		encoding: REDIS_ENCODING_INT,
 		refCount: 1,
 	}
 }
 
 func CreateObject(t RedisType, v interface{}) *RedisObj {
-	return &RedisObj{
+	o := &RedisObj{
 		Type_:    t,
 		Val_:     v,
+		encoding: REDIS_ENCODING_RAW,
 		refCount: 1,
 	}
+	if str, ok := v.(string); ok && t == REDISSTR && len(str) <= OBJ_ENCODING_EMBSTR_SIZE_LIMIT {
+		o.encoding = REDIS_ENCODING_EMBSTR
+	}
+	return o
+}
+
+// createBitmapObject return a string object holding buf, which the bit
+// commands write in place.
+func createBitmapObject(buf []byte) *RedisObj {
+	o := CreateObject(REDISSTR, buf)
+	o.encoding = REDIS_ENCODING_BITMAP
+	return o
+}
+
+// createQuicklistObject return an empty list object encoded as a quicklist.
+func createQuicklistObject() *RedisObj {
+	o := CreateObject(REDISLIST, QuicklistCreate(server.listMaxListpackSize, server.listCompressDepth))
+	o.encoding = REDIS_ENCODING_QUICKLIST
+	return o
+}
+
+// createListListpackObject return an empty list object encoded as a
+// listpack, which is converted to a quicklist when it grows.
+func createListListpackObject() *RedisObj {
+	o := CreateObject(REDISLIST, LpNew())
+	o.encoding = REDIS_ENCODING_LISTPACK
+	return o
+}
+
+// createHashObject return an empty hash object encoded as a listpack of
+// field value pairs, which is converted to a dict when it grows.
+func createHashObject() *RedisObj {
+	o := CreateObject(REDISDICT, LpNew())
+	o.encoding = REDIS_ENCODING_LISTPACK
+	return o
+}
+
+// createSetObject return an empty set object, the members are the keys of
+// the dict and the values are nil.
+func createSetObject() *RedisObj {
+	o := CreateObject(REDISSET, DictCreate(DictFunc{
+		HashFunc:  RedisStrHash,
+		EqualFunc: RedisStrEqual,
+	}))
+	o.encoding = REDIS_ENCODING_HT
+	return o
+}
+
+// createZsetObject return an empty sorted set object, the dict maps the
+// members to their score objects.
+func createZsetObject() *RedisObj {
+	o := CreateObject(REDISZSET, &zset{
+		dict: DictCreate(DictFunc{
+			HashFunc:  RedisStrHash,
+			EqualFunc: RedisStrEqual,
+		}),
+		zsl: ZslCreate(),
+	})
+	o.encoding = REDIS_ENCODING_SKIPLIST
+	return o
+}
+
+// createStreamObject return an empty stream object.
+func createStreamObject() *RedisObj {
+	o := CreateObject(REDISSTREAM, streamNew())
+	o.encoding = REDIS_ENCODING_STREAM
+	return o
+}
+
+// createClientsObject return an empty list of the clients subscribed to a
+// pubsub channel, in subscription order.
+func createClientsObject() *RedisObj {
+	o := CreateObject(REDISCLIENTS, []*RedisClient(nil))
+	o.encoding = REDIS_ENCODING_CLIENTS
+	return o
+}
+
+// dupStringObject return a new string object with the same value of o.
+func dupStringObject(o *RedisObj) *RedisObj {
+	if o.encoding == REDIS_ENCODING_INT {
+		return CreateFromInt(o.Val_.(int64))
+	}
+	if o.encoding == REDIS_ENCODING_LZF {
+		d := CreateObject(REDISSTR, o.Val_)
+		d.encoding = REDIS_ENCODING_LZF
+		return d
+	}
+	if o.encoding == REDIS_ENCODING_BITMAP {
+		return createBitmapObject(append([]byte(nil), o.Val_.([]byte)...))
+	}
+	return CreateObject(REDISSTR, o.Val_.(string))
+}
+
+// tryObjectEncoding try to encode a string object as an integer, or to
+// compress it if it is large, to save memory. The returned object should be
+// used in place of o.
+func tryObjectEncoding(o *RedisObj) *RedisObj {
+	if o.Type_ != REDISSTR || o.encoding == REDIS_ENCODING_INT || o.encoding == REDIS_ENCODING_LZF ||
+		o.encoding == REDIS_ENCODING_BITMAP {
+		return o
+	}
+	str := o.Val_.(string)
+	// an int64 has at most 20 chars.
+	if len(str) > 20 {
+		return tryCompressStringObject(o)
+	}
+	val, ok := string2ll(str)
+	if !ok {
+		return o
+	}
+	if val >= 0 && val < OBJ_SHARED_INTEGERS {
+		o.DecrRefCount()
+		return shared.integers[val]
+	}
+	o.encoding = REDIS_ENCODING_INT
+	o.Val_ = val
+	return o
+}
+
+// tryCompressStringObject compress o in place if it is longer than
+// string-compress-threshold. The compression is skipped when it doesn't save
+// at least 1/8 of the size, as it wouldn't pay for the decompressions.
+func tryCompressStringObject(o *RedisObj) *RedisObj {
+	str := o.Val_.(string)
+	if server.stringCompressThreshold <= 0 || len(str) <= server.stringCompressThreshold {
+		return o
+	}
+	data := lzfCompress([]byte(str), len(str)-len(str)/8)
+	if data == nil {
+		return o
+	}
+	o.Val_ = &lzfString{data: data, len: len(str)}
+	o.encoding = REDIS_ENCODING_LZF
+	return o
+}
+
+// makeObjectShared make the object immune to IncrRefCount and DecrRefCount,
+// so it can be reused everywhere without being freed.
+func makeObjectShared(o *RedisObj) *RedisObj {
+	o.refCount = OBJ_SHARED_REFCOUNT
+	return o
 }
 
 func (o *RedisObj) IncrRefCount() {
+	if o.refCount == OBJ_SHARED_REFCOUNT {
+		return
+	}
 	o.refCount++
 }
 
 func (o *RedisObj) DecrRefCount() {
+	if o.refCount == OBJ_SHARED_REFCOUNT {
+		return
+	}
 	o.refCount--
 	if o.refCount == 0 {
 		// let GC clear the object.
 		o.Val_ = nil
 	}
 }
+
+func getLongLongFromObject(o *RedisObj) (int64, bool) {
+	if o.Type_ != REDISSTR {
+		return 0, false
+	}
+	if o.encoding == REDIS_ENCODING_INT {
+		return o.Val_.(int64), true
+	}
+	return string2ll(o.StrVal())
+}
+
+// getLongLongFromObjectOrReply reply msg, or the generic not integer error
+// if msg is empty, when o is not an integer.
+func getLongLongFromObjectOrReply(c *RedisClient, o *RedisObj, msg string) (int64, bool) {
+	val, ok := getLongLongFromObject(o)
+	if !ok {
+		if msg != "" {
+			c.AddReplyError(msg)
+		} else {
+			c.AddReply(shared.notIntErr)
+		}
+	}
+	return val, ok
+}
+
+func getLongDoubleFromObject(o *RedisObj) (float64, bool) {
+	if o.Type_ != REDISSTR {
+		return 0, false
+	}
+	if o.encoding == REDIS_ENCODING_INT {
+		return float64(o.Val_.(int64)), true
+	}
+	return string2ld(o.StrVal())
+}
+
+func getLongDoubleFromObjectOrReply(c *RedisClient, o *RedisObj, msg string) (float64, bool) {
+	val, ok := getLongDoubleFromObject(o)
+	if !ok {
+		if msg != "" {
+			c.AddReplyError(msg)
+		} else {
+			c.AddReplyError("value is not a valid float")
+		}
+	}
+	return val, ok
+}
+
+// objectCommand implement OBJECT ENCODING|REFCOUNT key
+func objectCommand(c *RedisClient) {
+	sub := strings.ToLower(c.args[1].StrVal())
+	if (sub != "encoding" && sub != "refcount") || len(c.args) != 3 {
+		c.AddReplyErrorFormat("unknown subcommand or wrong number of arguments for '%s'. Try OBJECT HELP.", c.args[1].StrVal())
+		return
+	}
+	o := lookupKeyReadOrReply(c, c.args[2], shared.nullBulk)
+	if o == nil {
+		return
+	}
+	if sub == "encoding" {
+		c.AddReplyBulkStr(strEncoding(o.encoding))
+	} else if o.refCount == OBJ_SHARED_REFCOUNT {
+		c.AddReplyInt(int64(OBJ_SHARED_REFCOUNT))
+	} else {
+		c.AddReplyInt(int64(o.refCount))
+	}
+}
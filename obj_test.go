@@ -0,0 +1,134 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStringEncoding(t *testing.T) {
+	o := CreateObject(REDISSTR, "hello")
+	assert.Equal(t, REDIS_ENCODING_EMBSTR, o.encoding)
+	o = CreateObject(REDISSTR, strings.Repeat("a", OBJ_ENCODING_EMBSTR_SIZE_LIMIT+1))
+	assert.Equal(t, REDIS_ENCODING_RAW, o.encoding)
+
+	o = CreateFromInt(123456)
+	assert.Equal(t, REDIS_ENCODING_INT, o.encoding)
+	assert.Equal(t, int64(123456), o.IntVal())
+	assert.Equal(t, "123456", o.StrVal())
+
+	// small integers are shared.
+	o = CreateFromInt(10)
+	assert.Equal(t, shared.integers[10], o)
+	o.DecrRefCount()
+	assert.Equal(t, OBJ_SHARED_REFCOUNT, o.refCount)
+	assert.Equal(t, int64(10), o.IntVal())
+}
+
+func TestTryObjectEncoding(t *testing.T) {
+	o := tryObjectEncoding(CreateObject(REDISSTR, "-100"))
+	assert.Equal(t, REDIS_ENCODING_INT, o.encoding)
+	assert.Equal(t, int64(-100), o.Val_)
+	assert.Equal(t, "-100", o.StrVal())
+
+	o = tryObjectEncoding(CreateObject(REDISSTR, "99"))
+	assert.Equal(t, shared.integers[99], o)
+
+	for _, str := range []string{"abc", "01", "+1", " 1", "1.5", "", "99999999999999999999"} {
+		o = tryObjectEncoding(CreateObject(REDISSTR, str))
+		assert.NotEqual(t, REDIS_ENCODING_INT, o.encoding)
+		assert.Equal(t, str, o.StrVal())
+	}
+}
+
+func TestIntEncodedCommands(t *testing.T) {
+	c := testClient()
+	key := CreateObject(REDISSTR, "key")
+	execCommand(c, "set", "key", "12345")
+	val := c.db.data.DictGet(key)
+	assert.Equal(t, REDIS_ENCODING_INT, val.encoding)
+	assert.Equal(t, "$5\r\n12345\r\n", execCommand(c, "get", "key"))
+	assert.Equal(t, ":5\r\n", execCommand(c, "strlen", "key"))
+	assert.Equal(t, "$3\r\n234\r\n", execCommand(c, "getrange", "key", "1", "3"))
+	assert.Equal(t, ":7\r\n", execCommand(c, "append", "key", "ab"))
+	assert.Equal(t, "$7\r\n12345ab\r\n", execCommand(c, "get", "key"))
+
+	execCommand(c, "set", "key", "5")
+	assert.Equal(t, shared.integers[5], c.db.data.DictGet(key))
+
+	// counters out of the shared range are updated in place.
+	execCommand(c, "set", "key", "20000")
+	val = c.db.data.DictGet(key)
+	assert.Equal(t, ":20001\r\n", execCommand(c, "incr", "key"))
+	assert.Equal(t, val, c.db.data.DictGet(key))
+	assert.Equal(t, int64(20001), val.Val_)
+
+	// expire is stored as int.
+	execCommand(c, "expire", "key", "100")
+	assert.Equal(t, REDIS_ENCODING_INT, c.db.expire.DictGet(key).encoding)
+}
+
+func TestObjectCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "int", "123")
+	execCommand(c, "set", "embstr", "abc")
+	execCommand(c, "set", "raw", strings.Repeat("a", 50))
+	execCommand(c, "rpush", "list", "a")
+	execCommand(c, "hset", "hash", "f", "v")
+	execCommand(c, "sadd", "set", "a")
+	execCommand(c, "zadd", "zset", "1", "a")
+	for key, enc := range map[string]string{"int": "int", "embstr": "embstr", "raw": "raw", "list": "listpack",
+		"hash": "listpack", "set": "hashtable", "zset": "skiplist"} {
+		assert.Equal(t, "$"+strconv.Itoa(len(enc))+"\r\n"+enc+"\r\n", execCommand(c, "object", "encoding", key))
+	}
+	assert.Equal(t, "$-1\r\n", execCommand(c, "object", "encoding", "nokey"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "object", "refcount", "list"))
+	assert.Equal(t, "-ERR unknown subcommand or wrong number of arguments for 'foo'. Try OBJECT HELP.\r\n", execCommand(c, "object", "foo", "list"))
+}
+
+func TestLzfEncodedCommands(t *testing.T) {
+	c := testClient()
+	server.stringCompressThreshold = 100
+	key := CreateObject(REDISSTR, "key")
+	str := strings.Repeat("hello world ", 250)
+	execCommand(c, "set", "key", str)
+	val := c.db.data.DictGet(key)
+	assert.Equal(t, REDIS_ENCODING_LZF, val.encoding)
+	assert.Less(t, len(val.Val_.(*lzfString).data), len(str))
+	assert.Equal(t, "$3\r\nlzf\r\n", execCommand(c, "object", "encoding", "key"))
+	assert.Equal(t, "$3000\r\n"+str+"\r\n", execCommand(c, "get", "key"))
+	assert.Equal(t, ":3000\r\n", execCommand(c, "strlen", "key"))
+	assert.Equal(t, "$5\r\nworld\r\n", execCommand(c, "getrange", "key", "6", "10"))
+	assert.Equal(t, "$6\r\nworld \r\n", execCommand(c, "getrange", "key", "-6", "-1"))
+
+	assert.Equal(t, ":3003\r\n", execCommand(c, "append", "key", "end"))
+	assert.Equal(t, REDIS_ENCODING_LZF, c.db.data.DictGet(key).encoding)
+	assert.Equal(t, "$3003\r\n"+str+"end\r\n", execCommand(c, "get", "key"))
+	assert.Equal(t, ":3003\r\n", execCommand(c, "setrange", "key", "0", "HELLO"))
+	assert.Equal(t, REDIS_ENCODING_LZF, c.db.data.DictGet(key).encoding)
+	assert.Equal(t, "$8\r\nHELLO wo\r\n", execCommand(c, "getrange", "key", "0", "7"))
+
+	// a copy shares the compressed value.
+	dup := dupStringObject(c.db.data.DictGet(key))
+	assert.Equal(t, REDIS_ENCODING_LZF, dup.encoding)
+	assert.Equal(t, "HELLO"+str[5:]+"end", dup.StrVal())
+
+	// short strings and strings that don't compress stay raw.
+	execCommand(c, "set", "key", strings.Repeat("a", 100))
+	assert.Equal(t, REDIS_ENCODING_RAW, c.db.data.DictGet(key).encoding)
+	random := make([]byte, 3000)
+	rand.New(rand.NewSource(1)).Read(random)
+	for i := range random {
+		random[i] = 'a' + random[i]%26
+	}
+	execCommand(c, "set", "key", string(random))
+	assert.Equal(t, REDIS_ENCODING_RAW, c.db.data.DictGet(key).encoding)
+	assert.Equal(t, "$3000\r\n"+string(random)+"\r\n", execCommand(c, "get", "key"))
+
+	// disabled compression.
+	server.stringCompressThreshold = 0
+	execCommand(c, "set", "key", str)
+	assert.Equal(t, REDIS_ENCODING_RAW, c.db.data.DictGet(key).encoding)
+}
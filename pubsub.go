@@ -0,0 +1,286 @@
+package main
+
+import (
+	"strings"
+)
+
+// pubsubPattern is a pattern subscribed by a client.
+type pubsubPattern struct {
+	client  *RedisClient
+	pattern *RedisObj
+}
+
+// createPubsubChannelsDict return a dict of channels. The value of a
+// channel in server.pubsubChannels is a clients object, see
+// createClientsObject; the dict of a client is a set.
+func createPubsubChannelsDict() *Dict {
+	return DictCreate(DictFunc{
+		HashFunc:  RedisStrHash,
+		EqualFunc: RedisStrEqual,
+	})
+}
+
+// clientSubscriptionsCount return the number of channels and patterns the
+// client is subscribed to.
+func clientSubscriptionsCount(c *RedisClient) int {
+	return int(c.pubsubChannels.DictSize()) + c.pubsubPatterns.ListLength()
+}
+
+// addReplyPubsubSubscription reply the (un)subscription of the client to
+// channel or pattern, kind is the name of the command. A nil channel is
+// replied when the client was not subscribed to anything.
+func addReplyPubsubSubscription(c *RedisClient, kind string, channel *RedisObj) {
+	c.AddReplyArrayLen(3)
+	c.AddReplyBulkStr(kind)
+	if channel != nil {
+		c.AddReplyBulk(channel)
+	} else {
+		c.AddReply(shared.nullBulk)
+	}
+	c.AddReplyInt(int64(clientSubscriptionsCount(c)))
+}
+
+// updatePubsubFlag set or clear CLIENT_PUBSUB after the subscriptions of
+// the client changed.
+func updatePubsubFlag(c *RedisClient) {
+	if clientSubscriptionsCount(c) > 0 {
+		c.flags |= CLIENT_PUBSUB
+	} else {
+		c.flags &^= CLIENT_PUBSUB
+	}
+}
+
+// pubsubSubscribeChannel subscribe the client to channel, return false if
+// it's already subscribed.
+func pubsubSubscribeChannel(c *RedisClient, channel *RedisObj) bool {
+	if c.pubsubChannels.DictAdd(channel, nil) != nil {
+		return false
+	}
+	e := server.pubsubChannels.DictFind(channel)
+	if e == nil {
+		clients := createClientsObject()
+		server.pubsubChannels.DictAdd(channel, clients)
+		clients.DecrRefCount()
+		e = server.pubsubChannels.DictFind(channel)
+	}
+	e.Val.Val_ = append(e.Val.Val_.([]*RedisClient), c)
+	return true
+}
+
+// pubsubUnsubscribeChannel unsubscribe the client from channel, return
+// false if it's not subscribed. The channel is removed from the server
+// when it has no more clients.
+func pubsubUnsubscribeChannel(c *RedisClient, channel *RedisObj, notify bool) bool {
+	// channel may be the key of the entry deleted below.
+	channel.IncrRefCount()
+	defer channel.DecrRefCount()
+	if c.pubsubChannels.DictDelete(channel) != nil {
+		return false
+	}
+	e := server.pubsubChannels.DictFind(channel)
+	clients := e.Val.Val_.([]*RedisClient)
+	for i, sc := range clients {
+		if sc == c {
+			clients = append(clients[:i], clients[i+1:]...)
+			break
+		}
+	}
+	if len(clients) == 0 {
+		server.pubsubChannels.DictDelete(channel)
+	} else {
+		e.Val.Val_ = clients
+	}
+	if notify {
+		addReplyPubsubSubscription(c, "unsubscribe", channel)
+	}
+	return true
+}
+
+// pubsubSubscribePattern subscribe the client to pattern, return false if
+// it's already subscribed.
+func pubsubSubscribePattern(c *RedisClient, pattern *RedisObj) bool {
+	if c.pubsubPatterns.ListSearchKey(pattern) != nil {
+		return false
+	}
+	c.pubsubPatterns.ListAddNodeTail(pattern)
+	pattern.IncrRefCount()
+	server.pubsubPatterns = append(server.pubsubPatterns, &pubsubPattern{client: c, pattern: pattern})
+	server.pubsubPatternsCount[pattern.StrVal()]++
+	return true
+}
+
+// pubsubUnsubscribePattern unsubscribe the client from pattern, return
+// false if it's not subscribed. The pattern is no more counted when it has
+// no more clients.
+func pubsubUnsubscribePattern(c *RedisClient, pattern *RedisObj, notify bool) bool {
+	n := c.pubsubPatterns.ListSearchKey(pattern)
+	if n == nil {
+		return false
+	}
+	pattern.IncrRefCount()
+	defer pattern.DecrRefCount()
+	c.pubsubPatterns.ListDelNode(n)
+	n.Val.DecrRefCount()
+	for i, pat := range server.pubsubPatterns {
+		if pat.client == c && RedisStrEqual(pat.pattern, pattern) {
+			server.pubsubPatterns = append(server.pubsubPatterns[:i], server.pubsubPatterns[i+1:]...)
+			break
+		}
+	}
+	server.pubsubPatternsCount[pattern.StrVal()]--
+	if server.pubsubPatternsCount[pattern.StrVal()] == 0 {
+		delete(server.pubsubPatternsCount, pattern.StrVal())
+	}
+	if notify {
+		addReplyPubsubSubscription(c, "punsubscribe", pattern)
+	}
+	return true
+}
+
+// pubsubUnsubscribeAllChannels unsubscribe the client from all the
+// channels, and return the number of channels.
+func pubsubUnsubscribeAllChannels(c *RedisClient, notify bool) int {
+	var channels []*RedisObj
+	iter := c.pubsubChannels.DictGetIterator()
+	for e := iter.DictNext(); e != nil; e = iter.DictNext() {
+		channels = append(channels, e.Key)
+	}
+	iter.DictReleaseIterator()
+	for _, channel := range channels {
+		pubsubUnsubscribeChannel(c, channel, notify)
+	}
+	if notify && len(channels) == 0 {
+		addReplyPubsubSubscription(c, "unsubscribe", nil)
+	}
+	return len(channels)
+}
+
+// pubsubUnsubscribeAllPatterns unsubscribe the client from all the
+// patterns, and return the number of patterns.
+func pubsubUnsubscribeAllPatterns(c *RedisClient, notify bool) int {
+	count := 0
+	for c.pubsubPatterns.ListLength() > 0 {
+		pubsubUnsubscribePattern(c, c.pubsubPatterns.ListFirst().Val, notify)
+		count++
+	}
+	if notify && count == 0 {
+		addReplyPubsubSubscription(c, "punsubscribe", nil)
+	}
+	return count
+}
+
+// pubsubPublishMessage send message to the clients subscribed to channel
+// and to the patterns matching it, and return the number of receivers.
+func pubsubPublishMessage(channel, message *RedisObj) int64 {
+	var receivers int64
+	if e := server.pubsubChannels.DictFind(channel); e != nil {
+		for _, c := range e.Val.Val_.([]*RedisClient) {
+			c.AddReplyArrayLen(3)
+			c.AddReplyBulkStr("message")
+			c.AddReplyBulk(channel)
+			c.AddReplyBulk(message)
+			receivers++
+		}
+	}
+	for _, pat := range server.pubsubPatterns {
+		if !stringmatch(pat.pattern.StrVal(), channel.StrVal(), false) {
+			continue
+		}
+		pat.client.AddReplyArrayLen(4)
+		pat.client.AddReplyBulkStr("pmessage")
+		pat.client.AddReplyBulk(pat.pattern)
+		pat.client.AddReplyBulk(channel)
+		pat.client.AddReplyBulk(message)
+		receivers++
+	}
+	return receivers
+}
+
+// subscribeCommand implement SUBSCRIBE channel [channel ...]
+func subscribeCommand(c *RedisClient) {
+	for _, channel := range c.args[1:] {
+		pubsubSubscribeChannel(c, channel)
+		addReplyPubsubSubscription(c, "subscribe", channel)
+	}
+	updatePubsubFlag(c)
+}
+
+// unsubscribeCommand implement UNSUBSCRIBE [channel [channel ...]], all
+// the channels are unsubscribed if none is given.
+func unsubscribeCommand(c *RedisClient) {
+	if len(c.args) == 1 {
+		pubsubUnsubscribeAllChannels(c, true)
+	} else {
+		for _, channel := range c.args[1:] {
+			if !pubsubUnsubscribeChannel(c, channel, true) {
+				addReplyPubsubSubscription(c, "unsubscribe", channel)
+			}
+		}
+	}
+	updatePubsubFlag(c)
+}
+
+// psubscribeCommand implement PSUBSCRIBE pattern [pattern ...]
+func psubscribeCommand(c *RedisClient) {
+	for _, pattern := range c.args[1:] {
+		pubsubSubscribePattern(c, pattern)
+		addReplyPubsubSubscription(c, "psubscribe", pattern)
+	}
+	updatePubsubFlag(c)
+}
+
+// punsubscribeCommand implement PUNSUBSCRIBE [pattern [pattern ...]], all
+// the patterns are unsubscribed if none is given.
+func punsubscribeCommand(c *RedisClient) {
+	if len(c.args) == 1 {
+		pubsubUnsubscribeAllPatterns(c, true)
+	} else {
+		for _, pattern := range c.args[1:] {
+			if !pubsubUnsubscribePattern(c, pattern, true) {
+				addReplyPubsubSubscription(c, "punsubscribe", pattern)
+			}
+		}
+	}
+	updatePubsubFlag(c)
+}
+
+// publishCommand implement PUBLISH channel message, return the number of
+// clients that received the message.
+func publishCommand(c *RedisClient) {
+	c.AddReplyInt(pubsubPublishMessage(c.args[1], c.args[2]))
+}
+
+// pubsubCommand implement PUBSUB CHANNELS [pattern], PUBSUB NUMSUB
+// [channel [channel ...]] and PUBSUB NUMPAT
+func pubsubCommand(c *RedisClient) {
+	sub := strings.ToLower(c.args[1].StrVal())
+	if sub == "channels" && (len(c.args) == 2 || len(c.args) == 3) {
+		node := c.AddDeferredArrayLen()
+		n := 0
+		iter := server.pubsubChannels.DictGetIterator()
+		for e := iter.DictNext(); e != nil; e = iter.DictNext() {
+			if len(c.args) == 3 && !stringmatch(c.args[2].StrVal(), e.Key.StrVal(), false) {
+				continue
+			}
+			c.AddReplyBulk(e.Key)
+			n++
+		}
+		iter.DictReleaseIterator()
+		c.SetDeferredArrayLen(node, n)
+	} else if sub == "numsub" {
+		c.AddReplyArrayLen((len(c.args) - 2) * 2)
+		for _, channel := range c.args[2:] {
+			var n int
+			if e := server.pubsubChannels.DictFind(channel); e != nil {
+				n = len(e.Val.Val_.([]*RedisClient))
+			}
+			c.AddReplyBulk(channel)
+			c.AddReplyInt(int64(n))
+		}
+	} else if sub == "numpat" && len(c.args) == 2 {
+		// the distinct patterns, whatever the number of clients.
+		c.AddReplyInt(int64(len(server.pubsubPatternsCount)))
+	} else {
+		c.AddReplyErrorFormat("unknown subcommand or wrong number of arguments for '%s'. Try PUBSUB HELP.", c.args[1].StrVal())
+	}
+}
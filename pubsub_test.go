@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSubscribeCmd(t *testing.T) {
+	c := testClient()
+	c1, c2 := CreateClient(c.fd), CreateClient(c.fd)
+	assert.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$3\r\nch2\r\n:2\r\n",
+		execCommand(c1, "subscribe", "ch", "ch2"))
+	assert.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:2\r\n", execCommand(c1, "subscribe", "ch"))
+	assert.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n", execCommand(c2, "subscribe", "ch"))
+	assert.Equal(t, CLIENT_PUBSUB, c1.flags&CLIENT_PUBSUB)
+
+	assert.Equal(t, ":2\r\n", execCommand(c, "publish", "ch", "hello"))
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$5\r\nhello\r\n", takeReply(c1))
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$5\r\nhello\r\n", takeReply(c2))
+	assert.Equal(t, ":0\r\n", execCommand(c, "publish", "nosub", "hello"))
+
+	// only the pubsub commands are allowed in subscribed mode.
+	assert.Equal(t, "-ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n",
+		execCommand(c1, "get", "k"))
+	assert.Equal(t, "*2\r\n$4\r\npong\r\n$0\r\n\r\n", execCommand(c1, "ping"))
+	assert.Equal(t, "+PONG\r\n", execCommand(c, "ping"))
+	assert.Equal(t, "$2\r\nhi\r\n", execCommand(c, "ping", "hi"))
+
+	assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$2\r\nch\r\n:1\r\n*3\r\n$11\r\nunsubscribe\r\n$5\r\nnosub\r\n:1\r\n",
+		execCommand(c1, "unsubscribe", "ch", "nosub"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "publish", "ch", "hello"))
+	assert.Equal(t, "", takeReply(c1))
+	takeReply(c2)
+	assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$3\r\nch2\r\n:0\r\n", execCommand(c1, "unsubscribe"))
+	assert.Equal(t, 0, c1.flags&CLIENT_PUBSUB)
+	assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n", execCommand(c1, "unsubscribe"))
+	assert.Equal(t, "$-1\r\n", execCommand(c1, "get", "k"))
+	assert.Equal(t, int64(1), server.pubsubChannels.DictSize())
+}
+
+func TestPsubscribeCmd(t *testing.T) {
+	c := testClient()
+	c1, c2 := CreateClient(c.fd), CreateClient(c.fd)
+	assert.Equal(t, "*3\r\n$10\r\npsubscribe\r\n$4\r\nnew*\r\n:1\r\n", execCommand(c1, "psubscribe", "new*"))
+	execCommand(c1, "subscribe", "news")
+	execCommand(c2, "psubscribe", "n?ws", "new*")
+
+	assert.Equal(t, ":4\r\n", execCommand(c, "publish", "news", "m"))
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$1\r\nm\r\n*4\r\n$8\r\npmessage\r\n$4\r\nnew*\r\n$4\r\nnews\r\n$1\r\nm\r\n",
+		takeReply(c1))
+	assert.Equal(t, "*4\r\n$8\r\npmessage\r\n$4\r\nn?ws\r\n$4\r\nnews\r\n$1\r\nm\r\n*4\r\n$8\r\npmessage\r\n$4\r\nnew*\r\n$4\r\nnews\r\n$1\r\nm\r\n",
+		takeReply(c2))
+
+	// the distinct patterns are counted.
+	assert.Equal(t, ":2\r\n", execCommand(c, "pubsub", "numpat"))
+	assert.Equal(t, "*1\r\n$4\r\nnews\r\n", execCommand(c, "pubsub", "channels"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "pubsub", "channels", "x*"))
+	assert.Equal(t, "*4\r\n$4\r\nnews\r\n:1\r\n$1\r\nx\r\n:0\r\n", execCommand(c, "pubsub", "numsub", "news", "x"))
+	assert.Equal(t, "-ERR unknown subcommand or wrong number of arguments for 'foo'. Try PUBSUB HELP.\r\n", execCommand(c, "pubsub", "foo"))
+
+	assert.Equal(t, "*3\r\n$12\r\npunsubscribe\r\n$4\r\nn?ws\r\n:1\r\n*3\r\n$12\r\npunsubscribe\r\n$4\r\nnew*\r\n:0\r\n",
+		execCommand(c2, "punsubscribe"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "pubsub", "numpat"))
+
+	// a freed client is removed from all its subscriptions.
+	c1.fd = -1
+	server.clients[-1] = c1
+	freeClient(c1)
+	assert.Equal(t, ":0\r\n", execCommand(c, "pubsub", "numpat"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "pubsub", "channels"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "publish", "news", "m"))
+}
@@ -0,0 +1,503 @@
+package main
+
+// A quicklist is a doubly linked list of listpacks. Every node holds as many
+// elements as list-max-listpack-size allows, and the nodes deeper than
+// list-compress-depth from both ends can be stored lzf compressed, the head
+// and the tail nodes are never compressed so push and pop stay O(1).
+
+// where of QuicklistPush and QuicklistPop.
+const (
+	QUICKLIST_HEAD int = 0
+	QUICKLIST_TAIL int = 1
+)
+
+const (
+	// SIZE_ESTIMATE_OVERHEAD is the estimated encoding overhead of an element.
+	SIZE_ESTIMATE_OVERHEAD int = 8
+	// MIN_COMPRESS_BYTES is the min size of a listpack worth compressing.
+	MIN_COMPRESS_BYTES int = 48
+	// MIN_COMPRESS_IMPROVE is the min number of bytes a compression must save.
+	MIN_COMPRESS_IMPROVE int = 8
+)
+
+type QuicklistNode struct {
+	prev  *QuicklistNode
+	next  *QuicklistNode
+	lp    *Listpack // nil while the node is compressed.
+	lzf   []byte    // the compressed listpack.
+	sz    int       // size in bytes of the uncompressed listpack.
+	count int       // number of elements.
+	// the node is temporarily decompressed to be accessed.
+	recompress bool
+}
+
+type Quicklist struct {
+	head     *QuicklistNode
+	tail     *QuicklistNode
+	count    int // number of elements in all the nodes.
+	len      int // number of nodes.
+	fill     int // list-max-listpack-size of the nodes.
+	compress int // nodes at each end left uncompressed, 0 disables it.
+}
+
+// QuicklistIter walk the quicklist from head to tail with AL_START_HEAD, or
+// from tail to head with AL_START_TAIL. The entry returned by QuicklistNext
+// can be deleted without breaking the iteration.
+type QuicklistIter struct {
+	ql        *Quicklist
+	current   *QuicklistNode
+	p         int // offset of the next element in current, -1 at its end.
+	direction int
+}
+
+// QuicklistEntry is an element returned by QuicklistNext.
+type QuicklistEntry struct {
+	node *QuicklistNode
+	p    int // offset of the element in the listpack of node.
+}
+
+func QuicklistCreate(fill, compress int) *Quicklist {
+	return &Quicklist{fill: fill, compress: compress}
+}
+
+// quicklistCreateNode return a new node holding the element val.
+func quicklistCreateNode(val string) *QuicklistNode {
+	lp := LpNew()
+	lp.LpAppend(val)
+	return &QuicklistNode{lp: lp, sz: lp.LpBytes(), count: 1}
+}
+
+func (ql *Quicklist) QuicklistCount() int {
+	return ql.count
+}
+
+// quicklistNodeUpdateSz must be called after the listpack of node changes.
+func (node *QuicklistNode) quicklistNodeUpdateSz() {
+	node.sz = node.lp.LpBytes()
+}
+
+// quicklistNodeAllowInsert report whether an element of sz bytes can be
+// added to node.
+func (node *QuicklistNode) quicklistNodeAllowInsert(fill int, sz int) bool {
+	if node == nil {
+		return false
+	}
+	return !listpackExceedsLimit(fill, node.sz+sz+SIZE_ESTIMATE_OVERHEAD, node.count+1)
+}
+
+// quicklistCompressNode compress the listpack of node, return false if the
+// node is too small or the compression doesn't save enough.
+func (node *QuicklistNode) quicklistCompressNode() bool {
+	if node == nil || node.lp == nil {
+		return false
+	}
+	node.recompress = false
+	if node.sz < MIN_COMPRESS_BYTES {
+		return false
+	}
+	data := lzfCompress(node.lp.buf, node.sz-MIN_COMPRESS_IMPROVE)
+	if data == nil {
+		return false
+	}
+	node.lzf = data
+	node.lp = nil
+	return true
+}
+
+// quicklistDecompressNode decompress node for good.
+func (node *QuicklistNode) quicklistDecompressNode() {
+	if node == nil {
+		return
+	}
+	node.recompress = false
+	if node.lp == nil {
+		node.lp = &Listpack{buf: lzfDecompress(node.lzf, node.sz)}
+		node.lzf = nil
+	}
+}
+
+// quicklistDecompressNodeForUse decompress node to access it, it is
+// compressed again by quicklistRecompressOnly.
+func (node *QuicklistNode) quicklistDecompressNodeForUse() {
+	if node.lp == nil {
+		node.quicklistDecompressNode()
+		node.recompress = true
+	}
+}
+
+func (node *QuicklistNode) quicklistRecompressOnly() {
+	if node.recompress {
+		node.quicklistCompressNode()
+	}
+}
+
+// quicklistCompress compress node if it is deeper than the compress depth.
+// The nodes within the depth from both ends are decompressed, and the ones
+// just beyond it are compressed as they may have been pushed out of it.
+func (ql *Quicklist) quicklistCompress(node *QuicklistNode) {
+	if node != nil && node.recompress {
+		node.quicklistCompressNode()
+		return
+	}
+	if ql.compress == 0 || ql.len < ql.compress*2 {
+		return
+	}
+	forward, reverse := ql.head, ql.tail
+	inDepth := false
+	for depth := 0; depth < ql.compress; depth++ {
+		forward.quicklistDecompressNode()
+		reverse.quicklistDecompressNode()
+		if forward == node || reverse == node {
+			inDepth = true
+		}
+		// the nodes met, no node is deep enough to be compressed.
+		if forward == reverse || forward.next == reverse {
+			return
+		}
+		forward, reverse = forward.next, reverse.prev
+	}
+	if !inDepth {
+		node.quicklistCompressNode()
+	}
+	forward.quicklistCompressNode()
+	reverse.quicklistCompressNode()
+}
+
+// quicklistInsertNode link newNode after or before oldNode, oldNode is nil
+// when the quicklist is empty.
+func (ql *Quicklist) quicklistInsertNode(oldNode, newNode *QuicklistNode, after bool) {
+	if after {
+		newNode.prev = oldNode
+		if oldNode != nil {
+			newNode.next = oldNode.next
+			if oldNode.next != nil {
+				oldNode.next.prev = newNode
+			}
+			oldNode.next = newNode
+		}
+		if ql.tail == oldNode {
+			ql.tail = newNode
+		}
+	} else {
+		newNode.next = oldNode
+		if oldNode != nil {
+			newNode.prev = oldNode.prev
+			if oldNode.prev != nil {
+				oldNode.prev.next = newNode
+			}
+			oldNode.prev = newNode
+		}
+		if ql.head == oldNode {
+			ql.head = newNode
+		}
+	}
+	if ql.len == 0 {
+		ql.head, ql.tail = newNode, newNode
+	}
+	ql.len++
+	if oldNode != nil {
+		ql.quicklistCompress(oldNode)
+	}
+	ql.quicklistCompress(newNode)
+}
+
+// quicklistDelNode unlink node and remove its elements from the count.
+func (ql *Quicklist) quicklistDelNode(node *QuicklistNode) {
+	if node.next != nil {
+		node.next.prev = node.prev
+	}
+	if node.prev != nil {
+		node.prev.next = node.next
+	}
+	if node == ql.tail {
+		ql.tail = node.prev
+	}
+	if node == ql.head {
+		ql.head = node.next
+	}
+	ql.len--
+	ql.count -= node.count
+	// the nodes entering the compress depth must be decompressed.
+	ql.quicklistCompress(nil)
+}
+
+// quicklistAppendListpack add lp as a new node at the tail, the quicklist
+// takes the ownership of lp.
+func (ql *Quicklist) quicklistAppendListpack(lp *Listpack) {
+	node := &QuicklistNode{lp: lp, sz: lp.LpBytes(), count: lp.LpLength()}
+	ql.quicklistInsertNode(ql.tail, node, true)
+	ql.count += node.count
+}
+
+// QuicklistPush add val at the head or the tail, a new node is created if
+// the end node is full.
+func (ql *Quicklist) QuicklistPush(val string, where int) {
+	node, after := ql.head, false
+	if where == QUICKLIST_TAIL {
+		node, after = ql.tail, true
+	}
+	if node.quicklistNodeAllowInsert(ql.fill, len(val)) {
+		node.quicklistDecompressNode()
+		if after {
+			node.lp.LpAppend(val)
+		} else {
+			node.lp.LpPrepend(val)
+		}
+		node.count++
+		node.quicklistNodeUpdateSz()
+	} else {
+		ql.quicklistInsertNode(node, quicklistCreateNode(val), after)
+	}
+	ql.count++
+}
+
+// QuicklistPop remove and return the element at the head or the tail, nil
+// if the quicklist is empty.
+func (ql *Quicklist) QuicklistPop(where int) *RedisObj {
+	node := ql.head
+	if where == QUICKLIST_TAIL {
+		node = ql.tail
+	}
+	if node == nil {
+		return nil
+	}
+	node.quicklistDecompressNode()
+	p := node.lp.LpFirst()
+	if where == QUICKLIST_TAIL {
+		p = node.lp.LpLast()
+	}
+	val := node.lp.LpGetObject(p)
+	node.lp.LpDelete(p)
+	node.count--
+	node.quicklistNodeUpdateSz()
+	ql.count--
+	if node.count == 0 {
+		ql.quicklistDelNode(node)
+	}
+	return val
+}
+
+// QuicklistDup return a copy of the quicklist, compressed nodes stay
+// compressed.
+func (ql *Quicklist) QuicklistDup() *Quicklist {
+	dup := QuicklistCreate(ql.fill, ql.compress)
+	for node := ql.head; node != nil; node = node.next {
+		newNode := &QuicklistNode{sz: node.sz, count: node.count}
+		if node.lp != nil {
+			newNode.lp = node.lp.LpDup()
+		} else {
+			newNode.lzf = append([]byte(nil), node.lzf...)
+		}
+		newNode.prev = dup.tail
+		if dup.tail != nil {
+			dup.tail.next = newNode
+		} else {
+			dup.head = newNode
+		}
+		dup.tail = newNode
+		dup.len++
+	}
+	dup.count = ql.count
+	return dup
+}
+
+// QuicklistGetIterator return an iterator starting at the head with
+// AL_START_HEAD, or at the tail with AL_START_TAIL.
+func (ql *Quicklist) QuicklistGetIterator(direction int) *QuicklistIter {
+	iter := &QuicklistIter{ql: ql, p: -1, direction: direction}
+	if direction == AL_START_HEAD {
+		iter.current = ql.head
+	} else {
+		iter.current = ql.tail
+	}
+	if iter.current != nil {
+		iter.current.quicklistDecompressNodeForUse()
+		iter.p = iter.quicklistFirstOffset()
+	}
+	return iter
+}
+
+// QuicklistGetIteratorAtIdx return an iterator starting at idx, negative
+// idx counts from the tail, nil if idx is out of range.
+func (ql *Quicklist) QuicklistGetIteratorAtIdx(direction int, idx int) *QuicklistIter {
+	if idx < 0 {
+		idx += ql.count
+	}
+	if idx < 0 || idx >= ql.count {
+		return nil
+	}
+	// walk the nodes from the nearest end.
+	var node *QuicklistNode
+	var offset int
+	if idx < ql.count/2 {
+		accum := 0
+		for node = ql.head; accum+node.count <= idx; node = node.next {
+			accum += node.count
+		}
+		offset = idx - accum
+	} else {
+		accum, ridx := 0, ql.count-1-idx
+		for node = ql.tail; accum+node.count <= ridx; node = node.prev {
+			accum += node.count
+		}
+		offset = node.count - 1 - (ridx - accum)
+	}
+	node.quicklistDecompressNodeForUse()
+	return &QuicklistIter{ql: ql, current: node, p: node.lp.LpSeek(offset), direction: direction}
+}
+
+// quicklistFirstOffset return the offset of the first element of the
+// current node in the direction of the iterator.
+func (iter *QuicklistIter) quicklistFirstOffset() int {
+	if iter.direction == AL_START_HEAD {
+		return iter.current.lp.LpFirst()
+	}
+	return iter.current.lp.LpLast()
+}
+
+// QuicklistNext store the next element in entry, return false when the
+// iteration is done.
+func (iter *QuicklistIter) QuicklistNext(entry *QuicklistEntry) bool {
+	for iter.current != nil && iter.p == -1 {
+		iter.current.quicklistRecompressOnly()
+		if iter.direction == AL_START_HEAD {
+			iter.current = iter.current.next
+		} else {
+			iter.current = iter.current.prev
+		}
+		if iter.current != nil {
+			iter.current.quicklistDecompressNodeForUse()
+			iter.p = iter.quicklistFirstOffset()
+		}
+	}
+	if iter.current == nil {
+		return false
+	}
+	entry.node, entry.p = iter.current, iter.p
+	if iter.direction == AL_START_HEAD {
+		iter.p = iter.current.lp.LpNext(iter.p)
+	} else {
+		iter.p = iter.current.lp.LpPrev(iter.p)
+	}
+	return true
+}
+
+// QuicklistDelEntry delete the element of entry, the iterator stays valid.
+func (iter *QuicklistIter) QuicklistDelEntry(entry *QuicklistEntry) {
+	node := entry.node
+	// the next element moves to the offset of the deleted one, the
+	// previous elements don't move.
+	p := node.lp.LpDelete(entry.p)
+	if iter.direction == AL_START_HEAD {
+		iter.p = p
+	}
+	node.count--
+	node.quicklistNodeUpdateSz()
+	iter.ql.count--
+	if node.count > 0 {
+		return
+	}
+
+	next := node.next
+	if iter.direction == AL_START_TAIL {
+		next = node.prev
+	}
+	iter.ql.quicklistDelNode(node)
+	iter.current, iter.p = next, -1
+	if next != nil {
+		next.quicklistDecompressNodeForUse()
+		iter.p = iter.quicklistFirstOffset()
+	}
+}
+
+// QuicklistReleaseIterator compress again the node being accessed.
+func (iter *QuicklistIter) QuicklistReleaseIterator() {
+	if iter.current != nil {
+		iter.current.quicklistRecompressOnly()
+	}
+}
+
+// QuicklistInsert insert val before or after the element of entry. The
+// iterator of entry must not be used after the insert.
+func (ql *Quicklist) QuicklistInsert(entry *QuicklistEntry, val string, after bool) {
+	node := entry.node
+	ql.count++
+	if node.quicklistNodeAllowInsert(ql.fill, len(val)) {
+		where := LP_BEFORE
+		if after {
+			where = LP_AFTER
+		}
+		node.lp.LpInsert(val, entry.p, where)
+		node.count++
+		node.quicklistNodeUpdateSz()
+		return
+	}
+
+	// node is full, try the neighbor node when inserting at an end of node.
+	atTail := after && node.lp.LpNext(entry.p) == -1
+	atHead := !after && node.lp.LpPrev(entry.p) == -1
+	switch {
+	case atTail && node.next.quicklistNodeAllowInsert(ql.fill, len(val)):
+		next := node.next
+		next.quicklistDecompressNodeForUse()
+		next.lp.LpPrepend(val)
+		next.count++
+		next.quicklistNodeUpdateSz()
+		next.quicklistRecompressOnly()
+	case atHead && node.prev.quicklistNodeAllowInsert(ql.fill, len(val)):
+		prev := node.prev
+		prev.quicklistDecompressNodeForUse()
+		prev.lp.LpAppend(val)
+		prev.count++
+		prev.quicklistNodeUpdateSz()
+		prev.quicklistRecompressOnly()
+	case atTail || atHead:
+		ql.quicklistInsertNode(node, quicklistCreateNode(val), after)
+	default:
+		// split node at the insert position and put val in its own node
+		// between the two halves.
+		p := entry.p
+		if after {
+			p = node.lp.LpNext(p)
+		}
+		right := node.quicklistSplitNode(p)
+		ql.quicklistInsertNode(node, right, true)
+		ql.quicklistInsertNode(node, quicklistCreateNode(val), true)
+	}
+}
+
+// QuicklistReplaceEntry replace the element of entry with val. The
+// iterator of entry must not be used after the replace.
+func (ql *Quicklist) QuicklistReplaceEntry(entry *QuicklistEntry, val string) {
+	node := entry.node
+	p := node.lp.LpReplace(entry.p, val)
+	node.quicklistNodeUpdateSz()
+	if node.count == 1 || !listpackExceedsLimit(ql.fill, node.sz, node.count) {
+		return
+	}
+	// the node is too large now, move the element to its own node. The
+	// nodes are split before being linked as linking may compress node.
+	var right, mid *QuicklistNode
+	if next := node.lp.LpNext(p); next != -1 {
+		right = node.quicklistSplitNode(next)
+	}
+	if p != node.lp.LpFirst() {
+		mid = node.quicklistSplitNode(p)
+	}
+	if right != nil {
+		ql.quicklistInsertNode(node, right, true)
+	}
+	if mid != nil {
+		ql.quicklistInsertNode(node, mid, true)
+	}
+}
+
+// quicklistSplitNode move the elements of node from the offset p to the end
+// to a new node, which is returned unlinked.
+func (node *QuicklistNode) quicklistSplitNode(p int) *QuicklistNode {
+	lp := node.lp.lpSplit(p)
+	newNode := &QuicklistNode{lp: lp, sz: lp.LpBytes(), count: lp.LpLength()}
+	node.count -= newNode.count
+	node.quicklistNodeUpdateSz()
+	return newNode
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// qlElements return the elements of ql from the head, and check the nodes
+// are linked and counted right.
+func qlElements(t *testing.T, ql *Quicklist) []string {
+	elements := []string{}
+	iter := ql.QuicklistGetIterator(AL_START_HEAD)
+	var entry QuicklistEntry
+	for iter.QuicklistNext(&entry) {
+		elements = append(elements, entry.node.lp.LpGetString(entry.p))
+	}
+	iter.QuicklistReleaseIterator()
+
+	count, length := 0, 0
+	var prev *QuicklistNode
+	for node := ql.head; node != nil; node = node.next {
+		assert.Equal(t, prev, node.prev)
+		assert.Greater(t, node.count, 0)
+		count += node.count
+		length++
+		prev = node
+	}
+	assert.Equal(t, ql.tail, prev)
+	assert.Equal(t, ql.count, count)
+	assert.Equal(t, ql.len, length)
+	assert.Equal(t, ql.count, len(elements))
+	return elements
+}
+
+func TestQuicklistPushPop(t *testing.T) {
+	ql := QuicklistCreate(4, 0)
+	for i := 0; i < 10; i++ {
+		ql.QuicklistPush(strconv.Itoa(i), QUICKLIST_TAIL)
+	}
+	ql.QuicklistPush("a", QUICKLIST_HEAD)
+	assert.Equal(t, []string{"a", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, qlElements(t, ql))
+	assert.Equal(t, 4, ql.len)
+
+	assert.Equal(t, "a", ql.QuicklistPop(QUICKLIST_HEAD).StrVal())
+	assert.Equal(t, int64(9), ql.QuicklistPop(QUICKLIST_TAIL).IntVal())
+	for i := 0; i < 9; i++ {
+		ql.QuicklistPop(QUICKLIST_HEAD)
+	}
+	assert.Nil(t, ql.QuicklistPop(QUICKLIST_HEAD))
+	assert.Nil(t, ql.head)
+	assert.Nil(t, ql.tail)
+	assert.Equal(t, 0, ql.len)
+}
+
+func TestQuicklistIndex(t *testing.T) {
+	ql := QuicklistCreate(3, 0)
+	for i := 0; i < 20; i++ {
+		ql.QuicklistPush(strconv.Itoa(i), QUICKLIST_TAIL)
+	}
+	var entry QuicklistEntry
+	for _, idx := range []int{0, 2, 3, 10, 17, 19, -1, -20} {
+		iter := ql.QuicklistGetIteratorAtIdx(AL_START_HEAD, idx)
+		assert.True(t, iter.QuicklistNext(&entry))
+		want := idx
+		if want < 0 {
+			want += 20
+		}
+		assert.Equal(t, int64(want), entry.node.lp.LpGetObject(entry.p).IntVal())
+	}
+	assert.Nil(t, ql.QuicklistGetIteratorAtIdx(AL_START_HEAD, 20))
+	assert.Nil(t, ql.QuicklistGetIteratorAtIdx(AL_START_HEAD, -21))
+
+	// walk backward from the middle.
+	iter := ql.QuicklistGetIteratorAtIdx(AL_START_TAIL, 5)
+	var got []string
+	for iter.QuicklistNext(&entry) {
+		got = append(got, entry.node.lp.LpGetString(entry.p))
+	}
+	assert.Equal(t, []string{"5", "4", "3", "2", "1", "0"}, got)
+}
+
+func TestQuicklistCompress(t *testing.T) {
+	ql := QuicklistCreate(8, 2)
+	for i := 0; i < 100; i++ {
+		ql.QuicklistPush(strings.Repeat("x", 20)+strconv.Itoa(i), QUICKLIST_TAIL)
+	}
+	// only the 2 nodes at each end are not compressed.
+	depth := 0
+	for node := ql.head; node != nil; node = node.next {
+		fromTail := ql.len - 1 - depth
+		if depth < 2 || fromTail < 2 {
+			assert.NotNil(t, node.lp)
+		} else {
+			assert.Nil(t, node.lp)
+			assert.Less(t, len(node.lzf), node.sz)
+		}
+		depth++
+	}
+
+	// nodes are decompressed to be read and compressed again.
+	iter := ql.QuicklistGetIteratorAtIdx(AL_START_HEAD, 50)
+	var entry QuicklistEntry
+	assert.True(t, iter.QuicklistNext(&entry))
+	assert.Equal(t, strings.Repeat("x", 20)+"50", entry.node.lp.LpGetString(entry.p))
+	node := entry.node
+	iter.QuicklistReleaseIterator()
+	assert.Nil(t, node.lp)
+
+	// popping brings the compressed nodes into the depth.
+	for ql.len > 4 {
+		ql.QuicklistPop(QUICKLIST_HEAD)
+	}
+	for node := ql.head; node != nil; node = node.next {
+		assert.NotNil(t, node.lp)
+	}
+	dup := ql.QuicklistDup()
+	assert.Equal(t, qlElements(t, ql), qlElements(t, dup))
+}
+
+// TestQuicklistRandom compare the quicklist with a slice after random
+// operations, with and without compression.
+func TestQuicklistRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, opt := range [][2]int{{4, 0}, {4, 1}, {-1, 2}, {1, 1}} {
+		ql := QuicklistCreate(opt[0], opt[1])
+		model := []string{}
+		randVal := func() string {
+			if r.Intn(2) == 0 {
+				return strconv.Itoa(r.Intn(1000))
+			}
+			return strings.Repeat(string(rune('a'+r.Intn(26))), r.Intn(300))
+		}
+		for i := 0; i < 3000; i++ {
+			switch op := r.Intn(10); {
+			case op < 3 || len(model) == 0:
+				val := randVal()
+				if r.Intn(2) == 0 {
+					ql.QuicklistPush(val, QUICKLIST_HEAD)
+					model = append([]string{val}, model...)
+				} else {
+					ql.QuicklistPush(val, QUICKLIST_TAIL)
+					model = append(model, val)
+				}
+			case op < 5:
+				if r.Intn(2) == 0 {
+					assert.Equal(t, model[0], ql.QuicklistPop(QUICKLIST_HEAD).StrVal())
+					model = model[1:]
+				} else {
+					assert.Equal(t, model[len(model)-1], ql.QuicklistPop(QUICKLIST_TAIL).StrVal())
+					model = model[:len(model)-1]
+				}
+			case op < 7:
+				idx, val, after := r.Intn(len(model)), randVal(), r.Intn(2) == 0
+				iter := ql.QuicklistGetIteratorAtIdx(AL_START_HEAD, idx)
+				var entry QuicklistEntry
+				iter.QuicklistNext(&entry)
+				ql.QuicklistInsert(&entry, val, after)
+				iter.QuicklistReleaseIterator()
+				if after {
+					idx++
+				}
+				model = append(model[:idx], append([]string{val}, model[idx:]...)...)
+			case op < 8:
+				idx, val := r.Intn(len(model)), randVal()
+				iter := ql.QuicklistGetIteratorAtIdx(AL_START_HEAD, idx)
+				var entry QuicklistEntry
+				iter.QuicklistNext(&entry)
+				ql.QuicklistReplaceEntry(&entry, val)
+				iter.QuicklistReleaseIterator()
+				model[idx] = val
+			default:
+				// delete every element starting with the same char, walking
+				// in a random direction.
+				direction := AL_START_HEAD
+				if r.Intn(2) == 0 {
+					direction = AL_START_TAIL
+				}
+				target := strconv.Itoa(r.Intn(10))
+				iter := ql.QuicklistGetIterator(direction)
+				var entry QuicklistEntry
+				for iter.QuicklistNext(&entry) {
+					if strings.HasPrefix(entry.node.lp.LpGetString(entry.p), target) {
+						iter.QuicklistDelEntry(&entry)
+					}
+				}
+				iter.QuicklistReleaseIterator()
+				kept := []string{}
+				for _, v := range model {
+					if !strings.HasPrefix(v, target) {
+						kept = append(kept, v)
+					}
+				}
+				model = kept
+			}
+			if i%50 == 0 {
+				assert.Equal(t, model, qlElements(t, ql))
+				assertQuicklistCompressed(t, ql)
+			}
+		}
+		assert.Equal(t, model, qlElements(t, ql))
+	}
+}
+
+// assertQuicklistCompressed check the nodes within the compress depth are
+// not compressed.
+func assertQuicklistCompressed(t *testing.T, ql *Quicklist) {
+	i := 0
+	for node := ql.head; node != nil; node = node.next {
+		if ql.compress == 0 || i < ql.compress || ql.len-1-i < ql.compress {
+			assert.NotNil(t, node.lp)
+		}
+		i++
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// A rax is a radix tree mapping string keys to values, the keys are kept in
+// lexicographic order. Every node holds the part of the key from its parent
+// to itself, so the chains of nodes with a single child are compressed in a
+// single node, and the children of a node are sorted by their first byte.
+type raxNode struct {
+	prefix   string
+	isKey    bool
+	value    interface{}
+	children []*raxNode
+}
+
+type Rax struct {
+	head     *raxNode
+	numele   uint64
+	numnodes uint64
+}
+
+func RaxNew() *Rax {
+	return &Rax{head: &raxNode{}, numnodes: 1}
+}
+
+// RaxSize return the number of keys.
+func (rax *Rax) RaxSize() uint64 {
+	return rax.numele
+}
+
+// raxFindChild return the index of the child of n starting with b, or the
+// index where it should be inserted and false if there is none.
+func (n *raxNode) raxFindChild(b byte) (int, bool) {
+	i := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= b
+	})
+	return i, i < len(n.children) && n.children[i].prefix[0] == b
+}
+
+// raxCommonPrefixLen return the length of the common prefix of a and b.
+func raxCommonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// raxGenericInsert insert key with value, an existing key is updated only
+// if overwrite is true. Return true if the key is new.
+func (rax *Rax) raxGenericInsert(key string, value interface{}, overwrite bool) bool {
+	n := rax.head
+	for len(key) > 0 {
+		i, found := n.raxFindChild(key[0])
+		if !found {
+			child := &raxNode{prefix: key, isKey: true, value: value}
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = child
+			rax.numnodes++
+			rax.numele++
+			return true
+		}
+		child := n.children[i]
+		l := raxCommonPrefixLen(child.prefix, key)
+		if l < len(child.prefix) {
+			// split the child where the key diverges.
+			split := &raxNode{prefix: child.prefix[:l], children: []*raxNode{child}}
+			child.prefix = child.prefix[l:]
+			n.children[i] = split
+			rax.numnodes++
+			child = split
+		}
+		key = key[l:]
+		n = child
+	}
+	if n.isKey {
+		if overwrite {
+			n.value = value
+		}
+		return false
+	}
+	n.isKey = true
+	n.value = value
+	rax.numele++
+	return true
+}
+
+// RaxInsert insert key with value, overwriting the value of an existing
+// key. Return true if the key is new.
+func (rax *Rax) RaxInsert(key string, value interface{}) bool {
+	return rax.raxGenericInsert(key, value, true)
+}
+
+// RaxTryInsert insert key with value only if the key doesn't exist.
+func (rax *Rax) RaxTryInsert(key string, value interface{}) bool {
+	return rax.raxGenericInsert(key, value, false)
+}
+
+// raxLowWalk return the node of key and the path of its parents with the
+// index of every node in its parent, or nil if key is not a node.
+func (rax *Rax) raxLowWalk(key string) (*raxNode, []*raxNode, []int) {
+	var parents []*raxNode
+	var idxs []int
+	n := rax.head
+	for len(key) > 0 {
+		i, found := n.raxFindChild(key[0])
+		if !found || !strings.HasPrefix(key, n.children[i].prefix) {
+			return nil, nil, nil
+		}
+		parents = append(parents, n)
+		idxs = append(idxs, i)
+		key = key[len(n.children[i].prefix):]
+		n = n.children[i]
+	}
+	return n, parents, idxs
+}
+
+// RaxFind return the value of key, false if key doesn't exist.
+func (rax *Rax) RaxFind(key string) (interface{}, bool) {
+	n, _, _ := rax.raxLowWalk(key)
+	if n == nil || !n.isKey {
+		return nil, false
+	}
+	return n.value, true
+}
+
+// RaxRemove remove key and return its old value, false if key doesn't
+// exist. The nodes left with no key and a single child are merged with it.
+func (rax *Rax) RaxRemove(key string) (interface{}, bool) {
+	n, parents, idxs := rax.raxLowWalk(key)
+	if n == nil || !n.isKey {
+		return nil, false
+	}
+	old := n.value
+	n.isKey = false
+	n.value = nil
+	rax.numele--
+	if len(parents) == 0 {
+		return old, true
+	}
+	parent, i := parents[len(parents)-1], idxs[len(idxs)-1]
+	if len(n.children) == 1 {
+		child := n.children[0]
+		child.prefix = n.prefix + child.prefix
+		parent.children[i] = child
+		rax.numnodes--
+		return old, true
+	}
+	if len(n.children) > 0 {
+		return old, true
+	}
+	parent.children = append(parent.children[:i], parent.children[i+1:]...)
+	rax.numnodes--
+	// the parent may now be a plain link to its last child.
+	if len(parents) > 1 && !parent.isKey && len(parent.children) == 1 {
+		child := parent.children[0]
+		child.prefix = parent.prefix + child.prefix
+		parents[len(parents)-2].children[idxs[len(idxs)-2]] = child
+		rax.numnodes--
+	}
+	return old, true
+}
+
+// raxMin return the smallest key of the subtree of n, path is the key of n.
+func (n *raxNode) raxMin(path string) (string, *raxNode) {
+	for !n.isKey {
+		if len(n.children) == 0 {
+			return "", nil
+		}
+		n = n.children[0]
+		path += n.prefix
+	}
+	return path, n
+}
+
+// raxMax return the greatest key of the subtree of n, path is the key of n.
+func (n *raxNode) raxMax(path string) (string, *raxNode) {
+	for len(n.children) > 0 {
+		n = n.children[len(n.children)-1]
+		path += n.prefix
+	}
+	if !n.isKey {
+		return "", nil
+	}
+	return path, n
+}
+
+// raxCeil return the smallest key of the subtree of n greater than key, or
+// equal to it if eq is true. path is the key of n.
+func (n *raxNode) raxCeil(path, key string, eq bool) (string, *raxNode) {
+	l := len(path)
+	if l > len(key) {
+		l = len(key)
+	}
+	if cmp := strings.Compare(path[:l], key[:l]); cmp > 0 {
+		return n.raxMin(path)
+	} else if cmp < 0 {
+		return "", nil
+	}
+	if len(path) > len(key) {
+		return n.raxMin(path)
+	}
+	if len(path) == len(key) {
+		if n.isKey && eq {
+			return path, n
+		}
+		if len(n.children) == 0 {
+			return "", nil
+		}
+		// all the keys below are longer than key.
+		child := n.children[0]
+		return child.raxMin(path + child.prefix)
+	}
+	i, _ := n.raxFindChild(key[len(path)])
+	for ; i < len(n.children); i++ {
+		child := n.children[i]
+		if k, found := child.raxCeil(path+child.prefix, key, eq); found != nil {
+			return k, found
+		}
+	}
+	return "", nil
+}
+
+// raxFloor return the greatest key of the subtree of n smaller than key, or
+// equal to it if eq is true. path is the key of n.
+func (n *raxNode) raxFloor(path, key string, eq bool) (string, *raxNode) {
+	l := len(path)
+	if l > len(key) {
+		l = len(key)
+	}
+	if cmp := strings.Compare(path[:l], key[:l]); cmp < 0 {
+		return n.raxMax(path)
+	} else if cmp > 0 {
+		return "", nil
+	}
+	if len(path) > len(key) {
+		return "", nil
+	}
+	if len(path) == len(key) {
+		if n.isKey && eq {
+			return path, n
+		}
+		return "", nil
+	}
+	i, found := n.raxFindChild(key[len(path)])
+	if !found {
+		i--
+	}
+	for ; i >= 0; i-- {
+		child := n.children[i]
+		if k, found := child.raxFloor(path+child.prefix, key, eq); found != nil {
+			return k, found
+		}
+	}
+	// the key of n is a prefix of key, so it's smaller.
+	if n.isKey {
+		return path, n
+	}
+	return "", nil
+}
+
+// raxIterator walks the keys of a rax in order. Every step looks up the key
+// following the current one from the head, so the rax can be modified while
+// iterating.
+type raxIterator struct {
+	rt   *Rax
+	key  string      // the current key
+	data interface{} // the value of the current key
+	// the element found by RaxSeek is returned by the following RaxNext or
+	// RaxPrev.
+	justSeeked bool
+	eof        bool
+}
+
+func RaxStart(rt *Rax) *raxIterator {
+	return &raxIterator{rt: rt, eof: true}
+}
+
+// RaxSeek position the iterator on the element selected by op and key. op
+// is "^" for the first element, "$" for the last one, "=" for key, and
+// ">", ">=", "<" or "<=" for the closest element to key. Return false if
+// there is no such element.
+func (it *raxIterator) RaxSeek(op string, key string) bool {
+	head := it.rt.head
+	var k string
+	var n *raxNode
+	switch op {
+	case "^":
+		k, n = head.raxMin("")
+	case "$":
+		k, n = head.raxMax("")
+	case "=":
+		if found, _, _ := it.rt.raxLowWalk(key); found != nil && found.isKey {
+			k, n = key, found
+		}
+	case ">", ">=":
+		k, n = head.raxCeil("", key, op == ">=")
+	case "<", "<=":
+		k, n = head.raxFloor("", key, op == "<=")
+	default:
+		panic("unknown rax seek operator")
+	}
+	it.justSeeked = true
+	it.setCurrent(k, n)
+	return !it.eof
+}
+
+func (it *raxIterator) setCurrent(key string, n *raxNode) {
+	if n == nil {
+		it.key, it.data, it.eof = "", nil, true
+		return
+	}
+	it.key, it.data, it.eof = key, n.value, false
+}
+
+// RaxNext move to the next element, return false at the end.
+func (it *raxIterator) RaxNext() bool {
+	if it.justSeeked {
+		it.justSeeked = false
+		return !it.eof
+	}
+	if it.eof {
+		return false
+	}
+	it.setCurrent(it.rt.head.raxCeil("", it.key, false))
+	return !it.eof
+}
+
+// RaxPrev move to the previous element, return false at the start.
+func (it *raxIterator) RaxPrev() bool {
+	if it.justSeeked {
+		it.justSeeked = false
+		return !it.eof
+	}
+	if it.eof {
+		return false
+	}
+	it.setCurrent(it.rt.head.raxFloor("", it.key, false))
+	return !it.eof
+}
+
+// RaxEOF report whether the iterator has no current element.
+func (it *raxIterator) RaxEOF() bool {
+	return it.eof
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestRaxInsertFindRemove(t *testing.T) {
+	rax := RaxNew()
+	assert.True(t, rax.RaxInsert("annibale", 1))
+	assert.True(t, rax.RaxInsert("annientare", 2))
+	assert.True(t, rax.RaxInsert("anni", 3))
+	assert.True(t, rax.RaxInsert("", 4))
+	assert.False(t, rax.RaxInsert("anni", 5))
+	assert.False(t, rax.RaxTryInsert("anni", 6))
+	assert.Equal(t, uint64(4), rax.RaxSize())
+
+	val, ok := rax.RaxFind("anni")
+	assert.True(t, ok)
+	assert.Equal(t, 5, val)
+	val, ok = rax.RaxFind("")
+	assert.True(t, ok)
+	assert.Equal(t, 4, val)
+	_, ok = rax.RaxFind("ann")
+	assert.False(t, ok)
+	_, ok = rax.RaxFind("annibalex")
+	assert.False(t, ok)
+
+	// "" -> "anni" -> "b" "e", and the two leaves.
+	assert.Equal(t, uint64(4), rax.numnodes)
+	val, ok = rax.RaxRemove("anni")
+	assert.True(t, ok)
+	assert.Equal(t, 5, val)
+	_, ok = rax.RaxRemove("anni")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(4), rax.numnodes)
+	rax.RaxRemove("annibale")
+	// the link node is merged with the remaining leaf.
+	assert.Equal(t, uint64(2), rax.numnodes)
+	val, ok = rax.RaxFind("annientare")
+	assert.True(t, ok)
+	assert.Equal(t, 2, val)
+	rax.RaxRemove("annientare")
+	rax.RaxRemove("")
+	assert.Equal(t, uint64(0), rax.RaxSize())
+	assert.Equal(t, uint64(1), rax.numnodes)
+}
+
+func TestRaxIterator(t *testing.T) {
+	rax := RaxNew()
+	keys := []string{"a", "ab", "abc", "abd", "b", "ba", "c"}
+	for i, key := range keys {
+		rax.RaxInsert(key, i)
+	}
+	it := RaxStart(rax)
+	var got []string
+	it.RaxSeek("^", "")
+	for it.RaxNext() {
+		got = append(got, it.key)
+	}
+	assert.Equal(t, keys, got)
+	got = nil
+	it.RaxSeek("$", "")
+	for it.RaxPrev() {
+		got = append(got, it.key)
+	}
+	assert.Equal(t, []string{"c", "ba", "b", "abd", "abc", "ab", "a"}, got)
+
+	seek := func(op, key string) string {
+		if !it.RaxSeek(op, key) {
+			return "EOF"
+		}
+		return it.key
+	}
+	assert.Equal(t, "abc", seek("=", "abc"))
+	assert.Equal(t, "EOF", seek("=", "abe"))
+	assert.Equal(t, "abc", seek(">=", "abc"))
+	assert.Equal(t, "abd", seek(">", "abc"))
+	assert.Equal(t, "abd", seek(">", "abcz"))
+	assert.Equal(t, "b", seek(">", "abd"))
+	assert.Equal(t, "a", seek(">", ""))
+	assert.Equal(t, "EOF", seek(">", "c"))
+	assert.Equal(t, "abc", seek("<=", "abc"))
+	assert.Equal(t, "ab", seek("<", "abc"))
+	assert.Equal(t, "abc", seek("<", "abcz"))
+	assert.Equal(t, "abd", seek("<", "b"))
+	assert.Equal(t, "c", seek("<", "z"))
+	assert.Equal(t, "EOF", seek("<", "a"))
+
+	// the iterator survives the removal of the current key.
+	it.RaxSeek(">=", "ab")
+	it.RaxNext()
+	rax.RaxRemove("ab")
+	assert.True(t, it.RaxNext())
+	assert.Equal(t, "abc", it.key)
+}
+
+func TestRaxRandom(t *testing.T) {
+	rax := RaxNew()
+	ref := make(map[string]int)
+	for i := 0; i < 5000; i++ {
+		key := strconv.Itoa(rand.Intn(2000))
+		if rand.Intn(3) == 0 {
+			_, ok := rax.RaxRemove(key)
+			_, refOk := ref[key]
+			assert.Equal(t, refOk, ok)
+			delete(ref, key)
+		} else {
+			rax.RaxInsert(key, i)
+			ref[key] = i
+		}
+	}
+	assert.Equal(t, uint64(len(ref)), rax.RaxSize())
+
+	var keys []string
+	for key := range ref {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	it := RaxStart(rax)
+	it.RaxSeek("^", "")
+	for _, key := range keys {
+		assert.True(t, it.RaxNext())
+		assert.Equal(t, key, it.key)
+		assert.Equal(t, ref[key], it.data)
+	}
+	assert.False(t, it.RaxNext())
+}
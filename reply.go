@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type sharedObjects struct {
+	ok           *RedisObj
+	pong         *RedisObj
+	emptyBulk    *RedisObj
+	nullBulk     *RedisObj
+	nullArray    *RedisObj
+	emptyArray   *RedisObj
+	czero        *RedisObj
+	cone         *RedisObj
+	cnegone      *RedisObj
+	syntaxErr    *RedisObj
+	wrongTypeErr *RedisObj
+	noKeyErr     *RedisObj
+	notIntErr    *RedisObj
+	outOfRange   *RedisObj
+	emptyScan    *RedisObj
+	integers     []*RedisObj
+}
+
+// shared holds the preallocated replies, so the hot paths don't need to
+// allocate a new object for every common reply.
+var shared = createSharedObjects()
+
+func createSharedObjects() sharedObjects {
+	create := func(str string) *RedisObj {
+		return makeObjectShared(CreateObject(REDISSTR, str))
+	}
+	integers := make([]*RedisObj, OBJ_SHARED_INTEGERS)
+	for i := range integers {
+		integers[i] = makeObjectShared(&RedisObj{
+			Type_:    REDISSTR,
+			Val_:     int64(i),
+			encoding: REDIS_ENCODING_INT,
+		})
+	}
+	return sharedObjects{
+		integers:     integers,
+		ok:           create("+OK\r\n"),
+		pong:         create("+PONG\r\n"),
+		emptyBulk:    create("$0\r\n\r\n"),
+		nullBulk:     create("$-1\r\n"),
+		nullArray:    create("*-1\r\n"),
+		emptyArray:   create("*0\r\n"),
+		czero:        create(":0\r\n"),
+		cone:         create(":1\r\n"),
+		cnegone:      create(":-1\r\n"),
+		syntaxErr:    create("-ERR syntax error\r\n"),
+		wrongTypeErr: create("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"),
+		noKeyErr:     create("-ERR no such key\r\n"),
+		notIntErr:    create("-ERR value is not an integer or out of range\r\n"),
+		outOfRange:   create("-ERR index out of range\r\n"),
+		emptyScan:    create("*2\r\n$1\r\n0\r\n*0\r\n"),
+	}
+}
+
+func (c *RedisClient) AddReply(obj *RedisObj) {
+	c.reply.ListAddNodeTail(obj)
+	obj.IncrRefCount()
+	server.aeLoop.AeCreateFileEvent(c.fd, AE_WRITABLE, SendReplyToClient, c)
+}
+
+func (c *RedisClient) AddReplyStr(str string) {
+	obj := CreateObject(REDISSTR, str)
+	c.AddReply(obj)
+	obj.DecrRefCount()
+}
+
+// AddReplyBulk reply the string value of obj as a bulk string.
+func (c *RedisClient) AddReplyBulk(obj *RedisObj) {
+	c.AddReplyBulkStr(obj.StrVal())
+}
+
+func (c *RedisClient) AddReplyBulkStr(str string) {
+	if len(str) == 0 {
+		c.AddReply(shared.emptyBulk)
+		return
+	}
+	c.AddReplyStr("$" + strconv.Itoa(len(str)) + "\r\n" + str + "\r\n")
+}
+
+func (c *RedisClient) AddReplyNullBulk() {
+	c.AddReply(shared.nullBulk)
+}
+
+// AddReplyDouble add a double as a bulk string.
+func (c *RedisClient) AddReplyDouble(val float64) {
+	c.AddReplyBulkStr(d2string(val))
+}
+
+func (c *RedisClient) AddReplyInt(val int64) {
+	switch val {
+	case 0:
+		c.AddReply(shared.czero)
+	case 1:
+		c.AddReply(shared.cone)
+	case -1:
+		c.AddReply(shared.cnegone)
+	default:
+		c.AddReplyStr(":" + strconv.FormatInt(val, 10) + "\r\n")
+	}
+}
+
+// AddReplyStatus reply a simple string, e.g. "+OK\r\n".
+func (c *RedisClient) AddReplyStatus(status string) {
+	c.AddReplyStr("+" + status + "\r\n")
+}
+
+// AddReplyError reply an error with the generic "ERR" prefix. If msg starts
+// with "-", it already carries its own error code and is sent as it is.
+func (c *RedisClient) AddReplyError(msg string) {
+	if len(msg) == 0 || msg[0] != '-' {
+		msg = "-ERR " + msg
+	}
+	c.AddReplyStr(msg + "\r\n")
+}
+
+func (c *RedisClient) AddReplyErrorFormat(format string, a ...interface{}) {
+	c.AddReplyError(fmt.Sprintf(format, a...))
+}
+
+func (c *RedisClient) AddReplyArrayLen(length int) {
+	if length == 0 {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+	c.AddReplyStr("*" + strconv.Itoa(length) + "\r\n")
+}
+
+// AddDeferredArrayLen add a placeholder to the reply list for an array whose
+// length is unknown yet, SetDeferredArrayLen must be called with the returned
+// node before the client gets back to the event loop.
+func (c *RedisClient) AddDeferredArrayLen() *ListNode {
+	obj := CreateObject(REDISSTR, "")
+	c.reply.ListAddNodeTail(obj)
+	return c.reply.ListLast()
+}
+
+func (c *RedisClient) SetDeferredArrayLen(node *ListNode, length int) {
+	node.Val.DecrRefCount()
+	node.Val = CreateObject(REDISSTR, "*"+strconv.Itoa(length)+"\r\n")
+	server.aeLoop.AeCreateFileEvent(c.fd, AE_WRITABLE, SendReplyToClient, c)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReply(t *testing.T) {
+	conf, _ := LoadConfig("config.json")
+	initServer(conf)
+	c := CreateClient(server.fd)
+
+	c.AddReplyBulkStr("hello")
+	assert.Equal(t, "$5\r\nhello\r\n", takeReply(c))
+	c.AddReplyBulkStr("")
+	assert.Equal(t, "$0\r\n\r\n", takeReply(c))
+	c.AddReplyBulk(CreateFromInt(100))
+	assert.Equal(t, "$3\r\n100\r\n", takeReply(c))
+	c.AddReplyNullBulk()
+	assert.Equal(t, "$-1\r\n", takeReply(c))
+
+	c.AddReplyInt(0)
+	c.AddReplyInt(1)
+	c.AddReplyInt(-1)
+	c.AddReplyInt(1024)
+	assert.Equal(t, ":0\r\n:1\r\n:-1\r\n:1024\r\n", takeReply(c))
+
+	c.AddReplyStatus("PONG")
+	assert.Equal(t, "+PONG\r\n", takeReply(c))
+
+	c.AddReplyError("syntax error")
+	assert.Equal(t, "-ERR syntax error\r\n", takeReply(c))
+	c.AddReplyError("-NOGROUP no such group")
+	assert.Equal(t, "-NOGROUP no such group\r\n", takeReply(c))
+	c.AddReplyErrorFormat("unknown command '%s'", "foo")
+	assert.Equal(t, "-ERR unknown command 'foo'\r\n", takeReply(c))
+	c.AddReply(shared.wrongTypeErr)
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", takeReply(c))
+
+	c.AddReplyArrayLen(0)
+	assert.Equal(t, "*0\r\n", takeReply(c))
+	c.AddReplyArrayLen(2)
+	c.AddReplyBulkStr("a")
+	c.AddReplyBulkStr("b")
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", takeReply(c))
+
+	node := c.AddDeferredArrayLen()
+	c.AddReplyInt(5)
+	c.AddReplyInt(6)
+	c.SetDeferredArrayLen(node, 2)
+	assert.Equal(t, "*2\r\n:5\r\n:6\r\n", takeReply(c))
+
+	// shared objects are never freed.
+	c.AddReply(shared.ok)
+	assert.Equal(t, "+OK\r\n", takeReply(c))
+	assert.Equal(t, OBJ_SHARED_REFCOUNT, shared.ok.refCount)
+	assert.Equal(t, "+OK\r\n", shared.ok.StrVal())
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+)
+
+const (
+	ZSKIPLIST_MAXLEVEL int     = 32   // enough for 2^64 elements.
+	ZSKIPLIST_P        float64 = 0.25 // skiplist P = 1/4.
+)
+
+type ZSkiplistLevel struct {
+	forward *ZSkiplistNode
+	span    int64 // number of nodes between this node and forward.
+}
+
+type ZSkiplistNode struct {
+	ele      *RedisObj
+	score    float64
+	backward *ZSkiplistNode
+	level    []ZSkiplistLevel
+}
+
+// ZSkiplist keeps the elements ordered by score, then by the bytes of the
+// element for the same score. The spans make the rank of an element
+// computable in O(log(N)).
+type ZSkiplist struct {
+	header *ZSkiplistNode
+	tail   *ZSkiplistNode
+	length int64
+	level  int
+}
+
+// ZRangeSpec is a score range, minex and maxex tell whether the bounds are
+// exclusive.
+type ZRangeSpec struct {
+	min, max     float64
+	minex, maxex bool
+}
+
+// ZLexRangeSpec is a lex range, a bound is -inf or +inf if its inf is -1
+// or 1, otherwise the bound is the string.
+type ZLexRangeSpec struct {
+	min, max       string
+	minex, maxex   bool
+	minInf, maxInf int
+}
+
+func zslCreateNode(level int, score float64, ele *RedisObj) *ZSkiplistNode {
+	return &ZSkiplistNode{
+		ele:   ele,
+		score: score,
+		level: make([]ZSkiplistLevel, level),
+	}
+}
+
+func ZslCreate() *ZSkiplist {
+	return &ZSkiplist{
+		header: zslCreateNode(ZSKIPLIST_MAXLEVEL, 0, nil),
+		level:  1,
+	}
+}
+
+// zslRandomLevel return a random level for a new node, the returned level
+// is more likely to be low, level n has a probability of P^(n-1).
+func zslRandomLevel() int {
+	level := 1
+	for rand.Float64() < ZSKIPLIST_P && level < ZSKIPLIST_MAXLEVEL {
+		level++
+	}
+	return level
+}
+
+func (zsl *ZSkiplist) ZslLength() int64 {
+	return zsl.length
+}
+
+// ZslFirst return the node with the lowest score.
+func (zsl *ZSkiplist) ZslFirst() *ZSkiplistNode {
+	return zsl.header.level[0].forward
+}
+
+func (zsl *ZSkiplist) ZslLast() *ZSkiplistNode {
+	return zsl.tail
+}
+
+// zslLess report whether (score, ele) is ordered before the node x.
+func zslLess(x *ZSkiplistNode, score float64, ele string) bool {
+	return x.score < score || (x.score == score && x.ele.StrVal() < ele)
+}
+
+// ZslInsert insert a new node, the element must not exist already. The
+// skiplist holds a new reference to ele.
+func (zsl *ZSkiplist) ZslInsert(score float64, ele *RedisObj) *ZSkiplistNode {
+	var update [ZSKIPLIST_MAXLEVEL]*ZSkiplistNode
+	var rank [ZSKIPLIST_MAXLEVEL]int64
+	str := ele.StrVal()
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		// store the rank that is crossed to reach the insert position.
+		if i != zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && zslLess(x.level[i].forward, score, str) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zslRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+	ele.IncrRefCount()
+	x = zslCreateNode(level, score, ele)
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		// update span covered by update[i] as x is inserted here.
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+	// increment span for untouched levels.
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+// zslDeleteNode unlink x, update holds the nodes before x at every level.
+func (zsl *ZSkiplist) zslDeleteNode(x *ZSkiplistNode, update []*ZSkiplistNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// zslFindUpdate return the nodes before (score, ele) at every level.
+func (zsl *ZSkiplist) zslFindUpdate(score float64, ele string) []*ZSkiplistNode {
+	update := make([]*ZSkiplistNode, ZSKIPLIST_MAXLEVEL)
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLess(x.level[i].forward, score, ele) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return update
+}
+
+// ZslDelete delete the node with the matching score and element, return
+// false if it is not found.
+func (zsl *ZSkiplist) ZslDelete(score float64, ele *RedisObj) bool {
+	str := ele.StrVal()
+	update := zsl.zslFindUpdate(score, str)
+	x := update[0].level[0].forward
+	if x != nil && x.score == score && x.ele.StrVal() == str {
+		zsl.zslDeleteNode(x, update)
+		x.ele.DecrRefCount()
+		return true
+	}
+	return false
+}
+
+// ZslUpdateScore change the score of the element, which must exist with
+// curscore, and return its node.
+func (zsl *ZSkiplist) ZslUpdateScore(curscore float64, ele *RedisObj, newscore float64) *ZSkiplistNode {
+	str := ele.StrVal()
+	update := zsl.zslFindUpdate(curscore, str)
+	x := update[0].level[0].forward
+
+	// the node stays at the same position, update the score in place.
+	if (x.backward == nil || x.backward.score < newscore) &&
+		(x.level[0].forward == nil || x.level[0].forward.score > newscore) {
+		x.score = newscore
+		return x
+	}
+
+	// otherwise remove and insert the element again.
+	zsl.zslDeleteNode(x, update)
+	newnode := zsl.ZslInsert(newscore, x.ele)
+	x.ele.DecrRefCount()
+	return newnode
+}
+
+func zslValueGteMin(value float64, spec *ZRangeSpec) bool {
+	if spec.minex {
+		return value > spec.min
+	}
+	return value >= spec.min
+}
+
+func zslValueLteMax(value float64, spec *ZRangeSpec) bool {
+	if spec.maxex {
+		return value < spec.max
+	}
+	return value <= spec.max
+}
+
+// zslIsInRange report whether a part of the skiplist is in range.
+func (zsl *ZSkiplist) zslIsInRange(spec *ZRangeSpec) bool {
+	if spec.min > spec.max || (spec.min == spec.max && (spec.minex || spec.maxex)) {
+		return false
+	}
+	x := zsl.tail
+	if x == nil || !zslValueGteMin(x.score, spec) {
+		return false
+	}
+	x = zsl.header.level[0].forward
+	return zslValueLteMax(x.score, spec)
+}
+
+// ZslFirstInRange return the first node in range, or nil.
+func (zsl *ZSkiplist) ZslFirstInRange(spec *ZRangeSpec) *ZSkiplistNode {
+	if !zsl.zslIsInRange(spec) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslValueGteMin(x.level[i].forward.score, spec) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !zslValueLteMax(x.score, spec) {
+		return nil
+	}
+	return x
+}
+
+// ZslLastInRange return the last node in range, or nil.
+func (zsl *ZSkiplist) ZslLastInRange(spec *ZRangeSpec) *ZSkiplistNode {
+	if !zsl.zslIsInRange(spec) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslValueLteMax(x.level[i].forward.score, spec) {
+			x = x.level[i].forward
+		}
+	}
+	if !zslValueGteMin(x.score, spec) {
+		return nil
+	}
+	return x
+}
+
+// zslLexCmp compare two lex bounds, inf is -1 or 1 for "-" and "+".
+func zslLexCmp(a string, ainf int, b string, binf int) int {
+	if ainf != 0 || binf != 0 {
+		if ainf == binf {
+			return 0
+		}
+		if ainf == -1 || binf == 1 {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func zslLexValueGteMin(value string, spec *ZLexRangeSpec) bool {
+	cmp := zslLexCmp(value, 0, spec.min, spec.minInf)
+	if spec.minex {
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+func zslLexValueLteMax(value string, spec *ZLexRangeSpec) bool {
+	cmp := zslLexCmp(value, 0, spec.max, spec.maxInf)
+	if spec.maxex {
+		return cmp < 0
+	}
+	return cmp <= 0
+}
+
+// zslIsInLexRange report whether a part of the skiplist is in the lex range.
+func (zsl *ZSkiplist) zslIsInLexRange(spec *ZLexRangeSpec) bool {
+	cmp := zslLexCmp(spec.min, spec.minInf, spec.max, spec.maxInf)
+	if cmp > 0 || (cmp == 0 && (spec.minex || spec.maxex)) {
+		return false
+	}
+	x := zsl.tail
+	if x == nil || !zslLexValueGteMin(x.ele.StrVal(), spec) {
+		return false
+	}
+	x = zsl.header.level[0].forward
+	return zslLexValueLteMax(x.ele.StrVal(), spec)
+}
+
+// ZslFirstInLexRange return the first node in the lex range, or nil.
+func (zsl *ZSkiplist) ZslFirstInLexRange(spec *ZLexRangeSpec) *ZSkiplistNode {
+	if !zsl.zslIsInLexRange(spec) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslLexValueGteMin(x.level[i].forward.ele.StrVal(), spec) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !zslLexValueLteMax(x.ele.StrVal(), spec) {
+		return nil
+	}
+	return x
+}
+
+// ZslLastInLexRange return the last node in the lex range, or nil.
+func (zsl *ZSkiplist) ZslLastInLexRange(spec *ZLexRangeSpec) *ZSkiplistNode {
+	if !zsl.zslIsInLexRange(spec) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLexValueLteMax(x.level[i].forward.ele.StrVal(), spec) {
+			x = x.level[i].forward
+		}
+	}
+	if !zslLexValueGteMin(x.ele.StrVal(), spec) {
+		return nil
+	}
+	return x
+}
+
+// zslDeleteWhile delete the nodes from x as long as inRange returns true,
+// the elements are also deleted from dict. Return the number of deleted nodes.
+func (zsl *ZSkiplist) zslDeleteWhile(x *ZSkiplistNode, update []*ZSkiplistNode, dict *Dict, inRange func(x *ZSkiplistNode) bool) int64 {
+	var removed int64
+	for x != nil && inRange(x) {
+		next := x.level[0].forward
+		zsl.zslDeleteNode(x, update)
+		dict.DictDelete(x.ele)
+		x.ele.DecrRefCount()
+		removed++
+		x = next
+	}
+	return removed
+}
+
+// ZslDeleteRangeByScore delete the nodes in the score range.
+func (zsl *ZSkiplist) ZslDeleteRangeByScore(spec *ZRangeSpec, dict *Dict) int64 {
+	update := make([]*ZSkiplistNode, ZSKIPLIST_MAXLEVEL)
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslValueGteMin(x.level[i].forward.score, spec) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return zsl.zslDeleteWhile(x.level[0].forward, update, dict, func(x *ZSkiplistNode) bool {
+		return zslValueLteMax(x.score, spec)
+	})
+}
+
+// ZslDeleteRangeByLex delete the nodes in the lex range.
+func (zsl *ZSkiplist) ZslDeleteRangeByLex(spec *ZLexRangeSpec, dict *Dict) int64 {
+	update := make([]*ZSkiplistNode, ZSKIPLIST_MAXLEVEL)
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslLexValueGteMin(x.level[i].forward.ele.StrVal(), spec) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return zsl.zslDeleteWhile(x.level[0].forward, update, dict, func(x *ZSkiplistNode) bool {
+		return zslLexValueLteMax(x.ele.StrVal(), spec)
+	})
+}
+
+// ZslDeleteRangeByRank delete the nodes with rank in [start, end], the
+// ranks start at 1.
+func (zsl *ZSkiplist) ZslDeleteRangeByRank(start, end int64, dict *Dict) int64 {
+	update := make([]*ZSkiplistNode, ZSKIPLIST_MAXLEVEL)
+	var traversed int64
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span < start {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	traversed++
+	return zsl.zslDeleteWhile(x.level[0].forward, update, dict, func(x *ZSkiplistNode) bool {
+		if traversed > end {
+			return false
+		}
+		traversed++
+		return true
+	})
+}
+
+// ZslGetRank return the rank of the element starting at 1, or 0 if it is
+// not found.
+func (zsl *ZSkiplist) ZslGetRank(score float64, ele *RedisObj) int64 {
+	str := ele.StrVal()
+	var rank int64
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(x.level[i].forward.score == score && x.level[i].forward.ele.StrVal() <= str)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		// x might be the header, whose ele is nil.
+		if x.ele != nil && x.ele.StrVal() == str {
+			return rank
+		}
+	}
+	return 0
+}
+
+// ZslGetElementByRank return the node at rank starting at 1, or nil.
+func (zsl *ZSkiplist) ZslGetElementByRank(rank int64) *ZSkiplistNode {
+	var traversed int64
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
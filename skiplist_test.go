@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// zslElements return the elements of zsl from the lowest score.
+func zslElements(zsl *ZSkiplist) []string {
+	var elements []string
+	for x := zsl.ZslFirst(); x != nil; x = x.level[0].forward {
+		elements = append(elements, x.ele.StrVal())
+	}
+	return elements
+}
+
+func TestZslInsertDelete(t *testing.T) {
+	zsl := ZslCreate()
+	assert.Nil(t, zsl.ZslFirst())
+	zsl.ZslInsert(2, CreateObject(REDISSTR, "b"))
+	zsl.ZslInsert(1, CreateObject(REDISSTR, "c"))
+	zsl.ZslInsert(2, CreateObject(REDISSTR, "a"))
+	zsl.ZslInsert(3, CreateObject(REDISSTR, "d"))
+	assert.Equal(t, int64(4), zsl.ZslLength())
+	assert.Equal(t, []string{"c", "a", "b", "d"}, zslElements(zsl))
+	assert.Equal(t, "d", zsl.ZslLast().ele.StrVal())
+	assert.Equal(t, "b", zsl.ZslLast().backward.ele.StrVal())
+
+	assert.Equal(t, int64(3), zsl.ZslGetRank(2, CreateObject(REDISSTR, "b")))
+	assert.Equal(t, int64(0), zsl.ZslGetRank(1, CreateObject(REDISSTR, "b")))
+	assert.Equal(t, "a", zsl.ZslGetElementByRank(2).ele.StrVal())
+	assert.Nil(t, zsl.ZslGetElementByRank(5))
+
+	assert.False(t, zsl.ZslDelete(3, CreateObject(REDISSTR, "a")))
+	assert.True(t, zsl.ZslDelete(2, CreateObject(REDISSTR, "a")))
+	assert.Equal(t, []string{"c", "b", "d"}, zslElements(zsl))
+
+	x := zsl.ZslUpdateScore(1, CreateObject(REDISSTR, "c"), 5)
+	assert.Equal(t, 5.0, x.score)
+	assert.Equal(t, []string{"b", "d", "c"}, zslElements(zsl))
+	zsl.ZslUpdateScore(5, CreateObject(REDISSTR, "c"), 4)
+	assert.Equal(t, []string{"b", "d", "c"}, zslElements(zsl))
+	assert.Equal(t, int64(3), zsl.ZslGetRank(4, CreateObject(REDISSTR, "c")))
+}
+
+func TestZslRange(t *testing.T) {
+	zsl := ZslCreate()
+	for i, ele := range []string{"a", "b", "c", "d", "e"} {
+		zsl.ZslInsert(float64(i), CreateObject(REDISSTR, ele))
+	}
+	spec := &ZRangeSpec{min: 1, max: 3, maxex: true}
+	assert.Equal(t, "b", zsl.ZslFirstInRange(spec).ele.StrVal())
+	assert.Equal(t, "c", zsl.ZslLastInRange(spec).ele.StrVal())
+	assert.Nil(t, zsl.ZslFirstInRange(&ZRangeSpec{min: 5, max: 10}))
+	assert.Nil(t, zsl.ZslFirstInRange(&ZRangeSpec{min: 2, max: 2, minex: true}))
+
+	lexspec := &ZLexRangeSpec{min: "b", minex: true, maxInf: 1}
+	assert.Equal(t, "c", zsl.ZslFirstInLexRange(lexspec).ele.StrVal())
+	assert.Equal(t, "e", zsl.ZslLastInLexRange(lexspec).ele.StrVal())
+	assert.Nil(t, zsl.ZslFirstInLexRange(&ZLexRangeSpec{min: "f", maxInf: 1}))
+}
+
+func TestZslDeleteRange(t *testing.T) {
+	dict := DictCreate(DictFunc{HashFunc: RedisStrHash, EqualFunc: RedisStrEqual})
+	zsl := ZslCreate()
+	for i, ele := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		o := CreateObject(REDISSTR, ele)
+		zsl.ZslInsert(float64(i), o)
+		dict.DictAdd(o, nil)
+	}
+	assert.Equal(t, int64(2), zsl.ZslDeleteRangeByScore(&ZRangeSpec{min: 0, max: 2, minex: true}, dict))
+	assert.Equal(t, []string{"a", "d", "e", "f", "g"}, zslElements(zsl))
+	assert.Equal(t, int64(2), zsl.ZslDeleteRangeByLex(&ZLexRangeSpec{min: "e", max: "f"}, dict))
+	assert.Equal(t, []string{"a", "d", "g"}, zslElements(zsl))
+	assert.Equal(t, int64(2), zsl.ZslDeleteRangeByRank(2, 5, dict))
+	assert.Equal(t, []string{"a"}, zslElements(zsl))
+	assert.Equal(t, int64(1), dict.DictSize())
+	assert.Equal(t, int64(1), zsl.ZslLength())
+}
@@ -0,0 +1,751 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// A stream is a rax of listpacks, the key of every node is the big endian
+// ID of its first entry, the master ID. Every listpack starts with a master
+// entry:
+//
+//	count | deleted | num-fields | field_1 | ... | field_N | 0
+//
+// count and deleted are the number of valid and deleted entries of the
+// node, and the fields are the fields of the first entry. Then every entry
+// is stored as:
+//
+//	flags | ms-diff | seq-diff | num-fields | field_1 | value_1 | ... | lp-count
+//
+// or, when the entry has the same fields of the master entry:
+//
+//	flags | ms-diff | seq-diff | value_1 | ... | value_N | lp-count
+//
+// The ID of an entry is the master ID plus the diffs, and lp-count is the
+// number of elements of the entry before it, so the listpack can be walked
+// backward. A deleted entry is only flagged, the node is freed when all its
+// entries are deleted.
+
+// flags of the entries.
+const (
+	STREAM_ITEM_FLAG_NONE       int64 = 0
+	STREAM_ITEM_FLAG_DELETED    int64 = 1 << 0
+	STREAM_ITEM_FLAG_SAMEFIELDS int64 = 1 << 1
+)
+
+const (
+	// STREAM_LISTPACK_MAX_SIZE is the max size of a node, whatever
+	// stream-node-max-bytes is.
+	STREAM_LISTPACK_MAX_SIZE int = 1 << 30
+	// SCG_INVALID_ENTRIES_READ is the entries read counter of a consumer
+	// group whose position in the stream is unknown.
+	SCG_INVALID_ENTRIES_READ int64 = -1
+)
+
+// trim strategies of XADD and XTRIM.
+const (
+	TRIM_STRATEGY_NONE   int = 0
+	TRIM_STRATEGY_MAXLEN int = 1
+	TRIM_STRATEGY_MINID  int = 2
+)
+
+type streamID struct {
+	ms  uint64 // unix time in ms
+	seq uint64 // sequence number in the same ms
+}
+
+var streamMaxID = streamID{ms: math.MaxUint64, seq: math.MaxUint64}
+
+type stream struct {
+	rax               *Rax     // master ID -> *Listpack
+	length            uint64   // number of valid entries
+	lastID            streamID // ID of the last entry ever added
+	firstID           streamID // ID of the first valid entry, 0-0 if empty
+	maxDeletedEntryID streamID // greatest ID deleted by XDEL
+	entriesAdded      uint64   // number of entries ever added
+	cgroups           *Rax     // group name -> *streamCG, nil if none
+}
+
+// streamCG is a consumer group. Every entry delivered to a consumer and not
+// acknowledged yet is pending in both the group and the consumer PEL.
+type streamCG struct {
+	lastID streamID // ID of the last entry delivered
+	// the number of entries added before lastID included, or
+	// SCG_INVALID_ENTRIES_READ if unknown.
+	entriesRead int64
+	pel         *Rax // encoded ID -> *streamNACK
+	consumers   *Rax // name -> *streamConsumer
+}
+
+type streamConsumer struct {
+	name       string
+	seenTime   int64 // unix time in ms of the last command of the consumer
+	activeTime int64 // unix time in ms of the last delivery, -1 if never
+	pel        *Rax  // encoded ID -> *streamNACK, shared with the group
+}
+
+// streamNACK is a delivered entry not acknowledged yet.
+type streamNACK struct {
+	deliveryTime  int64 // unix time in ms of the last delivery
+	deliveryCount uint64
+	consumer      *streamConsumer
+}
+
+// streamAddTrimArgs are the options of XADD and XTRIM.
+type streamAddTrimArgs struct {
+	id           streamID // the ID of XADD if idGiven
+	idGiven      bool
+	seqGiven     bool // false for "ms-*"
+	noMkStream   bool
+	trimStrategy int
+	approxTrim   bool  // trim whole nodes only
+	limit        int64 // max number of trimmed entries, 0 for no limit
+	maxlen       int64
+	minid        streamID
+}
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+// streamCompareID return -1, 0 or 1 if a is smaller, equal or greater than b.
+func streamCompareID(a, b streamID) int {
+	if a.ms > b.ms {
+		return 1
+	} else if a.ms < b.ms {
+		return -1
+	} else if a.seq > b.seq {
+		return 1
+	} else if a.seq < b.seq {
+		return -1
+	}
+	return 0
+}
+
+// streamEncodeID return id as a big endian 128 bit key, so the keys of a rax
+// are sorted as the IDs.
+func streamEncodeID(id streamID) string {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], id.ms)
+	binary.BigEndian.PutUint64(buf[8:], id.seq)
+	return string(buf[:])
+}
+
+func streamDecodeID(key string) streamID {
+	return streamID{
+		ms:  binary.BigEndian.Uint64([]byte(key[:8])),
+		seq: binary.BigEndian.Uint64([]byte(key[8:])),
+	}
+}
+
+// streamIncrID return the ID following id, false if id is the greatest ID.
+func streamIncrID(id streamID) (streamID, bool) {
+	if id.seq == math.MaxUint64 {
+		if id.ms == math.MaxUint64 {
+			return id, false
+		}
+		return streamID{ms: id.ms + 1}, true
+	}
+	return streamID{ms: id.ms, seq: id.seq + 1}, true
+}
+
+// streamDecrID return the ID preceding id, false if id is 0-0.
+func streamDecrID(id streamID) (streamID, bool) {
+	if id.seq == 0 {
+		if id.ms == 0 {
+			return id, false
+		}
+		return streamID{ms: id.ms - 1, seq: math.MaxUint64}, true
+	}
+	return streamID{ms: id.ms, seq: id.seq - 1}, true
+}
+
+// streamNextID return the ID generated for a new entry after lastID, from
+// the current time unless the clock went backward.
+func streamNextID(lastID streamID) streamID {
+	ms := uint64(GetMsTime())
+	if ms > lastID.ms {
+		return streamID{ms: ms}
+	}
+	id, _ := streamIncrID(lastID)
+	return id
+}
+
+func streamNew() *stream {
+	return &stream{rax: RaxNew()}
+}
+
+// lpGetInteger return the integer element at p of a stream listpack.
+func lpGetInteger(lp *Listpack, p int) int64 {
+	sval, ival, isInt := lp.LpGet(p)
+	if isInt {
+		return ival
+	}
+	ival, _ = strconv.ParseInt(sval, 10, 64)
+	return ival
+}
+
+func lpAppendInteger(lp *Listpack, val int64) {
+	lp.LpAppend(strconv.FormatInt(val, 10))
+}
+
+func lpReplaceInteger(lp *Listpack, p int, val int64) int {
+	return lp.LpReplace(p, strconv.FormatInt(val, 10))
+}
+
+// streamAppendItem add an entry with the field value pairs of argv. The ID
+// is generated unless useID is given, and its sequence is generated unless
+// seqGiven. Return false if the ID is not greater than the last ID.
+func streamAppendItem(s *stream, argv []*RedisObj, useID *streamID, seqGiven bool) (streamID, bool) {
+	var id streamID
+	if useID == nil {
+		id = streamNextID(s.lastID)
+	} else if seqGiven {
+		id = *useID
+	} else if useID.ms == s.lastID.ms {
+		if s.lastID.seq == math.MaxUint64 {
+			return id, false
+		}
+		id = streamID{ms: useID.ms, seq: s.lastID.seq + 1}
+	} else {
+		id = streamID{ms: useID.ms}
+	}
+	if streamCompareID(id, s.lastID) <= 0 {
+		return id, false
+	}
+
+	numFields := len(argv) / 2
+	totelelen := 0
+	for _, arg := range argv {
+		totelelen += len(arg.StrVal())
+	}
+	// add the entry to the last node, unless it's full.
+	var lp *Listpack
+	var masterID streamID
+	ri := RaxStart(s.rax)
+	if ri.RaxSeek("$", "") {
+		lp = ri.data.(*Listpack)
+		maxBytes := server.streamNodeMaxBytes
+		if maxBytes <= 0 || maxBytes > STREAM_LISTPACK_MAX_SIZE {
+			maxBytes = STREAM_LISTPACK_MAX_SIZE
+		}
+		if lp.LpBytes()+totelelen >= maxBytes {
+			lp = nil
+		} else if server.streamNodeMaxEntries > 0 {
+			p := lp.LpFirst()
+			count := lpGetInteger(lp, p) + lpGetInteger(lp, lp.LpNext(p))
+			if count >= int64(server.streamNodeMaxEntries) {
+				lp = nil
+			}
+		}
+	}
+	if lp == nil {
+		masterID = id
+		lp = LpNew()
+		lpAppendInteger(lp, 1)
+		lpAppendInteger(lp, 0)
+		lpAppendInteger(lp, int64(numFields))
+		for i := 0; i < numFields; i++ {
+			lp.LpAppend(argv[i*2].StrVal())
+		}
+		lpAppendInteger(lp, 0)
+		s.rax.RaxInsert(streamEncodeID(id), lp)
+	} else {
+		masterID = streamDecodeID(ri.key)
+		p := lp.LpFirst()
+		lpReplaceInteger(lp, p, lpGetInteger(lp, p)+1)
+	}
+
+	// check whether the fields are the ones of the master entry.
+	flags := STREAM_ITEM_FLAG_NONE
+	p := lp.LpNext(lp.LpNext(lp.LpFirst()))
+	if lpGetInteger(lp, p) == int64(numFields) {
+		flags |= STREAM_ITEM_FLAG_SAMEFIELDS
+		for i := 0; i < numFields; i++ {
+			p = lp.LpNext(p)
+			if !lp.lpCompare(p, argv[i*2].StrVal()) {
+				flags = STREAM_ITEM_FLAG_NONE
+				break
+			}
+		}
+	}
+	sameFields := flags&STREAM_ITEM_FLAG_SAMEFIELDS != 0
+
+	lpAppendInteger(lp, flags)
+	lpAppendInteger(lp, int64(id.ms-masterID.ms))
+	lpAppendInteger(lp, int64(id.seq-masterID.seq))
+	if !sameFields {
+		lpAppendInteger(lp, int64(numFields))
+	}
+	for i := 0; i < numFields; i++ {
+		if !sameFields {
+			lp.LpAppend(argv[i*2].StrVal())
+		}
+		lp.LpAppend(argv[i*2+1].StrVal())
+	}
+	lpCount := numFields + 3
+	if !sameFields {
+		lpCount += numFields + 1
+	}
+	lpAppendInteger(lp, int64(lpCount))
+
+	s.length++
+	s.entriesAdded++
+	s.lastID = id
+	if s.length == 1 {
+		s.firstID = id
+	}
+	return id, true
+}
+
+// streamIterator walks the entries of a stream from start to end, forward
+// or backward.
+type streamIterator struct {
+	s              *stream
+	ri             *raxIterator
+	start, end     streamID
+	rev            bool
+	skipTombstones bool // skip the deleted entries
+	// the current node, nil when the next one must be loaded.
+	lp           *Listpack
+	masterID     streamID
+	masterFields []string
+	masterEnd    int // offset of the terminator of the master entry
+	// forward the last element of the current entry, backward the lp-count
+	// of the next entry.
+	lpEle   int
+	lpFlags int // offset of the flags of the current entry
+}
+
+// lpGetEdgeStreamID return the ID of the first or the last entry of the
+// node lp, deleted or not.
+func lpGetEdgeStreamID(lp *Listpack, first bool, masterID streamID) streamID {
+	var p int
+	if first {
+		p = lp.LpNext(lp.LpNext(lp.LpFirst()))
+		for i := lpGetInteger(lp, p); i >= 0; i-- {
+			p = lp.LpNext(p)
+		}
+		p = lp.LpNext(p)
+	} else {
+		p = lp.LpLast()
+		for i := lpGetInteger(lp, p); i > 0; i-- {
+			p = lp.LpPrev(p)
+		}
+	}
+	id := masterID
+	p = lp.LpNext(p)
+	id.ms += uint64(lpGetInteger(lp, p))
+	id.seq += uint64(lpGetInteger(lp, lp.LpNext(p)))
+	return id
+}
+
+// streamIteratorStart return an iterator on the entries from start to end
+// included, nil start and end are the first and the last entries.
+func streamIteratorStart(s *stream, start, end *streamID, rev bool) *streamIterator {
+	si := &streamIterator{s: s, ri: RaxStart(s.rax), end: streamMaxID, rev: rev, skipTombstones: true}
+	if start != nil {
+		si.start = *start
+	}
+	if end != nil {
+		si.end = *end
+	}
+	// seek the node holding the first entry to return.
+	seekID := si.start
+	edge := "^"
+	if rev {
+		seekID = si.end
+		edge = "$"
+	}
+	if seekID == (streamID{}) || !si.ri.RaxSeek("<=", streamEncodeID(seekID)) {
+		si.ri.RaxSeek(edge, "")
+	}
+	return si
+}
+
+// streamIteratorGetID move to the next entry in the range, and return its
+// ID, fields and values. Return false when there are no more entries.
+func (si *streamIterator) streamIteratorGetID() (streamID, []string, []string, bool) {
+	for {
+		if si.lp == nil {
+			if (!si.rev && !si.ri.RaxNext()) || (si.rev && !si.ri.RaxPrev()) {
+				return streamID{}, nil, nil, false
+			}
+			si.lp = si.ri.data.(*Listpack)
+			si.masterID = streamDecodeID(si.ri.key)
+			p := si.lp.LpNext(si.lp.LpNext(si.lp.LpFirst()))
+			si.masterFields = make([]string, lpGetInteger(si.lp, p))
+			for i := range si.masterFields {
+				p = si.lp.LpNext(p)
+				si.masterFields[i] = si.lp.LpGetString(p)
+			}
+			si.masterEnd = si.lp.LpNext(p)
+			if si.rev {
+				si.lpEle = si.lp.LpLast()
+			} else {
+				si.lpEle = si.masterEnd
+			}
+		}
+
+		lp := si.lp
+		if !si.rev {
+			si.lpFlags = lp.LpNext(si.lpEle)
+			if si.lpFlags == -1 {
+				si.lp = nil
+				continue
+			}
+		} else {
+			if si.lpEle == si.masterEnd {
+				si.lp = nil
+				continue
+			}
+			si.lpFlags = si.lpEle
+			for i := lpGetInteger(lp, si.lpEle); i > 0; i-- {
+				si.lpFlags = lp.LpPrev(si.lpFlags)
+			}
+			si.lpEle = lp.LpPrev(si.lpFlags)
+		}
+
+		flags := lpGetInteger(lp, si.lpFlags)
+		p := lp.LpNext(si.lpFlags)
+		id := si.masterID
+		id.ms += uint64(lpGetInteger(lp, p))
+		p = lp.LpNext(p)
+		id.seq += uint64(lpGetInteger(lp, p))
+		sameFields := flags&STREAM_ITEM_FLAG_SAMEFIELDS != 0
+		numFields := len(si.masterFields)
+		if !sameFields {
+			p = lp.LpNext(p)
+			numFields = int(lpGetInteger(lp, p))
+		}
+		fields, values := make([]string, numFields), make([]string, numFields)
+		for i := 0; i < numFields; i++ {
+			if sameFields {
+				fields[i] = si.masterFields[i]
+			} else {
+				p = lp.LpNext(p)
+				fields[i] = lp.LpGetString(p)
+			}
+			p = lp.LpNext(p)
+			values[i] = lp.LpGetString(p)
+		}
+		if !si.rev {
+			si.lpEle = lp.LpNext(p)
+		}
+
+		if flags&STREAM_ITEM_FLAG_DELETED != 0 && si.skipTombstones {
+			continue
+		}
+		if !si.rev {
+			if streamCompareID(id, si.end) > 0 {
+				return streamID{}, nil, nil, false
+			}
+			if streamCompareID(id, si.start) >= 0 {
+				return id, fields, values, true
+			}
+		} else {
+			if streamCompareID(id, si.start) < 0 {
+				return streamID{}, nil, nil, false
+			}
+			if streamCompareID(id, si.end) <= 0 {
+				return id, fields, values, true
+			}
+		}
+	}
+}
+
+// streamIteratorRemoveEntry delete the entry with id last returned by the
+// iterator, the iterator is restarted from it.
+func (si *streamIterator) streamIteratorRemoveEntry(id streamID) {
+	lp := si.lp
+	lpReplaceInteger(lp, si.lpFlags, lpGetInteger(lp, si.lpFlags)|STREAM_ITEM_FLAG_DELETED)
+	p := lp.LpFirst()
+	count := lpGetInteger(lp, p)
+	if count == 1 {
+		si.s.rax.RaxRemove(si.ri.key)
+	} else {
+		p = lpReplaceInteger(lp, p, count-1)
+		p = lp.LpNext(p)
+		lpReplaceInteger(lp, p, lpGetInteger(lp, p)+1)
+	}
+	si.s.length--
+
+	start, end := si.start, si.end
+	if si.rev {
+		end = id
+	} else {
+		start = id
+	}
+	skipTombstones := si.skipTombstones
+	*si = *streamIteratorStart(si.s, &start, &end, si.rev)
+	si.skipTombstones = skipTombstones
+}
+
+// streamGetEdgeID return the ID of the first or the last entry, false if
+// there is none.
+func streamGetEdgeID(s *stream, first, skipTombstones bool) (streamID, bool) {
+	si := streamIteratorStart(s, nil, nil, !first)
+	si.skipTombstones = skipTombstones
+	id, _, _, found := si.streamIteratorGetID()
+	return id, found
+}
+
+// streamLastValidID return the ID of the last entry not deleted, 0-0 if
+// the stream is empty.
+func streamLastValidID(s *stream) streamID {
+	id, _ := streamGetEdgeID(s, false, true)
+	return id
+}
+
+// streamDeleteItem delete the entry with id, return false if not found.
+func streamDeleteItem(s *stream, id streamID) bool {
+	si := streamIteratorStart(s, &id, &id, false)
+	myid, _, _, found := si.streamIteratorGetID()
+	if found {
+		si.streamIteratorRemoveEntry(myid)
+	}
+	return found
+}
+
+// streamUpdateFirstID set the first ID after entries were deleted.
+func streamUpdateFirstID(s *stream) {
+	if s.length == 0 {
+		s.firstID = streamID{}
+		return
+	}
+	s.firstID, _ = streamGetEdgeID(s, true, true)
+}
+
+// streamTrim delete the entries from the start of the stream until it has
+// at most maxlen entries, or until the first entry is not smaller than
+// minid. An approximated trim deletes only whole nodes. Return the number
+// of deleted entries.
+func streamTrim(s *stream, args *streamAddTrimArgs) int64 {
+	if args.trimStrategy == TRIM_STRATEGY_NONE {
+		return 0
+	}
+	var deleted int64
+	ri := RaxStart(s.rax)
+	ri.RaxSeek("^", "")
+	for ri.RaxNext() {
+		if args.trimStrategy == TRIM_STRATEGY_MAXLEN && s.length <= uint64(args.maxlen) {
+			break
+		}
+		lp := ri.data.(*Listpack)
+		p := lp.LpFirst()
+		entries := lpGetInteger(lp, p)
+		if args.limit > 0 && deleted+entries > args.limit {
+			break
+		}
+
+		// remove the whole node if possible.
+		masterID := streamDecodeID(ri.key)
+		var removeNode bool
+		if args.trimStrategy == TRIM_STRATEGY_MAXLEN {
+			removeNode = s.length-uint64(entries) >= uint64(args.maxlen)
+		} else {
+			removeNode = streamCompareID(lpGetEdgeStreamID(lp, false, masterID), args.minid) < 0
+		}
+		if removeNode {
+			s.rax.RaxRemove(ri.key)
+			s.length -= uint64(entries)
+			deleted += entries
+			continue
+		}
+		if args.approxTrim {
+			break
+		}
+
+		// flag the entries of the node as deleted, starting from the first.
+		p = lp.LpNext(lp.LpNext(p))
+		masterFields := lpGetInteger(lp, p)
+		for i := int64(0); i <= masterFields; i++ {
+			p = lp.LpNext(p)
+		}
+		var deletedFromLp int64
+		for p = lp.LpNext(p); p != -1; p = lp.LpNext(p) {
+			flagsP := p
+			flags := lpGetInteger(lp, p)
+			p = lp.LpNext(p)
+			id := masterID
+			id.ms += uint64(lpGetInteger(lp, p))
+			p = lp.LpNext(p)
+			id.seq += uint64(lpGetInteger(lp, p))
+			if args.trimStrategy == TRIM_STRATEGY_MAXLEN {
+				if s.length <= uint64(args.maxlen) {
+					break
+				}
+			} else if streamCompareID(id, args.minid) >= 0 {
+				break
+			}
+			toSkip := masterFields
+			if flags&STREAM_ITEM_FLAG_SAMEFIELDS == 0 {
+				p = lp.LpNext(p)
+				toSkip = lpGetInteger(lp, p) * 2
+			}
+			for ; toSkip > 0; toSkip-- {
+				p = lp.LpNext(p)
+			}
+			// move to lp-count.
+			p = lp.LpNext(p)
+			if flags&STREAM_ITEM_FLAG_DELETED == 0 {
+				// the flags keep their size, so p is still valid.
+				lpReplaceInteger(lp, flagsP, flags|STREAM_ITEM_FLAG_DELETED)
+				deletedFromLp++
+				s.length--
+			}
+		}
+		deleted += deletedFromLp
+		p = lp.LpFirst()
+		p = lpReplaceInteger(lp, p, entries-deletedFromLp)
+		p = lp.LpNext(p)
+		lpReplaceInteger(lp, p, lpGetInteger(lp, p)+deletedFromLp)
+		break
+	}
+	streamUpdateFirstID(s)
+	return deleted
+}
+
+// streamRangeHasTombstones report whether entries between start and end
+// may have been deleted by XDEL, nil start and end are the first and the
+// last entries.
+func streamRangeHasTombstones(s *stream, start, end *streamID) bool {
+	if s.length == 0 || s.maxDeletedEntryID == (streamID{}) {
+		return false
+	}
+	startID, endID := streamID{}, streamMaxID
+	if start != nil {
+		startID = *start
+	}
+	if end != nil {
+		endID = *end
+	}
+	return streamCompareID(startID, s.maxDeletedEntryID) <= 0 &&
+		streamCompareID(endID, s.maxDeletedEntryID) >= 0
+}
+
+// streamEstimateDistanceFromFirstEverEntry return the number of entries
+// added up to id included, or SCG_INVALID_ENTRIES_READ if it can't be known
+// because of deleted entries.
+func streamEstimateDistanceFromFirstEverEntry(s *stream, id streamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	cmpLast := streamCompareID(id, s.lastID)
+	if s.length == 0 && cmpLast < 1 {
+		return int64(s.entriesAdded)
+	}
+	if cmpLast == 0 {
+		return int64(s.entriesAdded)
+	} else if cmpLast > 0 {
+		return 0
+	}
+	// with no deletions in the middle, the entries before the first one
+	// were all trimmed.
+	cmpFirst := streamCompareID(id, s.firstID)
+	if s.maxDeletedEntryID == (streamID{}) || streamCompareID(s.maxDeletedEntryID, s.firstID) < 0 {
+		if cmpFirst < 0 {
+			return int64(s.entriesAdded - s.length)
+		} else if cmpFirst == 0 {
+			return int64(s.entriesAdded - s.length + 1)
+		}
+	}
+	return SCG_INVALID_ENTRIES_READ
+}
+
+// streamCreateCG create the consumer group name delivering the entries
+// after id, return nil if it already exists.
+func streamCreateCG(s *stream, name string, id streamID, entriesRead int64) *streamCG {
+	if s.cgroups == nil {
+		s.cgroups = RaxNew()
+	}
+	cg := &streamCG{lastID: id, entriesRead: entriesRead, pel: RaxNew(), consumers: RaxNew()}
+	if !s.cgroups.RaxTryInsert(name, cg) {
+		return nil
+	}
+	return cg
+}
+
+// streamLookupCG return the consumer group name, nil if not found.
+func streamLookupCG(s *stream, name string) *streamCG {
+	if s.cgroups == nil {
+		return nil
+	}
+	cg, ok := s.cgroups.RaxFind(name)
+	if !ok {
+		return nil
+	}
+	return cg.(*streamCG)
+}
+
+// streamCreateConsumer create the consumer name of cg, return nil if it
+// already exists.
+func streamCreateConsumer(cg *streamCG, name string) *streamConsumer {
+	consumer := &streamConsumer{name: name, seenTime: GetMsTime(), activeTime: -1, pel: RaxNew()}
+	if !cg.consumers.RaxTryInsert(name, consumer) {
+		return nil
+	}
+	return consumer
+}
+
+// streamLookupConsumer return the consumer name of cg, nil if not found.
+func streamLookupConsumer(cg *streamCG, name string) *streamConsumer {
+	consumer, ok := cg.consumers.RaxFind(name)
+	if !ok {
+		return nil
+	}
+	return consumer.(*streamConsumer)
+}
+
+// streamDelConsumer delete the consumer and its pending entries from cg.
+func streamDelConsumer(cg *streamCG, consumer *streamConsumer) {
+	ri := RaxStart(consumer.pel)
+	ri.RaxSeek("^", "")
+	for ri.RaxNext() {
+		cg.pel.RaxRemove(ri.key)
+	}
+	cg.consumers.RaxRemove(consumer.name)
+}
+
+// streamDup return a deep copy of s, consumer groups included.
+func streamDup(s *stream) *stream {
+	d := &stream{
+		rax:               RaxNew(),
+		length:            s.length,
+		lastID:            s.lastID,
+		firstID:           s.firstID,
+		maxDeletedEntryID: s.maxDeletedEntryID,
+		entriesAdded:      s.entriesAdded,
+	}
+	ri := RaxStart(s.rax)
+	ri.RaxSeek("^", "")
+	for ri.RaxNext() {
+		d.rax.RaxInsert(ri.key, ri.data.(*Listpack).LpDup())
+	}
+	if s.cgroups == nil {
+		return d
+	}
+	gi := RaxStart(s.cgroups)
+	gi.RaxSeek("^", "")
+	for gi.RaxNext() {
+		cg := gi.data.(*streamCG)
+		dcg := streamCreateCG(d, gi.key, cg.lastID, cg.entriesRead)
+		ci := RaxStart(cg.consumers)
+		ci.RaxSeek("^", "")
+		for ci.RaxNext() {
+			consumer := ci.data.(*streamConsumer)
+			dconsumer := streamCreateConsumer(dcg, consumer.name)
+			dconsumer.seenTime, dconsumer.activeTime = consumer.seenTime, consumer.activeTime
+			pi := RaxStart(consumer.pel)
+			pi.RaxSeek("^", "")
+			for pi.RaxNext() {
+				nack := *pi.data.(*streamNACK)
+				nack.consumer = dconsumer
+				dconsumer.pel.RaxInsert(pi.key, &nack)
+				dcg.pel.RaxInsert(pi.key, &nack)
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestStreamID(t *testing.T) {
+	a, b := streamID{ms: 1, seq: 2}, streamID{ms: 2, seq: 0}
+	assert.Equal(t, -1, streamCompareID(a, b))
+	assert.Equal(t, 0, streamCompareID(a, a))
+	assert.Equal(t, a, streamDecodeID(streamEncodeID(a)))
+	// the encoded IDs sort like the IDs.
+	assert.True(t, streamEncodeID(a) < streamEncodeID(b))
+	assert.Equal(t, "1-2", a.String())
+
+	id, ok := streamIncrID(streamID{ms: 1, seq: streamMaxID.seq})
+	assert.True(t, ok)
+	assert.Equal(t, streamID{ms: 2}, id)
+	_, ok = streamIncrID(streamMaxID)
+	assert.False(t, ok)
+	id, ok = streamDecrID(b)
+	assert.True(t, ok)
+	assert.Equal(t, streamID{ms: 1, seq: streamMaxID.seq}, id)
+	_, ok = streamDecrID(streamID{})
+	assert.False(t, ok)
+}
+
+func TestStreamIterator(t *testing.T) {
+	s := streamNew()
+	for i := 1; i <= 300; i++ {
+		// every other entry has the fields of the master entry.
+		argv := []*RedisObj{CreateObject(REDISSTR, "f"), CreateObject(REDISSTR, strconv.Itoa(i))}
+		if i%2 == 0 {
+			argv = append(argv, CreateObject(REDISSTR, "g"), CreateObject(REDISSTR, "x"))
+		}
+		_, ok := streamAppendItem(s, argv, &streamID{ms: uint64(i)}, true)
+		assert.True(t, ok)
+	}
+	_, ok := streamAppendItem(s, []*RedisObj{CreateObject(REDISSTR, "f"), CreateObject(REDISSTR, "v")}, &streamID{ms: 300}, true)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(300), s.length)
+
+	start, end := streamID{ms: 99}, streamID{ms: 102}
+	si := streamIteratorStart(s, &start, &end, true)
+	var got []uint64
+	for {
+		id, fields, values, ok := si.streamIteratorGetID()
+		if !ok {
+			break
+		}
+		assert.Equal(t, strconv.FormatUint(id.ms, 10), values[0])
+		assert.Equal(t, 1+int(id.ms+1)%2, len(fields))
+		got = append(got, id.ms)
+	}
+	assert.Equal(t, []uint64{102, 101, 100, 99}, got)
+
+	// the deleted entries are skipped, and the edges are updated.
+	assert.True(t, streamDeleteItem(s, streamID{ms: 1}))
+	assert.False(t, streamDeleteItem(s, streamID{ms: 1}))
+	streamUpdateFirstID(s)
+	assert.Equal(t, streamID{ms: 2}, s.firstID)
+	id, ok := streamGetEdgeID(s, true, true)
+	assert.True(t, ok)
+	assert.Equal(t, streamID{ms: 2}, id)
+
+	// the copy doesn't share the nodes.
+	d := streamDup(s)
+	streamDeleteItem(d, streamID{ms: 2})
+	assert.Equal(t, uint64(299), s.length)
+	assert.Equal(t, uint64(298), d.length)
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// what of hashTypeCurrentObject.
+const (
+	OBJ_HASH_KEY   int = 1
+	OBJ_HASH_VALUE int = 2
+)
+
+// hashTypeLookupWriteOrCreate return the hash at key, creating it if it
+// doesn't exist, or reply WRONGTYPE and return nil if key is not a hash.
+func hashTypeLookupWriteOrCreate(c *RedisClient, key *RedisObj) *RedisObj {
+	o := lookupKeyWrite(c.db, key)
+	if o != nil {
+		if checkType(c, o, REDISDICT) {
+			return nil
+		}
+		return o
+	}
+	o = createHashObject()
+	dbAdd(c.db, key, o)
+	o.DecrRefCount()
+	return o
+}
+
+// hashTypeConvert convert a listpack encoded hash to a dict.
+func hashTypeConvert(o *RedisObj) {
+	if o.encoding != REDIS_ENCODING_LISTPACK {
+		panic("unknown hash encoding")
+	}
+	lp := o.Val_.(*Listpack)
+	d := DictCreate(DictFunc{
+		HashFunc:  RedisStrHash,
+		EqualFunc: RedisStrEqual,
+	})
+	for p := lp.LpFirst(); p != -1; p = lp.LpNext(p) {
+		field := lp.LpGetObject(p)
+		p = lp.LpNext(p)
+		value := lp.LpGetObject(p)
+		d.DictAdd(field, value)
+		field.DecrRefCount()
+		value.DecrRefCount()
+	}
+	o.Val_ = d
+	o.encoding = REDIS_ENCODING_HT
+}
+
+func hashTypeLength(o *RedisObj) int64 {
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		return int64(o.Val_.(*Listpack).LpLength() / 2)
+	case REDIS_ENCODING_HT:
+		return o.Val_.(*Dict).DictSize()
+	}
+	panic("unknown hash encoding")
+}
+
+// hashTypeListpackFind return the offset of the value of field in a
+// listpack encoded hash, -1 if field doesn't exist.
+func hashTypeListpackFind(lp *Listpack, field *RedisObj) int {
+	fptr := lp.LpFirst()
+	if fptr != -1 {
+		fptr = lp.LpFind(fptr, field.StrVal(), 1)
+	}
+	if fptr == -1 {
+		return -1
+	}
+	return lp.LpNext(fptr)
+}
+
+// hashTypeGetValue return the value of field, or nil if field doesn't exist.
+func hashTypeGetValue(o *RedisObj, field *RedisObj) *RedisObj {
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		lp := o.Val_.(*Listpack)
+		if vptr := hashTypeListpackFind(lp, field); vptr != -1 {
+			return lp.LpGetObject(vptr)
+		}
+		return nil
+	case REDIS_ENCODING_HT:
+		return o.Val_.(*Dict).DictGet(field)
+	}
+	panic("unknown hash encoding")
+}
+
+func hashTypeExists(o *RedisObj, field *RedisObj) bool {
+	return hashTypeGetValue(o, field) != nil
+}
+
+// hashTypeSet add or update field, return true if field is updated. A
+// listpack encoded hash is converted to a dict when it exceeds the
+// hash-max-listpack limits.
+func hashTypeSet(o *RedisObj, field, value *RedisObj) bool {
+	if o.encoding == REDIS_ENCODING_LISTPACK {
+		if len(field.StrVal()) > server.hashMaxListpackValue || len(value.StrVal()) > server.hashMaxListpackValue {
+			hashTypeConvert(o)
+		}
+	}
+
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		lp := o.Val_.(*Listpack)
+		if vptr := hashTypeListpackFind(lp, field); vptr != -1 {
+			lp.LpReplace(vptr, value.StrVal())
+			return true
+		}
+		lp.LpAppend(field.StrVal())
+		lp.LpAppend(value.StrVal())
+		if hashTypeLength(o) > int64(server.hashMaxListpackEntries) {
+			hashTypeConvert(o)
+		}
+		return false
+	case REDIS_ENCODING_HT:
+		d := o.Val_.(*Dict)
+		if d.DictAdd(field, value) == nil {
+			return false
+		}
+		d.DictSet(field, value)
+		return true
+	}
+	panic("unknown hash encoding")
+}
+
+// hashTypeDelete return true if field exists and is deleted.
+func hashTypeDelete(o *RedisObj, field *RedisObj) bool {
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		lp := o.Val_.(*Listpack)
+		vptr := hashTypeListpackFind(lp, field)
+		if vptr == -1 {
+			return false
+		}
+		// the value takes the offset of the deleted field.
+		lp.LpDelete(lp.LpDelete(lp.LpPrev(vptr)))
+		return true
+	case REDIS_ENCODING_HT:
+		return o.Val_.(*Dict).DictDelete(field) == nil
+	}
+	panic("unknown hash encoding")
+}
+
+// hashTypeRandomElement return a random field and its value, the hash must
+// not be empty.
+func hashTypeRandomElement(o *RedisObj) (*RedisObj, *RedisObj) {
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		lp := o.Val_.(*Listpack)
+		fptr := lp.LpSeek(2 * rand.Intn(lp.LpLength()/2))
+		return lp.LpGetObject(fptr), lp.LpGetObject(lp.LpNext(fptr))
+	case REDIS_ENCODING_HT:
+		de := o.Val_.(*Dict).DictGetRandomKey()
+		return de.Key, de.Val
+	}
+	panic("unknown hash encoding")
+}
+
+// hashTypeIterator iterate the fields and values of a hash, the hash must
+// not be modified during the iteration.
+type hashTypeIterator struct {
+	subject *RedisObj
+	// listpack encoding, offsets of the current field and value.
+	fptr, vptr int
+	// dict encoding
+	di *DictIterator
+	de *DictEntry
+}
+
+func hashTypeInitIterator(o *RedisObj) *hashTypeIterator {
+	hi := &hashTypeIterator{subject: o, fptr: -1, vptr: -1}
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+	case REDIS_ENCODING_HT:
+		hi.di = o.Val_.(*Dict).DictGetIterator()
+	default:
+		panic("unknown hash encoding")
+	}
+	return hi
+}
+
+// hashTypeNext move to the next field, return false when the iteration is done.
+func (hi *hashTypeIterator) hashTypeNext() bool {
+	if hi.subject.encoding == REDIS_ENCODING_LISTPACK {
+		lp := hi.subject.Val_.(*Listpack)
+		if hi.vptr == -1 {
+			hi.fptr = lp.LpFirst()
+		} else {
+			hi.fptr = lp.LpNext(hi.vptr)
+		}
+		if hi.fptr == -1 {
+			return false
+		}
+		hi.vptr = lp.LpNext(hi.fptr)
+		return true
+	}
+	hi.de = hi.di.DictNext()
+	return hi.de != nil
+}
+
+// hashTypeCurrentObject return the field or the value of the current entry.
+func (hi *hashTypeIterator) hashTypeCurrentObject(what int) *RedisObj {
+	if hi.subject.encoding == REDIS_ENCODING_LISTPACK {
+		lp := hi.subject.Val_.(*Listpack)
+		if what == OBJ_HASH_KEY {
+			return lp.LpGetObject(hi.fptr)
+		}
+		return lp.LpGetObject(hi.vptr)
+	}
+	if what == OBJ_HASH_KEY {
+		return hi.de.Key
+	}
+	return hi.de.Val
+}
+
+func (hi *hashTypeIterator) hashTypeReleaseIterator() {
+	if hi.di != nil {
+		hi.di.DictReleaseIterator()
+	}
+}
+
+// hashTypeDup return a new hash with the same fields, values and encoding.
+func hashTypeDup(o *RedisObj) *RedisObj {
+	if o.encoding == REDIS_ENCODING_LISTPACK {
+		dup := CreateObject(REDISDICT, o.Val_.(*Listpack).LpDup())
+		dup.encoding = REDIS_ENCODING_LISTPACK
+		return dup
+	}
+	dup := createHashObject()
+	hashTypeConvert(dup)
+	hi := hashTypeInitIterator(o)
+	for hi.hashTypeNext() {
+		hashTypeSet(dup, hi.hashTypeCurrentObject(OBJ_HASH_KEY), hi.hashTypeCurrentObject(OBJ_HASH_VALUE))
+	}
+	hi.hashTypeReleaseIterator()
+	return dup
+}
+
+// hsetCommand implement HSET key field value [field value ...]
+func hsetCommand(c *RedisClient) {
+	if len(c.args)%2 == 1 {
+		c.AddReplyErrorFormat("wrong number of arguments for '%s' command", c.args[0].StrVal())
+		return
+	}
+	o := hashTypeLookupWriteOrCreate(c, c.args[1])
+	if o == nil {
+		return
+	}
+	var created int64
+	for i := 2; i < len(c.args); i += 2 {
+		if !hashTypeSet(o, c.args[i], c.args[i+1]) {
+			created++
+		}
+	}
+	c.AddReplyInt(created)
+}
+
+func hsetnxCommand(c *RedisClient) {
+	o := hashTypeLookupWriteOrCreate(c, c.args[1])
+	if o == nil {
+		return
+	}
+	if hashTypeExists(o, c.args[2]) {
+		c.AddReply(shared.czero)
+		return
+	}
+	hashTypeSet(o, c.args[2], c.args[3])
+	c.AddReply(shared.cone)
+}
+
+func addHashFieldToReply(c *RedisClient, o *RedisObj, field *RedisObj) {
+	if o == nil {
+		c.AddReplyNullBulk()
+		return
+	}
+	val := hashTypeGetValue(o, field)
+	if val == nil {
+		c.AddReplyNullBulk()
+		return
+	}
+	c.AddReplyBulk(val)
+}
+
+func hgetCommand(c *RedisClient) {
+	o := lookupKeyReadOrReply(c, c.args[1], shared.nullBulk)
+	if o == nil || checkType(c, o, REDISDICT) {
+		return
+	}
+	addHashFieldToReply(c, o, c.args[2])
+}
+
+// hmgetCommand implement HMGET key field [field ...], a missing key is
+// handled as an empty hash.
+func hmgetCommand(c *RedisClient) {
+	o := lookupKeyRead(c.db, c.args[1])
+	if o != nil && checkType(c, o, REDISDICT) {
+		return
+	}
+	c.AddReplyArrayLen(len(c.args) - 2)
+	for _, field := range c.args[2:] {
+		addHashFieldToReply(c, o, field)
+	}
+}
+
+// hdelCommand implement HDEL key field [field ...], the key is deleted when
+// the hash is empty.
+func hdelCommand(c *RedisClient) {
+	key := c.args[1]
+	o := lookupKeyWriteOrReply(c, key, shared.czero)
+	if o == nil || checkType(c, o, REDISDICT) {
+		return
+	}
+	var deleted int64
+	for _, field := range c.args[2:] {
+		if hashTypeDelete(o, field) {
+			deleted++
+			if hashTypeLength(o) == 0 {
+				dbDelete(c.db, key)
+				break
+			}
+		}
+	}
+	c.AddReplyInt(deleted)
+}
+
+func hlenCommand(c *RedisClient) {
+	o := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if o == nil || checkType(c, o, REDISDICT) {
+		return
+	}
+	c.AddReplyInt(hashTypeLength(o))
+}
+
+func hexistsCommand(c *RedisClient) {
+	o := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if o == nil || checkType(c, o, REDISDICT) {
+		return
+	}
+	if hashTypeExists(o, c.args[2]) {
+		c.AddReply(shared.cone)
+	} else {
+		c.AddReply(shared.czero)
+	}
+}
+
+func hstrlenCommand(c *RedisClient) {
+	o := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if o == nil || checkType(c, o, REDISDICT) {
+		return
+	}
+	val := hashTypeGetValue(o, c.args[2])
+	if val == nil {
+		c.AddReply(shared.czero)
+		return
+	}
+	c.AddReplyInt(int64(len(val.StrVal())))
+}
+
+// genericHgetallCommand implement HKEYS, HVALS and HGETALL, flags tells
+// whether the fields and the values are replied.
+func genericHgetallCommand(c *RedisClient, flags int) {
+	o := lookupKeyReadOrReply(c, c.args[1], shared.emptyArray)
+	if o == nil || checkType(c, o, REDISDICT) {
+		return
+	}
+	length := hashTypeLength(o)
+	if flags&OBJ_HASH_KEY != 0 && flags&OBJ_HASH_VALUE != 0 {
+		length *= 2
+	}
+	c.AddReplyArrayLen(int(length))
+	hi := hashTypeInitIterator(o)
+	for hi.hashTypeNext() {
+		if flags&OBJ_HASH_KEY != 0 {
+			c.AddReplyBulk(hi.hashTypeCurrentObject(OBJ_HASH_KEY))
+		}
+		if flags&OBJ_HASH_VALUE != 0 {
+			c.AddReplyBulk(hi.hashTypeCurrentObject(OBJ_HASH_VALUE))
+		}
+	}
+	hi.hashTypeReleaseIterator()
+}
+
+func hkeysCommand(c *RedisClient) {
+	genericHgetallCommand(c, OBJ_HASH_KEY)
+}
+
+func hvalsCommand(c *RedisClient) {
+	genericHgetallCommand(c, OBJ_HASH_VALUE)
+}
+
+func hgetallCommand(c *RedisClient) {
+	genericHgetallCommand(c, OBJ_HASH_KEY|OBJ_HASH_VALUE)
+}
+
+// hincrbyCommand implement HINCRBY key field increment
+func hincrbyCommand(c *RedisClient) {
+	incr, ok := getLongLongFromObjectOrReply(c, c.args[3], "")
+	if !ok {
+		return
+	}
+	o := hashTypeLookupWriteOrCreate(c, c.args[1])
+	if o == nil {
+		return
+	}
+	var value int64
+	if cur := hashTypeGetValue(o, c.args[2]); cur != nil {
+		if value, ok = getLongLongFromObject(cur); !ok {
+			c.AddReplyError("hash value is not an integer")
+			return
+		}
+	}
+	if (incr < 0 && value < 0 && incr < math.MinInt64-value) ||
+		(incr > 0 && value > 0 && incr > math.MaxInt64-value) {
+		c.AddReplyError("increment or decrement would overflow")
+		return
+	}
+	value += incr
+	newVal := CreateFromInt(value)
+	hashTypeSet(o, c.args[2], newVal)
+	newVal.DecrRefCount()
+	c.AddReplyInt(value)
+}
+
+// hincrbyfloatCommand implement HINCRBYFLOAT key field increment
+func hincrbyfloatCommand(c *RedisClient) {
+	incr, ok := getLongDoubleFromObjectOrReply(c, c.args[3], "")
+	if !ok {
+		return
+	}
+	// compute the new value before creating the hash, an error must not
+	// leave an empty hash behind.
+	o := lookupKeyWrite(c.db, c.args[1])
+	if o != nil && checkType(c, o, REDISDICT) {
+		return
+	}
+	var value float64
+	if o != nil {
+		if cur := hashTypeGetValue(o, c.args[2]); cur != nil {
+			if value, ok = getLongDoubleFromObject(cur); !ok {
+				c.AddReplyError("hash value is not a float")
+				return
+			}
+		}
+	}
+	value += incr
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		c.AddReplyError("increment would produce NaN or Infinity")
+		return
+	}
+	if o == nil {
+		o = hashTypeLookupWriteOrCreate(c, c.args[1])
+	}
+	newVal := CreateObject(REDISSTR, ld2string(value))
+	hashTypeSet(o, c.args[2], newVal)
+	c.AddReplyBulk(newVal)
+	newVal.DecrRefCount()
+}
+
+// hrandfieldWithCountCommand reply count random fields. A positive count
+// returns distinct fields, a negative count may return the same field many
+// times and the reply has exactly -count fields.
+func hrandfieldWithCountCommand(c *RedisClient, count int64, withvalues bool) {
+	o := lookupKeyReadOrReply(c, c.args[1], shared.emptyArray)
+	if o == nil || checkType(c, o, REDISDICT) {
+		return
+	}
+	size := hashTypeLength(o)
+	if count == 0 {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+
+	addEntry := func(field, value *RedisObj) {
+		c.AddReplyBulk(field)
+		if withvalues {
+			c.AddReplyBulk(value)
+		}
+	}
+	replyLen := func(n int64) {
+		if withvalues {
+			n *= 2
+		}
+		c.AddReplyArrayLen(int(n))
+	}
+
+	// the same field can be returned multiple times.
+	if count < 0 {
+		count = -count
+		replyLen(count)
+		for ; count > 0; count-- {
+			addEntry(hashTypeRandomElement(o))
+		}
+		return
+	}
+
+	// the whole hash is returned.
+	if count >= size {
+		replyLen(size)
+		hi := hashTypeInitIterator(o)
+		for hi.hashTypeNext() {
+			addEntry(hi.hashTypeCurrentObject(OBJ_HASH_KEY), hi.hashTypeCurrentObject(OBJ_HASH_VALUE))
+		}
+		hi.hashTypeReleaseIterator()
+		return
+	}
+
+	// count is close to the size of the hash, or the hash is a small
+	// listpack, shuffle all the entries and take the first count of them,
+	// otherwise pick random entries until there are count distinct ones.
+	replyLen(count)
+	if count*3 > size || o.encoding == REDIS_ENCODING_LISTPACK {
+		type entry struct{ field, value *RedisObj }
+		entries := make([]entry, 0, size)
+		hi := hashTypeInitIterator(o)
+		for hi.hashTypeNext() {
+			entries = append(entries, entry{hi.hashTypeCurrentObject(OBJ_HASH_KEY), hi.hashTypeCurrentObject(OBJ_HASH_VALUE)})
+		}
+		hi.hashTypeReleaseIterator()
+		for i := int64(0); i < count; i++ {
+			j := i + rand.Int63n(size-i)
+			entries[i], entries[j] = entries[j], entries[i]
+			addEntry(entries[i].field, entries[i].value)
+		}
+		return
+	}
+	picked := make(map[string]struct{}, count)
+	for int64(len(picked)) < count {
+		field, value := hashTypeRandomElement(o)
+		if _, ok := picked[field.StrVal()]; ok {
+			continue
+		}
+		picked[field.StrVal()] = struct{}{}
+		addEntry(field, value)
+	}
+}
+
+// hrandfieldCommand implement HRANDFIELD key [count [WITHVALUES]]
+func hrandfieldCommand(c *RedisClient) {
+	if len(c.args) >= 3 {
+		withvalues := false
+		if len(c.args) > 4 || (len(c.args) == 4 && strings.ToLower(c.args[3].StrVal()) != "withvalues") {
+			c.AddReply(shared.syntaxErr)
+			return
+		} else if len(c.args) == 4 {
+			withvalues = true
+		}
+		count, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+		if !ok {
+			return
+		}
+		// -count must not overflow, nor the reply length with the values.
+		if count == math.MinInt64 || (withvalues && (count < -math.MaxInt64/2 || count > math.MaxInt64/2)) {
+			c.AddReplyError("value is out of range")
+			return
+		}
+		hrandfieldWithCountCommand(c, count, withvalues)
+		return
+	}
+
+	o := lookupKeyReadOrReply(c, c.args[1], shared.nullBulk)
+	if o == nil || checkType(c, o, REDISDICT) {
+		return
+	}
+	field, _ := hashTypeRandomElement(o)
+	c.AddReplyBulk(field)
+}
+
+// hscanCommand implement HSCAN key cursor [MATCH pattern] [COUNT count]
+func hscanCommand(c *RedisClient) {
+	cursor, ok := parseScanCursorOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	o := lookupKeyReadOrReply(c, c.args[1], shared.emptyScan)
+	if o == nil || checkType(c, o, REDISDICT) {
+		return
+	}
+	scanGenericCommand(c, o, cursor)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestHsetHgetCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":2\r\n", execCommand(c, "hset", "h", "f1", "v1", "f2", "v2"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "hset", "h", "f1", "v1new", "f3", "v3"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'hset' command\r\n", execCommand(c, "hset", "h", "f1", "v1", "f2"))
+	assert.Equal(t, "$5\r\nv1new\r\n", execCommand(c, "hget", "h", "f1"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "hget", "h", "nofield"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "hget", "nokey", "f1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "hsetnx", "h", "f1", "v"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "hsetnx", "h", "f4", "v4"))
+	assert.Equal(t, "*3\r\n$2\r\nv2\r\n$-1\r\n$2\r\nv4\r\n", execCommand(c, "hmget", "h", "f2", "nofield", "f4"))
+	assert.Equal(t, "*1\r\n$-1\r\n", execCommand(c, "hmget", "nokey", "f1"))
+	assert.Equal(t, ":4\r\n", execCommand(c, "hlen", "h"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "hexists", "h", "f2"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "hexists", "h", "nofield"))
+	assert.Equal(t, ":5\r\n", execCommand(c, "hstrlen", "h", "f1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "hstrlen", "h", "nofield"))
+	assert.Equal(t, "+hash\r\n", execCommand(c, "type", "h"))
+
+	assert.Equal(t, ":2\r\n", execCommand(c, "hdel", "h", "f1", "f2", "nofield"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "hdel", "h", "f3", "f4"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "h"))
+
+	execCommand(c, "set", "s", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "hset", "s", "f", "v"))
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "hget", "s", "f"))
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "hmget", "s", "f"))
+}
+
+func TestHgetallCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "*0\r\n", execCommand(c, "hgetall", "h"))
+	execCommand(c, "hset", "h", "f1", "v1")
+	assert.Equal(t, "*2\r\n$2\r\nf1\r\n$2\r\nv1\r\n", execCommand(c, "hgetall", "h"))
+	assert.Equal(t, "*1\r\n$2\r\nf1\r\n", execCommand(c, "hkeys", "h"))
+	assert.Equal(t, "*1\r\n$2\r\nv1\r\n", execCommand(c, "hvals", "h"))
+	execCommand(c, "hset", "h", "f2", "v2", "f3", "v3")
+	reply := execCommand(c, "hgetall", "h")
+	assert.True(t, strings.HasPrefix(reply, "*6\r\n"))
+	for _, s := range []string{"$2\r\nf2\r\n$2\r\nv2\r\n", "$2\r\nf3\r\n$2\r\nv3\r\n"} {
+		assert.True(t, strings.Contains(reply, s))
+	}
+}
+
+func TestHincrbyCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":5\r\n", execCommand(c, "hincrby", "h", "f", "5"))
+	assert.Equal(t, ":-5\r\n", execCommand(c, "hincrby", "h", "f", "-10"))
+	execCommand(c, "hset", "h", "max", "9223372036854775807", "str", "abc")
+	assert.Equal(t, "-ERR increment or decrement would overflow\r\n", execCommand(c, "hincrby", "h", "max", "1"))
+	assert.Equal(t, "-ERR hash value is not an integer\r\n", execCommand(c, "hincrby", "h", "str", "1"))
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", execCommand(c, "hincrby", "h", "f", "a"))
+
+	assert.Equal(t, "$3\r\n0.5\r\n", execCommand(c, "hincrbyfloat", "h", "fl", "0.5"))
+	assert.Equal(t, "$4\r\n-4.5\r\n", execCommand(c, "hincrbyfloat", "h", "f", "0.5"))
+	assert.Equal(t, "-ERR hash value is not a float\r\n", execCommand(c, "hincrbyfloat", "h", "str", "1"))
+	assert.Equal(t, "-ERR increment would produce NaN or Infinity\r\n", execCommand(c, "hincrbyfloat", "h", "f", "inf"))
+	assert.Equal(t, "-ERR increment would produce NaN or Infinity\r\n", execCommand(c, "hincrbyfloat", "newkey", "f", "inf"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "newkey"))
+}
+
+func TestHrandfieldCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "$-1\r\n", execCommand(c, "hrandfield", "h"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "hrandfield", "h", "3"))
+	execCommand(c, "hset", "h", "f1", "v1", "f2", "v2", "f3", "v3", "f4", "v4", "f5", "v5",
+		"f6", "v6", "f7", "v7", "f8", "v8", "f9", "v9", "f0", "v0")
+	assert.True(t, strings.HasPrefix(execCommand(c, "hrandfield", "h"), "$2\r\nf"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "hrandfield", "h", "0"))
+
+	countFields := func(reply string) map[string]int {
+		fields := map[string]int{}
+		for _, s := range strings.Split(reply, "\r\n") {
+			if strings.HasPrefix(s, "f") {
+				fields[s]++
+			}
+		}
+		return fields
+	}
+	// distinct fields with the two strategies.
+	for _, count := range []string{"2", "8", "20"} {
+		reply := execCommand(c, "hrandfield", "h", count)
+		fields := countFields(reply)
+		for _, n := range fields {
+			assert.Equal(t, 1, n)
+		}
+		if count == "20" {
+			assert.Equal(t, 10, len(fields))
+		} else {
+			assert.True(t, strings.HasPrefix(reply, "*"+count+"\r\n"))
+		}
+	}
+	reply := execCommand(c, "hrandfield", "h", "-30")
+	assert.True(t, strings.HasPrefix(reply, "*30\r\n"))
+	reply = execCommand(c, "hrandfield", "h", "-3", "withvalues")
+	assert.True(t, strings.HasPrefix(reply, "*6\r\n"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "hrandfield", "h", "3", "withscores"))
+	assert.Equal(t, "-ERR value is out of range\r\n", execCommand(c, "hrandfield", "h", "-9223372036854775808"))
+	assert.Equal(t, "-ERR value is out of range\r\n", execCommand(c, "hrandfield", "h", "-4611686018427387904", "withvalues"))
+	assert.Equal(t, "-ERR value is out of range\r\n", execCommand(c, "hrandfield", "h", "9223372036854775807", "withvalues"))
+	// the whole hash is returned.
+	assert.Equal(t, 10, len(countFields(execCommand(c, "hrandfield", "h", "9223372036854775807"))))
+}
+
+func TestHscanCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "*2\r\n$1\r\n0\r\n*0\r\n", execCommand(c, "hscan", "h", "0"))
+	execCommand(c, "hset", "h", "a1", "v1", "a2", "v2", "b1", "v3")
+	reply := execCommand(c, "hscan", "h", "0", "match", "a*")
+	assert.True(t, strings.HasPrefix(reply, "*2\r\n$1\r\n0\r\n*4\r\n"))
+	assert.True(t, strings.Contains(reply, "$2\r\na1\r\n$2\r\nv1\r\n"))
+	assert.True(t, strings.Contains(reply, "$2\r\na2\r\n$2\r\nv2\r\n"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "hscan", "h", "0", "type", "string"))
+}
+
+func TestHashCopy(t *testing.T) {
+	c := testClient()
+	execCommand(c, "hset", "h", "f", "v")
+	assert.Equal(t, ":1\r\n", execCommand(c, "copy", "h", "h2"))
+	execCommand(c, "hset", "h2", "f", "v2")
+	assert.Equal(t, "$1\r\nv\r\n", execCommand(c, "hget", "h", "f"))
+	assert.Equal(t, "$2\r\nv2\r\n", execCommand(c, "hget", "h2", "f"))
+}
+
+func TestHashEncodingConversion(t *testing.T) {
+	c := testClient()
+	server.hashMaxListpackEntries = 2
+	execCommand(c, "hset", "h", "f1", "v1", "f2", "v2")
+	assert.Equal(t, "$8\r\nlistpack\r\n", execCommand(c, "object", "encoding", "h"))
+	execCommand(c, "hset", "h", "f3", "v3")
+	assert.Equal(t, "$9\r\nhashtable\r\n", execCommand(c, "object", "encoding", "h"))
+	assert.Equal(t, ":3\r\n", execCommand(c, "hlen", "h"))
+	assert.Equal(t, "$2\r\nv1\r\n", execCommand(c, "hget", "h", "f1"))
+
+	execCommand(c, "hset", "long", "f", "v")
+	execCommand(c, "hset", "long", "f", strings.Repeat("v", 65))
+	assert.Equal(t, "$9\r\nhashtable\r\n", execCommand(c, "object", "encoding", "long"))
+	execCommand(c, "hset", "longfield", strings.Repeat("f", 65), "v")
+	assert.Equal(t, "$9\r\nhashtable\r\n", execCommand(c, "object", "encoding", "longfield"))
+}
+
+// TestHashEncodings run the same commands on a listpack and a dict.
+func TestHashEncodings(t *testing.T) {
+	for _, entries := range []int{128, 0} {
+		c := testClient()
+		server.hashMaxListpackEntries = entries
+		assert.Equal(t, ":3\r\n", execCommand(c, "hset", "h", "f1", "1", "f2", "v2", "f3", "-500"))
+		assert.Equal(t, ":0\r\n", execCommand(c, "hset", "h", "f2", "v2new"))
+		assert.Equal(t, "*3\r\n$1\r\n1\r\n$5\r\nv2new\r\n$4\r\n-500\r\n", execCommand(c, "hmget", "h", "f1", "f2", "f3"))
+		assert.Equal(t, ":501\r\n", execCommand(c, "hincrby", "h", "f3", "1001"))
+		assert.Equal(t, "$3\r\n1.5\r\n", execCommand(c, "hincrbyfloat", "h", "f1", "0.5"))
+		assert.Equal(t, ":1\r\n", execCommand(c, "hdel", "h", "f2"))
+		assert.Equal(t, ":0\r\n", execCommand(c, "hexists", "h", "f2"))
+		reply := execCommand(c, "hgetall", "h")
+		assert.True(t, strings.HasPrefix(reply, "*4\r\n"))
+		assert.True(t, strings.Contains(reply, "$2\r\nf1\r\n$3\r\n1.5\r\n"))
+		assert.True(t, strings.Contains(reply, "$2\r\nf3\r\n$3\r\n501\r\n"))
+		assert.True(t, strings.HasPrefix(execCommand(c, "hrandfield", "h"), "$2\r\nf"))
+		assert.True(t, strings.HasPrefix(execCommand(c, "hrandfield", "h", "-5", "withvalues"), "*10\r\n"))
+		assert.True(t, strings.HasPrefix(execCommand(c, "hrandfield", "h", "1"), "*1\r\n$2\r\nf"))
+		assert.True(t, strings.HasPrefix(execCommand(c, "hscan", "h", "0", "match", "f1"), "*2\r\n$1\r\n0\r\n*2\r\n$2\r\nf1\r\n"))
+		assert.Equal(t, ":1\r\n", execCommand(c, "copy", "h", "h2"))
+		execCommand(c, "hset", "h2", "f1", "x")
+		assert.Equal(t, "$3\r\n1.5\r\n", execCommand(c, "hget", "h", "f1"))
+		assert.Equal(t, ":2\r\n", execCommand(c, "hdel", "h", "f1", "f3"))
+		assert.Equal(t, ":0\r\n", execCommand(c, "exists", "h"))
+	}
+}
@@ -0,0 +1,842 @@
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+// where of list push and pop.
+const (
+	LIST_HEAD int = 0
+	LIST_TAIL int = 1
+)
+
+// optimizationLevel is the max size in bytes of a listpack for the negative
+// values -1 to -5 of list-max-listpack-size.
+var optimizationLevel = []int{4096, 8192, 16384, 32768, 65536}
+
+// SIZE_SAFETY_LIMIT is the max size in bytes of a listpack when
+// list-max-listpack-size is a number of elements.
+const SIZE_SAFETY_LIMIT int = 8192
+
+// listpackExceedsLimit report whether a listpack of sz bytes and count
+// elements doesn't fit the list-max-listpack-size fill.
+func listpackExceedsLimit(fill int, sz, count int) bool {
+	if fill >= 0 {
+		return count > fill || sz > SIZE_SAFETY_LIMIT
+	}
+	offset := -fill - 1
+	if offset >= len(optimizationLevel) {
+		offset = len(optimizationLevel) - 1
+	}
+	return sz > optimizationLevel[offset]
+}
+
+// listTypeTryConversionAppend convert a listpack encoded list to a
+// quicklist if adding vals would exceed list-max-listpack-size.
+func listTypeTryConversionAppend(o *RedisObj, vals []*RedisObj) {
+	if o.encoding != REDIS_ENCODING_LISTPACK {
+		return
+	}
+	lp := o.Val_.(*Listpack)
+	sz := lp.LpBytes()
+	for _, val := range vals {
+		sz += len(val.StrVal())
+	}
+	if listpackExceedsLimit(server.listMaxListpackSize, sz, lp.LpLength()+len(vals)) {
+		listTypeConvert(o, REDIS_ENCODING_QUICKLIST)
+	}
+}
+
+// listTypeConvert convert a listpack encoded list to enc, only the
+// conversion to a quicklist is supported. The listpack becomes the first
+// node of the quicklist.
+func listTypeConvert(o *RedisObj, enc RedisEncoding) {
+	if o.encoding != REDIS_ENCODING_LISTPACK || enc != REDIS_ENCODING_QUICKLIST {
+		panic("unsupported list conversion")
+	}
+	ql := createQuicklistObject().Val_.(*Quicklist)
+	if lp := o.Val_.(*Listpack); lp.LpLength() > 0 {
+		ql.quicklistAppendListpack(lp)
+	}
+	o.Val_ = ql
+	o.encoding = REDIS_ENCODING_QUICKLIST
+}
+
+func listTypeLength(o *RedisObj) int64 {
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		return int64(o.Val_.(*Listpack).LpLength())
+	case REDIS_ENCODING_QUICKLIST:
+		return int64(o.Val_.(*Quicklist).QuicklistCount())
+	}
+	panic("unknown list encoding")
+}
+
+// listTypePush add val to the head or the tail of the list.
+func listTypePush(o *RedisObj, val *RedisObj, where int) {
+	listTypeTryConversionAppend(o, []*RedisObj{val})
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		lp := o.Val_.(*Listpack)
+		if where == LIST_HEAD {
+			lp.LpPrepend(val.StrVal())
+		} else {
+			lp.LpAppend(val.StrVal())
+		}
+	case REDIS_ENCODING_QUICKLIST:
+		pos := QUICKLIST_TAIL
+		if where == LIST_HEAD {
+			pos = QUICKLIST_HEAD
+		}
+		o.Val_.(*Quicklist).QuicklistPush(val.StrVal(), pos)
+	default:
+		panic("unknown list encoding")
+	}
+}
+
+// listTypePop remove and return the element at the head or the tail of the
+// list, the reference of the element is passed to the caller.
+func listTypePop(o *RedisObj, where int) *RedisObj {
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		lp := o.Val_.(*Listpack)
+		p := lp.LpFirst()
+		if where == LIST_TAIL {
+			p = lp.LpLast()
+		}
+		if p == -1 {
+			return nil
+		}
+		val := lp.LpGetObject(p)
+		lp.LpDelete(p)
+		return val
+	case REDIS_ENCODING_QUICKLIST:
+		pos := QUICKLIST_TAIL
+		if where == LIST_HEAD {
+			pos = QUICKLIST_HEAD
+		}
+		return o.Val_.(*Quicklist).QuicklistPop(pos)
+	}
+	panic("unknown list encoding")
+}
+
+// listTypeDup return a new list with the same elements and encoding.
+func listTypeDup(o *RedisObj) *RedisObj {
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		dup := CreateObject(REDISLIST, o.Val_.(*Listpack).LpDup())
+		dup.encoding = REDIS_ENCODING_LISTPACK
+		return dup
+	case REDIS_ENCODING_QUICKLIST:
+		dup := CreateObject(REDISLIST, o.Val_.(*Quicklist).QuicklistDup())
+		dup.encoding = REDIS_ENCODING_QUICKLIST
+		return dup
+	}
+	panic("unknown list encoding")
+}
+
+// listTypeIterator iterate a list from an index towards the head or the
+// tail, the current entry can be deleted during the iteration. The iterator
+// must be released with listTypeReleaseIterator.
+type listTypeIterator struct {
+	subject   *RedisObj
+	direction int            // LIST_TAIL iterates from the head to the tail.
+	lpi       int            // offset of the next listpack element, -1 at the end.
+	iter      *QuicklistIter // iterator of a quicklist.
+}
+
+// listTypeEntry is the current element of a listTypeIterator.
+type listTypeEntry struct {
+	li    *listTypeIterator
+	lpe   int            // offset of the listpack element.
+	entry QuicklistEntry // element of a quicklist.
+}
+
+// listTypeInitIterator return an iterator starting at index, negative index
+// counts from the tail, nil if index is out of range.
+func listTypeInitIterator(o *RedisObj, index int64, direction int) *listTypeIterator {
+	llen := listTypeLength(o)
+	if index < 0 {
+		index += llen
+	}
+	if index < 0 || index >= llen {
+		return nil
+	}
+	li := &listTypeIterator{subject: o, direction: direction}
+	switch o.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		li.lpi = o.Val_.(*Listpack).LpSeek(int(index))
+	case REDIS_ENCODING_QUICKLIST:
+		iterDirection := AL_START_HEAD
+		if direction == LIST_HEAD {
+			iterDirection = AL_START_TAIL
+		}
+		li.iter = o.Val_.(*Quicklist).QuicklistGetIteratorAtIdx(iterDirection, int(index))
+	default:
+		panic("unknown list encoding")
+	}
+	return li
+}
+
+// listTypeReleaseIterator compress again the quicklist node being accessed.
+func (li *listTypeIterator) listTypeReleaseIterator() {
+	if li != nil && li.iter != nil {
+		li.iter.QuicklistReleaseIterator()
+	}
+}
+
+// listTypeNext store the next element in entry, return false when the
+// iteration is done.
+func (li *listTypeIterator) listTypeNext(entry *listTypeEntry) bool {
+	entry.li = li
+	switch li.subject.encoding {
+	case REDIS_ENCODING_LISTPACK:
+		entry.lpe = li.lpi
+		if entry.lpe == -1 {
+			return false
+		}
+		lp := li.subject.Val_.(*Listpack)
+		if li.direction == LIST_TAIL {
+			li.lpi = lp.LpNext(li.lpi)
+		} else {
+			li.lpi = lp.LpPrev(li.lpi)
+		}
+		return true
+	case REDIS_ENCODING_QUICKLIST:
+		return li.iter.QuicklistNext(&entry.entry)
+	}
+	panic("unknown list encoding")
+}
+
+// listTypeGet return the element of entry.
+func (entry *listTypeEntry) listTypeGet() *RedisObj {
+	if entry.li.subject.encoding == REDIS_ENCODING_LISTPACK {
+		return entry.li.subject.Val_.(*Listpack).LpGetObject(entry.lpe)
+	}
+	return entry.entry.node.lp.LpGetObject(entry.entry.p)
+}
+
+func (entry *listTypeEntry) listTypeEqual(o *RedisObj) bool {
+	if entry.li.subject.encoding == REDIS_ENCODING_LISTPACK {
+		return entry.li.subject.Val_.(*Listpack).lpCompare(entry.lpe, o.StrVal())
+	}
+	return entry.entry.node.lp.lpCompare(entry.entry.p, o.StrVal())
+}
+
+// listTypeDelete delete the element of entry, the iterator stays valid.
+func (entry *listTypeEntry) listTypeDelete() {
+	li := entry.li
+	if li.subject.encoding == REDIS_ENCODING_LISTPACK {
+		// the next element moves to the offset of the deleted one, the
+		// previous elements don't move.
+		p := li.subject.Val_.(*Listpack).LpDelete(entry.lpe)
+		if li.direction == LIST_TAIL {
+			li.lpi = p
+		}
+		return
+	}
+	li.iter.QuicklistDelEntry(&entry.entry)
+}
+
+// listTypeInsert insert val before or after the element of entry, where is
+// LIST_HEAD for before. The iterator must not be used after the insert.
+func (entry *listTypeEntry) listTypeInsert(val *RedisObj, where int) {
+	if entry.li.subject.encoding == REDIS_ENCODING_LISTPACK {
+		lpWhere := LP_BEFORE
+		if where == LIST_TAIL {
+			lpWhere = LP_AFTER
+		}
+		entry.li.subject.Val_.(*Listpack).LpInsert(val.StrVal(), entry.lpe, lpWhere)
+		return
+	}
+	entry.li.subject.Val_.(*Quicklist).QuicklistInsert(&entry.entry, val.StrVal(), where == LIST_TAIL)
+}
+
+// listTypeReplace replace the element of entry with val. The iterator must
+// not be used after the replace.
+func (entry *listTypeEntry) listTypeReplace(val *RedisObj) {
+	if entry.li.subject.encoding == REDIS_ENCODING_LISTPACK {
+		entry.li.subject.Val_.(*Listpack).LpReplace(entry.lpe, val.StrVal())
+		return
+	}
+	entry.li.subject.Val_.(*Quicklist).QuicklistReplaceEntry(&entry.entry, val.StrVal())
+}
+
+// pushGenericCommand implement LPUSH, RPUSH, LPUSHX and RPUSHX, the X
+// variants only push to an existing list.
+func pushGenericCommand(c *RedisClient, where int, xx bool) {
+	key := c.args[1]
+	lobj := lookupKeyWrite(c.db, key)
+	if lobj != nil && checkType(c, lobj, REDISLIST) {
+		return
+	}
+	if lobj == nil {
+		if xx {
+			c.AddReply(shared.czero)
+			return
+		}
+		lobj = createListListpackObject()
+		dbAdd(c.db, key, lobj)
+		lobj.DecrRefCount()
+	}
+	for _, val := range c.args[2:] {
+		listTypePush(lobj, val, where)
+	}
+	c.AddReplyInt(listTypeLength(lobj))
+}
+
+// lpushCommand implement LPUSH key element [element ...]
+func lpushCommand(c *RedisClient) {
+	pushGenericCommand(c, LIST_HEAD, false)
+}
+
+func rpushCommand(c *RedisClient) {
+	pushGenericCommand(c, LIST_TAIL, false)
+}
+
+func lpushxCommand(c *RedisClient) {
+	pushGenericCommand(c, LIST_HEAD, true)
+}
+
+func rpushxCommand(c *RedisClient) {
+	pushGenericCommand(c, LIST_TAIL, true)
+}
+
+// popGenericCommand implement LPOP and RPOP key [count]. Without count a
+// single element is replied, otherwise an array of up to count elements.
+func popGenericCommand(c *RedisClient, where int) {
+	if len(c.args) > 3 {
+		c.AddReplyErrorFormat("wrong number of arguments for '%s' command", c.args[0].StrVal())
+		return
+	}
+	hasCount := len(c.args) == 3
+	var count int64 = 1
+	if hasCount {
+		var ok bool
+		count, ok = getLongLongFromObjectOrReply(c, c.args[2], "value is out of range, must be positive")
+		if !ok {
+			return
+		}
+		if count < 0 {
+			c.AddReplyError("value is out of range, must be positive")
+			return
+		}
+	}
+
+	nullReply := shared.nullBulk
+	if hasCount {
+		nullReply = shared.nullArray
+	}
+	key := c.args[1]
+	lobj := lookupKeyWriteOrReply(c, key, nullReply)
+	if lobj == nil || checkType(c, lobj, REDISLIST) {
+		return
+	}
+
+	if !hasCount {
+		val := listTypePop(lobj, where)
+		c.AddReplyBulk(val)
+		val.DecrRefCount()
+	} else {
+		if llen := listTypeLength(lobj); count > llen {
+			count = llen
+		}
+		c.AddReplyArrayLen(int(count))
+		for ; count > 0; count-- {
+			val := listTypePop(lobj, where)
+			c.AddReplyBulk(val)
+			val.DecrRefCount()
+		}
+	}
+	if listTypeLength(lobj) == 0 {
+		dbDelete(c.db, key)
+	}
+}
+
+func lpopCommand(c *RedisClient) {
+	popGenericCommand(c, LIST_HEAD)
+}
+
+func rpopCommand(c *RedisClient) {
+	popGenericCommand(c, LIST_TAIL)
+}
+
+func llenCommand(c *RedisClient) {
+	lobj := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if lobj == nil || checkType(c, lobj, REDISLIST) {
+		return
+	}
+	c.AddReplyInt(listTypeLength(lobj))
+}
+
+// lrangeCommand implement LRANGE key start stop
+func lrangeCommand(c *RedisClient) {
+	start, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	end, ok := getLongLongFromObjectOrReply(c, c.args[3], "")
+	if !ok {
+		return
+	}
+	lobj := lookupKeyReadOrReply(c, c.args[1], shared.emptyArray)
+	if lobj == nil || checkType(c, lobj, REDISLIST) {
+		return
+	}
+
+	llen := listTypeLength(lobj)
+	if start < 0 {
+		start += llen
+	}
+	if end < 0 {
+		end += llen
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > end || start >= llen {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+	if end >= llen {
+		end = llen - 1
+	}
+	rangelen := end - start + 1
+	c.AddReplyArrayLen(int(rangelen))
+	li := listTypeInitIterator(lobj, start, LIST_TAIL)
+	var entry listTypeEntry
+	for ; rangelen > 0; rangelen-- {
+		li.listTypeNext(&entry)
+		c.AddReplyBulk(entry.listTypeGet())
+	}
+	li.listTypeReleaseIterator()
+}
+
+func lindexCommand(c *RedisClient) {
+	index, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	lobj := lookupKeyReadOrReply(c, c.args[1], shared.nullBulk)
+	if lobj == nil || checkType(c, lobj, REDISLIST) {
+		return
+	}
+	li := listTypeInitIterator(lobj, index, LIST_TAIL)
+	if li == nil {
+		c.AddReply(shared.nullBulk)
+		return
+	}
+	var entry listTypeEntry
+	li.listTypeNext(&entry)
+	c.AddReplyBulk(entry.listTypeGet())
+	li.listTypeReleaseIterator()
+}
+
+// lsetCommand implement LSET key index element
+func lsetCommand(c *RedisClient) {
+	index, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	lobj := lookupKeyWriteOrReply(c, c.args[1], shared.noKeyErr)
+	if lobj == nil || checkType(c, lobj, REDISLIST) {
+		return
+	}
+	listTypeTryConversionAppend(lobj, c.args[3:4])
+	li := listTypeInitIterator(lobj, index, LIST_TAIL)
+	if li == nil {
+		c.AddReply(shared.outOfRange)
+		return
+	}
+	var entry listTypeEntry
+	li.listTypeNext(&entry)
+	entry.listTypeReplace(c.args[3])
+	li.listTypeReleaseIterator()
+	c.AddReply(shared.ok)
+}
+
+// lremCommand implement LREM key count element. count > 0 removes from head
+// to tail, count < 0 from tail to head, and count = 0 removes all.
+func lremCommand(c *RedisClient) {
+	toremove, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	key, elem := c.args[1], c.args[3]
+	lobj := lookupKeyWriteOrReply(c, key, shared.czero)
+	if lobj == nil || checkType(c, lobj, REDISLIST) {
+		return
+	}
+
+	li := listTypeInitIterator(lobj, 0, LIST_TAIL)
+	if toremove < 0 {
+		toremove = -toremove
+		li = listTypeInitIterator(lobj, -1, LIST_HEAD)
+	}
+	var removed int64
+	var entry listTypeEntry
+	for li.listTypeNext(&entry) {
+		if entry.listTypeEqual(elem) {
+			entry.listTypeDelete()
+			removed++
+			if removed == toremove {
+				break
+			}
+		}
+	}
+	li.listTypeReleaseIterator()
+	if listTypeLength(lobj) == 0 {
+		dbDelete(c.db, key)
+	}
+	c.AddReplyInt(removed)
+}
+
+// ltrimCommand implement LTRIM key start stop
+func ltrimCommand(c *RedisClient) {
+	start, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	end, ok := getLongLongFromObjectOrReply(c, c.args[3], "")
+	if !ok {
+		return
+	}
+	key := c.args[1]
+	lobj := lookupKeyWriteOrReply(c, key, shared.ok)
+	if lobj == nil || checkType(c, lobj, REDISLIST) {
+		return
+	}
+
+	llen := listTypeLength(lobj)
+	if start < 0 {
+		start += llen
+	}
+	if end < 0 {
+		end += llen
+	}
+	if start < 0 {
+		start = 0
+	}
+	var ltrim, rtrim int64
+	if start > end || start >= llen {
+		// out of range, the list is emptied.
+		ltrim, rtrim = llen, 0
+	} else {
+		if end >= llen {
+			end = llen - 1
+		}
+		ltrim, rtrim = start, llen-end-1
+	}
+	for ; ltrim > 0; ltrim-- {
+		listTypePop(lobj, LIST_HEAD).DecrRefCount()
+	}
+	for ; rtrim > 0; rtrim-- {
+		listTypePop(lobj, LIST_TAIL).DecrRefCount()
+	}
+	if listTypeLength(lobj) == 0 {
+		dbDelete(c.db, key)
+	}
+	c.AddReply(shared.ok)
+}
+
+// linsertCommand implement LINSERT key BEFORE|AFTER pivot element
+func linsertCommand(c *RedisClient) {
+	var where int
+	switch strings.ToLower(c.args[2].StrVal()) {
+	case "after":
+		where = LIST_TAIL
+	case "before":
+		where = LIST_HEAD
+	default:
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	lobj := lookupKeyWriteOrReply(c, c.args[1], shared.czero)
+	if lobj == nil || checkType(c, lobj, REDISLIST) {
+		return
+	}
+
+	pivot, val := c.args[3], c.args[4]
+	listTypeTryConversionAppend(lobj, c.args[4:5])
+	li := listTypeInitIterator(lobj, 0, LIST_TAIL)
+	var entry listTypeEntry
+	for li.listTypeNext(&entry) {
+		if entry.listTypeEqual(pivot) {
+			entry.listTypeInsert(val, where)
+			li.listTypeReleaseIterator()
+			c.AddReplyInt(listTypeLength(lobj))
+			return
+		}
+	}
+	li.listTypeReleaseIterator()
+	c.AddReply(shared.cnegone)
+}
+
+// lposCommand implement LPOS key element [RANK rank] [COUNT num-matches]
+// [MAXLEN len]. A negative rank searches from the tail, COUNT 0 returns all
+// the matches and MAXLEN 0 compares all the elements.
+func lposCommand(c *RedisClient) {
+	var rank int64 = 1
+	var count, maxlen int64
+	hasCount := false
+	for i := 3; i < len(c.args); i++ {
+		opt := strings.ToLower(c.args[i].StrVal())
+		moreargs := i+1 < len(c.args)
+		var ok bool
+		if opt == "rank" && moreargs {
+			i++
+			if rank, ok = getLongLongFromObjectOrReply(c, c.args[i], ""); !ok {
+				return
+			}
+			// -rank must not overflow.
+			if rank == math.MinInt64 {
+				c.AddReplyError("value is out of range, value must between -9223372036854775807 and 9223372036854775807")
+				return
+			}
+			if rank == 0 {
+				c.AddReplyError("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+				return
+			}
+		} else if opt == "count" && moreargs {
+			i++
+			if count, ok = getLongLongFromObjectOrReply(c, c.args[i], ""); !ok {
+				return
+			}
+			if count < 0 {
+				c.AddReplyError("COUNT can't be negative")
+				return
+			}
+			hasCount = true
+		} else if opt == "maxlen" && moreargs {
+			i++
+			if maxlen, ok = getLongLongFromObjectOrReply(c, c.args[i], ""); !ok {
+				return
+			}
+			if maxlen < 0 {
+				c.AddReplyError("MAXLEN can't be negative")
+				return
+			}
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+
+	nullReply := shared.nullBulk
+	if hasCount {
+		nullReply = shared.emptyArray
+	}
+	lobj := lookupKeyReadOrReply(c, c.args[1], nullReply)
+	if lobj == nil || checkType(c, lobj, REDISLIST) {
+		return
+	}
+
+	elem := c.args[2]
+	li, index, step := listTypeInitIterator(lobj, 0, LIST_TAIL), int64(0), int64(1)
+	if rank < 0 {
+		rank = -rank
+		li, index, step = listTypeInitIterator(lobj, -1, LIST_HEAD), listTypeLength(lobj)-1, -1
+	}
+	var matches []int64
+	var entry listTypeEntry
+	for checked := int64(0); (maxlen == 0 || checked < maxlen) && li.listTypeNext(&entry); checked++ {
+		if entry.listTypeEqual(elem) {
+			// skip the first rank-1 matches.
+			if rank > 1 {
+				rank--
+			} else {
+				matches = append(matches, index)
+				if !hasCount || int64(len(matches)) == count {
+					break
+				}
+			}
+		}
+		index += step
+	}
+	li.listTypeReleaseIterator()
+
+	if !hasCount {
+		if len(matches) == 0 {
+			c.AddReply(shared.nullBulk)
+		} else {
+			c.AddReplyInt(matches[0])
+		}
+		return
+	}
+	c.AddReplyArrayLen(len(matches))
+	for _, m := range matches {
+		c.AddReplyInt(m)
+	}
+}
+
+// getListPositionFromObjectOrReply parse LEFT or RIGHT.
+func getListPositionFromObjectOrReply(c *RedisClient, o *RedisObj) (int, bool) {
+	switch strings.ToLower(o.StrVal()) {
+	case "left":
+		return LIST_HEAD, true
+	case "right":
+		return LIST_TAIL, true
+	}
+	c.AddReply(shared.syntaxErr)
+	return 0, false
+}
+
+// lmoveGenericCommand pop an element from the src list and push it to the
+// dst list atomically, src and dst may be the same list.
+func lmoveGenericCommand(c *RedisClient, wherefrom, whereto int) {
+	src, dst := c.args[1], c.args[2]
+	sobj := lookupKeyWriteOrReply(c, src, shared.nullBulk)
+	if sobj == nil || checkType(c, sobj, REDISLIST) {
+		return
+	}
+	dobj := lookupKeyWrite(c.db, dst)
+	if dobj != nil && checkType(c, dobj, REDISLIST) {
+		return
+	}
+
+	val := listTypePop(sobj, wherefrom)
+	lmoveHandlePush(c.db, dst, dobj, val, whereto)
+	// the source list is empty only if it is not the destination.
+	if listTypeLength(sobj) == 0 {
+		dbDelete(c.db, src)
+	}
+	c.AddReplyBulk(val)
+	val.DecrRefCount()
+}
+
+// lmoveHandlePush push val to the dst list, which is created if dobj is
+// nil.
+func lmoveHandlePush(db *RedisDB, dst, dobj, val *RedisObj, where int) {
+	if dobj == nil {
+		dobj = createListListpackObject()
+		dbAdd(db, dst, dobj)
+		dobj.DecrRefCount()
+	}
+	listTypePush(dobj, val, where)
+}
+
+// lmoveCommand implement LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func lmoveCommand(c *RedisClient) {
+	wherefrom, ok := getListPositionFromObjectOrReply(c, c.args[3])
+	if !ok {
+		return
+	}
+	whereto, ok := getListPositionFromObjectOrReply(c, c.args[4])
+	if !ok {
+		return
+	}
+	lmoveGenericCommand(c, wherefrom, whereto)
+}
+
+func rpoplpushCommand(c *RedisClient) {
+	lmoveGenericCommand(c, LIST_TAIL, LIST_HEAD)
+}
+
+// blockingPopGenericCommand implement BLPOP and BRPOP key [key ...] timeout.
+// The element is popped from the first non empty list, the client blocks if
+// all the lists are empty.
+func blockingPopGenericCommand(c *RedisClient, where int) {
+	timeout, ok := getTimeoutFromObjectOrReply(c, c.args[len(c.args)-1], UNIT_SECONDS)
+	if !ok {
+		return
+	}
+	keys := c.args[1 : len(c.args)-1]
+	for _, key := range keys {
+		lobj := lookupKeyWrite(c.db, key)
+		if lobj == nil {
+			continue
+		}
+		if checkType(c, lobj, REDISLIST) {
+			return
+		}
+		val := listTypePop(lobj, where)
+		c.AddReplyArrayLen(2)
+		c.AddReplyBulk(key)
+		c.AddReplyBulk(val)
+		val.DecrRefCount()
+		if listTypeLength(lobj) == 0 {
+			dbDelete(c.db, key)
+		}
+		return
+	}
+	c.bpop.wherefrom = where
+	blockForKeys(c, BLOCKED_LIST, keys, timeout)
+}
+
+func blpopCommand(c *RedisClient) {
+	blockingPopGenericCommand(c, LIST_HEAD)
+}
+
+func brpopCommand(c *RedisClient) {
+	blockingPopGenericCommand(c, LIST_TAIL)
+}
+
+// blmoveGenericCommand behave like LMOVE if the source list is not empty,
+// otherwise the client blocks on it.
+func blmoveGenericCommand(c *RedisClient, wherefrom, whereto int, timeout int64) {
+	sobj := lookupKeyWrite(c.db, c.args[1])
+	if sobj != nil && checkType(c, sobj, REDISLIST) {
+		return
+	}
+	if sobj != nil {
+		lmoveGenericCommand(c, wherefrom, whereto)
+		return
+	}
+	c.bpop.wherefrom = wherefrom
+	c.bpop.target = c.args[2]
+	c.bpop.target.IncrRefCount()
+	c.bpop.whereto = whereto
+	blockForKeys(c, BLOCKED_LIST, c.args[1:2], timeout)
+}
+
+// blmoveCommand implement BLMOVE source destination LEFT|RIGHT LEFT|RIGHT
+// timeout
+func blmoveCommand(c *RedisClient) {
+	wherefrom, ok := getListPositionFromObjectOrReply(c, c.args[3])
+	if !ok {
+		return
+	}
+	whereto, ok := getListPositionFromObjectOrReply(c, c.args[4])
+	if !ok {
+		return
+	}
+	timeout, ok := getTimeoutFromObjectOrReply(c, c.args[5], UNIT_SECONDS)
+	if !ok {
+		return
+	}
+	blmoveGenericCommand(c, wherefrom, whereto, timeout)
+}
+
+func brpoplpushCommand(c *RedisClient) {
+	timeout, ok := getTimeoutFromObjectOrReply(c, c.args[3], UNIT_SECONDS)
+	if !ok {
+		return
+	}
+	blmoveGenericCommand(c, LIST_TAIL, LIST_HEAD, timeout)
+}
+
+// serveClientBlockedOnList pop an element of the list o stored at key for
+// the client blocked on it, return false if the client can't be served
+// because the target of BLMOVE is not a list.
+func serveClientBlockedOnList(receiver *RedisClient, key, o *RedisObj) bool {
+	db, target := receiver.bpop.db, receiver.bpop.target
+	var dobj *RedisObj
+	if target != nil {
+		dobj = lookupKeyWrite(db, target)
+		if dobj != nil && dobj.Type_ != REDISLIST {
+			return false
+		}
+	}
+	val := listTypePop(o, receiver.bpop.wherefrom)
+	if target == nil {
+		receiver.AddReplyArrayLen(2)
+		receiver.AddReplyBulk(key)
+		receiver.AddReplyBulk(val)
+	} else {
+		lmoveHandlePush(db, target, dobj, val, receiver.bpop.whereto)
+		receiver.AddReplyBulk(val)
+	}
+	val.DecrRefCount()
+	return true
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPushPopCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":0\r\n", execCommand(c, "lpushx", "l", "a"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "lpush", "l", "b", "a"))
+	assert.Equal(t, ":4\r\n", execCommand(c, "rpush", "l", "c", "d"))
+	assert.Equal(t, ":5\r\n", execCommand(c, "rpushx", "l", "e"))
+	assert.Equal(t, "*5\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n$1\r\ne\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+	assert.Equal(t, "$1\r\na\r\n", execCommand(c, "lpop", "l"))
+	assert.Equal(t, "*2\r\n$1\r\ne\r\n$1\r\nd\r\n", execCommand(c, "rpop", "l", "2"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "rpop", "l", "0"))
+	assert.Equal(t, "-ERR value is out of range, must be positive\r\n", execCommand(c, "lpop", "l", "-1"))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", execCommand(c, "lpop", "l", "10"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "l"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "lpop", "l"))
+	assert.Equal(t, "*-1\r\n", execCommand(c, "lpop", "l", "1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "llen", "l"))
+
+	execCommand(c, "set", "s", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "lpush", "s", "a"))
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "llen", "s"))
+	execCommand(c, "rpush", "l", "a")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "get", "l"))
+}
+
+func TestLrangeCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "rpush", "l", "a", "b", "c", "d")
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", execCommand(c, "lrange", "l", "1", "2"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n", execCommand(c, "lrange", "l", "-2", "100"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "lrange", "l", "3", "1"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "lrange", "nokey", "0", "-1"))
+	assert.Equal(t, "$1\r\nd\r\n", execCommand(c, "lindex", "l", "-1"))
+	assert.Equal(t, "$1\r\na\r\n", execCommand(c, "lindex", "l", "0"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "lindex", "l", "4"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "lset", "l", "-2", "x"))
+	assert.Equal(t, "$1\r\nx\r\n", execCommand(c, "lindex", "l", "2"))
+	assert.Equal(t, "-ERR index out of range\r\n", execCommand(c, "lset", "l", "4", "x"))
+	assert.Equal(t, "-ERR no such key\r\n", execCommand(c, "lset", "nokey", "0", "x"))
+}
+
+func TestLremCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "rpush", "l", "a", "b", "a", "c", "a")
+	assert.Equal(t, ":1\r\n", execCommand(c, "lrem", "l", "-1", "a"))
+	assert.Equal(t, "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\na\r\n$1\r\nc\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "lrem", "l", "1", "a"))
+	assert.Equal(t, "*3\r\n$1\r\nb\r\n$1\r\na\r\n$1\r\nc\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+	execCommand(c, "rpush", "l", "a")
+	assert.Equal(t, ":2\r\n", execCommand(c, "lrem", "l", "0", "a"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "lrem", "l", "0", "a"))
+	execCommand(c, "lrem", "l", "0", "b")
+	assert.Equal(t, ":1\r\n", execCommand(c, "lrem", "l", "0", "c"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "l"))
+}
+
+func TestLtrimCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "rpush", "l", "a", "b", "a", "c", "a")
+	assert.Equal(t, "+OK\r\n", execCommand(c, "ltrim", "l", "1", "-2"))
+	assert.Equal(t, "*3\r\n$1\r\nb\r\n$1\r\na\r\n$1\r\nc\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "ltrim", "l", "5", "10"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "l"))
+}
+
+func TestLinsertCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":0\r\n", execCommand(c, "linsert", "l", "before", "a", "x"))
+	execCommand(c, "rpush", "l", "a", "b")
+	assert.Equal(t, ":3\r\n", execCommand(c, "linsert", "l", "before", "a", "x"))
+	assert.Equal(t, ":4\r\n", execCommand(c, "linsert", "l", "AFTER", "b", "y"))
+	assert.Equal(t, ":5\r\n", execCommand(c, "linsert", "l", "after", "a", "z"))
+	assert.Equal(t, ":-1\r\n", execCommand(c, "linsert", "l", "after", "nopivot", "z"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "linsert", "l", "middle", "a", "z"))
+	assert.Equal(t, "*5\r\n$1\r\nx\r\n$1\r\na\r\n$1\r\nz\r\n$1\r\nb\r\n$1\r\ny\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+	assert.Equal(t, "$1\r\ny\r\n", execCommand(c, "rpop", "l"))
+}
+
+func TestLposCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "rpush", "l", "a", "b", "c", "1", "2", "3", "c", "c")
+	assert.Equal(t, ":2\r\n", execCommand(c, "lpos", "l", "c"))
+	assert.Equal(t, ":6\r\n", execCommand(c, "lpos", "l", "c", "rank", "2"))
+	assert.Equal(t, ":7\r\n", execCommand(c, "lpos", "l", "c", "rank", "-1"))
+	assert.Equal(t, "*2\r\n:2\r\n:6\r\n", execCommand(c, "lpos", "l", "c", "count", "2"))
+	assert.Equal(t, "*3\r\n:2\r\n:6\r\n:7\r\n", execCommand(c, "lpos", "l", "c", "count", "0"))
+	assert.Equal(t, "*2\r\n:7\r\n:6\r\n", execCommand(c, "lpos", "l", "c", "rank", "-1", "count", "2"))
+	assert.Equal(t, "*1\r\n:2\r\n", execCommand(c, "lpos", "l", "c", "count", "0", "maxlen", "3"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "lpos", "l", "x"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "lpos", "l", "x", "count", "1"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "lpos", "nokey", "x", "count", "1"))
+	assert.Equal(t, "-ERR COUNT can't be negative\r\n", execCommand(c, "lpos", "l", "c", "count", "-1"))
+	assert.Equal(t, "-ERR MAXLEN can't be negative\r\n", execCommand(c, "lpos", "l", "c", "maxlen", "-1"))
+	assert.Contains(t, execCommand(c, "lpos", "l", "c", "rank", "0"), "RANK can't be zero")
+	assert.Equal(t, "-ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807\r\n",
+		execCommand(c, "lpos", "l", "c", "rank", "-9223372036854775808"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "lpos", "l", "c", "rank", "-9223372036854775807"))
+}
+
+func TestLmoveCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "rpush", "src", "a", "b", "c")
+	assert.Equal(t, "$1\r\nc\r\n", execCommand(c, "rpoplpush", "src", "dst"))
+	assert.Equal(t, "$1\r\na\r\n", execCommand(c, "lmove", "src", "dst", "left", "right"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\na\r\n", execCommand(c, "lrange", "dst", "0", "-1"))
+	// rotate the list.
+	assert.Equal(t, "$1\r\nc\r\n", execCommand(c, "lmove", "dst", "dst", "LEFT", "RIGHT"))
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nc\r\n", execCommand(c, "lrange", "dst", "0", "-1"))
+	assert.Equal(t, "$1\r\nb\r\n", execCommand(c, "lmove", "src", "src", "left", "right"))
+	assert.Equal(t, "$1\r\nb\r\n", execCommand(c, "lmove", "src", "dst", "left", "left"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "src"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "lmove", "src", "dst", "left", "left"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "lmove", "dst", "src", "up", "left"))
+	execCommand(c, "set", "s", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "lmove", "dst", "s", "left", "left"))
+	assert.Equal(t, ":3\r\n", execCommand(c, "llen", "dst"))
+}
+
+func TestListCopy(t *testing.T) {
+	c := testClient()
+	execCommand(c, "rpush", "l", "a", "b")
+	assert.Equal(t, ":1\r\n", execCommand(c, "copy", "l", "l2"))
+	execCommand(c, "lset", "l2", "0", "x")
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+	assert.Equal(t, "*2\r\n$1\r\nx\r\n$1\r\nb\r\n", execCommand(c, "lrange", "l2", "0", "-1"))
+}
+
+func TestListEncodingConversion(t *testing.T) {
+	c := testClient()
+	server.listMaxListpackSize = 4
+	execCommand(c, "rpush", "l", "a", "b", "c", "d")
+	assert.Equal(t, "$8\r\nlistpack\r\n", execCommand(c, "object", "encoding", "l"))
+	execCommand(c, "rpush", "l", "e")
+	assert.Equal(t, "$9\r\nquicklist\r\n", execCommand(c, "object", "encoding", "l"))
+	assert.Equal(t, "*5\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n$1\r\ne\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+
+	// the size in bytes with a negative limit.
+	server.listMaxListpackSize = -1
+	long := strings.Repeat("x", 3000)
+	execCommand(c, "rpush", "ins", long)
+	assert.Equal(t, "$8\r\nlistpack\r\n", execCommand(c, "object", "encoding", "ins"))
+	execCommand(c, "linsert", "ins", "before", long, long)
+	assert.Equal(t, "$9\r\nquicklist\r\n", execCommand(c, "object", "encoding", "ins"))
+	execCommand(c, "rpush", "set", "a", long)
+	execCommand(c, "lset", "set", "0", long)
+	assert.Equal(t, "$9\r\nquicklist\r\n", execCommand(c, "object", "encoding", "set"))
+	assert.True(t, execCommand(c, "lindex", "set", "0") == "$3000\r\n"+long+"\r\n")
+}
+
+// TestListEncodings run the same commands on a listpack, a quicklist and a
+// compressed quicklist.
+func TestListEncodings(t *testing.T) {
+	for _, opt := range [][2]int{{-2, 0}, {1, 0}, {1, 1}} {
+		c := testClient()
+		server.listMaxListpackSize, server.listCompressDepth = opt[0], opt[1]
+		execCommand(c, "rpush", "l", "1", "b", "c", "b", "300", "b")
+		assert.Equal(t, "*6\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nb\r\n$3\r\n300\r\n$1\r\nb\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+		assert.Equal(t, "$3\r\n300\r\n", execCommand(c, "lindex", "l", "-2"))
+		assert.Equal(t, "*2\r\n:1\r\n:3\r\n", execCommand(c, "lpos", "l", "b", "count", "2"))
+		assert.Equal(t, ":5\r\n", execCommand(c, "lpos", "l", "b", "rank", "-1"))
+		assert.Equal(t, ":2\r\n", execCommand(c, "lrem", "l", "-2", "b"))
+		assert.Equal(t, "*4\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\nc\r\n$3\r\n300\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+		assert.Equal(t, ":5\r\n", execCommand(c, "linsert", "l", "after", "300", "d"))
+		assert.Equal(t, "+OK\r\n", execCommand(c, "lset", "l", "0", "a"))
+		assert.Equal(t, "$1\r\na\r\n", execCommand(c, "lpop", "l"))
+		assert.Equal(t, "$1\r\nd\r\n", execCommand(c, "rpop", "l"))
+		assert.Equal(t, "+OK\r\n", execCommand(c, "ltrim", "l", "1", "-1"))
+		assert.Equal(t, "*2\r\n$1\r\nc\r\n$3\r\n300\r\n", execCommand(c, "lrange", "l", "0", "-1"))
+		assert.Equal(t, ":1\r\n", execCommand(c, "copy", "l", "l2"))
+		assert.Equal(t, ":1\r\n", execCommand(c, "lrem", "l2", "0", "300"))
+		assert.Equal(t, ":2\r\n", execCommand(c, "llen", "l"))
+	}
+}
+
+func TestListCompressDepth(t *testing.T) {
+	c := testClient()
+	server.listMaxListpackSize, server.listCompressDepth = 4, 1
+	key := CreateObject(REDISSTR, "l")
+	var args []string
+	for i := 0; i < 100; i++ {
+		args = append(args, strings.Repeat("x", 20)+strconv.Itoa(i))
+	}
+	execCommand(c, append([]string{"rpush", "l"}, args...)...)
+	assert.Equal(t, "$9\r\nquicklist\r\n", execCommand(c, "object", "encoding", "l"))
+	ql := c.db.data.DictGet(key).Val_.(*Quicklist)
+	assert.NotNil(t, ql.head.lp)
+	assert.NotNil(t, ql.tail.lp)
+	assert.Nil(t, ql.head.next.lp)
+
+	elem := args[50]
+	assert.Equal(t, "$"+strconv.Itoa(len(elem))+"\r\n"+elem+"\r\n", execCommand(c, "lindex", "l", "50"))
+	assert.Equal(t, ":50\r\n", execCommand(c, "lpos", "l", elem))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "lset", "l", "50", "y"))
+	assert.Equal(t, ":101\r\n", execCommand(c, "linsert", "l", "before", "y", "z"))
+	assert.Equal(t, "*3\r\n$1\r\nz\r\n$1\r\ny\r\n$"+strconv.Itoa(len(args[51]))+"\r\n"+args[51]+"\r\n",
+		execCommand(c, "lrange", "l", "50", "52"))
+	// the interior nodes are compressed again after being accessed.
+	assert.Nil(t, ql.head.next.lp)
+	assert.Equal(t, ":101\r\n", execCommand(c, "llen", "l"))
+}
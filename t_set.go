@@ -0,0 +1,537 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// operations of sunionDiffGenericCommand and zunionInterGenericCommand.
+const (
+	SET_OP_UNION int = 0
+	SET_OP_DIFF  int = 1
+	SET_OP_INTER int = 2
+)
+
+func setTypeSize(o *RedisObj) int64 {
+	return o.Val_.(*Dict).DictSize()
+}
+
+// setTypeAdd return true if member is added, false if it's already a member.
+func setTypeAdd(o *RedisObj, member *RedisObj) bool {
+	return o.Val_.(*Dict).DictAdd(member, nil) == nil
+}
+
+// setTypeRemove return true if member is removed.
+func setTypeRemove(o *RedisObj, member *RedisObj) bool {
+	return o.Val_.(*Dict).DictDelete(member) == nil
+}
+
+func setTypeIsMember(o *RedisObj, member *RedisObj) bool {
+	return o.Val_.(*Dict).DictFind(member) != nil
+}
+
+// setTypeRandomElement return a random member, the set must not be empty.
+func setTypeRandomElement(o *RedisObj) *RedisObj {
+	return o.Val_.(*Dict).DictGetRandomKey().Key
+}
+
+// setTypeMembers return all the members of the set.
+func setTypeMembers(o *RedisObj) []*RedisObj {
+	members := make([]*RedisObj, 0, setTypeSize(o))
+	di := o.Val_.(*Dict).DictGetIterator()
+	for de := di.DictNext(); de != nil; de = di.DictNext() {
+		members = append(members, de.Key)
+	}
+	di.DictReleaseIterator()
+	return members
+}
+
+func setTypeDup(o *RedisObj) *RedisObj {
+	dup := createSetObject()
+	for _, member := range setTypeMembers(o) {
+		setTypeAdd(dup, member)
+	}
+	return dup
+}
+
+// saddCommand implement SADD key member [member ...]
+func saddCommand(c *RedisClient) {
+	key := c.args[1]
+	set := lookupKeyWrite(c.db, key)
+	if set != nil && checkType(c, set, REDISSET) {
+		return
+	}
+	if set == nil {
+		set = createSetObject()
+		dbAdd(c.db, key, set)
+		set.DecrRefCount()
+	}
+	var added int64
+	for _, member := range c.args[2:] {
+		if setTypeAdd(set, member) {
+			added++
+		}
+	}
+	c.AddReplyInt(added)
+}
+
+// sremCommand implement SREM key member [member ...], the key is deleted
+// when the set is empty.
+func sremCommand(c *RedisClient) {
+	key := c.args[1]
+	set := lookupKeyWriteOrReply(c, key, shared.czero)
+	if set == nil || checkType(c, set, REDISSET) {
+		return
+	}
+	var deleted int64
+	for _, member := range c.args[2:] {
+		if setTypeRemove(set, member) {
+			deleted++
+			if setTypeSize(set) == 0 {
+				dbDelete(c.db, key)
+				break
+			}
+		}
+	}
+	c.AddReplyInt(deleted)
+}
+
+func sismemberCommand(c *RedisClient) {
+	set := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if set == nil || checkType(c, set, REDISSET) {
+		return
+	}
+	if setTypeIsMember(set, c.args[2]) {
+		c.AddReply(shared.cone)
+	} else {
+		c.AddReply(shared.czero)
+	}
+}
+
+// smismemberCommand implement SMISMEMBER key member [member ...], a missing
+// key is handled as an empty set.
+func smismemberCommand(c *RedisClient) {
+	set := lookupKeyRead(c.db, c.args[1])
+	if set != nil && checkType(c, set, REDISSET) {
+		return
+	}
+	c.AddReplyArrayLen(len(c.args) - 2)
+	for _, member := range c.args[2:] {
+		if set != nil && setTypeIsMember(set, member) {
+			c.AddReply(shared.cone)
+		} else {
+			c.AddReply(shared.czero)
+		}
+	}
+}
+
+func scardCommand(c *RedisClient) {
+	set := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if set == nil || checkType(c, set, REDISSET) {
+		return
+	}
+	c.AddReplyInt(setTypeSize(set))
+}
+
+// smoveCommand implement SMOVE source destination member
+func smoveCommand(c *RedisClient) {
+	src, dst, member := c.args[1], c.args[2], c.args[3]
+	srcset := lookupKeyWrite(c.db, src)
+	dstset := lookupKeyWrite(c.db, dst)
+	if srcset == nil {
+		c.AddReply(shared.czero)
+		return
+	}
+	if checkType(c, srcset, REDISSET) || (dstset != nil && checkType(c, dstset, REDISSET)) {
+		return
+	}
+	// the member is already in place.
+	if srcset == dstset {
+		if setTypeIsMember(srcset, member) {
+			c.AddReply(shared.cone)
+		} else {
+			c.AddReply(shared.czero)
+		}
+		return
+	}
+	if !setTypeRemove(srcset, member) {
+		c.AddReply(shared.czero)
+		return
+	}
+	if setTypeSize(srcset) == 0 {
+		dbDelete(c.db, src)
+	}
+	if dstset == nil {
+		dstset = createSetObject()
+		dbAdd(c.db, dst, dstset)
+		dstset.DecrRefCount()
+	}
+	setTypeAdd(dstset, member)
+	c.AddReply(shared.cone)
+}
+
+// spopWithCountCommand remove and reply up to count random members.
+func spopWithCountCommand(c *RedisClient) {
+	count, ok := getLongLongFromObjectOrReply(c, c.args[2], "value is out of range, must be positive")
+	if !ok {
+		return
+	}
+	if count < 0 {
+		c.AddReplyError("value is out of range, must be positive")
+		return
+	}
+	key := c.args[1]
+	set := lookupKeyWriteOrReply(c, key, shared.emptyArray)
+	if set == nil || checkType(c, set, REDISSET) {
+		return
+	}
+	if count == 0 {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+
+	// the whole set is popped.
+	size := setTypeSize(set)
+	if count >= size {
+		members := setTypeMembers(set)
+		c.AddReplyArrayLen(len(members))
+		for _, member := range members {
+			c.AddReplyBulk(member)
+		}
+		dbDelete(c.db, key)
+		return
+	}
+
+	c.AddReplyArrayLen(int(count))
+	for ; count > 0; count-- {
+		member := setTypeRandomElement(set)
+		c.AddReplyBulk(member)
+		setTypeRemove(set, member)
+	}
+}
+
+// spopCommand implement SPOP key [count]
+func spopCommand(c *RedisClient) {
+	if len(c.args) == 3 {
+		spopWithCountCommand(c)
+		return
+	} else if len(c.args) > 3 {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	key := c.args[1]
+	set := lookupKeyWriteOrReply(c, key, shared.nullBulk)
+	if set == nil || checkType(c, set, REDISSET) {
+		return
+	}
+	member := setTypeRandomElement(set)
+	c.AddReplyBulk(member)
+	setTypeRemove(set, member)
+	if setTypeSize(set) == 0 {
+		dbDelete(c.db, key)
+	}
+}
+
+// srandmemberWithCountCommand reply count random members. A positive count
+// returns distinct members, a negative count may return the same member many
+// times and the reply has exactly -count members.
+func srandmemberWithCountCommand(c *RedisClient) {
+	count, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	// -count must not overflow.
+	if count == math.MinInt64 {
+		c.AddReplyError("value is out of range")
+		return
+	}
+	set := lookupKeyReadOrReply(c, c.args[1], shared.emptyArray)
+	if set == nil || checkType(c, set, REDISSET) {
+		return
+	}
+	if count == 0 {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+
+	// the same member can be returned multiple times.
+	if count < 0 {
+		count = -count
+		c.AddReplyArrayLen(int(count))
+		for ; count > 0; count-- {
+			c.AddReplyBulk(setTypeRandomElement(set))
+		}
+		return
+	}
+
+	// the whole set is returned.
+	size := setTypeSize(set)
+	if count >= size {
+		members := setTypeMembers(set)
+		c.AddReplyArrayLen(len(members))
+		for _, member := range members {
+			c.AddReplyBulk(member)
+		}
+		return
+	}
+
+	// count is close to the size of the set, shuffle all the members and
+	// take the first count of them, otherwise pick random members until
+	// there are count distinct ones.
+	c.AddReplyArrayLen(int(count))
+	if count*3 > size {
+		members := setTypeMembers(set)
+		for i := int64(0); i < count; i++ {
+			j := i + rand.Int63n(size-i)
+			members[i], members[j] = members[j], members[i]
+			c.AddReplyBulk(members[i])
+		}
+		return
+	}
+	picked := make(map[*RedisObj]struct{}, count)
+	for int64(len(picked)) < count {
+		member := setTypeRandomElement(set)
+		if _, ok := picked[member]; ok {
+			continue
+		}
+		picked[member] = struct{}{}
+		c.AddReplyBulk(member)
+	}
+}
+
+// srandmemberCommand implement SRANDMEMBER key [count]
+func srandmemberCommand(c *RedisClient) {
+	if len(c.args) == 3 {
+		srandmemberWithCountCommand(c)
+		return
+	} else if len(c.args) > 3 {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	set := lookupKeyReadOrReply(c, c.args[1], shared.nullBulk)
+	if set == nil || checkType(c, set, REDISSET) {
+		return
+	}
+	c.AddReplyBulk(setTypeRandomElement(set))
+}
+
+// lookupSetsOrReply return the sets at keys, nil for the missing keys. ok is
+// false if a key is not a set and WRONGTYPE has been replied.
+func lookupSetsOrReply(c *RedisClient, keys []*RedisObj, write bool) ([]*RedisObj, bool) {
+	sets := make([]*RedisObj, len(keys))
+	for i, key := range keys {
+		if write {
+			sets[i] = lookupKeyWrite(c.db, key)
+		} else {
+			sets[i] = lookupKeyRead(c.db, key)
+		}
+		if sets[i] != nil && checkType(c, sets[i], REDISSET) {
+			return nil, false
+		}
+	}
+	return sets, true
+}
+
+// sinterSets return the intersection of sets, stopping once limit members
+// are found if limit is not 0. A missing set is handled as an empty set.
+func sinterSets(sets []*RedisObj, limit int64) *RedisObj {
+	result := createSetObject()
+	for _, set := range sets {
+		if set == nil {
+			return result
+		}
+	}
+	// iterate the smallest set and check the others.
+	sorted := make([]*RedisObj, len(sets))
+	copy(sorted, sets)
+	sort.Slice(sorted, func(i, j int) bool {
+		return setTypeSize(sorted[i]) < setTypeSize(sorted[j])
+	})
+	for _, member := range setTypeMembers(sorted[0]) {
+		found := true
+		for _, set := range sorted[1:] {
+			if !setTypeIsMember(set, member) {
+				found = false
+				break
+			}
+		}
+		if found {
+			setTypeAdd(result, member)
+			if limit != 0 && setTypeSize(result) == limit {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// sunionDiffSets return the union of sets, or the members of the first set
+// not in the others. A missing set is handled as an empty set.
+func sunionDiffSets(sets []*RedisObj, op int) *RedisObj {
+	result := createSetObject()
+	if op == SET_OP_DIFF {
+		if sets[0] == nil {
+			return result
+		}
+		for _, member := range setTypeMembers(sets[0]) {
+			found := false
+			for _, set := range sets[1:] {
+				if set != nil && setTypeIsMember(set, member) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				setTypeAdd(result, member)
+			}
+		}
+		return result
+	}
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		for _, member := range setTypeMembers(set) {
+			setTypeAdd(result, member)
+		}
+	}
+	return result
+}
+
+// storeSetResult set dstkey to result, or delete it if result is empty, and
+// reply the size of result.
+func storeSetResult(c *RedisClient, dstkey *RedisObj, result *RedisObj) {
+	size := setTypeSize(result)
+	if size > 0 {
+		setKey(c.db, dstkey, result, false)
+	} else {
+		dbDelete(c.db, dstkey)
+	}
+	result.DecrRefCount()
+	c.AddReplyInt(size)
+}
+
+func replySetMembers(c *RedisClient, set *RedisObj) {
+	members := setTypeMembers(set)
+	c.AddReplyArrayLen(len(members))
+	for _, member := range members {
+		c.AddReplyBulk(member)
+	}
+}
+
+// sinterGenericCommand implement SINTER and SINTERSTORE, dstkey is nil
+// if the result is replied to the client.
+func sinterGenericCommand(c *RedisClient, keys []*RedisObj, dstkey *RedisObj) {
+	sets, ok := lookupSetsOrReply(c, keys, dstkey != nil)
+	if !ok {
+		return
+	}
+	result := sinterSets(sets, 0)
+	if dstkey != nil {
+		storeSetResult(c, dstkey, result)
+		return
+	}
+	replySetMembers(c, result)
+	result.DecrRefCount()
+}
+
+// sunionDiffGenericCommand implement SUNION, SDIFF and their STORE variants,
+// dstkey is nil if the result is replied to the client.
+func sunionDiffGenericCommand(c *RedisClient, keys []*RedisObj, dstkey *RedisObj, op int) {
+	sets, ok := lookupSetsOrReply(c, keys, dstkey != nil)
+	if !ok {
+		return
+	}
+	result := sunionDiffSets(sets, op)
+	if dstkey != nil {
+		storeSetResult(c, dstkey, result)
+		return
+	}
+	replySetMembers(c, result)
+	result.DecrRefCount()
+}
+
+// smembersCommand implement SMEMBERS key, which is SINTER with one key.
+func smembersCommand(c *RedisClient) {
+	sinterGenericCommand(c, c.args[1:], nil)
+}
+
+func sinterCommand(c *RedisClient) {
+	sinterGenericCommand(c, c.args[1:], nil)
+}
+
+// sinterstoreCommand implement SINTERSTORE destination key [key ...]
+func sinterstoreCommand(c *RedisClient) {
+	sinterGenericCommand(c, c.args[2:], c.args[1])
+}
+
+func sunionCommand(c *RedisClient) {
+	sunionDiffGenericCommand(c, c.args[1:], nil, SET_OP_UNION)
+}
+
+func sunionstoreCommand(c *RedisClient) {
+	sunionDiffGenericCommand(c, c.args[2:], c.args[1], SET_OP_UNION)
+}
+
+func sdiffCommand(c *RedisClient) {
+	sunionDiffGenericCommand(c, c.args[1:], nil, SET_OP_DIFF)
+}
+
+func sdiffstoreCommand(c *RedisClient) {
+	sunionDiffGenericCommand(c, c.args[2:], c.args[1], SET_OP_DIFF)
+}
+
+// sintercardCommand implement SINTERCARD numkeys key [key ...] [LIMIT limit]
+func sintercardCommand(c *RedisClient) {
+	numkeys, ok := getLongLongFromObjectOrReply(c, c.args[1], "")
+	if !ok {
+		return
+	}
+	if numkeys <= 0 {
+		c.AddReplyError("numkeys should be greater than 0")
+		return
+	}
+	if numkeys > int64(len(c.args)-2) {
+		c.AddReplyError("Number of keys can't be greater than number of args")
+		return
+	}
+	var limit int64
+	for i := 2 + int(numkeys); i < len(c.args); i++ {
+		if strings.ToLower(c.args[i].StrVal()) == "limit" && i+1 < len(c.args) {
+			i++
+			if limit, ok = getLongLongFromObjectOrReply(c, c.args[i], ""); !ok {
+				return
+			}
+			if limit < 0 {
+				c.AddReplyError("LIMIT can't be negative")
+				return
+			}
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+
+	sets, ok := lookupSetsOrReply(c, c.args[2:2+numkeys], false)
+	if !ok {
+		return
+	}
+	result := sinterSets(sets, limit)
+	c.AddReplyInt(setTypeSize(result))
+	result.DecrRefCount()
+}
+
+// sscanCommand implement SSCAN key cursor [MATCH pattern] [COUNT count]
+func sscanCommand(c *RedisClient) {
+	cursor, ok := parseScanCursorOrReply(c, c.args[2])
+	if !ok {
+		return
+	}
+	set := lookupKeyReadOrReply(c, c.args[1], shared.emptyScan)
+	if set == nil || checkType(c, set, REDISSET) {
+		return
+	}
+	scanGenericCommand(c, set, cursor)
+}
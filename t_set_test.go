@@ -0,0 +1,140 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// replyMembers return the sorted bulk strings of an array reply.
+func replyMembers(reply string) []string {
+	parts := strings.Split(reply, "\r\n")
+	var members []string
+	for i := 1; i+1 < len(parts); i += 2 {
+		members = append(members, parts[i+1])
+	}
+	sort.Strings(members)
+	return members
+}
+
+func TestSaddSremCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":3\r\n", execCommand(c, "sadd", "s", "a", "b", "c", "a"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "sadd", "s", "a", "d"))
+	assert.Equal(t, ":4\r\n", execCommand(c, "scard", "s"))
+	assert.Equal(t, "+set\r\n", execCommand(c, "type", "s"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "sismember", "s", "a"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "sismember", "s", "x"))
+	assert.Equal(t, "*3\r\n:1\r\n:0\r\n:1\r\n", execCommand(c, "smismember", "s", "a", "x", "d"))
+	assert.Equal(t, "*1\r\n:0\r\n", execCommand(c, "smismember", "nokey", "a"))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, replyMembers(execCommand(c, "smembers", "s")))
+	assert.Equal(t, "*0\r\n", execCommand(c, "smembers", "nokey"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "srem", "s", "a", "b", "x"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "srem", "s", "c", "d"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "s"))
+
+	execCommand(c, "set", "str", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "sadd", "str", "a"))
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "smembers", "str"))
+}
+
+func TestSmoveCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "sadd", "src", "a", "b")
+	assert.Equal(t, ":1\r\n", execCommand(c, "smove", "src", "dst", "a"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "smove", "src", "dst", "a"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "smove", "src", "src", "b"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "smove", "src", "dst", "b"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "src"))
+	assert.Equal(t, []string{"a", "b"}, replyMembers(execCommand(c, "smembers", "dst")))
+	assert.Equal(t, ":0\r\n", execCommand(c, "smove", "nokey", "dst", "a"))
+	execCommand(c, "set", "str", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "smove", "dst", "str", "a"))
+}
+
+func TestSpopSrandmemberCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "$-1\r\n", execCommand(c, "spop", "s"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "spop", "s", "2"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "srandmember", "s"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "srandmember", "s", "2"))
+
+	execCommand(c, "sadd", "s", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9")
+	for _, count := range []string{"2", "8"} {
+		members := replyMembers(execCommand(c, "srandmember", "s", count))
+		assert.Equal(t, count, strconv.Itoa(len(members)))
+		for i := 1; i < len(members); i++ {
+			assert.NotEqual(t, members[i-1], members[i])
+		}
+	}
+	assert.Equal(t, 10, len(replyMembers(execCommand(c, "srandmember", "s", "20"))))
+	assert.True(t, strings.HasPrefix(execCommand(c, "srandmember", "s", "-20"), "*20\r\n"))
+	assert.Equal(t, "-ERR value is out of range\r\n", execCommand(c, "srandmember", "s", "-9223372036854775808"))
+	assert.Equal(t, 10, len(replyMembers(execCommand(c, "srandmember", "s", "9223372036854775807"))))
+	assert.True(t, strings.HasPrefix(execCommand(c, "srandmember", "s"), "$1\r\n"))
+
+	assert.True(t, strings.HasPrefix(execCommand(c, "spop", "s"), "$1\r\n"))
+	assert.Equal(t, 3, len(replyMembers(execCommand(c, "spop", "s", "3"))))
+	assert.Equal(t, ":6\r\n", execCommand(c, "scard", "s"))
+	assert.Equal(t, "-ERR value is out of range, must be positive\r\n", execCommand(c, "spop", "s", "-1"))
+	assert.Equal(t, 6, len(replyMembers(execCommand(c, "spop", "s", "10"))))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "s"))
+}
+
+func TestSetAlgebraCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "sadd", "s1", "a", "b", "c", "d")
+	execCommand(c, "sadd", "s2", "c", "d", "e")
+	execCommand(c, "sadd", "s3", "a", "c", "e")
+	assert.Equal(t, []string{"c"}, replyMembers(execCommand(c, "sinter", "s1", "s2", "s3")))
+	assert.Equal(t, "*0\r\n", execCommand(c, "sinter", "s1", "nokey"))
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, replyMembers(execCommand(c, "sunion", "s1", "s2", "nokey")))
+	assert.Equal(t, []string{"b"}, replyMembers(execCommand(c, "sdiff", "s1", "s2", "s3")))
+	assert.Equal(t, "*0\r\n", execCommand(c, "sdiff", "nokey", "s1"))
+
+	assert.Equal(t, ":2\r\n", execCommand(c, "sinterstore", "dst", "s1", "s2"))
+	assert.Equal(t, []string{"c", "d"}, replyMembers(execCommand(c, "smembers", "dst")))
+	assert.Equal(t, ":5\r\n", execCommand(c, "sunionstore", "dst", "s1", "s2"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "sdiffstore", "s1", "s1", "s2"))
+	assert.Equal(t, []string{"a", "b"}, replyMembers(execCommand(c, "smembers", "s1")))
+	assert.Equal(t, ":0\r\n", execCommand(c, "sinterstore", "dst", "s1", "s2"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "dst"))
+
+	execCommand(c, "set", "str", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "sunion", "s1", "str"))
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "sinter", "nokey", "str"))
+}
+
+func TestSintercardCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "sadd", "s1", "a", "b", "c", "d")
+	execCommand(c, "sadd", "s2", "b", "c", "d", "e")
+	assert.Equal(t, ":3\r\n", execCommand(c, "sintercard", "2", "s1", "s2"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "sintercard", "2", "s1", "s2", "limit", "2"))
+	assert.Equal(t, ":3\r\n", execCommand(c, "sintercard", "2", "s1", "s2", "limit", "0"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "sintercard", "2", "s1", "nokey"))
+	assert.Equal(t, "-ERR numkeys should be greater than 0\r\n", execCommand(c, "sintercard", "0", "s1"))
+	assert.Equal(t, "-ERR Number of keys can't be greater than number of args\r\n", execCommand(c, "sintercard", "3", "s1", "s2"))
+	assert.Equal(t, "-ERR LIMIT can't be negative\r\n", execCommand(c, "sintercard", "1", "s1", "limit", "-1"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "sintercard", "1", "s1", "s2"))
+}
+
+func TestSscanCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "*2\r\n$1\r\n0\r\n*0\r\n", execCommand(c, "sscan", "s", "0"))
+	execCommand(c, "sadd", "s", "a1", "a2", "b1")
+	reply := execCommand(c, "sscan", "s", "0", "match", "a*")
+	assert.True(t, strings.HasPrefix(reply, "*2\r\n$1\r\n0\r\n*2\r\n"))
+	assert.Equal(t, []string{"a1", "a2"}, replyMembers(strings.TrimPrefix(reply, "*2\r\n$1\r\n0\r\n")))
+}
+
+func TestSetCopy(t *testing.T) {
+	c := testClient()
+	execCommand(c, "sadd", "s", "a")
+	assert.Equal(t, ":1\r\n", execCommand(c, "copy", "s", "s2"))
+	execCommand(c, "sadd", "s2", "b")
+	assert.Equal(t, ":1\r\n", execCommand(c, "scard", "s"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "scard", "s2"))
+}
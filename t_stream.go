@@ -0,0 +1,1450 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// flags of streamReplyWithRange.
+const (
+	STREAM_RWR_NOACK      int = 1 << 0 // don't add the delivered entries to the PEL.
+	STREAM_RWR_RAWENTRIES int = 1 << 1 // reply the entries without the array length.
+	STREAM_RWR_HISTORY    int = 1 << 2 // reply the consumer PEL, not the new entries.
+)
+
+// XAUTOCLAIM scans at most count*XAUTOCLAIM_ATTEMPTS_FACTOR pending entries.
+const XAUTOCLAIM_ATTEMPTS_FACTOR int64 = 10
+
+// streamGenericParseIDOrReply parse an ID as ms-seq, or as ms with the
+// sequence missingSeq. "-" and "+" are the smallest and the greatest IDs
+// unless strict. If seqGiven is not nil "ms-*" is accepted too, and
+// seqGiven tells whether the sequence was given. The error is replied only
+// if c is not nil.
+func streamGenericParseIDOrReply(c *RedisClient, o *RedisObj, missingSeq uint64, strict bool, seqGiven *bool) (streamID, bool) {
+	invalid := func() (streamID, bool) {
+		if c != nil {
+			c.AddReplyError("Invalid stream ID specified as stream command argument")
+		}
+		return streamID{}, false
+	}
+	str := o.StrVal()
+	if seqGiven != nil {
+		*seqGiven = true
+	}
+	if str == "-" || str == "+" {
+		if strict {
+			return invalid()
+		}
+		if str == "-" {
+			return streamID{}, true
+		}
+		return streamMaxID, true
+	}
+	msStr, seqStr, hasSeq := strings.Cut(str, "-")
+	ms, err := strconv.ParseUint(msStr, 10, 64)
+	if err != nil {
+		return invalid()
+	}
+	seq := missingSeq
+	if hasSeq {
+		if seqGiven != nil && seqStr == "*" {
+			seq = 0
+			*seqGiven = false
+		} else if seq, err = strconv.ParseUint(seqStr, 10, 64); err != nil {
+			return invalid()
+		}
+	}
+	return streamID{ms: ms, seq: seq}, true
+}
+
+func streamParseIDOrReply(c *RedisClient, o *RedisObj, missingSeq uint64) (streamID, bool) {
+	return streamGenericParseIDOrReply(c, o, missingSeq, false, nil)
+}
+
+// streamParseStrictIDOrReply parse an ID like streamParseIDOrReply, but
+// "-" and "+" are not accepted.
+func streamParseStrictIDOrReply(c *RedisClient, o *RedisObj, missingSeq uint64, seqGiven *bool) (streamID, bool) {
+	return streamGenericParseIDOrReply(c, o, missingSeq, true, seqGiven)
+}
+
+// streamParseIntervalIDOrReply parse a bound of a range, an ID starting
+// with "(" is exclusive.
+func streamParseIntervalIDOrReply(c *RedisClient, o *RedisObj, missingSeq uint64) (streamID, bool, bool) {
+	str := o.StrVal()
+	if len(str) > 1 && str[0] == '(' {
+		t := CreateObject(REDISSTR, str[1:])
+		id, ok := streamParseStrictIDOrReply(c, t, missingSeq, nil)
+		t.DecrRefCount()
+		return id, true, ok
+	}
+	id, ok := streamParseIDOrReply(c, o, missingSeq)
+	return id, false, ok
+}
+
+// streamParseRangeOrReply parse the start and the end of a range, the
+// exclusive bounds are converted to inclusive ones.
+func streamParseRangeOrReply(c *RedisClient, startArg, endArg *RedisObj) (streamID, streamID, bool) {
+	start, startex, ok := streamParseIntervalIDOrReply(c, startArg, 0)
+	if !ok {
+		return start, start, false
+	}
+	if startex {
+		if start, ok = streamIncrID(start); !ok {
+			c.AddReplyError("invalid start ID for the interval")
+			return start, start, false
+		}
+	}
+	end, endex, ok := streamParseIntervalIDOrReply(c, endArg, streamMaxID.seq)
+	if !ok {
+		return start, end, false
+	}
+	if endex {
+		if end, ok = streamDecrID(end); !ok {
+			c.AddReplyError("invalid end ID for the interval")
+			return start, end, false
+		}
+	}
+	return start, end, true
+}
+
+// streamParseAddOrTrimArgsOrReply parse the trimming options of XADD and
+// XTRIM, and NOMKSTREAM and the ID of XADD. Return the index of the ID of
+// XADD, or -1 on error.
+func streamParseAddOrTrimArgsOrReply(c *RedisClient, args *streamAddTrimArgs, xadd bool) int {
+	*args = streamAddTrimArgs{}
+	limitGiven := false
+	i := 2
+	for ; i < len(c.args); i++ {
+		moreargs := len(c.args) - 1 - i
+		opt := strings.ToLower(c.args[i].StrVal())
+		if xadd && opt == "*" {
+			break
+		} else if (opt == "maxlen" || opt == "minid") && moreargs > 0 {
+			if args.trimStrategy != TRIM_STRATEGY_NONE {
+				c.AddReplyError("syntax error, MAXLEN and MINID options at the same time are not compatible")
+				return -1
+			}
+			args.approxTrim = false
+			next := c.args[i+1].StrVal()
+			if moreargs >= 2 && (next == "~" || next == "=") {
+				args.approxTrim = next == "~"
+				i++
+			}
+			i++
+			if opt == "maxlen" {
+				var ok bool
+				if args.maxlen, ok = getLongLongFromObjectOrReply(c, c.args[i], ""); !ok {
+					return -1
+				}
+				if args.maxlen < 0 {
+					c.AddReplyError("The MAXLEN argument must be >= 0.")
+					return -1
+				}
+				args.trimStrategy = TRIM_STRATEGY_MAXLEN
+			} else {
+				var ok bool
+				if args.minid, ok = streamParseStrictIDOrReply(c, c.args[i], 0, nil); !ok {
+					return -1
+				}
+				args.trimStrategy = TRIM_STRATEGY_MINID
+			}
+		} else if opt == "limit" && moreargs > 0 {
+			var ok bool
+			i++
+			if args.limit, ok = getLongLongFromObjectOrReply(c, c.args[i], ""); !ok {
+				return -1
+			}
+			if args.limit < 0 {
+				c.AddReplyError("The LIMIT argument must be >= 0.")
+				return -1
+			}
+			limitGiven = true
+		} else if xadd && opt == "nomkstream" {
+			args.noMkStream = true
+		} else if xadd {
+			// it's the ID, or a syntax error.
+			var ok bool
+			if args.id, ok = streamParseStrictIDOrReply(c, c.args[i], 0, &args.seqGiven); !ok {
+				return -1
+			}
+			args.idGiven = true
+			break
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return -1
+		}
+	}
+
+	if limitGiven && args.trimStrategy == TRIM_STRATEGY_NONE {
+		c.AddReplyError("syntax error, LIMIT cannot be used without specifying a trimming strategy")
+		return -1
+	}
+	if !xadd && args.trimStrategy == TRIM_STRATEGY_NONE {
+		c.AddReplyError("syntax error, XTRIM must be called with a trimming strategy")
+		return -1
+	}
+	if limitGiven && !args.approxTrim {
+		c.AddReplyError("syntax error, LIMIT cannot be used without the special ~ option")
+		return -1
+	}
+	// an approximated trim is limited by default, so it can't take too long.
+	if !limitGiven && args.approxTrim {
+		args.limit = 100 * int64(server.streamNodeMaxEntries)
+		if args.limit <= 0 {
+			args.limit = 10000
+		}
+	}
+	return i
+}
+
+// streamTypeLookupWriteOrCreate return the stream at key, creating it
+// unless noCreate. Reply a null bulk if the key doesn't exist and noCreate,
+// or WRONGTYPE if key is not a stream, and return nil.
+func streamTypeLookupWriteOrCreate(c *RedisClient, key *RedisObj, noCreate bool) *RedisObj {
+	o := lookupKeyWrite(c.db, key)
+	if o != nil {
+		if checkType(c, o, REDISSTREAM) {
+			return nil
+		}
+		return o
+	}
+	if noCreate {
+		c.AddReply(shared.nullBulk)
+		return nil
+	}
+	o = createStreamObject()
+	dbAdd(c.db, key, o)
+	o.DecrRefCount()
+	return o
+}
+
+func addReplyStreamID(c *RedisClient, id streamID) {
+	c.AddReplyBulkStr(id.String())
+}
+
+// addReplyStreamEntry reply an entry as its ID and the array of its fields
+// and values.
+func addReplyStreamEntry(c *RedisClient, id streamID, fields, values []string) {
+	c.AddReplyArrayLen(2)
+	addReplyStreamID(c, id)
+	c.AddReplyArrayLen(len(fields) * 2)
+	for i := range fields {
+		c.AddReplyBulkStr(fields[i])
+		c.AddReplyBulkStr(values[i])
+	}
+}
+
+// streamEntryExists report whether the entry with id exists.
+func streamEntryExists(s *stream, id streamID) bool {
+	si := streamIteratorStart(s, &id, &id, false)
+	_, _, _, found := si.streamIteratorGetID()
+	return found
+}
+
+// streamReplyWithRange reply the entries from start to end, at most count
+// of them unless count is 0, and return the number of entries. With a
+// group the entries are delivered to consumer: the last ID of the group
+// moves forward, and the entries are added to the PEL unless NOACK. With
+// STREAM_RWR_HISTORY the entries pending for the consumer are replied.
+func streamReplyWithRange(c *RedisClient, s *stream, start, end *streamID, count int64, rev bool, group *streamCG, consumer *streamConsumer, flags int) int64 {
+	if group != nil && flags&STREAM_RWR_HISTORY != 0 {
+		return streamReplyWithRangeFromConsumerPEL(c, s, start, end, count, consumer)
+	}
+	var node *ListNode
+	if flags&STREAM_RWR_RAWENTRIES == 0 {
+		node = c.AddDeferredArrayLen()
+	}
+	var arraylen int64
+	now := GetMsTime()
+	si := streamIteratorStart(s, start, end, rev)
+	for count == 0 || arraylen < count {
+		id, fields, values, ok := si.streamIteratorGetID()
+		if !ok {
+			break
+		}
+		if group != nil && streamCompareID(id, group.lastID) > 0 {
+			// the counter stays valid while no entry after id was deleted.
+			if group.entriesRead != SCG_INVALID_ENTRIES_READ && !streamRangeHasTombstones(s, &id, nil) {
+				group.entriesRead++
+			} else if s.entriesAdded > 0 {
+				group.entriesRead = streamEstimateDistanceFromFirstEverEntry(s, id)
+			}
+			group.lastID = id
+		}
+		addReplyStreamEntry(c, id, fields, values)
+		arraylen++
+
+		if group != nil && flags&STREAM_RWR_NOACK == 0 {
+			// an entry already pending, e.g. after XGROUP SETID, is moved to
+			// the consumer.
+			key := streamEncodeID(id)
+			nack := &streamNACK{deliveryTime: now, deliveryCount: 1, consumer: consumer}
+			if !group.pel.RaxTryInsert(key, nack) {
+				found, _ := group.pel.RaxFind(key)
+				nack = found.(*streamNACK)
+				nack.consumer.pel.RaxRemove(key)
+				nack.consumer = consumer
+				nack.deliveryTime = now
+				nack.deliveryCount = 1
+			}
+			consumer.pel.RaxInsert(key, nack)
+		}
+	}
+	if consumer != nil && arraylen > 0 {
+		consumer.activeTime = now
+	}
+	if node != nil {
+		c.SetDeferredArrayLen(node, int(arraylen))
+	}
+	return arraylen
+}
+
+// streamReplyWithRangeFromConsumerPEL reply the entries pending for the
+// consumer from start to end, their delivery counter is incremented. An
+// entry deleted from the stream is replied with null fields.
+func streamReplyWithRangeFromConsumerPEL(c *RedisClient, s *stream, start, end *streamID, count int64, consumer *streamConsumer) int64 {
+	node := c.AddDeferredArrayLen()
+	var arraylen int64
+	now := GetMsTime()
+	ri := RaxStart(consumer.pel)
+	ri.RaxSeek(">=", streamEncodeID(*start))
+	for ri.RaxNext() && (count == 0 || arraylen < count) {
+		id := streamDecodeID(ri.key)
+		if end != nil && streamCompareID(id, *end) > 0 {
+			break
+		}
+		if streamReplyWithRange(c, s, &id, &id, 1, false, nil, nil, STREAM_RWR_RAWENTRIES) == 0 {
+			c.AddReplyArrayLen(2)
+			addReplyStreamID(c, id)
+			c.AddReply(shared.nullArray)
+		} else {
+			nack := ri.data.(*streamNACK)
+			nack.deliveryTime = now
+			nack.deliveryCount++
+		}
+		arraylen++
+	}
+	c.SetDeferredArrayLen(node, int(arraylen))
+	return arraylen
+}
+
+// xaddCommand implement XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold
+// [LIMIT count]] *|id field value [field value ...]
+func xaddCommand(c *RedisClient) {
+	var args streamAddTrimArgs
+	idpos := streamParseAddOrTrimArgsOrReply(c, &args, true)
+	if idpos < 0 {
+		return
+	}
+	fieldPos := idpos + 1
+	if len(c.args)-fieldPos < 2 || (len(c.args)-fieldPos)%2 == 1 {
+		c.AddReplyErrorFormat("wrong number of arguments for '%s' command", c.args[0].StrVal())
+		return
+	}
+	// fail before creating the key.
+	if args.idGiven && args.seqGiven && args.id == (streamID{}) {
+		c.AddReplyError("The ID specified in XADD must be greater than 0-0")
+		return
+	}
+	o := streamTypeLookupWriteOrCreate(c, c.args[1], args.noMkStream)
+	if o == nil {
+		return
+	}
+	s := o.Val_.(*stream)
+	if s.lastID == streamMaxID {
+		c.AddReplyError("The stream has exhausted the last possible ID, unable to add more items")
+		return
+	}
+	var useID *streamID
+	if args.idGiven {
+		useID = &args.id
+	}
+	id, ok := streamAppendItem(s, c.args[fieldPos:], useID, args.seqGiven)
+	if !ok {
+		c.AddReplyError("The ID specified in XADD is equal or smaller than the target stream top item")
+		return
+	}
+	addReplyStreamID(c, id)
+	streamTrim(s, &args)
+	signalKeyAsReady(c.db, c.args[1])
+}
+
+// xrangeGenericCommand implement XRANGE key start end [COUNT count] and
+// XREVRANGE key end start [COUNT count]
+func xrangeGenericCommand(c *RedisClient, rev bool) {
+	startArg, endArg := c.args[2], c.args[3]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, end, ok := streamParseRangeOrReply(c, startArg, endArg)
+	if !ok {
+		return
+	}
+	count := int64(-1)
+	for j := 4; j < len(c.args); j++ {
+		if strings.ToLower(c.args[j].StrVal()) == "count" && j+1 < len(c.args) {
+			j++
+			if count, ok = getLongLongFromObjectOrReply(c, c.args[j], ""); !ok {
+				return
+			}
+			if count < 0 {
+				count = 0
+			}
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+	o := lookupKeyReadOrReply(c, c.args[1], shared.emptyArray)
+	if o == nil || checkType(c, o, REDISSTREAM) {
+		return
+	}
+	if count == 0 {
+		c.AddReply(shared.nullArray)
+		return
+	}
+	if count == -1 {
+		count = 0
+	}
+	streamReplyWithRange(c, o.Val_.(*stream), &start, &end, count, rev, nil, nil, 0)
+}
+
+func xrangeCommand(c *RedisClient) {
+	xrangeGenericCommand(c, false)
+}
+
+func xrevrangeCommand(c *RedisClient) {
+	xrangeGenericCommand(c, true)
+}
+
+// xlenCommand implement XLEN key
+func xlenCommand(c *RedisClient) {
+	o := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if o == nil || checkType(c, o, REDISSTREAM) {
+		return
+	}
+	c.AddReplyInt(int64(o.Val_.(*stream).length))
+}
+
+// xdelCommand implement XDEL key id [id ...], the stream is kept even when
+// it gets empty.
+func xdelCommand(c *RedisClient) {
+	o := lookupKeyWriteOrReply(c, c.args[1], shared.czero)
+	if o == nil || checkType(c, o, REDISSTREAM) {
+		return
+	}
+	s := o.Val_.(*stream)
+	// parse all the IDs first, so nothing is deleted on syntax errors.
+	ids := make([]streamID, len(c.args)-2)
+	for i := range ids {
+		var ok bool
+		if ids[i], ok = streamParseStrictIDOrReply(c, c.args[i+2], 0, nil); !ok {
+			return
+		}
+	}
+	var deleted int64
+	for _, id := range ids {
+		if streamDeleteItem(s, id) {
+			if streamCompareID(id, s.maxDeletedEntryID) > 0 {
+				s.maxDeletedEntryID = id
+			}
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		streamUpdateFirstID(s)
+	}
+	c.AddReplyInt(deleted)
+}
+
+// xtrimCommand implement XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT
+// count]
+func xtrimCommand(c *RedisClient) {
+	o := lookupKeyWriteOrReply(c, c.args[1], shared.czero)
+	if o == nil || checkType(c, o, REDISSTREAM) {
+		return
+	}
+	var args streamAddTrimArgs
+	if streamParseAddOrTrimArgsOrReply(c, &args, false) < 0 {
+		return
+	}
+	c.AddReplyInt(streamTrim(o.Val_.(*stream), &args))
+}
+
+// xreadGenericCommand implement XREAD [COUNT count] [BLOCK milliseconds]
+// STREAMS key [key ...] id [id ...] and XREADGROUP GROUP group consumer
+// [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id
+// [id ...]. The client blocks if no stream has entries to serve.
+func xreadGenericCommand(c *RedisClient, xreadgroup bool) {
+	cmdName, newIDArg := "xread", "$"
+	if xreadgroup {
+		cmdName, newIDArg = "xreadgroup", ">"
+	}
+	var timeout, count int64
+	block, noack := false, false
+	var groupname, consumername *RedisObj
+	streamsArg, streamsCount := 0, 0
+	for i := 1; i < len(c.args) && streamsArg == 0; i++ {
+		moreargs := len(c.args) - 1 - i
+		opt := strings.ToLower(c.args[i].StrVal())
+		var ok bool
+		if opt == "block" && moreargs > 0 {
+			i++
+			if timeout, ok = getTimeoutFromObjectOrReply(c, c.args[i], UNIT_MILLISECONDS); !ok {
+				return
+			}
+			block = true
+		} else if opt == "count" && moreargs > 0 {
+			i++
+			if count, ok = getLongLongFromObjectOrReply(c, c.args[i], ""); !ok {
+				return
+			}
+			if count < 0 {
+				count = 0
+			}
+		} else if opt == "streams" && moreargs > 0 {
+			streamsArg = i + 1
+			streamsCount = len(c.args) - streamsArg
+			if streamsCount%2 != 0 {
+				c.AddReplyErrorFormat("Unbalanced '%s' list of streams: for each stream key an ID or '%s' must be specified.", cmdName, newIDArg)
+				return
+			}
+			streamsCount /= 2
+		} else if opt == "group" && moreargs >= 2 {
+			if !xreadgroup {
+				c.AddReplyError("The GROUP option is only supported by XREADGROUP. You called XREAD instead.")
+				return
+			}
+			groupname, consumername = c.args[i+1], c.args[i+2]
+			i += 2
+		} else if opt == "noack" {
+			if !xreadgroup {
+				c.AddReplyError("The NOACK option is only supported by XREADGROUP. You called XREAD instead.")
+				return
+			}
+			noack = true
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+	if streamsArg == 0 {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	if xreadgroup && groupname == nil {
+		c.AddReplyError("Missing GROUP option for XREADGROUP")
+		return
+	}
+
+	// the entries after ids are served, streamMaxID is ">".
+	keys := c.args[streamsArg : streamsArg+streamsCount]
+	ids := make([]streamID, streamsCount)
+	groups := make([]*streamCG, streamsCount)
+	for i, key := range keys {
+		o := lookupKeyRead(c.db, key)
+		if o != nil && checkType(c, o, REDISSTREAM) {
+			return
+		}
+		if groupname != nil {
+			if o != nil {
+				groups[i] = streamLookupCG(o.Val_.(*stream), groupname.StrVal())
+			}
+			if groups[i] == nil {
+				c.AddReplyErrorFormat("-NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option",
+					key.StrVal(), groupname.StrVal())
+				return
+			}
+		}
+		idArg := c.args[streamsArg+streamsCount+i]
+		switch idArg.StrVal() {
+		case "$":
+			if xreadgroup {
+				c.AddReplyError("The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+				return
+			}
+			if o != nil {
+				ids[i] = o.Val_.(*stream).lastID
+			}
+		case ">":
+			if !xreadgroup {
+				c.AddReplyError("The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+				return
+			}
+			ids[i] = streamMaxID
+		default:
+			var ok bool
+			if ids[i], ok = streamParseStrictIDOrReply(c, idArg, 0, nil); !ok {
+				return
+			}
+		}
+	}
+
+	var node *ListNode
+	arraylen := 0
+	for i, key := range keys {
+		o := lookupKeyRead(c.db, key)
+		if o == nil {
+			continue
+		}
+		s := o.Val_.(*stream)
+		gt := ids[i]
+		serve, history := false, false
+		var consumer *streamConsumer
+		if groups[i] != nil {
+			// any ID but ">" reads the consumer history.
+			if gt != streamMaxID {
+				serve, history = true, true
+			} else if s.length > 0 && streamCompareID(streamLastValidID(s), groups[i].lastID) > 0 {
+				serve = true
+				gt = groups[i].lastID
+			}
+			consumer = streamLookupConsumer(groups[i], consumername.StrVal())
+			if consumer == nil {
+				consumer = streamCreateConsumer(groups[i], consumername.StrVal())
+			}
+			consumer.seenTime = GetMsTime()
+		} else if s.length > 0 && streamCompareID(streamLastValidID(s), gt) > 0 {
+			serve = true
+		}
+		if !serve {
+			continue
+		}
+		arraylen++
+		if arraylen == 1 {
+			node = c.AddDeferredArrayLen()
+		}
+		start, _ := streamIncrID(gt)
+		flags := 0
+		if noack {
+			flags |= STREAM_RWR_NOACK
+		}
+		if history {
+			flags |= STREAM_RWR_HISTORY
+		}
+		c.AddReplyArrayLen(2)
+		c.AddReplyBulk(key)
+		streamReplyWithRange(c, s, &start, nil, count, false, groups[i], consumer, flags)
+	}
+	if arraylen > 0 {
+		c.SetDeferredArrayLen(node, arraylen)
+		return
+	}
+
+	if !block {
+		c.AddReply(shared.nullArray)
+		return
+	}
+	c.bpop.ids = make(map[string]streamID)
+	for i, key := range keys {
+		// a key given more than once keeps its first ID.
+		if _, ok := c.bpop.ids[key.StrVal()]; !ok {
+			c.bpop.ids[key.StrVal()] = ids[i]
+		}
+	}
+	c.bpop.xreadCount = count
+	if groupname != nil {
+		groupname.IncrRefCount()
+		consumername.IncrRefCount()
+		c.bpop.xreadGroup = groupname
+		c.bpop.xreadConsumer = consumername
+		c.bpop.xreadNoAck = noack
+	}
+	blockForKeys(c, BLOCKED_STREAM, keys, timeout)
+}
+
+func xreadCommand(c *RedisClient) {
+	xreadGenericCommand(c, false)
+}
+
+func xreadgroupCommand(c *RedisClient) {
+	xreadGenericCommand(c, true)
+}
+
+// serveClientBlockedOnStream serve the entries of the stream s at key
+// after the ID the receiver is blocked on, and unblock it. A client of a
+// consumer group is served the entries not delivered to the group yet, or
+// an error if the group was destroyed.
+func serveClientBlockedOnStream(receiver *RedisClient, key *RedisObj, s *stream) {
+	gt := receiver.bpop.ids[key.StrVal()]
+	var group *streamCG
+	var consumer *streamConsumer
+	if receiver.bpop.xreadGroup != nil {
+		group = streamLookupCG(s, receiver.bpop.xreadGroup.StrVal())
+		if group == nil {
+			receiver.AddReplyError("-NOGROUP the consumer group this client was blocked on no longer exists")
+			unblockClient(receiver)
+			return
+		}
+		gt = group.lastID
+	}
+	if streamCompareID(s.lastID, gt) <= 0 {
+		return
+	}
+	flags := 0
+	if group != nil {
+		name := receiver.bpop.xreadConsumer.StrVal()
+		consumer = streamLookupConsumer(group, name)
+		if consumer == nil {
+			consumer = streamCreateConsumer(group, name)
+		}
+		consumer.seenTime = GetMsTime()
+		if receiver.bpop.xreadNoAck {
+			flags |= STREAM_RWR_NOACK
+		}
+	}
+	start, _ := streamIncrID(gt)
+	receiver.AddReplyArrayLen(1)
+	receiver.AddReplyArrayLen(2)
+	receiver.AddReplyBulk(key)
+	streamReplyWithRange(receiver, s, &start, nil, receiver.bpop.xreadCount, false, group, consumer, flags)
+	unblockClient(receiver)
+}
+
+// xgroupCommand implement XGROUP CREATE key group id|$ [MKSTREAM]
+// [ENTRIESREAD entries-read], XGROUP SETID key group id|$ [ENTRIESREAD
+// entries-read], XGROUP DESTROY key group, XGROUP CREATECONSUMER key group
+// consumer and XGROUP DELCONSUMER key group consumer
+func xgroupCommand(c *RedisClient) {
+	sub := strings.ToLower(c.args[1].StrVal())
+	mkstream := false
+	entriesRead := SCG_INVALID_ENTRIES_READ
+	valid := false
+	switch sub {
+	case "create", "setid":
+		valid = len(c.args) >= 5
+		for i := 5; valid && i < len(c.args); i++ {
+			opt := strings.ToLower(c.args[i].StrVal())
+			if sub == "create" && opt == "mkstream" {
+				mkstream = true
+			} else if opt == "entriesread" && i+1 < len(c.args) {
+				i++
+				var ok bool
+				if entriesRead, ok = getLongLongFromObjectOrReply(c, c.args[i], ""); !ok {
+					return
+				}
+				if entriesRead < 0 && entriesRead != SCG_INVALID_ENTRIES_READ {
+					c.AddReplyError("value for ENTRIESREAD must be positive or -1")
+					return
+				}
+			} else {
+				valid = false
+			}
+		}
+	case "destroy":
+		valid = len(c.args) == 4
+	case "createconsumer", "delconsumer":
+		valid = len(c.args) == 5
+	}
+	if !valid {
+		c.AddReplyErrorFormat("unknown subcommand or wrong number of arguments for '%s'. Try XGROUP HELP.", c.args[1].StrVal())
+		return
+	}
+
+	key, groupname := c.args[2], c.args[3].StrVal()
+	o := lookupKeyWrite(c.db, key)
+	var s *stream
+	var cg *streamCG
+	if o != nil {
+		if checkType(c, o, REDISSTREAM) {
+			return
+		}
+		s = o.Val_.(*stream)
+		cg = streamLookupCG(s, groupname)
+	}
+	if s == nil && !mkstream {
+		c.AddReplyError("The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+		return
+	}
+	if cg == nil && (sub == "setid" || sub == "createconsumer" || sub == "delconsumer") {
+		c.AddReplyErrorFormat("-NOGROUP No such consumer group '%s' for key name '%s'", groupname, key.StrVal())
+		return
+	}
+
+	switch sub {
+	case "create", "setid":
+		var id streamID
+		if c.args[4].StrVal() == "$" {
+			if s != nil {
+				id = s.lastID
+			}
+		} else {
+			var ok bool
+			if id, ok = streamParseIDOrReply(c, c.args[4], 0); !ok {
+				return
+			}
+		}
+		if sub == "setid" {
+			cg.lastID = id
+			cg.entriesRead = entriesRead
+			c.AddReply(shared.ok)
+			return
+		}
+		if s == nil {
+			o = createStreamObject()
+			dbAdd(c.db, key, o)
+			o.DecrRefCount()
+			s = o.Val_.(*stream)
+		}
+		if streamCreateCG(s, groupname, id, entriesRead) == nil {
+			c.AddReplyError("-BUSYGROUP Consumer Group name already exists")
+			return
+		}
+		c.AddReply(shared.ok)
+	case "destroy":
+		if cg == nil {
+			c.AddReply(shared.czero)
+			return
+		}
+		s.cgroups.RaxRemove(groupname)
+		// the clients blocked on the group get an error.
+		signalKeyAsReady(c.db, key)
+		c.AddReply(shared.cone)
+	case "createconsumer":
+		if streamCreateConsumer(cg, c.args[4].StrVal()) == nil {
+			c.AddReply(shared.czero)
+		} else {
+			c.AddReply(shared.cone)
+		}
+	case "delconsumer":
+		var pending int64
+		if consumer := streamLookupConsumer(cg, c.args[4].StrVal()); consumer != nil {
+			pending = int64(consumer.pel.RaxSize())
+			streamDelConsumer(cg, consumer)
+		}
+		c.AddReplyInt(pending)
+	}
+}
+
+// streamLookupCGOrReply return the stream at key and its consumer group,
+// or reply NOGROUP and return nil if one of them doesn't exist.
+func streamLookupCGOrReply(c *RedisClient, key, groupname *RedisObj) (*stream, *streamCG) {
+	o := lookupKeyRead(c.db, key)
+	if o != nil && checkType(c, o, REDISSTREAM) {
+		return nil, nil
+	}
+	var cg *streamCG
+	if o != nil {
+		cg = streamLookupCG(o.Val_.(*stream), groupname.StrVal())
+	}
+	if cg == nil {
+		c.AddReplyErrorFormat("-NOGROUP No such key '%s' or consumer group '%s'", key.StrVal(), groupname.StrVal())
+		return nil, nil
+	}
+	return o.Val_.(*stream), cg
+}
+
+// xackCommand implement XACK key group id [id ...], return the number of
+// entries removed from the PEL.
+func xackCommand(c *RedisClient) {
+	o := lookupKeyRead(c.db, c.args[1])
+	if o != nil && checkType(c, o, REDISSTREAM) {
+		return
+	}
+	var cg *streamCG
+	if o != nil {
+		cg = streamLookupCG(o.Val_.(*stream), c.args[2].StrVal())
+	}
+	if cg == nil {
+		c.AddReply(shared.czero)
+		return
+	}
+	ids := make([]streamID, len(c.args)-3)
+	for i := range ids {
+		var ok bool
+		if ids[i], ok = streamParseStrictIDOrReply(c, c.args[i+3], 0, nil); !ok {
+			return
+		}
+	}
+	var acknowledged int64
+	for _, id := range ids {
+		key := streamEncodeID(id)
+		if nack, ok := cg.pel.RaxRemove(key); ok {
+			nack.(*streamNACK).consumer.pel.RaxRemove(key)
+			acknowledged++
+		}
+	}
+	c.AddReplyInt(acknowledged)
+}
+
+// xpendingCommand implement XPENDING key group [[IDLE min-idle-time] start
+// end count [consumer]]. Without the range it replies a summary of the PEL.
+func xpendingCommand(c *RedisClient) {
+	justinfo := len(c.args) == 3
+	if !justinfo && (len(c.args) < 6 || len(c.args) > 9) {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	var start, end streamID
+	var count, minidle int64
+	var consumername *RedisObj
+	if !justinfo {
+		startidx := 3
+		if strings.ToLower(c.args[3].StrVal()) == "idle" {
+			var ok bool
+			if minidle, ok = getLongLongFromObjectOrReply(c, c.args[4], ""); !ok {
+				return
+			}
+			if len(c.args) < 8 {
+				c.AddReply(shared.syntaxErr)
+				return
+			}
+			startidx += 2
+		}
+		var ok bool
+		if count, ok = getLongLongFromObjectOrReply(c, c.args[startidx+2], ""); !ok {
+			return
+		}
+		if count < 0 {
+			count = 0
+		}
+		if start, end, ok = streamParseRangeOrReply(c, c.args[startidx], c.args[startidx+1]); !ok {
+			return
+		}
+		if startidx+3 < len(c.args) {
+			consumername = c.args[startidx+3]
+		}
+	}
+	_, cg := streamLookupCGOrReply(c, c.args[1], c.args[2])
+	if cg == nil {
+		return
+	}
+
+	if justinfo {
+		c.AddReplyArrayLen(4)
+		c.AddReplyInt(int64(cg.pel.RaxSize()))
+		if cg.pel.RaxSize() == 0 {
+			c.AddReply(shared.nullBulk)
+			c.AddReply(shared.nullBulk)
+			c.AddReply(shared.nullArray)
+			return
+		}
+		ri := RaxStart(cg.pel)
+		ri.RaxSeek("^", "")
+		addReplyStreamID(c, streamDecodeID(ri.key))
+		ri.RaxSeek("$", "")
+		addReplyStreamID(c, streamDecodeID(ri.key))
+		node := c.AddDeferredArrayLen()
+		arraylen := 0
+		ri = RaxStart(cg.consumers)
+		ri.RaxSeek("^", "")
+		for ri.RaxNext() {
+			consumer := ri.data.(*streamConsumer)
+			if consumer.pel.RaxSize() == 0 {
+				continue
+			}
+			c.AddReplyArrayLen(2)
+			c.AddReplyBulkStr(consumer.name)
+			c.AddReplyBulkStr(strconv.FormatUint(consumer.pel.RaxSize(), 10))
+			arraylen++
+		}
+		c.SetDeferredArrayLen(node, arraylen)
+		return
+	}
+
+	pel := cg.pel
+	if consumername != nil {
+		consumer := streamLookupConsumer(cg, consumername.StrVal())
+		if consumer == nil {
+			c.AddReply(shared.emptyArray)
+			return
+		}
+		pel = consumer.pel
+	}
+	now := GetMsTime()
+	node := c.AddDeferredArrayLen()
+	arraylen := 0
+	ri := RaxStart(pel)
+	ri.RaxSeek(">=", streamEncodeID(start))
+	endKey := streamEncodeID(end)
+	for count > 0 && ri.RaxNext() && ri.key <= endKey {
+		nack := ri.data.(*streamNACK)
+		elapsed := now - nack.deliveryTime
+		if minidle > 0 && elapsed < minidle {
+			continue
+		}
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		arraylen++
+		count--
+		c.AddReplyArrayLen(4)
+		addReplyStreamID(c, streamDecodeID(ri.key))
+		c.AddReplyBulkStr(nack.consumer.name)
+		c.AddReplyInt(elapsed)
+		c.AddReplyInt(int64(nack.deliveryCount))
+	}
+	c.SetDeferredArrayLen(node, arraylen)
+}
+
+// streamClaimNACK move the pending entry nack with the encoded ID key to
+// consumer, and set its delivery time.
+func streamClaimNACK(nack *streamNACK, key string, consumer *streamConsumer, deliveryTime int64) {
+	if nack.consumer != consumer {
+		if nack.consumer != nil {
+			nack.consumer.pel.RaxRemove(key)
+		}
+		consumer.pel.RaxInsert(key, nack)
+		nack.consumer = consumer
+	}
+	nack.deliveryTime = deliveryTime
+}
+
+// xclaimCommand implement XCLAIM key group consumer min-idle-time id [id
+// ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE]
+// [JUSTID] [LASTID lastid]. The pending entries idle for at least
+// min-idle-time are moved to consumer, the entries deleted from the stream
+// are removed from the PEL.
+func xclaimCommand(c *RedisClient) {
+	s, cg := streamLookupCGOrReply(c, c.args[1], c.args[2])
+	if cg == nil {
+		return
+	}
+	minidle, ok := getLongLongFromObjectOrReply(c, c.args[4], "Invalid min-idle-time argument for XCLAIM")
+	if !ok {
+		return
+	}
+	if minidle < 0 {
+		minidle = 0
+	}
+	// the IDs are followed by the options.
+	var ids []streamID
+	j := 5
+	for ; j < len(c.args); j++ {
+		id, ok := streamParseStrictIDOrReply(nil, c.args[j], 0, nil)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+	now := GetMsTime()
+	deliveryTime, retrycount := int64(-1), int64(-1)
+	force, justid := false, false
+	var lastID streamID
+	for ; j < len(c.args); j++ {
+		moreargs := len(c.args) - 1 - j
+		opt := strings.ToLower(c.args[j].StrVal())
+		if opt == "force" {
+			force = true
+		} else if opt == "justid" {
+			justid = true
+		} else if opt == "idle" && moreargs > 0 {
+			j++
+			if deliveryTime, ok = getLongLongFromObjectOrReply(c, c.args[j], "Invalid IDLE option argument for XCLAIM"); !ok {
+				return
+			}
+			deliveryTime = now - deliveryTime
+		} else if opt == "time" && moreargs > 0 {
+			j++
+			if deliveryTime, ok = getLongLongFromObjectOrReply(c, c.args[j], "Invalid TIME option argument for XCLAIM"); !ok {
+				return
+			}
+		} else if opt == "retrycount" && moreargs > 0 {
+			j++
+			if retrycount, ok = getLongLongFromObjectOrReply(c, c.args[j], "Invalid RETRYCOUNT option argument for XCLAIM"); !ok {
+				return
+			}
+		} else if opt == "lastid" && moreargs > 0 {
+			j++
+			if lastID, ok = streamParseStrictIDOrReply(c, c.args[j], 0, nil); !ok {
+				return
+			}
+		} else {
+			c.AddReplyErrorFormat("Unrecognized XCLAIM option '%s'", c.args[j].StrVal())
+			return
+		}
+	}
+	if streamCompareID(lastID, cg.lastID) > 0 {
+		cg.lastID = lastID
+	}
+	// a bogus delivery time is not an error, the clocks may differ.
+	if deliveryTime < 0 || deliveryTime > now {
+		deliveryTime = now
+	}
+
+	var consumer *streamConsumer
+	node := c.AddDeferredArrayLen()
+	arraylen := 0
+	for _, id := range ids {
+		key := streamEncodeID(id)
+		var nack *streamNACK
+		if found, ok := cg.pel.RaxFind(key); ok {
+			nack = found.(*streamNACK)
+		}
+		if !streamEntryExists(s, id) {
+			if nack != nil {
+				cg.pel.RaxRemove(key)
+				nack.consumer.pel.RaxRemove(key)
+			}
+			continue
+		}
+		// FORCE creates the pending entry, its idle time is not checked.
+		if force && nack == nil {
+			nack = &streamNACK{}
+			cg.pel.RaxInsert(key, nack)
+		}
+		if nack == nil {
+			continue
+		}
+		if nack.consumer != nil && minidle > 0 && now-nack.deliveryTime < minidle {
+			continue
+		}
+		if consumer == nil {
+			if consumer = streamLookupConsumer(cg, c.args[3].StrVal()); consumer == nil {
+				consumer = streamCreateConsumer(cg, c.args[3].StrVal())
+			}
+			consumer.seenTime = now
+		}
+		streamClaimNACK(nack, key, consumer, deliveryTime)
+		if retrycount >= 0 {
+			nack.deliveryCount = uint64(retrycount)
+		} else if !justid {
+			nack.deliveryCount++
+		}
+		if justid {
+			addReplyStreamID(c, id)
+		} else {
+			streamReplyWithRange(c, s, &id, &id, 1, false, nil, nil, STREAM_RWR_RAWENTRIES)
+		}
+		arraylen++
+		consumer.activeTime = now
+	}
+	c.SetDeferredArrayLen(node, arraylen)
+}
+
+// xautoclaimCommand implement XAUTOCLAIM key group consumer min-idle-time
+// start [COUNT count] [JUSTID]. It claims like XCLAIM the pending entries
+// from start, and replies the ID to start the next call from, the claimed
+// entries and the IDs deleted from the stream and removed from the PEL.
+func xautoclaimCommand(c *RedisClient) {
+	minidle, ok := getLongLongFromObjectOrReply(c, c.args[4], "Invalid min-idle-time argument for XAUTOCLAIM")
+	if !ok {
+		return
+	}
+	if minidle < 0 {
+		minidle = 0
+	}
+	start, startex, ok := streamParseIntervalIDOrReply(c, c.args[5], 0)
+	if !ok {
+		return
+	}
+	if startex {
+		if start, ok = streamIncrID(start); !ok {
+			c.AddReplyError("invalid start ID for the interval")
+			return
+		}
+	}
+	count := int64(100)
+	justid := false
+	for j := 6; j < len(c.args); j++ {
+		opt := strings.ToLower(c.args[j].StrVal())
+		if opt == "count" && j+1 < len(c.args) {
+			j++
+			count, ok = getLongLongFromObject(c.args[j])
+			if !ok || count < 1 || count > (1<<63-1)/16 {
+				c.AddReplyError("COUNT must be > 0")
+				return
+			}
+		} else if opt == "justid" {
+			justid = true
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+	s, cg := streamLookupCGOrReply(c, c.args[1], c.args[2])
+	if cg == nil {
+		return
+	}
+
+	var claimed, deleted []streamID
+	var consumer *streamConsumer
+	now := GetMsTime()
+	attempts := count * XAUTOCLAIM_ATTEMPTS_FACTOR
+	ri := RaxStart(cg.pel)
+	ri.RaxSeek(">=", streamEncodeID(start))
+	for ; attempts > 0 && count > 0 && ri.RaxNext(); attempts-- {
+		nack := ri.data.(*streamNACK)
+		id := streamDecodeID(ri.key)
+		if !streamEntryExists(s, id) {
+			cg.pel.RaxRemove(ri.key)
+			nack.consumer.pel.RaxRemove(ri.key)
+			deleted = append(deleted, id)
+			count--
+			continue
+		}
+		if minidle > 0 && now-nack.deliveryTime < minidle {
+			continue
+		}
+		if consumer == nil {
+			if consumer = streamLookupConsumer(cg, c.args[3].StrVal()); consumer == nil {
+				consumer = streamCreateConsumer(cg, c.args[3].StrVal())
+			}
+			consumer.seenTime = now
+		}
+		streamClaimNACK(nack, ri.key, consumer, now)
+		if !justid {
+			nack.deliveryCount++
+		}
+		claimed = append(claimed, id)
+		count--
+		consumer.activeTime = now
+	}
+	// the cursor is the next pending entry, 0-0 when the scan is over.
+	var next streamID
+	if ri.RaxNext() {
+		next = streamDecodeID(ri.key)
+	}
+
+	c.AddReplyArrayLen(3)
+	addReplyStreamID(c, next)
+	c.AddReplyArrayLen(len(claimed))
+	for _, id := range claimed {
+		if justid {
+			addReplyStreamID(c, id)
+		} else {
+			streamReplyWithRange(c, s, &id, &id, 1, false, nil, nil, STREAM_RWR_RAWENTRIES)
+		}
+	}
+	c.AddReplyArrayLen(len(deleted))
+	for _, id := range deleted {
+		addReplyStreamID(c, id)
+	}
+}
+
+// addReplyStreamCGLag reply the number of entries not read by the group
+// yet, or null if it can't be known because of deleted entries.
+func addReplyStreamCGLag(c *RedisClient, s *stream, cg *streamCG) {
+	if s.entriesAdded == 0 {
+		c.AddReply(shared.czero)
+		return
+	}
+	if cg.entriesRead != SCG_INVALID_ENTRIES_READ && !streamRangeHasTombstones(s, &cg.lastID, nil) {
+		c.AddReplyInt(int64(s.entriesAdded) - cg.entriesRead)
+		return
+	}
+	entriesRead := streamEstimateDistanceFromFirstEverEntry(s, cg.lastID)
+	if entriesRead == SCG_INVALID_ENTRIES_READ {
+		c.AddReply(shared.nullBulk)
+		return
+	}
+	c.AddReplyInt(int64(s.entriesAdded) - entriesRead)
+}
+
+// xinfoReplyWithStreamInfo reply XINFO STREAM key [FULL [COUNT count]].
+// FULL replies at most count entries, and count entries of every PEL, all of
+// them if count is 0.
+func xinfoReplyWithStreamInfo(c *RedisClient, s *stream) {
+	full := false
+	count := int64(10)
+	if len(c.args) > 3 {
+		if strings.ToLower(c.args[3].StrVal()) != "full" {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+		full = true
+		if len(c.args) == 6 {
+			if strings.ToLower(c.args[4].StrVal()) != "count" {
+				c.AddReply(shared.syntaxErr)
+				return
+			}
+			var ok bool
+			if count, ok = getLongLongFromObjectOrReply(c, c.args[5], ""); !ok {
+				return
+			}
+			if count < 0 {
+				count = 0
+			}
+		}
+	}
+
+	if full {
+		c.AddReplyArrayLen(18)
+	} else {
+		c.AddReplyArrayLen(20)
+	}
+	c.AddReplyBulkStr("length")
+	c.AddReplyInt(int64(s.length))
+	c.AddReplyBulkStr("radix-tree-keys")
+	c.AddReplyInt(int64(s.rax.RaxSize()))
+	c.AddReplyBulkStr("radix-tree-nodes")
+	c.AddReplyInt(int64(s.rax.numnodes))
+	c.AddReplyBulkStr("last-generated-id")
+	addReplyStreamID(c, s.lastID)
+	c.AddReplyBulkStr("max-deleted-entry-id")
+	addReplyStreamID(c, s.maxDeletedEntryID)
+	c.AddReplyBulkStr("entries-added")
+	c.AddReplyInt(int64(s.entriesAdded))
+	c.AddReplyBulkStr("recorded-first-entry-id")
+	addReplyStreamID(c, s.firstID)
+
+	if !full {
+		var groups uint64
+		if s.cgroups != nil {
+			groups = s.cgroups.RaxSize()
+		}
+		c.AddReplyBulkStr("groups")
+		c.AddReplyInt(int64(groups))
+		c.AddReplyBulkStr("first-entry")
+		if streamReplyWithRange(c, s, nil, nil, 1, false, nil, nil, STREAM_RWR_RAWENTRIES) == 0 {
+			c.AddReply(shared.nullBulk)
+		}
+		c.AddReplyBulkStr("last-entry")
+		if streamReplyWithRange(c, s, nil, nil, 1, true, nil, nil, STREAM_RWR_RAWENTRIES) == 0 {
+			c.AddReply(shared.nullBulk)
+		}
+		return
+	}
+
+	c.AddReplyBulkStr("entries")
+	streamReplyWithRange(c, s, nil, nil, count, false, nil, nil, 0)
+	c.AddReplyBulkStr("groups")
+	if s.cgroups == nil {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+	c.AddReplyArrayLen(int(s.cgroups.RaxSize()))
+	ri := RaxStart(s.cgroups)
+	ri.RaxSeek("^", "")
+	for ri.RaxNext() {
+		cg := ri.data.(*streamCG)
+		c.AddReplyArrayLen(14)
+		c.AddReplyBulkStr("name")
+		c.AddReplyBulkStr(ri.key)
+		c.AddReplyBulkStr("last-delivered-id")
+		addReplyStreamID(c, cg.lastID)
+		c.AddReplyBulkStr("entries-read")
+		if cg.entriesRead != SCG_INVALID_ENTRIES_READ {
+			c.AddReplyInt(cg.entriesRead)
+		} else {
+			c.AddReply(shared.nullBulk)
+		}
+		c.AddReplyBulkStr("lag")
+		addReplyStreamCGLag(c, s, cg)
+		c.AddReplyBulkStr("pel-count")
+		c.AddReplyInt(int64(cg.pel.RaxSize()))
+
+		// the PEL of the group, with the owner of every entry.
+		c.AddReplyBulkStr("pending")
+		node := c.AddDeferredArrayLen()
+		arraylen := int64(0)
+		pi := RaxStart(cg.pel)
+		pi.RaxSeek("^", "")
+		for pi.RaxNext() && (count == 0 || arraylen < count) {
+			nack := pi.data.(*streamNACK)
+			c.AddReplyArrayLen(4)
+			addReplyStreamID(c, streamDecodeID(pi.key))
+			c.AddReplyBulkStr(nack.consumer.name)
+			c.AddReplyInt(nack.deliveryTime)
+			c.AddReplyInt(int64(nack.deliveryCount))
+			arraylen++
+		}
+		c.SetDeferredArrayLen(node, int(arraylen))
+
+		c.AddReplyBulkStr("consumers")
+		c.AddReplyArrayLen(int(cg.consumers.RaxSize()))
+		ci := RaxStart(cg.consumers)
+		ci.RaxSeek("^", "")
+		for ci.RaxNext() {
+			consumer := ci.data.(*streamConsumer)
+			c.AddReplyArrayLen(10)
+			c.AddReplyBulkStr("name")
+			c.AddReplyBulkStr(consumer.name)
+			c.AddReplyBulkStr("seen-time")
+			c.AddReplyInt(consumer.seenTime)
+			c.AddReplyBulkStr("active-time")
+			c.AddReplyInt(consumer.activeTime)
+			c.AddReplyBulkStr("pel-count")
+			c.AddReplyInt(int64(consumer.pel.RaxSize()))
+			c.AddReplyBulkStr("pending")
+			node := c.AddDeferredArrayLen()
+			arraylen := int64(0)
+			pi := RaxStart(consumer.pel)
+			pi.RaxSeek("^", "")
+			for pi.RaxNext() && (count == 0 || arraylen < count) {
+				nack := pi.data.(*streamNACK)
+				c.AddReplyArrayLen(3)
+				addReplyStreamID(c, streamDecodeID(pi.key))
+				c.AddReplyInt(nack.deliveryTime)
+				c.AddReplyInt(int64(nack.deliveryCount))
+				arraylen++
+			}
+			c.SetDeferredArrayLen(node, int(arraylen))
+		}
+	}
+}
+
+// xinfoCommand implement XINFO STREAM key [FULL [COUNT count]], XINFO
+// GROUPS key and XINFO CONSUMERS key group
+func xinfoCommand(c *RedisClient) {
+	sub := strings.ToLower(c.args[1].StrVal())
+	if !(sub == "stream" && (len(c.args) == 3 || len(c.args) == 4 || len(c.args) == 6)) &&
+		!(sub == "groups" && len(c.args) == 3) && !(sub == "consumers" && len(c.args) == 4) {
+		c.AddReplyErrorFormat("unknown subcommand or wrong number of arguments for '%s'. Try XINFO HELP.", c.args[1].StrVal())
+		return
+	}
+	o := lookupKeyReadOrReply(c, c.args[2], shared.noKeyErr)
+	if o == nil || checkType(c, o, REDISSTREAM) {
+		return
+	}
+	s := o.Val_.(*stream)
+	now := GetMsTime()
+
+	switch sub {
+	case "stream":
+		xinfoReplyWithStreamInfo(c, s)
+	case "groups":
+		if s.cgroups == nil {
+			c.AddReply(shared.emptyArray)
+			return
+		}
+		c.AddReplyArrayLen(int(s.cgroups.RaxSize()))
+		ri := RaxStart(s.cgroups)
+		ri.RaxSeek("^", "")
+		for ri.RaxNext() {
+			cg := ri.data.(*streamCG)
+			c.AddReplyArrayLen(12)
+			c.AddReplyBulkStr("name")
+			c.AddReplyBulkStr(ri.key)
+			c.AddReplyBulkStr("consumers")
+			c.AddReplyInt(int64(cg.consumers.RaxSize()))
+			c.AddReplyBulkStr("pending")
+			c.AddReplyInt(int64(cg.pel.RaxSize()))
+			c.AddReplyBulkStr("last-delivered-id")
+			addReplyStreamID(c, cg.lastID)
+			c.AddReplyBulkStr("entries-read")
+			if cg.entriesRead != SCG_INVALID_ENTRIES_READ {
+				c.AddReplyInt(cg.entriesRead)
+			} else {
+				c.AddReply(shared.nullBulk)
+			}
+			c.AddReplyBulkStr("lag")
+			addReplyStreamCGLag(c, s, cg)
+		}
+	case "consumers":
+		cg := streamLookupCG(s, c.args[3].StrVal())
+		if cg == nil {
+			c.AddReplyErrorFormat("-NOGROUP No such consumer group '%s' for key name '%s'", c.args[3].StrVal(), c.args[2].StrVal())
+			return
+		}
+		c.AddReplyArrayLen(int(cg.consumers.RaxSize()))
+		ri := RaxStart(cg.consumers)
+		ri.RaxSeek("^", "")
+		for ri.RaxNext() {
+			consumer := ri.data.(*streamConsumer)
+			inactive := int64(-1)
+			if consumer.activeTime != -1 {
+				inactive = now - consumer.activeTime
+			}
+			c.AddReplyArrayLen(8)
+			c.AddReplyBulkStr("name")
+			c.AddReplyBulkStr(consumer.name)
+			c.AddReplyBulkStr("pending")
+			c.AddReplyInt(int64(consumer.pel.RaxSize()))
+			c.AddReplyBulkStr("idle")
+			c.AddReplyInt(now - consumer.seenTime)
+			c.AddReplyBulkStr("inactive")
+			c.AddReplyInt(inactive)
+		}
+	}
+}
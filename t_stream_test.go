@@ -0,0 +1,214 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestXaddXrangeCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "$3\r\n1-0\r\n", execCommand(c, "xadd", "s", "1", "a", "1"))
+	assert.Equal(t, "$3\r\n1-1\r\n", execCommand(c, "xadd", "s", "1-*", "b", "2"))
+	assert.Equal(t, "$3\r\n5-3\r\n", execCommand(c, "xadd", "s", "5-3", "a", "3", "c", "4"))
+	assert.Equal(t, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n", execCommand(c, "xadd", "s", "5-3", "a", "1"))
+	assert.Equal(t, "-ERR The ID specified in XADD must be greater than 0-0\r\n", execCommand(c, "xadd", "s", "0-0", "a", "1"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'xadd' command\r\n", execCommand(c, "xadd", "s", "*", "a", "1", "b"))
+	assert.Equal(t, "-ERR Invalid stream ID specified as stream command argument\r\n", execCommand(c, "xadd", "s", "1-x", "a", "1"))
+	assert.Equal(t, ":3\r\n", execCommand(c, "xlen", "s"))
+	rep := execCommand(c, "xadd", "s", "*", "a", "5")
+	ms, _ := strconv.ParseUint(strings.Split(rep, "\r\n")[1][:13], 10, 64)
+	assert.Greater(t, ms, uint64(5))
+
+	entry1 := "*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"
+	entry2 := "*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"
+	entry3 := "*2\r\n$3\r\n5-3\r\n*4\r\n$1\r\na\r\n$1\r\n3\r\n$1\r\nc\r\n$1\r\n4\r\n"
+	assert.Equal(t, "*3\r\n"+entry1+entry2+entry3, execCommand(c, "xrange", "s", "-", "5"))
+	assert.Equal(t, "*2\r\n"+entry2+entry3, execCommand(c, "xrange", "s", "(1-0", "5-3"))
+	assert.Equal(t, "*2\r\n"+entry1+entry2, execCommand(c, "xrange", "s", "-", "+", "count", "2"))
+	assert.Equal(t, "*2\r\n"+entry3+entry2, execCommand(c, "xrevrange", "s", "(6", "1-1"))
+	assert.Equal(t, "*-1\r\n", execCommand(c, "xrange", "s", "-", "+", "count", "0"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "xrange", "s", "3", "2"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "xrange", "nokey", "-", "+"))
+	assert.Equal(t, "-ERR invalid end ID for the interval\r\n", execCommand(c, "xrange", "s", "-", "(0-0"))
+
+	assert.Equal(t, "$-1\r\n", execCommand(c, "xadd", "s2", "nomkstream", "*", "a", "1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "s2"))
+	assert.Equal(t, "+stream\r\n", execCommand(c, "type", "s"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "copy", "s", "s2"))
+	execCommand(c, "xdel", "s2", "1-0")
+	assert.Equal(t, ":4\r\n", execCommand(c, "xlen", "s"))
+	execCommand(c, "set", "str", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "xadd", "str", "*", "a", "1"))
+}
+
+func TestXdelXtrimCmd(t *testing.T) {
+	c := testClient()
+	for i := 1; i <= 250; i++ {
+		execCommand(c, "xadd", "s", strconv.Itoa(i), "f", strconv.Itoa(i))
+	}
+	s := lookupKeyRead(c.db, CreateObject(REDISSTR, "s")).Val_.(*stream)
+	// the entries are split in nodes of stream-node-max-entries.
+	assert.Equal(t, uint64(3), s.rax.RaxSize())
+
+	assert.Equal(t, ":2\r\n", execCommand(c, "xdel", "s", "1", "3", "1000"))
+	assert.Equal(t, ":248\r\n", execCommand(c, "xlen", "s"))
+	assert.Equal(t, "*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\n2\r\n", execCommand(c, "xrange", "s", "-", "3"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "xdel", "nokey", "1"))
+
+	// the approximated trim removes whole nodes only.
+	assert.Equal(t, ":0\r\n", execCommand(c, "xtrim", "s", "maxlen", "~", "200"))
+	assert.Equal(t, ":98\r\n", execCommand(c, "xtrim", "s", "maxlen", "~", "150"))
+	assert.Equal(t, ":150\r\n", execCommand(c, "xlen", "s"))
+	assert.Equal(t, ":50\r\n", execCommand(c, "xtrim", "s", "minid", "151"))
+	assert.Equal(t, ":10\r\n", execCommand(c, "xtrim", "s", "maxlen", "=", "90"))
+	assert.Equal(t, "*1\r\n*2\r\n$5\r\n161-0\r\n*2\r\n$1\r\nf\r\n$3\r\n161\r\n", execCommand(c, "xrange", "s", "-", "+", "count", "1"))
+	execCommand(c, "xadd", "s", "maxlen", "2", "*", "f", "x")
+	assert.Equal(t, ":2\r\n", execCommand(c, "xlen", "s"))
+
+	assert.Equal(t, "-ERR syntax error, LIMIT cannot be used without specifying a trimming strategy\r\n", execCommand(c, "xtrim", "s", "limit", "1"))
+	assert.Equal(t, "-ERR syntax error, LIMIT cannot be used without the special ~ option\r\n", execCommand(c, "xtrim", "s", "maxlen", "1", "limit", "1"))
+	assert.Equal(t, "-ERR syntax error, MAXLEN and MINID options at the same time are not compatible\r\n", execCommand(c, "xtrim", "s", "maxlen", "1", "minid", "1"))
+	assert.Equal(t, "-ERR The MAXLEN argument must be >= 0.\r\n", execCommand(c, "xtrim", "s", "maxlen", "-1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "xtrim", "nokey", "maxlen", "1"))
+}
+
+func TestXgroupXreadgroupCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.\r\n",
+		execCommand(c, "xgroup", "create", "s", "g", "$"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "xgroup", "create", "s", "g", "$", "mkstream"))
+	assert.Equal(t, "-BUSYGROUP Consumer Group name already exists\r\n", execCommand(c, "xgroup", "create", "s", "g", "0"))
+	assert.Equal(t, "-NOGROUP No such consumer group 'x' for key name 's'\r\n", execCommand(c, "xgroup", "setid", "s", "x", "0"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "xgroup", "createconsumer", "s", "g", "alice"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "xgroup", "createconsumer", "s", "g", "alice"))
+
+	execCommand(c, "xadd", "s", "1", "a", "1")
+	execCommand(c, "xadd", "s", "2", "b", "2")
+	entry1 := "*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"
+	entry2 := "*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"
+	assert.Equal(t, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n"+entry1, execCommand(c, "xreadgroup", "group", "g", "alice", "count", "1", "streams", "s", ">"))
+	assert.Equal(t, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n"+entry2, execCommand(c, "xreadgroup", "group", "g", "bob", "streams", "s", ">"))
+	assert.Equal(t, "*-1\r\n", execCommand(c, "xreadgroup", "group", "g", "bob", "streams", "s", ">"))
+	// the history of the consumer.
+	assert.Equal(t, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n"+entry1, execCommand(c, "xreadgroup", "group", "g", "alice", "streams", "s", "0"))
+
+	assert.Equal(t, "*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n",
+		execCommand(c, "xpending", "s", "g"))
+	rep := execCommand(c, "xpending", "s", "g", "-", "+", "10", "alice")
+	assert.True(t, strings.HasPrefix(rep, "*1\r\n*4\r\n$3\r\n1-0\r\n$5\r\nalice\r\n:"))
+	assert.True(t, strings.HasSuffix(rep, "\r\n:2\r\n"))
+
+	assert.Equal(t, ":1\r\n", execCommand(c, "xack", "s", "g", "1", "3"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "xack", "s", "g", "1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "xack", "s", "nogroup", "1"))
+	assert.Equal(t, "*1\r\n*2\r\n$1\r\ns\r\n*0\r\n", execCommand(c, "xreadgroup", "group", "g", "alice", "streams", "s", "0"))
+
+	// the deleted entries are replied with null fields.
+	execCommand(c, "xdel", "s", "2")
+	assert.Equal(t, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*-1\r\n", execCommand(c, "xreadgroup", "group", "g", "bob", "streams", "s", "0"))
+
+	assert.Equal(t, "-NOGROUP No such key 's' or consumer group 'x' in XREADGROUP with GROUP option\r\n", execCommand(c, "xreadgroup", "group", "x", "c", "streams", "s", ">"))
+	assert.Equal(t, "-ERR Missing GROUP option for XREADGROUP\r\n", execCommand(c, "xreadgroup", "count", "1", "noack", "streams", "s", ">"))
+	assert.Equal(t, "-ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.\r\n", execCommand(c, "xread", "streams", "s", ">"))
+	assert.Equal(t, "-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.\r\n", execCommand(c, "xread", "streams", "s", "t", "0"))
+
+	assert.Equal(t, ":1\r\n", execCommand(c, "xgroup", "delconsumer", "s", "g", "bob"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "xgroup", "destroy", "s", "g"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "xgroup", "destroy", "s", "g"))
+}
+
+func TestXclaimCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "xgroup", "create", "s", "g", "0", "mkstream")
+	for i := 1; i <= 3; i++ {
+		execCommand(c, "xadd", "s", strconv.Itoa(i), "f", strconv.Itoa(i))
+	}
+	execCommand(c, "xreadgroup", "group", "g", "alice", "streams", "s", ">")
+
+	// the entries are not idle enough.
+	assert.Equal(t, "*0\r\n", execCommand(c, "xclaim", "s", "g", "bob", "100000", "1"))
+	assert.Equal(t, "*1\r\n$3\r\n1-0\r\n", execCommand(c, "xclaim", "s", "g", "bob", "0", "1", "justid"))
+	assert.Equal(t, "*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\n2\r\n", execCommand(c, "xclaim", "s", "g", "bob", "0", "2", "retrycount", "5"))
+	rep := execCommand(c, "xpending", "s", "g", "-", "+", "10", "bob")
+	assert.True(t, strings.HasSuffix(rep, "\r\n:5\r\n"))
+	assert.Equal(t, "-ERR Unrecognized XCLAIM option 'foo'\r\n", execCommand(c, "xclaim", "s", "g", "bob", "0", "1", "foo"))
+	assert.Equal(t, "-ERR Invalid min-idle-time argument for XCLAIM\r\n", execCommand(c, "xclaim", "s", "g", "bob", "x", "1"))
+
+	// XAUTOCLAIM removes the deleted entries from the PEL.
+	execCommand(c, "xdel", "s", "2")
+	assert.Equal(t, "*3\r\n$3\r\n3-0\r\n*1\r\n$3\r\n1-0\r\n*1\r\n$3\r\n2-0\r\n", execCommand(c, "xautoclaim", "s", "g", "carol", "0", "0", "count", "2", "justid"))
+	assert.Equal(t, "*3\r\n$3\r\n0-0\r\n*1\r\n$3\r\n3-0\r\n*0\r\n", execCommand(c, "xautoclaim", "s", "g", "carol", "0", "(2", "justid"))
+	assert.Equal(t, "-ERR COUNT must be > 0\r\n", execCommand(c, "xautoclaim", "s", "g", "carol", "0", "0", "count", "0"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "xack", "s", "g", "2"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "xack", "s", "g", "1", "3"))
+}
+
+func TestXreadBlockCmd(t *testing.T) {
+	c := testClient()
+	c1, c2 := CreateClient(c.fd), CreateClient(c.fd)
+	execCommand(c, "xadd", "s", "1", "a", "1")
+	entry1 := "*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"
+	assert.Equal(t, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n"+entry1, execCommand(c, "xread", "streams", "nokey", "s", "0", "0"))
+	assert.Equal(t, "*-1\r\n", execCommand(c, "xread", "streams", "s", "$"))
+
+	assert.Equal(t, "", execCommand(c1, "xread", "block", "0", "streams", "s", "$"))
+	execCommand(c, "xgroup", "create", "s", "g", "$")
+	assert.Equal(t, "", execCommand(c2, "xreadgroup", "group", "g", "alice", "block", "0", "streams", "s", ">"))
+	assert.Equal(t, CLIENT_BLOCKED, c2.flags&CLIENT_BLOCKED)
+	execCommand(c, "xadd", "s", "2", "b", "2")
+	entry2 := "*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"
+	assert.Equal(t, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n"+entry2, takeReply(c1))
+	assert.Equal(t, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n"+entry2, takeReply(c2))
+	assert.Equal(t, 0, len(c.db.blockingKeys))
+	assert.Equal(t, ":1\r\n", execCommand(c, "xack", "s", "g", "2"))
+
+	// the clients blocked on a destroyed group get an error.
+	execCommand(c2, "xreadgroup", "group", "g", "alice", "block", "0", "streams", "s", ">")
+	execCommand(c, "xgroup", "destroy", "s", "g")
+	assert.Equal(t, "-NOGROUP the consumer group this client was blocked on no longer exists\r\n", takeReply(c2))
+
+	assert.Equal(t, "-ERR timeout is negative\r\n", execCommand(c1, "xread", "block", "-1", "streams", "s", "$"))
+	assert.Equal(t, "-ERR timeout is out of range\r\n", execCommand(c1, "xread", "block", "9223372036854775807", "streams", "s", "$"))
+	execCommand(c1, "xread", "block", "10", "streams", "s", "$")
+	te := server.aeLoop.TimeEventHead
+	server.aeLoop.AeProcessEvents([]*AeTimeEvent{te}, nil)
+	assert.Equal(t, "*-1\r\n", takeReply(c1))
+}
+
+func TestXinfoCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "-ERR no such key\r\n", execCommand(c, "xinfo", "stream", "s"))
+	execCommand(c, "xadd", "s", "1", "a", "1")
+	execCommand(c, "xadd", "s", "2", "b", "2")
+	execCommand(c, "xgroup", "create", "s", "g", "0")
+	execCommand(c, "xreadgroup", "group", "g", "alice", "count", "1", "streams", "s", ">")
+
+	rep := execCommand(c, "xinfo", "stream", "s")
+	assert.True(t, strings.HasPrefix(rep, "*20\r\n$6\r\nlength\r\n:2\r\n"))
+	assert.Contains(t, rep, "$17\r\nlast-generated-id\r\n$3\r\n2-0\r\n")
+	assert.Contains(t, rep, "$11\r\nfirst-entry\r\n*2\r\n$3\r\n1-0\r\n")
+	assert.Equal(t, "*1\r\n*12\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:1\r\n$7\r\npending\r\n:1\r\n"+
+		"$17\r\nlast-delivered-id\r\n$3\r\n1-0\r\n$12\r\nentries-read\r\n:1\r\n$3\r\nlag\r\n:1\r\n",
+		execCommand(c, "xinfo", "groups", "s"))
+	rep = execCommand(c, "xinfo", "consumers", "s", "g")
+	assert.True(t, strings.HasPrefix(rep, "*1\r\n*8\r\n$4\r\nname\r\n$5\r\nalice\r\n$7\r\npending\r\n:1\r\n"))
+	assert.Equal(t, "-ERR unknown subcommand or wrong number of arguments for 'foo'. Try XINFO HELP.\r\n", execCommand(c, "xinfo", "foo", "s"))
+
+	entry1 := "*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"
+	entry2 := "*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"
+	rep = execCommand(c, "xinfo", "stream", "s", "full")
+	assert.True(t, strings.HasPrefix(rep, "*18\r\n$6\r\nlength\r\n:2\r\n"))
+	assert.Contains(t, rep, "$7\r\nentries\r\n*2\r\n"+entry1+entry2+"$6\r\ngroups\r\n*1\r\n*14\r\n$4\r\nname\r\n$1\r\ng\r\n")
+	assert.Contains(t, rep, "$9\r\npel-count\r\n:1\r\n$7\r\npending\r\n*1\r\n*4\r\n$3\r\n1-0\r\n$5\r\nalice\r\n:")
+	assert.Contains(t, rep, "$9\r\nconsumers\r\n*1\r\n*10\r\n$4\r\nname\r\n$5\r\nalice\r\n")
+	// the PEL of the consumer, with a delivery count of 1.
+	assert.Contains(t, rep, "$9\r\npel-count\r\n:1\r\n$7\r\npending\r\n*1\r\n*3\r\n$3\r\n1-0\r\n:")
+	assert.True(t, strings.HasSuffix(rep, "\r\n:1\r\n"))
+	rep = execCommand(c, "xinfo", "stream", "s", "full", "count", "1")
+	assert.Contains(t, rep, "$7\r\nentries\r\n*1\r\n"+entry1+"$6\r\ngroups\r\n")
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "xinfo", "stream", "s", "foo"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "xinfo", "stream", "s", "full", "limit", "1"))
+	assert.Equal(t, "-ERR unknown subcommand or wrong number of arguments for 'stream'. Try XINFO HELP.\r\n", execCommand(c, "xinfo", "stream", "s", "full", "count"))
+}
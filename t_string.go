@@ -0,0 +1,527 @@
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+const PROTO_MAX_BULK_LEN int64 = 512 * 1024 * 1024
+
+// flags of the set and getex family commands.
+const (
+	OBJ_NO_FLAGS int = 0
+	OBJ_SET_NX   int = 1 << 0 // set if key not exists.
+	OBJ_SET_XX   int = 1 << 1 // set if key exists.
+	OBJ_EX       int = 1 << 2 // set if time in seconds is given.
+	OBJ_PX       int = 1 << 3 // set if time in ms is given.
+	OBJ_EXAT     int = 1 << 4 // set if timestamp in seconds is given.
+	OBJ_PXAT     int = 1 << 5 // set if timestamp in ms is given.
+	OBJ_PERSIST  int = 1 << 6 // set if we need to remove the ttl.
+	OBJ_KEEPTTL  int = 1 << 7 // set if we need to keep the ttl.
+	OBJ_SET_GET  int = 1 << 8 // set if we need to reply the old value.
+)
+
+const (
+	COMMAND_GET int = 0
+	COMMAND_SET int = 1
+)
+
+const (
+	UNIT_SECONDS      int = 0
+	UNIT_MILLISECONDS int = 1
+)
+
+func checkStringLength(c *RedisClient, size int64) bool {
+	if size > PROTO_MAX_BULK_LEN {
+		c.AddReplyError("string exceeds maximum allowed size (proto-max-bulk-len)")
+		return false
+	}
+	return true
+}
+
+// getExpireMillisecondsOrReply convert the expire argument of command into
+// an absolute unix time in ms, reply an error and return false if invalid.
+func getExpireMillisecondsOrReply(c *RedisClient, expire *RedisObj, flags int, unit int) (int64, bool) {
+	ms, ok := getLongLongFromObjectOrReply(c, expire, "")
+	if !ok {
+		return 0, false
+	}
+	if ms <= 0 || (unit == UNIT_SECONDS && ms > math.MaxInt64/1000) {
+		c.AddReplyErrorFormat("invalid expire time in '%s' command", c.args[0].StrVal())
+		return 0, false
+	}
+	if unit == UNIT_SECONDS {
+		ms *= 1000
+	}
+	if flags&(OBJ_EX|OBJ_PX) != 0 {
+		now := GetMsTime()
+		if ms > math.MaxInt64-now {
+			c.AddReplyErrorFormat("invalid expire time in '%s' command", c.args[0].StrVal())
+			return 0, false
+		}
+		ms += now
+	}
+	return ms, true
+}
+
+// parseExtendedStringArgumentsOrReply parse the options of SET and GETEX
+// starting from c.args[3] or c.args[2], it returns the flags, the unit and
+// the expire argument, or reply a syntax error and return false.
+func parseExtendedStringArgumentsOrReply(c *RedisClient, commandType int) (flags int, unit int, expire *RedisObj, ok bool) {
+	unit = UNIT_SECONDS
+	start := 2
+	if commandType == COMMAND_SET {
+		start = 3
+	}
+	for i := start; i < len(c.args); i++ {
+		opt := strings.ToLower(c.args[i].StrVal())
+		var next *RedisObj
+		if i+1 < len(c.args) {
+			next = c.args[i+1]
+		}
+		expireFlags := OBJ_EX | OBJ_PX | OBJ_EXAT | OBJ_PXAT
+		if opt == "nx" && flags&OBJ_SET_XX == 0 && commandType == COMMAND_SET {
+			flags |= OBJ_SET_NX
+		} else if opt == "xx" && flags&OBJ_SET_NX == 0 && commandType == COMMAND_SET {
+			flags |= OBJ_SET_XX
+		} else if opt == "get" && commandType == COMMAND_SET {
+			flags |= OBJ_SET_GET
+		} else if opt == "keepttl" && flags&(OBJ_PERSIST|expireFlags) == 0 && commandType == COMMAND_SET {
+			flags |= OBJ_KEEPTTL
+		} else if opt == "persist" && flags&(OBJ_KEEPTTL|expireFlags) == 0 && commandType == COMMAND_GET {
+			flags |= OBJ_PERSIST
+		} else if opt == "ex" && flags&(OBJ_KEEPTTL|OBJ_PERSIST|expireFlags&^OBJ_EX) == 0 && next != nil {
+			flags |= OBJ_EX
+			expire = next
+			i++
+		} else if opt == "px" && flags&(OBJ_KEEPTTL|OBJ_PERSIST|expireFlags&^OBJ_PX) == 0 && next != nil {
+			flags |= OBJ_PX
+			unit = UNIT_MILLISECONDS
+			expire = next
+			i++
+		} else if opt == "exat" && flags&(OBJ_KEEPTTL|OBJ_PERSIST|expireFlags&^OBJ_EXAT) == 0 && next != nil {
+			flags |= OBJ_EXAT
+			expire = next
+			i++
+		} else if opt == "pxat" && flags&(OBJ_KEEPTTL|OBJ_PERSIST|expireFlags&^OBJ_PXAT) == 0 && next != nil {
+			flags |= OBJ_PXAT
+			unit = UNIT_MILLISECONDS
+			expire = next
+			i++
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return flags, unit, expire, false
+		}
+	}
+	return flags, unit, expire, true
+}
+
+// setGenericCommand implement SET, SETEX, PSETEX and SETNX. expire is nil if
+// no expire is given, okReply and abortReply are used when the key is set or
+// not set because of NX or XX, nil means the default reply.
+func setGenericCommand(c *RedisClient, flags int, key, val, expire *RedisObj, unit int, okReply, abortReply *RedisObj) {
+	var when int64
+	if expire != nil {
+		var ok bool
+		if when, ok = getExpireMillisecondsOrReply(c, expire, flags, unit); !ok {
+			return
+		}
+	}
+
+	// reply the old value first, nothing is set if it's not a string.
+	if flags&OBJ_SET_GET != 0 {
+		if !getGenericCommand(c) {
+			return
+		}
+	}
+
+	found := lookupKeyWrite(c.db, key) != nil
+	if (flags&OBJ_SET_NX != 0 && found) || (flags&OBJ_SET_XX != 0 && !found) {
+		if flags&OBJ_SET_GET == 0 {
+			if abortReply == nil {
+				abortReply = shared.nullBulk
+			}
+			c.AddReply(abortReply)
+		}
+		return
+	}
+
+	setKey(c.db, key, val, flags&OBJ_KEEPTTL != 0)
+	if expire != nil {
+		if when <= GetMsTime() {
+			// an absolute time in the past makes the key expire at once.
+			dbDelete(c.db, key)
+		} else {
+			setExpire(c.db, key, when)
+		}
+	}
+	if flags&OBJ_SET_GET == 0 {
+		if okReply == nil {
+			okReply = shared.ok
+		}
+		c.AddReply(okReply)
+	}
+}
+
+// setCommand implement SET key value [NX|XX] [GET] [EX seconds|PX ms|EXAT timestamp|PXAT ms-timestamp|KEEPTTL]
+func setCommand(c *RedisClient) {
+	flags, unit, expire, ok := parseExtendedStringArgumentsOrReply(c, COMMAND_SET)
+	if !ok {
+		return
+	}
+	c.args[2] = tryObjectEncoding(c.args[2])
+	setGenericCommand(c, flags, c.args[1], c.args[2], expire, unit, nil, nil)
+}
+
+func setnxCommand(c *RedisClient) {
+	c.args[2] = tryObjectEncoding(c.args[2])
+	setGenericCommand(c, OBJ_SET_NX, c.args[1], c.args[2], nil, UNIT_SECONDS, shared.cone, shared.czero)
+}
+
+func setexCommand(c *RedisClient) {
+	c.args[3] = tryObjectEncoding(c.args[3])
+	setGenericCommand(c, OBJ_EX, c.args[1], c.args[3], c.args[2], UNIT_SECONDS, nil, nil)
+}
+
+func psetexCommand(c *RedisClient) {
+	c.args[3] = tryObjectEncoding(c.args[3])
+	setGenericCommand(c, OBJ_PX, c.args[1], c.args[3], c.args[2], UNIT_MILLISECONDS, nil, nil)
+}
+
+// getGenericCommand reply the value of key, return false if the key holds
+// a value of wrong type.
+func getGenericCommand(c *RedisClient) bool {
+	val := lookupKeyReadOrReply(c, c.args[1], shared.nullBulk)
+	if val == nil {
+		return true
+	}
+	if checkType(c, val, REDISSTR) {
+		return false
+	}
+	c.AddReplyBulk(val)
+	return true
+}
+
+func getCommand(c *RedisClient) {
+	getGenericCommand(c)
+}
+
+func getsetCommand(c *RedisClient) {
+	if !getGenericCommand(c) {
+		return
+	}
+	c.args[2] = tryObjectEncoding(c.args[2])
+	setKey(c.db, c.args[1], c.args[2], false)
+}
+
+func getdelCommand(c *RedisClient) {
+	if !getGenericCommand(c) {
+		return
+	}
+	dbDelete(c.db, c.args[1])
+}
+
+// getexCommand implement GETEX key [EX seconds|PX ms|EXAT timestamp|PXAT ms-timestamp|PERSIST]
+func getexCommand(c *RedisClient) {
+	flags, unit, expire, ok := parseExtendedStringArgumentsOrReply(c, COMMAND_GET)
+	if !ok {
+		return
+	}
+
+	key := c.args[1]
+	val := lookupKeyRead(c.db, key)
+	if val != nil && val.Type_ != REDISSTR {
+		c.AddReply(shared.wrongTypeErr)
+		return
+	}
+	var when int64
+	if expire != nil {
+		if when, ok = getExpireMillisecondsOrReply(c, expire, flags, unit); !ok {
+			return
+		}
+	}
+	if val == nil {
+		c.AddReplyNullBulk()
+		return
+	}
+	c.AddReplyBulk(val)
+
+	if expire != nil {
+		if when <= GetMsTime() {
+			dbDelete(c.db, key)
+		} else {
+			setExpire(c.db, key, when)
+		}
+	} else if flags&OBJ_PERSIST != 0 {
+		removeExpire(c.db, key)
+	}
+}
+
+func appendCommand(c *RedisClient) {
+	key := c.args[1]
+	val := lookupKeyWrite(c.db, key)
+	if val == nil {
+		dbAdd(c.db, key, c.args[2])
+		c.AddReplyInt(int64(len(c.args[2].StrVal())))
+		return
+	}
+	if checkType(c, val, REDISSTR) {
+		return
+	}
+	str := val.StrVal()
+	appendStr := c.args[2].StrVal()
+	if !checkStringLength(c, int64(len(str)+len(appendStr))) {
+		return
+	}
+	str += appendStr
+	newVal := tryObjectEncoding(CreateObject(REDISSTR, str))
+	dbOverwrite(c.db, key, newVal)
+	newVal.DecrRefCount()
+	c.AddReplyInt(int64(len(str)))
+}
+
+func strlenCommand(c *RedisClient) {
+	val := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if val == nil || checkType(c, val, REDISSTR) {
+		return
+	}
+	c.AddReplyInt(int64(stringObjectLen(val)))
+}
+
+func getrangeCommand(c *RedisClient) {
+	start, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	end, ok := getLongLongFromObjectOrReply(c, c.args[3], "")
+	if !ok {
+		return
+	}
+	val := lookupKeyReadOrReply(c, c.args[1], shared.emptyBulk)
+	if val == nil || checkType(c, val, REDISSTR) {
+		return
+	}
+
+	strLen := int64(stringObjectLen(val))
+	if start < 0 && end < 0 && start > end {
+		c.AddReply(shared.emptyBulk)
+		return
+	}
+	if start < 0 {
+		start += strLen
+	}
+	if end < 0 {
+		end += strLen
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= strLen {
+		end = strLen - 1
+	}
+	if start > end || strLen == 0 {
+		c.AddReply(shared.emptyBulk)
+		return
+	}
+	// a compressed string is only decompressed up to end.
+	c.AddReplyBulkStr(stringObjectPrefix(val, int(end+1))[start:])
+}
+
+func setrangeCommand(c *RedisClient) {
+	key := c.args[1]
+	offset, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	if offset < 0 {
+		c.AddReplyError("offset is out of range")
+		return
+	}
+	value := c.args[3].StrVal()
+
+	val := lookupKeyWrite(c.db, key)
+	var str string
+	if val == nil {
+		// return 0 when setting nothing on a non-existing string.
+		if len(value) == 0 {
+			c.AddReply(shared.czero)
+			return
+		}
+	} else {
+		if checkType(c, val, REDISSTR) {
+			return
+		}
+		// return existing string length when setting nothing.
+		if len(value) == 0 {
+			c.AddReplyInt(int64(stringObjectLen(val)))
+			return
+		}
+		str = val.StrVal()
+	}
+	if !checkStringLength(c, offset+int64(len(value))) {
+		return
+	}
+
+	buf := []byte(str)
+	if need := int(offset) + len(value); need > len(buf) {
+		buf = append(buf, make([]byte, need-len(buf))...)
+	}
+	copy(buf[offset:], value)
+	newVal := tryObjectEncoding(CreateObject(REDISSTR, string(buf)))
+	if val == nil {
+		dbAdd(c.db, key, newVal)
+	} else {
+		dbOverwrite(c.db, key, newVal)
+	}
+	newVal.DecrRefCount()
+	c.AddReplyInt(int64(len(buf)))
+}
+
+func mgetCommand(c *RedisClient) {
+	c.AddReplyArrayLen(len(c.args) - 1)
+	for _, key := range c.args[1:] {
+		val := lookupKeyRead(c.db, key)
+		if val == nil || val.Type_ != REDISSTR {
+			c.AddReplyNullBulk()
+		} else {
+			c.AddReplyBulk(val)
+		}
+	}
+}
+
+func msetGenericCommand(c *RedisClient, nx bool) {
+	if len(c.args)%2 == 0 {
+		c.AddReplyErrorFormat("wrong number of arguments for '%s' command", c.args[0].StrVal())
+		return
+	}
+	// MSETNX set nothing if any of the keys exists.
+	if nx {
+		for i := 1; i < len(c.args); i += 2 {
+			if lookupKeyWrite(c.db, c.args[i]) != nil {
+				c.AddReply(shared.czero)
+				return
+			}
+		}
+	}
+	for i := 1; i < len(c.args); i += 2 {
+		c.args[i+1] = tryObjectEncoding(c.args[i+1])
+		setKey(c.db, c.args[i], c.args[i+1], false)
+	}
+	if nx {
+		c.AddReply(shared.cone)
+	} else {
+		c.AddReply(shared.ok)
+	}
+}
+
+func msetCommand(c *RedisClient) {
+	msetGenericCommand(c, false)
+}
+
+func msetnxCommand(c *RedisClient) {
+	msetGenericCommand(c, true)
+}
+
+func incrDecrCommand(c *RedisClient, incr int64) {
+	key := c.args[1]
+	val := lookupKeyWrite(c.db, key)
+	if val != nil && checkType(c, val, REDISSTR) {
+		return
+	}
+	var value int64
+	if val != nil {
+		var ok bool
+		if value, ok = getLongLongFromObjectOrReply(c, val, ""); !ok {
+			return
+		}
+	}
+	if (incr < 0 && value < 0 && incr < math.MinInt64-value) ||
+		(incr > 0 && value > 0 && incr > math.MaxInt64-value) {
+		c.AddReplyError("increment or decrement would overflow")
+		return
+	}
+	value += incr
+
+	if val != nil && val.refCount == 1 && val.encoding == REDIS_ENCODING_INT &&
+		(value < 0 || value >= OBJ_SHARED_INTEGERS) {
+		// the value is owned only by the db, update it in place.
+		val.Val_ = value
+		if val.mcmeta != nil {
+			val.mcmeta.cas = memcachedNextCAS()
+		}
+	} else {
+		newVal := CreateFromInt(value)
+		if val == nil {
+			dbAdd(c.db, key, newVal)
+		} else {
+			dbOverwrite(c.db, key, newVal)
+		}
+		newVal.DecrRefCount()
+	}
+	c.AddReplyInt(value)
+}
+
+func incrCommand(c *RedisClient) {
+	incrDecrCommand(c, 1)
+}
+
+func decrCommand(c *RedisClient) {
+	incrDecrCommand(c, -1)
+}
+
+func incrbyCommand(c *RedisClient) {
+	incr, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	incrDecrCommand(c, incr)
+}
+
+func decrbyCommand(c *RedisClient) {
+	incr, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	// overflow if we negate math.MinInt64.
+	if incr == math.MinInt64 {
+		c.AddReplyError("decrement would overflow")
+		return
+	}
+	incrDecrCommand(c, -incr)
+}
+
+func incrbyfloatCommand(c *RedisClient) {
+	key := c.args[1]
+	val := lookupKeyWrite(c.db, key)
+	if val != nil && checkType(c, val, REDISSTR) {
+		return
+	}
+	var value float64
+	if val != nil {
+		var ok bool
+		if value, ok = getLongDoubleFromObjectOrReply(c, val, ""); !ok {
+			return
+		}
+	}
+	incr, ok := getLongDoubleFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	value += incr
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		c.AddReplyError("increment would produce NaN or Infinity")
+		return
+	}
+
+	newVal := CreateObject(REDISSTR, ld2string(value))
+	if val == nil {
+		dbAdd(c.db, key, newVal)
+	} else {
+		dbOverwrite(c.db, key, newVal)
+	}
+	c.AddReplyBulk(newVal)
+	newVal.DecrRefCount()
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestSetnxCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":1\r\n", execCommand(c, "setnx", "key", "v1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "setnx", "key", "v2"))
+	assert.Equal(t, "$2\r\nv1\r\n", execCommand(c, "get", "key"))
+}
+
+func TestSetexCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "+OK\r\n", execCommand(c, "setex", "key", "100", "val"))
+	assert.Equal(t, "$3\r\nval\r\n", execCommand(c, "get", "key"))
+	key := CreateObject(REDISSTR, "key")
+	when := getExpire(c.db, key)
+	assert.True(t, when > GetMsTime()+99000 && when <= GetMsTime()+100000)
+
+	assert.Equal(t, "+OK\r\n", execCommand(c, "psetex", "key", "100000", "val"))
+	when = getExpire(c.db, key)
+	assert.True(t, when > GetMsTime()+99000 && when <= GetMsTime()+100000)
+
+	assert.Equal(t, "-ERR invalid expire time in 'setex' command\r\n", execCommand(c, "setex", "key", "0", "val"))
+	assert.Equal(t, "-ERR invalid expire time in 'psetex' command\r\n", execCommand(c, "psetex", "key", "-1", "val"))
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", execCommand(c, "setex", "key", "a", "val"))
+
+	// set clears the ttl.
+	assert.Equal(t, "+OK\r\n", execCommand(c, "set", "key", "val"))
+	assert.Equal(t, int64(-1), getExpire(c.db, key))
+}
+
+func TestGetsetCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "$-1\r\n", execCommand(c, "getset", "key", "v1"))
+	execCommand(c, "setex", "key", "100", "v1")
+	assert.Equal(t, "$2\r\nv1\r\n", execCommand(c, "getset", "key", "v2"))
+	assert.Equal(t, "$2\r\nv2\r\n", execCommand(c, "get", "key"))
+	assert.Equal(t, int64(-1), getExpire(c.db, CreateObject(REDISSTR, "key")))
+}
+
+func TestGetdelCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "$-1\r\n", execCommand(c, "getdel", "key"))
+	execCommand(c, "set", "key", "val")
+	assert.Equal(t, "$3\r\nval\r\n", execCommand(c, "getdel", "key"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "key"))
+}
+
+func TestGetexCmd(t *testing.T) {
+	c := testClient()
+	key := CreateObject(REDISSTR, "key")
+	assert.Equal(t, "$-1\r\n", execCommand(c, "getex", "key", "ex", "10"))
+	execCommand(c, "set", "key", "val")
+
+	assert.Equal(t, "$3\r\nval\r\n", execCommand(c, "getex", "key", "ex", "100"))
+	when := getExpire(c.db, key)
+	assert.True(t, when > GetMsTime()+99000 && when <= GetMsTime()+100000)
+
+	assert.Equal(t, "$3\r\nval\r\n", execCommand(c, "getex", "key", "persist"))
+	assert.Equal(t, int64(-1), getExpire(c.db, key))
+
+	at := strconv.FormatInt(GetMsTime()+100000, 10)
+	assert.Equal(t, "$3\r\nval\r\n", execCommand(c, "getex", "key", "pxat", at))
+	assert.Equal(t, at, strconv.FormatInt(getExpire(c.db, key), 10))
+
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "getex", "key", "ex", "10", "persist"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "getex", "key", "ex"))
+
+	// a timestamp in the past deletes the key.
+	assert.Equal(t, "$3\r\nval\r\n", execCommand(c, "getex", "key", "exat", "1"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "key"))
+}
+
+func TestAppendCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":5\r\n", execCommand(c, "append", "key", "hello"))
+	assert.Equal(t, ":11\r\n", execCommand(c, "append", "key", " world"))
+	assert.Equal(t, "$11\r\nhello world\r\n", execCommand(c, "get", "key"))
+	assert.Equal(t, ":11\r\n", execCommand(c, "strlen", "key"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "strlen", "nokey"))
+}
+
+func TestGetrangeCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "key", "This is a string")
+	assert.Equal(t, "$4\r\nThis\r\n", execCommand(c, "getrange", "key", "0", "3"))
+	assert.Equal(t, "$3\r\ning\r\n", execCommand(c, "getrange", "key", "-3", "-1"))
+	assert.Equal(t, "$16\r\nThis is a string\r\n", execCommand(c, "getrange", "key", "0", "-1"))
+	assert.Equal(t, "$6\r\nstring\r\n", execCommand(c, "getrange", "key", "10", "100"))
+	assert.Equal(t, "$0\r\n\r\n", execCommand(c, "getrange", "key", "5", "3"))
+	assert.Equal(t, "$0\r\n\r\n", execCommand(c, "getrange", "key", "-1", "-5"))
+	assert.Equal(t, "$0\r\n\r\n", execCommand(c, "getrange", "nokey", "0", "-1"))
+}
+
+func TestSetrangeCmd(t *testing.T) {
+	c := testClient()
+	key := CreateObject(REDISSTR, "key")
+	execCommand(c, "setex", "key", "100", "Hello World")
+	assert.Equal(t, ":11\r\n", execCommand(c, "setrange", "key", "6", "Redis"))
+	assert.Equal(t, "$11\r\nHello Redis\r\n", execCommand(c, "get", "key"))
+	// setrange keeps the ttl.
+	assert.NotEqual(t, int64(-1), getExpire(c.db, key))
+
+	assert.Equal(t, ":0\r\n", execCommand(c, "setrange", "key2", "5", ""))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "key2"))
+	assert.Equal(t, ":7\r\n", execCommand(c, "setrange", "key2", "5", "ab"))
+	assert.Equal(t, "$7\r\n\x00\x00\x00\x00\x00ab\r\n", execCommand(c, "get", "key2"))
+
+	assert.Equal(t, "-ERR offset is out of range\r\n", execCommand(c, "setrange", "key", "-1", "a"))
+	assert.Equal(t, "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n",
+		execCommand(c, "setrange", "key", "536870912", "a"))
+}
+
+func TestMsetCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "+OK\r\n", execCommand(c, "mset", "k1", "v1", "k2", "v2"))
+	assert.Equal(t, "*3\r\n$2\r\nv1\r\n$2\r\nv2\r\n$-1\r\n", execCommand(c, "mget", "k1", "k2", "k3"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'mset' command\r\n", execCommand(c, "mset", "k1", "v1", "k2"))
+
+	assert.Equal(t, ":0\r\n", execCommand(c, "msetnx", "k2", "x", "k3", "v3"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "k3"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "msetnx", "k3", "v3", "k4", "v4"))
+	assert.Equal(t, "*2\r\n$2\r\nv3\r\n$2\r\nv4\r\n", execCommand(c, "mget", "k3", "k4"))
+}
+
+func TestSetOptions(t *testing.T) {
+	c := testClient()
+	key := CreateObject(REDISSTR, "key")
+
+	assert.Equal(t, "+OK\r\n", execCommand(c, "set", "key", "v1", "NX", "PX", "30000"))
+	when := getExpire(c.db, key)
+	assert.True(t, when > GetMsTime()+29000 && when <= GetMsTime()+30000)
+	assert.Equal(t, "$-1\r\n", execCommand(c, "set", "key", "v2", "nx", "px", "30000"))
+	assert.Equal(t, "$2\r\nv1\r\n", execCommand(c, "get", "key"))
+
+	assert.Equal(t, "$-1\r\n", execCommand(c, "set", "nokey", "v", "xx"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "nokey"))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "set", "key", "v2", "xx", "keepttl"))
+	assert.Equal(t, when, getExpire(c.db, key))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "set", "key", "v3", "xx"))
+	assert.Equal(t, int64(-1), getExpire(c.db, key))
+
+	assert.Equal(t, "+OK\r\n", execCommand(c, "set", "key", "v4", "ex", "100"))
+	when = getExpire(c.db, key)
+	assert.True(t, when > GetMsTime()+99000 && when <= GetMsTime()+100000)
+	at := strconv.FormatInt(GetMsTime()/1000+100, 10)
+	assert.Equal(t, "+OK\r\n", execCommand(c, "set", "key", "v4", "exat", at))
+	assert.Equal(t, at+"000", strconv.FormatInt(getExpire(c.db, key), 10))
+	at = strconv.FormatInt(GetMsTime()+100000, 10)
+	assert.Equal(t, "+OK\r\n", execCommand(c, "set", "key", "v4", "pxat", at))
+	assert.Equal(t, at, strconv.FormatInt(getExpire(c.db, key), 10))
+	assert.Equal(t, "+OK\r\n", execCommand(c, "set", "key", "v4", "pxat", "1"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "key"))
+
+	syntaxErr := "-ERR syntax error\r\n"
+	assert.Equal(t, syntaxErr, execCommand(c, "set", "key", "v", "nx", "xx"))
+	assert.Equal(t, syntaxErr, execCommand(c, "set", "key", "v", "ex", "10", "px", "100"))
+	assert.Equal(t, syntaxErr, execCommand(c, "set", "key", "v", "ex", "10", "keepttl"))
+	assert.Equal(t, syntaxErr, execCommand(c, "set", "key", "v", "keepttl", "exat", "10"))
+	assert.Equal(t, syntaxErr, execCommand(c, "set", "key", "v", "ex"))
+	assert.Equal(t, syntaxErr, execCommand(c, "set", "key", "v", "persist"))
+	assert.Equal(t, syntaxErr, execCommand(c, "set", "key", "v", "foo"))
+	assert.Equal(t, "-ERR invalid expire time in 'set' command\r\n", execCommand(c, "set", "key", "v", "ex", "0"))
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", execCommand(c, "set", "key", "v", "px", "1.5"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "key"))
+}
+
+func TestSetGetOption(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "$-1\r\n", execCommand(c, "set", "key", "v1", "get"))
+	assert.Equal(t, "$2\r\nv1\r\n", execCommand(c, "set", "key", "v2", "get"))
+	assert.Equal(t, "$2\r\nv2\r\n", execCommand(c, "get", "key"))
+
+	// nothing is set when the condition fails, but the old value is replied.
+	assert.Equal(t, "$2\r\nv2\r\n", execCommand(c, "set", "key", "v3", "nx", "get"))
+	assert.Equal(t, "$2\r\nv2\r\n", execCommand(c, "get", "key"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "set", "nokey", "v3", "xx", "get"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "get", "nokey"))
+}
+
+func TestIncrDecrCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":1\r\n", execCommand(c, "incr", "cnt"))
+	assert.Equal(t, ":11\r\n", execCommand(c, "incrby", "cnt", "10"))
+	assert.Equal(t, ":10\r\n", execCommand(c, "decr", "cnt"))
+	assert.Equal(t, ":-5\r\n", execCommand(c, "decrby", "cnt", "15"))
+	assert.Equal(t, "$2\r\n-5\r\n", execCommand(c, "get", "cnt"))
+
+	// incr keeps the ttl.
+	execCommand(c, "setex", "cnt", "100", "5")
+	assert.Equal(t, ":6\r\n", execCommand(c, "incr", "cnt"))
+	assert.NotEqual(t, int64(-1), getExpire(c.db, CreateObject(REDISSTR, "cnt")))
+
+	notInt := "-ERR value is not an integer or out of range\r\n"
+	execCommand(c, "set", "str", "abc")
+	assert.Equal(t, notInt, execCommand(c, "incr", "str"))
+	execCommand(c, "set", "str", " 1")
+	assert.Equal(t, notInt, execCommand(c, "incr", "str"))
+	execCommand(c, "set", "str", "01")
+	assert.Equal(t, notInt, execCommand(c, "incr", "str"))
+	assert.Equal(t, notInt, execCommand(c, "incrby", "cnt", "1.5"))
+	assert.Equal(t, notInt, execCommand(c, "incrby", "cnt", "9223372036854775808"))
+
+	execCommand(c, "set", "max", "9223372036854775807")
+	assert.Equal(t, "-ERR increment or decrement would overflow\r\n", execCommand(c, "incr", "max"))
+	execCommand(c, "set", "min", "-9223372036854775808")
+	assert.Equal(t, "-ERR increment or decrement would overflow\r\n", execCommand(c, "decr", "min"))
+	assert.Equal(t, "-ERR decrement would overflow\r\n", execCommand(c, "decrby", "cnt", "-9223372036854775808"))
+}
+
+func TestIncrbyfloatCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "set", "key", "10.50")
+	assert.Equal(t, "$4\r\n10.6\r\n", execCommand(c, "incrbyfloat", "key", "0.1"))
+	assert.Equal(t, "$3\r\n5.6\r\n", execCommand(c, "incrbyfloat", "key", "-5"))
+	execCommand(c, "set", "key", "5.0e3")
+	assert.Equal(t, "$4\r\n5200\r\n", execCommand(c, "incrbyfloat", "key", "2.0e2"))
+	assert.Equal(t, "$3\r\n1.5\r\n", execCommand(c, "incrbyfloat", "new", "1.5"))
+	// the rounding noise of the float64 sum is not shown nor stored.
+	assert.Equal(t, "$3\r\n0.1\r\n", execCommand(c, "incrbyfloat", "sum", "0.1"))
+	assert.Equal(t, "$3\r\n0.3\r\n", execCommand(c, "incrbyfloat", "sum", "0.2"))
+	assert.Equal(t, "$3\r\n0.3\r\n", execCommand(c, "get", "sum"))
+	assert.Equal(t, "$21\r\n100000000000000000000\r\n", execCommand(c, "incrbyfloat", "big", "1e20"))
+
+	assert.Equal(t, "-ERR value is not a valid float\r\n", execCommand(c, "incrbyfloat", "key", "abc"))
+	assert.Equal(t, "-ERR value is not a valid float\r\n", execCommand(c, "incrbyfloat", "key", " 1"))
+	assert.Equal(t, "-ERR increment would produce NaN or Infinity\r\n", execCommand(c, "incrbyfloat", "key", "inf"))
+	assert.Equal(t, "$4\r\n5200\r\n", execCommand(c, "get", "key"))
+}
@@ -0,0 +1,946 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// zset is the value of a REDISZSET object, dict maps the members to their
+// scores and zsl orders the members by score.
+type zset struct {
+	dict *Dict
+	zsl  *ZSkiplist
+}
+
+// input flags of zsetAdd.
+const (
+	ZADD_IN_NONE int = 0
+	ZADD_IN_INCR int = 1 << 0 // increment the score instead of setting it.
+	ZADD_IN_NX   int = 1 << 1 // don't touch elements not already existing.
+	ZADD_IN_XX   int = 1 << 2 // only touch elements already existing.
+	ZADD_IN_GT   int = 1 << 3 // only update if the new score is greater.
+	ZADD_IN_LT   int = 1 << 4 // only update if the new score is less.
+)
+
+// output flags of zsetAdd.
+const (
+	ZADD_OUT_NOP     int = 1 << 0 // the operation was not performed because of the flags.
+	ZADD_OUT_NAN     int = 1 << 1 // the resulting score is not a number.
+	ZADD_OUT_ADDED   int = 1 << 2 // the element was new and was added.
+	ZADD_OUT_UPDATED int = 1 << 3 // the score of the element was updated.
+)
+
+// range types of ZRANGE and ZREMRANGEBY*.
+const (
+	ZRANGE_RANK  int = 0
+	ZRANGE_SCORE int = 1
+	ZRANGE_LEX   int = 2
+)
+
+// aggregate functions of ZUNIONSTORE and ZINTERSTORE.
+const (
+	REDIS_AGGR_SUM int = 0
+	REDIS_AGGR_MIN int = 1
+	REDIS_AGGR_MAX int = 2
+)
+
+// createScoreObject return the object holding a score in the dict of a zset.
+func createScoreObject(score float64) *RedisObj {
+	return &RedisObj{Val_: score, refCount: 1}
+}
+
+func zsetLength(o *RedisObj) int64 {
+	return o.Val_.(*zset).zsl.ZslLength()
+}
+
+// zsetScore return the score of member, ok is false if it is not a member.
+func zsetScore(o *RedisObj, member *RedisObj) (float64, bool) {
+	val := o.Val_.(*zset).dict.DictGet(member)
+	if val == nil {
+		return 0, false
+	}
+	return val.Val_.(float64), true
+}
+
+// zsetAdd add member or update its score according to the ZADD_IN flags,
+// return the ZADD_OUT flags and the new score of member.
+func zsetAdd(o *RedisObj, score float64, member *RedisObj, inFlags int) (int, float64) {
+	incr := inFlags&ZADD_IN_INCR != 0
+	nx := inFlags&ZADD_IN_NX != 0
+	xx := inFlags&ZADD_IN_XX != 0
+	gt := inFlags&ZADD_IN_GT != 0
+	lt := inFlags&ZADD_IN_LT != 0
+	if math.IsNaN(score) {
+		return ZADD_OUT_NAN, 0
+	}
+
+	zs := o.Val_.(*zset)
+	if curscore, ok := zsetScore(o, member); ok {
+		if nx {
+			return ZADD_OUT_NOP, curscore
+		}
+		if incr {
+			score += curscore
+			if math.IsNaN(score) {
+				return ZADD_OUT_NAN, 0
+			}
+		}
+		if (lt && score >= curscore) || (gt && score <= curscore) {
+			return ZADD_OUT_NOP, curscore
+		}
+		if score == curscore {
+			return 0, score
+		}
+		zs.zsl.ZslUpdateScore(curscore, member, score)
+		sobj := createScoreObject(score)
+		zs.dict.DictSet(member, sobj)
+		sobj.DecrRefCount()
+		return ZADD_OUT_UPDATED, score
+	}
+	if xx {
+		return ZADD_OUT_NOP, 0
+	}
+	zs.zsl.ZslInsert(score, member)
+	sobj := createScoreObject(score)
+	zs.dict.DictAdd(member, sobj)
+	sobj.DecrRefCount()
+	return ZADD_OUT_ADDED, score
+}
+
+// zsetDel return true if member is deleted.
+func zsetDel(o *RedisObj, member *RedisObj) bool {
+	score, ok := zsetScore(o, member)
+	if !ok {
+		return false
+	}
+	zs := o.Val_.(*zset)
+	zs.zsl.ZslDelete(score, member)
+	zs.dict.DictDelete(member)
+	return true
+}
+
+// zsetRank return the rank of member starting at 0, ordered from the
+// highest score if reverse is true.
+func zsetRank(o *RedisObj, member *RedisObj, reverse bool) (int64, bool) {
+	score, ok := zsetScore(o, member)
+	if !ok {
+		return 0, false
+	}
+	rank := o.Val_.(*zset).zsl.ZslGetRank(score, member)
+	if reverse {
+		return zsetLength(o) - rank, true
+	}
+	return rank - 1, true
+}
+
+func zsetDup(o *RedisObj) *RedisObj {
+	dup := createZsetObject()
+	for ln := o.Val_.(*zset).zsl.ZslFirst(); ln != nil; ln = ln.level[0].forward {
+		zsetAdd(dup, ln.score, ln.ele, ZADD_IN_NONE)
+	}
+	return dup
+}
+
+// zslParseRangeItem parse a score bound, "(" makes it exclusive.
+func zslParseRangeItem(s string) (float64, bool, bool) {
+	ex := false
+	if len(s) > 0 && s[0] == '(' {
+		ex = true
+		s = s[1:]
+	}
+	val, ok := string2ld(s)
+	return val, ex, ok
+}
+
+// zslParseRange parse a score range as used by ZRANGE BYSCORE and ZCOUNT.
+func zslParseRange(min, max *RedisObj) (*ZRangeSpec, bool) {
+	var spec ZRangeSpec
+	var ok bool
+	if spec.min, spec.minex, ok = zslParseRangeItem(min.StrVal()); !ok {
+		return nil, false
+	}
+	if spec.max, spec.maxex, ok = zslParseRangeItem(max.StrVal()); !ok {
+		return nil, false
+	}
+	return &spec, true
+}
+
+// zslParseLexRangeItem parse a lex bound, which must start with "(" or "[",
+// or be "-" or "+" for the infinities.
+func zslParseLexRangeItem(s string) (val string, ex bool, inf int, ok bool) {
+	if len(s) == 0 {
+		return "", false, 0, false
+	}
+	switch s[0] {
+	case '+':
+		if len(s) != 1 {
+			return "", false, 0, false
+		}
+		return "", true, 1, true
+	case '-':
+		if len(s) != 1 {
+			return "", false, 0, false
+		}
+		return "", true, -1, true
+	case '(':
+		return s[1:], true, 0, true
+	case '[':
+		return s[1:], false, 0, true
+	}
+	return "", false, 0, false
+}
+
+func zslParseLexRange(min, max *RedisObj) (*ZLexRangeSpec, bool) {
+	var spec ZLexRangeSpec
+	var ok bool
+	if spec.min, spec.minex, spec.minInf, ok = zslParseLexRangeItem(min.StrVal()); !ok {
+		return nil, false
+	}
+	if spec.max, spec.maxex, spec.maxInf, ok = zslParseLexRangeItem(max.StrVal()); !ok {
+		return nil, false
+	}
+	return &spec, true
+}
+
+// zaddGenericCommand implement ZADD and ZINCRBY, flags is ZADD_IN_INCR for
+// ZINCRBY.
+func zaddGenericCommand(c *RedisClient, flags int) {
+	ch := false
+	scoreidx := 2
+	for ; scoreidx < len(c.args); scoreidx++ {
+		opt := strings.ToLower(c.args[scoreidx].StrVal())
+		if opt == "nx" {
+			flags |= ZADD_IN_NX
+		} else if opt == "xx" {
+			flags |= ZADD_IN_XX
+		} else if opt == "gt" {
+			flags |= ZADD_IN_GT
+		} else if opt == "lt" {
+			flags |= ZADD_IN_LT
+		} else if opt == "ch" {
+			ch = true
+		} else if opt == "incr" {
+			flags |= ZADD_IN_INCR
+		} else {
+			break
+		}
+	}
+	incr := flags&ZADD_IN_INCR != 0
+	nx := flags&ZADD_IN_NX != 0
+	xx := flags&ZADD_IN_XX != 0
+	gt := flags&ZADD_IN_GT != 0
+	lt := flags&ZADD_IN_LT != 0
+
+	elements := len(c.args) - scoreidx
+	if elements%2 != 0 || elements == 0 {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	elements /= 2
+	if nx && xx {
+		c.AddReplyError("XX and NX options at the same time are not compatible")
+		return
+	}
+	if (gt && nx) || (lt && nx) || (gt && lt) {
+		c.AddReplyError("GT, LT, and/or NX options at the same time are not compatible")
+		return
+	}
+	if incr && elements > 1 {
+		c.AddReplyError("INCR option supports a single increment-element pair")
+		return
+	}
+
+	// parse all the scores first, so the command is either fully executed
+	// or not at all.
+	scores := make([]float64, elements)
+	for j := 0; j < elements; j++ {
+		var ok bool
+		if scores[j], ok = getLongDoubleFromObjectOrReply(c, c.args[scoreidx+j*2], ""); !ok {
+			return
+		}
+	}
+
+	key := c.args[1]
+	zobj := lookupKeyWrite(c.db, key)
+	if zobj != nil && checkType(c, zobj, REDISZSET) {
+		return
+	}
+	var added, updated, processed int64
+	var score float64
+	if zobj == nil && !xx {
+		zobj = createZsetObject()
+		dbAdd(c.db, key, zobj)
+		zobj.DecrRefCount()
+	}
+	for j := 0; zobj != nil && j < elements; j++ {
+		var outFlags int
+		outFlags, score = zsetAdd(zobj, scores[j], c.args[scoreidx+j*2+1], flags)
+		if outFlags&ZADD_OUT_NAN != 0 {
+			c.AddReplyError("resulting score is not a number (NaN)")
+			return
+		}
+		if outFlags&ZADD_OUT_ADDED != 0 {
+			added++
+		}
+		if outFlags&ZADD_OUT_UPDATED != 0 {
+			updated++
+		}
+		if outFlags&ZADD_OUT_NOP == 0 {
+			processed++
+		}
+	}
+
+	if incr {
+		// ZADD INCR replies the new score, or nil if aborted by the flags.
+		if processed > 0 {
+			c.AddReplyDouble(score)
+		} else {
+			c.AddReplyNullBulk()
+		}
+	} else if ch {
+		c.AddReplyInt(added + updated)
+	} else {
+		c.AddReplyInt(added)
+	}
+}
+
+// zaddCommand implement ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member
+// [score member ...]
+func zaddCommand(c *RedisClient) {
+	zaddGenericCommand(c, ZADD_IN_NONE)
+}
+
+// zincrbyCommand implement ZINCRBY key increment member
+func zincrbyCommand(c *RedisClient) {
+	zaddGenericCommand(c, ZADD_IN_INCR)
+}
+
+func zcardCommand(c *RedisClient) {
+	zobj := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	c.AddReplyInt(zsetLength(zobj))
+}
+
+func zscoreCommand(c *RedisClient) {
+	zobj := lookupKeyReadOrReply(c, c.args[1], shared.nullBulk)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	if score, ok := zsetScore(zobj, c.args[2]); ok {
+		c.AddReplyDouble(score)
+	} else {
+		c.AddReplyNullBulk()
+	}
+}
+
+// zmscoreCommand implement ZMSCORE key member [member ...], a missing key is
+// handled as an empty zset.
+func zmscoreCommand(c *RedisClient) {
+	zobj := lookupKeyRead(c.db, c.args[1])
+	if zobj != nil && checkType(c, zobj, REDISZSET) {
+		return
+	}
+	c.AddReplyArrayLen(len(c.args) - 2)
+	for _, member := range c.args[2:] {
+		if zobj == nil {
+			c.AddReplyNullBulk()
+		} else if score, ok := zsetScore(zobj, member); ok {
+			c.AddReplyDouble(score)
+		} else {
+			c.AddReplyNullBulk()
+		}
+	}
+}
+
+func zrankGenericCommand(c *RedisClient, reverse bool) {
+	zobj := lookupKeyReadOrReply(c, c.args[1], shared.nullBulk)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	if rank, ok := zsetRank(zobj, c.args[2], reverse); ok {
+		c.AddReplyInt(rank)
+	} else {
+		c.AddReplyNullBulk()
+	}
+}
+
+func zrankCommand(c *RedisClient) {
+	zrankGenericCommand(c, false)
+}
+
+func zrevrankCommand(c *RedisClient) {
+	zrankGenericCommand(c, true)
+}
+
+// zremCommand implement ZREM key member [member ...]
+func zremCommand(c *RedisClient) {
+	key := c.args[1]
+	zobj := lookupKeyWriteOrReply(c, key, shared.czero)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	var deleted int64
+	for _, member := range c.args[2:] {
+		if zsetDel(zobj, member) {
+			deleted++
+		}
+		if zsetLength(zobj) == 0 {
+			dbDelete(c.db, key)
+			break
+		}
+	}
+	c.AddReplyInt(deleted)
+}
+
+// zremrangeGenericCommand implement ZREMRANGEBYRANK, ZREMRANGEBYSCORE and
+// ZREMRANGEBYLEX.
+func zremrangeGenericCommand(c *RedisClient, rangetype int) {
+	key := c.args[1]
+	var start, end int64
+	var spec *ZRangeSpec
+	var lexspec *ZLexRangeSpec
+	var ok bool
+	switch rangetype {
+	case ZRANGE_RANK:
+		if start, ok = getLongLongFromObjectOrReply(c, c.args[2], ""); !ok {
+			return
+		}
+		if end, ok = getLongLongFromObjectOrReply(c, c.args[3], ""); !ok {
+			return
+		}
+	case ZRANGE_SCORE:
+		if spec, ok = zslParseRange(c.args[2], c.args[3]); !ok {
+			c.AddReplyError("min or max is not a float")
+			return
+		}
+	case ZRANGE_LEX:
+		if lexspec, ok = zslParseLexRange(c.args[2], c.args[3]); !ok {
+			c.AddReplyError("min or max not valid string range item")
+			return
+		}
+	}
+
+	zobj := lookupKeyWriteOrReply(c, key, shared.czero)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	zs := zobj.Val_.(*zset)
+	var deleted int64
+	switch rangetype {
+	case ZRANGE_RANK:
+		llen := zsetLength(zobj)
+		if start < 0 {
+			start += llen
+		}
+		if end < 0 {
+			end += llen
+		}
+		if start < 0 {
+			start = 0
+		}
+		if start > end || start >= llen {
+			c.AddReply(shared.czero)
+			return
+		}
+		if end >= llen {
+			end = llen - 1
+		}
+		deleted = zs.zsl.ZslDeleteRangeByRank(start+1, end+1, zs.dict)
+	case ZRANGE_SCORE:
+		deleted = zs.zsl.ZslDeleteRangeByScore(spec, zs.dict)
+	case ZRANGE_LEX:
+		deleted = zs.zsl.ZslDeleteRangeByLex(lexspec, zs.dict)
+	}
+	if zsetLength(zobj) == 0 {
+		dbDelete(c.db, key)
+	}
+	c.AddReplyInt(deleted)
+}
+
+func zremrangebyrankCommand(c *RedisClient) {
+	zremrangeGenericCommand(c, ZRANGE_RANK)
+}
+
+func zremrangebyscoreCommand(c *RedisClient) {
+	zremrangeGenericCommand(c, ZRANGE_SCORE)
+}
+
+func zremrangebylexCommand(c *RedisClient) {
+	zremrangeGenericCommand(c, ZRANGE_LEX)
+}
+
+// zsetCountInRange return the number of elements between the first and the
+// last node in range.
+func zsetCountInRange(zobj *RedisObj, first, last *ZSkiplistNode) int64 {
+	if first == nil {
+		return 0
+	}
+	zsl := zobj.Val_.(*zset).zsl
+	return zsl.ZslGetRank(last.score, last.ele) - zsl.ZslGetRank(first.score, first.ele) + 1
+}
+
+// zcountCommand implement ZCOUNT key min max
+func zcountCommand(c *RedisClient) {
+	spec, ok := zslParseRange(c.args[2], c.args[3])
+	if !ok {
+		c.AddReplyError("min or max is not a float")
+		return
+	}
+	zobj := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	zsl := zobj.Val_.(*zset).zsl
+	c.AddReplyInt(zsetCountInRange(zobj, zsl.ZslFirstInRange(spec), zsl.ZslLastInRange(spec)))
+}
+
+// zlexcountCommand implement ZLEXCOUNT key min max
+func zlexcountCommand(c *RedisClient) {
+	spec, ok := zslParseLexRange(c.args[2], c.args[3])
+	if !ok {
+		c.AddReplyError("min or max not valid string range item")
+		return
+	}
+	zobj := lookupKeyReadOrReply(c, c.args[1], shared.czero)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	zsl := zobj.Val_.(*zset).zsl
+	c.AddReplyInt(zsetCountInRange(zobj, zsl.ZslFirstInLexRange(spec), zsl.ZslLastInLexRange(spec)))
+}
+
+func addZsetNodeToReply(c *RedisClient, ln *ZSkiplistNode, withscores bool) {
+	c.AddReplyBulk(ln.ele)
+	if withscores {
+		c.AddReplyDouble(ln.score)
+	}
+}
+
+// zsetNextNode return the node after ln in the direction of the range.
+func zsetNextNode(ln *ZSkiplistNode, reverse bool) *ZSkiplistNode {
+	if reverse {
+		return ln.backward
+	}
+	return ln.level[0].forward
+}
+
+// genericZrangebyrankCommand reply the elements from rank start to end.
+func genericZrangebyrankCommand(c *RedisClient, zobj *RedisObj, start, end int64, withscores, reverse bool) {
+	llen := zsetLength(zobj)
+	if start < 0 {
+		start += llen
+	}
+	if end < 0 {
+		end += llen
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > end || start >= llen {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+	if end >= llen {
+		end = llen - 1
+	}
+	rangelen := end - start + 1
+	if withscores {
+		c.AddReplyArrayLen(int(rangelen * 2))
+	} else {
+		c.AddReplyArrayLen(int(rangelen))
+	}
+
+	zsl := zobj.Val_.(*zset).zsl
+	var ln *ZSkiplistNode
+	if reverse {
+		ln = zsl.ZslGetElementByRank(llen - start)
+	} else {
+		ln = zsl.ZslGetElementByRank(start + 1)
+	}
+	for ; rangelen > 0; rangelen-- {
+		addZsetNodeToReply(c, ln, withscores)
+		ln = zsetNextNode(ln, reverse)
+	}
+}
+
+// genericZrangeInRange reply the elements from first as long as inRange
+// returns true, skipping offset elements and replying at most limit
+// elements if limit is not negative.
+func genericZrangeInRange(c *RedisClient, first *ZSkiplistNode, inRange func(ln *ZSkiplistNode) bool,
+	offset, limit int64, withscores, reverse bool) {
+	ln := first
+	for ln != nil && offset > 0 {
+		ln = zsetNextNode(ln, reverse)
+		offset--
+	}
+	if ln == nil || limit == 0 || !inRange(ln) {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+
+	node := c.AddDeferredArrayLen()
+	rangelen := 0
+	for ln != nil && limit != 0 && inRange(ln) {
+		addZsetNodeToReply(c, ln, withscores)
+		rangelen++
+		limit--
+		ln = zsetNextNode(ln, reverse)
+	}
+	if withscores {
+		rangelen *= 2
+	}
+	c.SetDeferredArrayLen(node, rangelen)
+}
+
+// zrangeCommand implement ZRANGE key start stop [BYSCORE|BYLEX] [REV]
+// [LIMIT offset count] [WITHSCORES]. With REV and BYSCORE or BYLEX, start
+// is the max and stop is the min of the range.
+func zrangeCommand(c *RedisClient) {
+	rangetype := ZRANGE_RANK
+	reverse, withscores, hasLimit := false, false, false
+	var offset int64
+	var limit int64 = -1
+	for j := 4; j < len(c.args); j++ {
+		opt := strings.ToLower(c.args[j].StrVal())
+		leftargs := len(c.args) - j - 1
+		if opt == "withscores" {
+			withscores = true
+		} else if opt == "limit" && leftargs >= 2 {
+			var ok bool
+			if offset, ok = getLongLongFromObjectOrReply(c, c.args[j+1], ""); !ok {
+				return
+			}
+			if limit, ok = getLongLongFromObjectOrReply(c, c.args[j+2], ""); !ok {
+				return
+			}
+			hasLimit = true
+			j += 2
+		} else if opt == "rev" {
+			reverse = true
+		} else if opt == "byscore" && rangetype == ZRANGE_RANK {
+			rangetype = ZRANGE_SCORE
+		} else if opt == "bylex" && rangetype == ZRANGE_RANK {
+			rangetype = ZRANGE_LEX
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+	if hasLimit && rangetype == ZRANGE_RANK {
+		c.AddReplyError("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+		return
+	}
+	if withscores && rangetype == ZRANGE_LEX {
+		c.AddReplyError("syntax error, WITHSCORES not supported in combination with BYLEX")
+		return
+	}
+
+	minArg, maxArg := c.args[2], c.args[3]
+	if reverse && rangetype != ZRANGE_RANK {
+		minArg, maxArg = maxArg, minArg
+	}
+	var start, end int64
+	var spec *ZRangeSpec
+	var lexspec *ZLexRangeSpec
+	var ok bool
+	switch rangetype {
+	case ZRANGE_RANK:
+		if start, ok = getLongLongFromObjectOrReply(c, minArg, ""); !ok {
+			return
+		}
+		if end, ok = getLongLongFromObjectOrReply(c, maxArg, ""); !ok {
+			return
+		}
+	case ZRANGE_SCORE:
+		if spec, ok = zslParseRange(minArg, maxArg); !ok {
+			c.AddReplyError("min or max is not a float")
+			return
+		}
+	case ZRANGE_LEX:
+		if lexspec, ok = zslParseLexRange(minArg, maxArg); !ok {
+			c.AddReplyError("min or max not valid string range item")
+			return
+		}
+	}
+
+	zobj := lookupKeyReadOrReply(c, c.args[1], shared.emptyArray)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	if offset < 0 {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+	zsl := zobj.Val_.(*zset).zsl
+	switch rangetype {
+	case ZRANGE_RANK:
+		genericZrangebyrankCommand(c, zobj, start, end, withscores, reverse)
+	case ZRANGE_SCORE:
+		first, inRange := zsl.ZslFirstInRange(spec), func(ln *ZSkiplistNode) bool {
+			return zslValueLteMax(ln.score, spec)
+		}
+		if reverse {
+			first, inRange = zsl.ZslLastInRange(spec), func(ln *ZSkiplistNode) bool {
+				return zslValueGteMin(ln.score, spec)
+			}
+		}
+		genericZrangeInRange(c, first, inRange, offset, limit, withscores, reverse)
+	case ZRANGE_LEX:
+		first, inRange := zsl.ZslFirstInLexRange(lexspec), func(ln *ZSkiplistNode) bool {
+			return zslLexValueLteMax(ln.ele.StrVal(), lexspec)
+		}
+		if reverse {
+			first, inRange = zsl.ZslLastInLexRange(lexspec), func(ln *ZSkiplistNode) bool {
+				return zslLexValueGteMin(ln.ele.StrVal(), lexspec)
+			}
+		}
+		genericZrangeInRange(c, first, inRange, offset, limit, false, reverse)
+	}
+}
+
+// genericZpopCommand implement ZPOPMIN and ZPOPMAX key [count], replying
+// the members along with their scores.
+func genericZpopCommand(c *RedisClient, reverse bool) {
+	if len(c.args) > 3 {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+	var count int64 = 1
+	if len(c.args) == 3 {
+		var ok bool
+		count, ok = getLongLongFromObjectOrReply(c, c.args[2], "value is out of range, must be positive")
+		if !ok {
+			return
+		}
+		if count < 0 {
+			c.AddReplyError("value is out of range, must be positive")
+			return
+		}
+	}
+	key := c.args[1]
+	zobj := lookupKeyWriteOrReply(c, key, shared.emptyArray)
+	if zobj == nil || checkType(c, zobj, REDISZSET) {
+		return
+	}
+	if count == 0 {
+		c.AddReply(shared.emptyArray)
+		return
+	}
+
+	if llen := zsetLength(zobj); count > llen {
+		count = llen
+	}
+	c.AddReplyArrayLen(int(count * 2))
+	zsl := zobj.Val_.(*zset).zsl
+	for ; count > 0; count-- {
+		ln := zsl.ZslFirst()
+		if reverse {
+			ln = zsl.ZslLast()
+		}
+		member := ln.ele
+		member.IncrRefCount()
+		addZsetNodeToReply(c, ln, true)
+		zsetDel(zobj, member)
+		member.DecrRefCount()
+	}
+	if zsetLength(zobj) == 0 {
+		dbDelete(c.db, key)
+	}
+}
+
+func zpopminCommand(c *RedisClient) {
+	genericZpopCommand(c, false)
+}
+
+func zpopmaxCommand(c *RedisClient) {
+	genericZpopCommand(c, true)
+}
+
+// zsetSourceLength return the number of elements of a zset or set source
+// of ZUNIONSTORE and ZINTERSTORE, a missing key is empty.
+func zsetSourceLength(o *RedisObj) int64 {
+	if o == nil {
+		return 0
+	}
+	if o.Type_ == REDISSET {
+		return setTypeSize(o)
+	}
+	return zsetLength(o)
+}
+
+// zsetSourceScore return the score of member in a zset or set source, the
+// members of a set have a score of 1.
+func zsetSourceScore(o *RedisObj, member *RedisObj) (float64, bool) {
+	if o.Type_ == REDISSET {
+		return 1, setTypeIsMember(o, member)
+	}
+	return zsetScore(o, member)
+}
+
+// zsetSourceForEach call fn for every element of a zset or set source.
+func zsetSourceForEach(o *RedisObj, fn func(member *RedisObj, score float64)) {
+	if o.Type_ == REDISSET {
+		for _, member := range setTypeMembers(o) {
+			fn(member, 1)
+		}
+		return
+	}
+	for ln := o.Val_.(*zset).zsl.ZslFirst(); ln != nil; ln = ln.level[0].forward {
+		fn(ln.ele, ln.score)
+	}
+}
+
+func zunionInterAggregate(target, val float64, aggregate int) float64 {
+	switch aggregate {
+	case REDIS_AGGR_SUM:
+		target += val
+		// the sum of +inf and -inf is 0.
+		if math.IsNaN(target) {
+			target = 0
+		}
+	case REDIS_AGGR_MIN:
+		if val < target {
+			target = val
+		}
+	case REDIS_AGGR_MAX:
+		if val > target {
+			target = val
+		}
+	}
+	return target
+}
+
+// zunionInterGenericCommand implement ZUNIONSTORE and ZINTERSTORE
+// destination numkeys key [key ...] [WEIGHTS weight [weight ...]]
+// [AGGREGATE SUM|MIN|MAX]. The sources can be zsets or sets.
+func zunionInterGenericCommand(c *RedisClient, op int) {
+	dstkey := c.args[1]
+	numkeys, ok := getLongLongFromObjectOrReply(c, c.args[2], "")
+	if !ok {
+		return
+	}
+	if numkeys < 1 {
+		c.AddReplyErrorFormat("at least 1 input key is needed for '%s' command", c.args[0].StrVal())
+		return
+	}
+	if numkeys > int64(len(c.args)-3) {
+		c.AddReply(shared.syntaxErr)
+		return
+	}
+
+	type source struct {
+		obj    *RedisObj
+		weight float64
+	}
+	sources := make([]source, numkeys)
+	for i := range sources {
+		obj := lookupKeyWrite(c.db, c.args[3+i])
+		if obj != nil && obj.Type_ != REDISZSET && obj.Type_ != REDISSET {
+			c.AddReply(shared.wrongTypeErr)
+			return
+		}
+		sources[i] = source{obj: obj, weight: 1}
+	}
+
+	aggregate := REDIS_AGGR_SUM
+	for j := 3 + int(numkeys); j < len(c.args); j++ {
+		opt := strings.ToLower(c.args[j].StrVal())
+		remaining := len(c.args) - j - 1
+		if opt == "weights" && remaining >= int(numkeys) {
+			for i := range sources {
+				j++
+				if sources[i].weight, ok = getLongDoubleFromObjectOrReply(c, c.args[j], "weight value is not a float"); !ok {
+					return
+				}
+			}
+		} else if opt == "aggregate" && remaining >= 1 {
+			j++
+			switch strings.ToLower(c.args[j].StrVal()) {
+			case "sum":
+				aggregate = REDIS_AGGR_SUM
+			case "min":
+				aggregate = REDIS_AGGR_MIN
+			case "max":
+				aggregate = REDIS_AGGR_MAX
+			default:
+				c.AddReply(shared.syntaxErr)
+				return
+			}
+		} else {
+			c.AddReply(shared.syntaxErr)
+			return
+		}
+	}
+
+	weighted := func(score, weight float64) float64 {
+		score *= weight
+		// 0 * inf is 0.
+		if math.IsNaN(score) {
+			score = 0
+		}
+		return score
+	}
+	dstzset := createZsetObject()
+	if op == SET_OP_INTER {
+		// iterate the smallest source and check the others.
+		sort.SliceStable(sources, func(i, j int) bool {
+			return zsetSourceLength(sources[i].obj) < zsetSourceLength(sources[j].obj)
+		})
+		if sources[0].obj != nil {
+			zsetSourceForEach(sources[0].obj, func(member *RedisObj, score float64) {
+				score = weighted(score, sources[0].weight)
+				for _, src := range sources[1:] {
+					if src.obj == nil {
+						return
+					}
+					val, ok := zsetSourceScore(src.obj, member)
+					if !ok {
+						return
+					}
+					score = zunionInterAggregate(score, weighted(val, src.weight), aggregate)
+				}
+				zsetAdd(dstzset, score, member, ZADD_IN_NONE)
+			})
+		}
+	} else {
+		scores := make(map[string]float64)
+		var members []*RedisObj
+		for _, src := range sources {
+			if src.obj == nil {
+				continue
+			}
+			zsetSourceForEach(src.obj, func(member *RedisObj, score float64) {
+				score = weighted(score, src.weight)
+				if cur, ok := scores[member.StrVal()]; ok {
+					scores[member.StrVal()] = zunionInterAggregate(cur, score, aggregate)
+				} else {
+					scores[member.StrVal()] = score
+					members = append(members, member)
+				}
+			})
+		}
+		for _, member := range members {
+			zsetAdd(dstzset, scores[member.StrVal()], member, ZADD_IN_NONE)
+		}
+	}
+
+	length := zsetLength(dstzset)
+	if length > 0 {
+		setKey(c.db, dstkey, dstzset, false)
+	} else {
+		dbDelete(c.db, dstkey)
+	}
+	dstzset.DecrRefCount()
+	c.AddReplyInt(length)
+}
+
+func zunionstoreCommand(c *RedisClient) {
+	zunionInterGenericCommand(c, SET_OP_UNION)
+}
+
+func zinterstoreCommand(c *RedisClient) {
+	zunionInterGenericCommand(c, SET_OP_INTER)
+}
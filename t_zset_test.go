@@ -0,0 +1,157 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestZaddCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, ":3\r\n", execCommand(c, "zadd", "z", "1", "a", "2", "b", "3", "c"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "zadd", "z", "5", "a", "4", "d"))
+	assert.Equal(t, ":4\r\n", execCommand(c, "zcard", "z"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zcard", "nokey"))
+	assert.Equal(t, "+zset\r\n", execCommand(c, "type", "z"))
+	assert.Equal(t, "$1\r\n5\r\n", execCommand(c, "zscore", "z", "a"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "zscore", "z", "x"))
+	assert.Equal(t, "*2\r\n$1\r\n2\r\n$-1\r\n", execCommand(c, "zmscore", "z", "b", "x"))
+	assert.Equal(t, "*1\r\n$-1\r\n", execCommand(c, "zmscore", "nokey", "b"))
+
+	assert.Equal(t, ":0\r\n", execCommand(c, "zadd", "z", "nx", "10", "a", "10", "b"))
+	assert.Equal(t, "$1\r\n5\r\n", execCommand(c, "zscore", "z", "a"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zadd", "z", "xx", "6", "a", "1", "x"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "zscore", "z", "x"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "zadd", "z", "xx", "ch", "7", "a", "2", "b"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zadd", "z", "gt", "ch", "1", "a"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "zadd", "z", "lt", "ch", "1", "a"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zadd", "nokey", "xx", "1", "a"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "nokey"))
+
+	assert.Equal(t, "$3\r\n3.5\r\n", execCommand(c, "zadd", "z", "incr", "2.5", "a"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "zadd", "z", "nx", "incr", "1", "a"))
+	assert.Equal(t, "$1\r\n1\r\n", execCommand(c, "zincrby", "z", "-2.5", "a"))
+	assert.Equal(t, "$3\r\ninf\r\n", execCommand(c, "zincrby", "z", "+inf", "a"))
+	assert.Equal(t, "-ERR resulting score is not a number (NaN)\r\n", execCommand(c, "zincrby", "z", "-inf", "a"))
+
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "zadd", "z", "1", "a", "2"))
+	assert.Equal(t, "-ERR value is not a valid float\r\n", execCommand(c, "zadd", "z", "x", "a"))
+	assert.Equal(t, "-ERR XX and NX options at the same time are not compatible\r\n", execCommand(c, "zadd", "z", "nx", "xx", "1", "a"))
+	assert.Equal(t, "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n", execCommand(c, "zadd", "z", "gt", "lt", "1", "a"))
+	assert.Equal(t, "-ERR INCR option supports a single increment-element pair\r\n", execCommand(c, "zadd", "z", "incr", "1", "a", "2", "b"))
+
+	execCommand(c, "set", "str", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "zadd", "str", "1", "a"))
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "zscore", "str", "a"))
+}
+
+func TestZrankZremCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "zadd", "z", "1", "a", "2", "b", "3", "c")
+	assert.Equal(t, ":0\r\n", execCommand(c, "zrank", "z", "a"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "zrank", "z", "c"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "zrevrank", "z", "a"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "zrank", "z", "x"))
+	assert.Equal(t, "$-1\r\n", execCommand(c, "zrank", "nokey", "a"))
+
+	assert.Equal(t, ":2\r\n", execCommand(c, "zrem", "z", "a", "b", "x"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zrank", "z", "c"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "zrem", "z", "c"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "z"))
+}
+
+func TestZrangeCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "*0\r\n", execCommand(c, "zrange", "z", "0", "-1"))
+	execCommand(c, "zadd", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	assert.Equal(t, "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n", execCommand(c, "zrange", "z", "0", "-1"))
+	assert.Equal(t, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n", execCommand(c, "zrange", "z", "1", "2", "withscores"))
+	assert.Equal(t, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n", execCommand(c, "zrange", "z", "0", "1", "rev"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "zrange", "z", "5", "10"))
+
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", execCommand(c, "zrange", "z", "(1", "3", "byscore"))
+	assert.Equal(t, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n", execCommand(c, "zrange", "z", "+inf", "(2", "byscore", "rev"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n", execCommand(c, "zrange", "z", "-inf", "+inf", "byscore", "limit", "2", "5"))
+	assert.Equal(t, "*1\r\n$1\r\nc\r\n", execCommand(c, "zrange", "z", "+inf", "-inf", "byscore", "rev", "limit", "1", "1"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "zrange", "z", "5", "10", "byscore"))
+	assert.Equal(t, "-ERR min or max is not a float\r\n", execCommand(c, "zrange", "z", "a", "1", "byscore"))
+
+	execCommand(c, "zadd", "l", "0", "a", "0", "b", "0", "c", "0", "d")
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", execCommand(c, "zrange", "l", "[b", "(d", "bylex"))
+	assert.Equal(t, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n", execCommand(c, "zrange", "l", "+", "(b", "bylex", "rev"))
+	assert.Equal(t, "*1\r\n$1\r\nb\r\n", execCommand(c, "zrange", "l", "-", "+", "bylex", "limit", "1", "1"))
+	assert.Equal(t, "-ERR min or max not valid string range item\r\n", execCommand(c, "zrange", "l", "b", "+", "bylex"))
+
+	assert.Equal(t, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n",
+		execCommand(c, "zrange", "z", "0", "1", "limit", "0", "1"))
+	assert.Equal(t, "-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n",
+		execCommand(c, "zrange", "l", "-", "+", "bylex", "withscores"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "zrange", "z", "0", "1", "byscore", "bylex"))
+}
+
+func TestZcountCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "zadd", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	assert.Equal(t, ":4\r\n", execCommand(c, "zcount", "z", "-inf", "+inf"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "zcount", "z", "(1", "(4"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zcount", "z", "5", "6"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zcount", "nokey", "0", "1"))
+	execCommand(c, "zadd", "l", "0", "a", "0", "b", "0", "c")
+	assert.Equal(t, ":3\r\n", execCommand(c, "zlexcount", "l", "-", "+"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "zlexcount", "l", "(a", "(c"))
+}
+
+func TestZremrangeCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "zadd", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	assert.Equal(t, ":2\r\n", execCommand(c, "zremrangebyrank", "z", "0", "1"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zremrangebyrank", "z", "5", "10"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "zremrangebyscore", "z", "(3", "4"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\ne\r\n", execCommand(c, "zrange", "z", "0", "-1"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "zremrangebylex", "z", "-", "+"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "z"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zremrangebyscore", "z", "0", "1"))
+}
+
+func TestZpopCmd(t *testing.T) {
+	c := testClient()
+	assert.Equal(t, "*0\r\n", execCommand(c, "zpopmin", "z"))
+	execCommand(c, "zadd", "z", "1", "a", "2", "b", "3", "c")
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\n1\r\n", execCommand(c, "zpopmin", "z"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\n3\r\n", execCommand(c, "zpopmax", "z", "1"))
+	assert.Equal(t, "*0\r\n", execCommand(c, "zpopmax", "z", "0"))
+	assert.Equal(t, "-ERR value is out of range, must be positive\r\n", execCommand(c, "zpopmax", "z", "-1"))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\n2\r\n", execCommand(c, "zpopmax", "z", "10"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "z"))
+}
+
+func TestZunionInterStoreCmd(t *testing.T) {
+	c := testClient()
+	execCommand(c, "zadd", "z1", "1", "a", "2", "b", "3", "c")
+	execCommand(c, "zadd", "z2", "4", "b", "5", "c", "6", "d")
+	execCommand(c, "sadd", "s", "c", "d")
+	assert.Equal(t, ":4\r\n", execCommand(c, "zunionstore", "dst", "2", "z1", "z2"))
+	assert.Equal(t, "*8\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n6\r\n$1\r\nd\r\n$1\r\n6\r\n$1\r\nc\r\n$1\r\n8\r\n",
+		execCommand(c, "zrange", "dst", "0", "-1", "withscores"))
+	assert.Equal(t, ":2\r\n", execCommand(c, "zinterstore", "dst", "2", "z1", "z2", "weights", "2", "1", "aggregate", "max"))
+	assert.Equal(t, "*4\r\n$1\r\nb\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n6\r\n", execCommand(c, "zrange", "dst", "0", "-1", "withscores"))
+	assert.Equal(t, ":1\r\n", execCommand(c, "zinterstore", "dst", "3", "z1", "z2", "s", "aggregate", "min"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\n1\r\n", execCommand(c, "zrange", "dst", "0", "-1", "withscores"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "zinterstore", "dst", "2", "z1", "nokey"))
+	assert.Equal(t, ":0\r\n", execCommand(c, "exists", "dst"))
+
+	assert.Equal(t, "-ERR at least 1 input key is needed for 'zunionstore' command\r\n", execCommand(c, "zunionstore", "dst", "0", "z1"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "zunionstore", "dst", "3", "z1", "z2"))
+	assert.Equal(t, "-ERR weight value is not a float\r\n", execCommand(c, "zunionstore", "dst", "1", "z1", "weights", "x"))
+	assert.Equal(t, "-ERR syntax error\r\n", execCommand(c, "zunionstore", "dst", "1", "z1", "aggregate", "avg"))
+	execCommand(c, "set", "str", "v")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", execCommand(c, "zunionstore", "dst", "2", "z1", "str"))
+}
+
+func TestZsetCopy(t *testing.T) {
+	c := testClient()
+	execCommand(c, "zadd", "z", "1", "a")
+	assert.Equal(t, ":1\r\n", execCommand(c, "copy", "z", "z2"))
+	execCommand(c, "zadd", "z2", "2", "a")
+	assert.Equal(t, "$1\r\n1\r\n", execCommand(c, "zscore", "z", "a"))
+	assert.Equal(t, "$1\r\n2\r\n", execCommand(c, "zscore", "z2", "a"))
+}
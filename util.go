@@ -0,0 +1,212 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const MAX_LONG_DOUBLE_CHARS int = 5 * 1024
+
+// string2ll convert s into an int64 strictly, the string must be the exact
+// representation of the number: no spaces, no "+" sign and no leading zeros.
+func string2ll(s string) (int64, bool) {
+	if len(s) == 0 || len(s) > 20 {
+		return 0, false
+	}
+	if s == "0" {
+		return 0, true
+	}
+	p := s
+	if p[0] == '-' {
+		p = p[1:]
+	}
+	if len(p) == 0 || p[0] < '1' || p[0] > '9' {
+		return 0, false
+	}
+	for i := 1; i < len(p); i++ {
+		if p[i] < '0' || p[i] > '9' {
+			return 0, false
+		}
+	}
+	val, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		// overflow
+		return 0, false
+	}
+	return val, true
+}
+
+// string2ld convert s into a float64, spaces around the number and NaN are
+// not accepted.
+func string2ld(s string) (float64, bool) {
+	if len(s) == 0 || len(s) > MAX_LONG_DOUBLE_CHARS {
+		return 0, false
+	}
+	val, err := strconv.ParseFloat(s, 64)
+	if err != nil && !math.IsInf(val, 0) {
+		return 0, false
+	}
+	if math.IsNaN(val) {
+		return 0, false
+	}
+	return val, true
+}
+
+// ld2string format val in the human friendly form used by INCRBYFLOAT,
+// no exponent and no trailing zeros. Redis computes with long doubles, val
+// is rounded to 15 significant digits so the rounding noise of float64,
+// like 0.1+0.2 = 0.30000000000000004, is not shown.
+func ld2string(val float64) string {
+	if math.IsInf(val, 1) {
+		return "inf"
+	} else if math.IsInf(val, -1) {
+		return "-inf"
+	}
+	// every decimal of 15 digits has a float64 that is formatted back to it.
+	val, _ = strconv.ParseFloat(strconv.FormatFloat(val, 'g', 15, 64), 64)
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+// humanDoubleString format val with 17 decimals and no trailing zeros, like
+// the human friendly replies of Redis, e.g. the GEOPOS coordinates. The
+// float64 is exact in a long double, so it prints the same digits.
+func humanDoubleString(val float64) string {
+	if math.IsInf(val, 0) {
+		return ld2string(val)
+	}
+	s := strconv.FormatFloat(val, 'f', 17, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// d2string format a double the way the sorted set scores are replied,
+// integral values are formatted without exponent.
+func d2string(val float64) string {
+	if math.IsNaN(val) {
+		return "nan"
+	} else if math.IsInf(val, 1) {
+		return "inf"
+	} else if math.IsInf(val, -1) {
+		return "-inf"
+	} else if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+		return strconv.FormatInt(int64(val), 10)
+	}
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+// stringmatch report whether str matches the glob-style pattern, supporting
+// "*", "?", "[abc]", "[^abc]", "[a-z]" and "\" to escape special chars.
+func stringmatch(pattern, str string, nocase bool) bool {
+	skipLongerMatches := false
+	return stringmatchImpl(pattern, str, nocase, &skipLongerMatches)
+}
+
+// stringmatchImpl do the matching, skipLongerMatches is set when a "*" failed
+// to match the rest of the string, so the outer "*" don't need to try longer
+// matches, which avoid exponential time on patterns like "a*a*a*a*b".
+func stringmatchImpl(pattern, str string, nocase bool, skipLongerMatches *bool) bool {
+	p, s := 0, 0
+	equal := func(a, b byte) bool {
+		if nocase {
+			return toLower(a) == toLower(b)
+		}
+		return a == b
+	}
+	for p < len(pattern) && s < len(str) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for s < len(str) {
+				if stringmatchImpl(pattern[p+1:], str[s:], nocase, skipLongerMatches) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				s++
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			s++
+		case '[':
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			match := false
+			for {
+				if p >= len(pattern) {
+					// unclosed bracket, step back so the last char is consumed.
+					p--
+					break
+				}
+				if pattern[p] == '\\' && len(pattern)-p >= 2 {
+					p++
+					if pattern[p] == str[s] {
+						match = true
+					}
+				} else if pattern[p] == ']' {
+					break
+				} else if len(pattern)-p >= 3 && pattern[p+1] == '-' {
+					start, end, ch := pattern[p], pattern[p+2], str[s]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, ch = toLower(start), toLower(end), toLower(ch)
+					}
+					p += 2
+					if ch >= start && ch <= end {
+						match = true
+					}
+				} else if equal(pattern[p], str[s]) {
+					match = true
+				}
+				p++
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s++
+		case '\\':
+			if len(pattern)-p >= 2 {
+				p++
+			}
+			if !equal(pattern[p], str[s]) {
+				return false
+			}
+			s++
+		default:
+			if !equal(pattern[p], str[s]) {
+				return false
+			}
+			s++
+		}
+		p++
+		if s == len(str) {
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			break
+		}
+	}
+	return p == len(pattern) && s == len(str)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestString2ll(t *testing.T) {
+	for str, val := range map[string]int64{
+		"0":                    0,
+		"1":                    1,
+		"-1":                   -1,
+		"9223372036854775807":  9223372036854775807,
+		"-9223372036854775808": -9223372036854775808,
+	} {
+		v, ok := string2ll(str)
+		assert.True(t, ok)
+		assert.Equal(t, val, v)
+	}
+	for _, str := range []string{"", "-", "+1", "01", "-0", " 1", "1 ", "1a", "9223372036854775808"} {
+		_, ok := string2ll(str)
+		assert.False(t, ok, str)
+	}
+}
+
+func TestStringmatch(t *testing.T) {
+	matches := [][2]string{
+		{"*", "anything"},
+		{"h?llo", "hello"},
+		{"h*llo", "heeeello"},
+		{"h*llo", "hllo"},
+		{"h[ae]llo", "hallo"},
+		{"h[^e]llo", "hallo"},
+		{"h[a-b]llo", "hbllo"},
+		{"h[b-a]llo", "hbllo"},
+		{"h\\*llo", "h*llo"},
+		{"h[\\]]llo", "h]llo"},
+		{"user:*:name", "user:1000:name"},
+		{"*a*", "bab"},
+		{"a**", "a"},
+	}
+	for _, m := range matches {
+		assert.True(t, stringmatch(m[0], m[1], false), m)
+	}
+	mismatches := [][2]string{
+		{"h?llo", "hllo"},
+		{"h[ae]llo", "hillo"},
+		{"h[^e]llo", "hello"},
+		{"h[a-b]llo", "hcllo"},
+		{"h\\*llo", "hello"},
+		{"hello", "hell"},
+		{"hell", "hello"},
+		{"[abc", "d"},
+	}
+	for _, m := range mismatches {
+		assert.False(t, stringmatch(m[0], m[1], false), m)
+	}
+	assert.True(t, stringmatch("HE[L-M]LO", "hello", true))
+	assert.False(t, stringmatch("HELLO", "hello", false))
+
+	// pathological pattern must not take exponential time.
+	assert.False(t, stringmatch(strings.Repeat("a*", 30)+"b", strings.Repeat("a", 60), false))
+}